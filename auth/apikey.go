@@ -0,0 +1,103 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// APIKey is a static API key and the access it grants
+type APIKey struct {
+	Name      string   `yaml:"name" json:"name"`
+	Key       string   `yaml:"key" json:"key"`             // Plaintext key
+	KeySHA256 string   `yaml:"keySha256" json:"keySha256"` // Hex SHA-256 of the key, used instead of Key to keep the file free of secrets
+	Scopes    []string `yaml:"scopes" json:"scopes"`
+	ConfigIDs []string `yaml:"configIds" json:"configIds"`
+}
+
+// apiKeysFile is the format of the API keys file
+type apiKeysFile struct {
+	Keys []APIKey `yaml:"keys" json:"keys"`
+}
+
+// APIKeyAuthenticator authenticates requests carrying a static API key
+type APIKeyAuthenticator struct {
+	keys   []APIKey
+	hashes [][]byte
+}
+
+// NewAPIKeyAuthenticator creates an authenticator for the given keys
+func NewAPIKeyAuthenticator(keys []APIKey) (*APIKeyAuthenticator, error) {
+	a := &APIKeyAuthenticator{}
+	for i, key := range keys {
+		if key.Name == "" {
+			return nil, fmt.Errorf("API key %d has no name", i)
+		}
+		if len(key.Scopes) == 0 {
+			return nil, fmt.Errorf("API key %s has no scopes", key.Name)
+		}
+
+		var hash []byte
+		switch {
+		case key.KeySHA256 != "":
+			decoded, err := hex.DecodeString(strings.TrimSpace(key.KeySHA256))
+			if err != nil || len(decoded) != sha256.Size {
+				return nil, fmt.Errorf("API key %s has an invalid keySha256", key.Name)
+			}
+			hash = decoded
+		case key.Key != "":
+			sum := sha256.Sum256([]byte(key.Key))
+			hash = sum[:]
+		default:
+			return nil, fmt.Errorf("API key %s has neither key nor keySha256", key.Name)
+		}
+
+		a.keys = append(a.keys, key)
+		a.hashes = append(a.hashes, hash)
+	}
+	return a, nil
+}
+
+// LoadAPIKeyFile reads API keys from a YAML or JSON file
+func LoadAPIKeyFile(path string) (*APIKeyAuthenticator, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read API keys file: %w", err)
+	}
+
+	var file apiKeysFile
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse API keys file: %w", err)
+	}
+	return NewAPIKeyAuthenticator(file.Keys)
+}
+
+// Authenticate returns the principal of the API key matching the token
+func (a *APIKeyAuthenticator) Authenticate(ctx context.Context, token string) (*Principal, error) {
+	sum := sha256.Sum256([]byte(token))
+
+	// Compare against every key so the time taken doesn't reveal which key matched
+	match := -1
+	for i, hash := range a.hashes {
+		if subtle.ConstantTimeCompare(sum[:], hash) == 1 {
+			match = i
+		}
+	}
+	if match < 0 {
+		return nil, ErrInvalidCredentials
+	}
+
+	key := a.keys[match]
+	return &Principal{
+		Subject:   "apikey:" + key.Name,
+		Scopes:    key.Scopes,
+		ConfigIDs: key.ConfigIDs,
+		Method:    "api_key",
+	}, nil
+}
@@ -0,0 +1,105 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// newSigningKey returns an ES256 key and a JWKS document holding its public key
+func newSigningKey(t *testing.T, kid string) (*ecdsa.PrivateKey, string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encode := func(b []byte) string { return base64.RawURLEncoding.EncodeToString(b) }
+	jwk := fmt.Sprintf(`{"kty":"EC","kid":%q,"use":"sig","crv":"P-256","x":%q,"y":%q}`,
+		kid, encode(key.X.FillBytes(make([]byte, 32))), encode(key.Y.FillBytes(make([]byte, 32))))
+	return key, `{"keys":[` + jwk + `]}`
+}
+
+func signToken(t *testing.T, key *ecdsa.PrivateKey, kid string, claims jwt.MapClaims) string {
+	t.Helper()
+
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, claims)
+	token.Header["kid"] = kid
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func TestJWTAuthenticator(t *testing.T) {
+	key, jwks := newSigningKey(t, "k1")
+	otherKey, _ := newSigningKey(t, "k1")
+	authenticator, err := NewJWTAuthenticator([]byte(jwks), JWTOptions{Issuer: "https://idp.example.com", Audience: "mcp-link"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	valid := func() jwt.MapClaims {
+		return jwt.MapClaims{
+			"iss":        "https://idp.example.com",
+			"aud":        "mcp-link",
+			"sub":        "alice",
+			"exp":        time.Now().Add(time.Hour).Unix(),
+			"scope":      "connect",
+			"config_ids": []string{"cfg-1"},
+		}
+	}
+
+	principal, err := authenticator.Authenticate(context.Background(), signToken(t, key, "k1", valid()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if principal.Subject != "jwt:alice" || !principal.HasScope(ScopeConnect) || principal.HasScope(ScopeAdmin) || !principal.CanUseConfig("cfg-1") || principal.CanUseConfig("cfg-2") {
+		t.Fatalf("unexpected principal %+v", principal)
+	}
+
+	rejected := map[string]string{
+		"signed by another key": signToken(t, otherKey, "k1", valid()),
+		"unknown key ID":        signToken(t, key, "k2", valid()),
+		"not a JWT":             "connect-key",
+	}
+	for name, change := range map[string]func(jwt.MapClaims){
+		"expired":             func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Minute).Unix() },
+		"without expiry":      func(c jwt.MapClaims) { delete(c, "exp") },
+		"for another API":     func(c jwt.MapClaims) { c["aud"] = "other-api" },
+		"without audience":    func(c jwt.MapClaims) { delete(c, "aud") },
+		"from another issuer": func(c jwt.MapClaims) { c["iss"] = "https://evil.example.com" },
+		"without subject":     func(c jwt.MapClaims) { delete(c, "sub") },
+	} {
+		claims := valid()
+		change(claims)
+		rejected[name] = signToken(t, key, "k1", claims)
+	}
+
+	// Tampering with the payload breaks the signature
+	token := signToken(t, key, "k1", valid())
+	tampered := signToken(t, key, "k1", jwt.MapClaims{"sub": "mallory", "exp": time.Now().Add(time.Hour).Unix(), "aud": "mcp-link", "iss": "https://idp.example.com", "scope": "admin"})
+	rejected["with a forged payload"] = token[:strings.Index(token, ".")] + tampered[strings.Index(tampered, "."):strings.LastIndex(tampered, ".")] + token[strings.LastIndex(token, "."):]
+
+	// Unsigned and HMAC tokens are not accepted
+	unsigned, _ := jwt.NewWithClaims(jwt.SigningMethodNone, valid()).SignedString(jwt.UnsafeAllowNoneSignatureType)
+	rejected["unsigned"] = unsigned
+	hmac, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, valid()).SignedString([]byte(jwks))
+	rejected["signed with HMAC"] = hmac
+
+	for name, token := range rejected {
+		if principal, err := authenticator.Authenticate(context.Background(), token); !errors.Is(err, ErrInvalidCredentials) {
+			t.Errorf("token %s: got %+v, %v", name, principal, err)
+		}
+	}
+}
@@ -0,0 +1,372 @@
+package auth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+	"gopkg.in/yaml.v3"
+)
+
+// Login authenticates the resource owner during an OAuth authorization
+// request. It returns the principal once the owner is authenticated;
+// otherwise it writes a response, such as a login form, and returns nil.
+type Login interface {
+	Login(w http.ResponseWriter, r *http.Request) *Principal
+}
+
+// UserStore verifies user credentials
+type UserStore interface {
+	Authenticate(ctx context.Context, username, password string) (*Principal, error)
+}
+
+// User is a local user allowed to authorize MCP clients
+type User struct {
+	Username     string   `yaml:"username" json:"username"`
+	PasswordHash string   `yaml:"passwordHash" json:"passwordHash"` // bcrypt hash of the password
+	Scopes       []string `yaml:"scopes" json:"scopes"`
+	ConfigIDs    []string `yaml:"configIds" json:"configIds"`
+}
+
+// StaticUserStore is a UserStore backed by a fixed list of users
+type StaticUserStore struct {
+	users map[string]User
+}
+
+// NewStaticUserStore creates a user store holding the given users
+func NewStaticUserStore(users []User) *StaticUserStore {
+	store := &StaticUserStore{users: map[string]User{}}
+	for _, user := range users {
+		store.users[user.Username] = user
+	}
+	return store
+}
+
+// LoadUserFile reads users from a YAML or JSON file with a top-level "users" list
+func LoadUserFile(path string) (*StaticUserStore, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read users file: %w", err)
+	}
+
+	var file struct {
+		Users []User `yaml:"users"`
+	}
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse users file: %w", err)
+	}
+	return NewStaticUserStore(file.Users), nil
+}
+
+var (
+	dummyHashOnce sync.Once
+	dummyHash     []byte
+)
+
+// dummyPasswordHash returns a bcrypt hash compared against for unknown users
+func dummyPasswordHash() []byte {
+	dummyHashOnce.Do(func() {
+		dummyHash, _ = bcrypt.GenerateFromPassword([]byte("unknown user"), bcrypt.DefaultCost)
+	})
+	return dummyHash
+}
+
+// Authenticate checks the password of the user
+func (s *StaticUserStore) Authenticate(ctx context.Context, username, password string) (*Principal, error) {
+	user, ok := s.users[username]
+	if !ok {
+		// Spend the same time as for a known user
+		bcrypt.CompareHashAndPassword(dummyPasswordHash(), []byte(password))
+		return nil, ErrInvalidCredentials
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)); err != nil {
+		return nil, ErrInvalidCredentials
+	}
+	return &Principal{
+		Subject:   user.Username,
+		Scopes:    user.Scopes,
+		ConfigIDs: user.ConfigIDs,
+		Method:    "password",
+	}, nil
+}
+
+// PasswordLogin is a Login showing a username/password form checked against a
+// UserStore, then a page where the signed-in user approves or denies the
+// client. Both forms carry a CSRF token bound to a cookie and to the
+// authorization request, so they cannot be submitted from another site.
+type PasswordLogin struct {
+	Users UserStore
+
+	initOnce sync.Once
+	csrfKey  []byte
+
+	mu       sync.Mutex
+	consents map[string]*pendingConsent
+}
+
+// pendingConsent is a signed-in user who has not yet approved the client
+type pendingConsent struct {
+	principal *Principal
+	request   string // Fingerprint of the authorization request
+	expiresAt time.Time
+}
+
+const (
+	// consentTTL is how long a signed-in user has to approve the client
+	consentTTL = 5 * time.Minute
+	// csrfCookieName is the cookie holding the nonce the CSRF tokens are bound to
+	csrfCookieName = "mcp_link_csrf"
+)
+
+// loginFormFields are the form fields of the login and consent pages, not
+// carried along as authorization parameters
+var loginFormFields = map[string]bool{
+	"username":   true,
+	"password":   true,
+	"csrf_token": true,
+	"consent":    true,
+	"decision":   true,
+}
+
+var loginTemplate = template.Must(template.New("login").Parse(`<!DOCTYPE html>
+<html>
+<head><title>Sign in to mcp-link</title></head>
+<body>
+<h1>Sign in to mcp-link</h1>
+<p>{{.ClientName}} is requesting access.</p>
+{{if .Error}}<p style="color:red">{{.Error}}</p>{{end}}
+<form method="post">
+{{range $name, $values := .Params}}{{range $values}}<input type="hidden" name="{{$name}}" value="{{.}}">
+{{end}}{{end}}<input type="hidden" name="csrf_token" value="{{.CSRFToken}}">
+<label>Username <input name="username" autocomplete="username"></label><br>
+<label>Password <input name="password" type="password" autocomplete="current-password"></label><br>
+<button type="submit">Sign in</button>
+</form>
+</body>
+</html>
+`))
+
+var consentTemplate = template.Must(template.New("consent").Parse(`<!DOCTYPE html>
+<html>
+<head><title>Authorize {{.ClientName}}</title></head>
+<body>
+<h1>Authorize {{.ClientName}}</h1>
+<p>{{.ClientName}} wants to use mcp-link as <strong>{{.Subject}}</strong> with the scopes <strong>{{.Scopes}}</strong>.</p>
+<p>After you decide, you will be sent to {{.RedirectHost}}.</p>
+<form method="post">
+{{range $name, $values := .Params}}{{range $values}}<input type="hidden" name="{{$name}}" value="{{.}}">
+{{end}}{{end}}<input type="hidden" name="csrf_token" value="{{.CSRFToken}}">
+<input type="hidden" name="consent" value="{{.Consent}}">
+<button type="submit" name="decision" value="approve">Approve</button>
+<button type="submit" name="decision" value="deny">Deny</button>
+</form>
+</body>
+</html>
+`))
+
+// Login shows the login form, checks the submitted credentials and asks the
+// signed-in user to approve the client
+func (l *PasswordLogin) Login(w http.ResponseWriter, r *http.Request) *Principal {
+	l.initOnce.Do(l.init)
+
+	if r.Method != http.MethodPost {
+		l.renderForm(w, r, "", http.StatusOK)
+		return nil
+	}
+	if !l.validCSRFToken(r) {
+		http.Error(w, "Invalid or missing CSRF token, reload the sign-in page", http.StatusForbidden)
+		return nil
+	}
+
+	if consent := r.PostForm.Get("consent"); consent != "" {
+		return l.decide(w, r, consent)
+	}
+	if r.PostForm.Get("username") == "" {
+		l.renderForm(w, r, "", http.StatusOK)
+		return nil
+	}
+
+	principal, err := l.Users.Authenticate(r.Context(), r.PostForm.Get("username"), r.PostForm.Get("password"))
+	if err != nil {
+		l.renderForm(w, r, "Invalid username or password", http.StatusUnauthorized)
+		return nil
+	}
+	consent, err := l.newConsent(principal, authorizationRequest(r))
+	if err != nil {
+		http.Error(w, "Failed to start authorization", http.StatusInternalServerError)
+		return nil
+	}
+	l.renderConsent(w, r, consent, principal)
+	return nil
+}
+
+// decide completes a pending consent: the principal is returned if the user
+// approved the client, and the client is told if the user denied it
+func (l *PasswordLogin) decide(w http.ResponseWriter, r *http.Request, id string) *Principal {
+	l.mu.Lock()
+	consent := l.consents[id]
+	delete(l.consents, id)
+	l.mu.Unlock()
+
+	if consent == nil || time.Now().After(consent.expiresAt) || consent.request != authorizationRequest(r) {
+		l.renderForm(w, r, "Your sign-in expired, please sign in again", http.StatusUnauthorized)
+		return nil
+	}
+	if r.PostForm.Get("decision") != "approve" {
+		redirectError(w, r, r.Form.Get("redirect_uri"), r.Form.Get("state"), "access_denied", "The user denied access")
+		return nil
+	}
+	return consent.principal
+}
+
+func (l *PasswordLogin) init() {
+	l.csrfKey = make([]byte, 32)
+	if _, err := rand.Read(l.csrfKey); err != nil {
+		panic(fmt.Sprintf("failed to generate CSRF key: %v", err))
+	}
+	l.consents = map[string]*pendingConsent{}
+}
+
+// newConsent records a signed-in user waiting to approve the client
+func (l *PasswordLogin) newConsent(principal *Principal, request string) (string, error) {
+	id, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for key, consent := range l.consents {
+		if now.After(consent.expiresAt) {
+			delete(l.consents, key)
+		}
+	}
+	l.consents[id] = &pendingConsent{principal: principal, request: request, expiresAt: now.Add(consentTTL)}
+	return id, nil
+}
+
+// authorizationRequest returns a fingerprint of the authorization request
+// parameters, which the CSRF token and a pending consent are bound to
+func authorizationRequest(r *http.Request) string {
+	var parts []string
+	for _, name := range []string{"response_type", "client_id", "redirect_uri", "scope", "state", "code_challenge", "code_challenge_method"} {
+		parts = append(parts, r.Form.Get(name))
+	}
+	return strings.Join(parts, "\x00")
+}
+
+// csrfToken returns the CSRF token of the authorization request for the
+// cookie nonce, setting the cookie if the browser does not have one yet
+func (l *PasswordLogin) csrfToken(w http.ResponseWriter, r *http.Request) string {
+	nonce := ""
+	if cookie, err := r.Cookie(csrfCookieName); err == nil {
+		nonce = cookie.Value
+	}
+	if nonce == "" {
+		var err error
+		if nonce, err = randomToken(); err != nil {
+			return ""
+		}
+		http.SetCookie(w, &http.Cookie{
+			Name:     csrfCookieName,
+			Value:    nonce,
+			Path:     AuthorizationPath,
+			HttpOnly: true,
+			Secure:   r.TLS != nil,
+			SameSite: http.SameSiteStrictMode,
+		})
+	}
+	return l.signCSRF(nonce, authorizationRequest(r))
+}
+
+// validCSRFToken reports whether the submitted CSRF token matches the cookie
+// nonce and the authorization request
+func (l *PasswordLogin) validCSRFToken(r *http.Request) bool {
+	cookie, err := r.Cookie(csrfCookieName)
+	if err != nil || cookie.Value == "" {
+		return false
+	}
+	expected := l.signCSRF(cookie.Value, authorizationRequest(r))
+	return hmac.Equal([]byte(r.PostForm.Get("csrf_token")), []byte(expected))
+}
+
+func (l *PasswordLogin) signCSRF(nonce, request string) string {
+	mac := hmac.New(sha256.New, l.csrfKey)
+	mac.Write([]byte(nonce + "\x00" + request))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// authorizationParams returns the authorization parameters to carry along in the forms
+func authorizationParams(r *http.Request) map[string][]string {
+	params := map[string][]string{}
+	for name, values := range r.Form {
+		if !loginFormFields[name] {
+			params[name] = values
+		}
+	}
+	return params
+}
+
+// clientName returns the name of the client shown to the user
+func clientName(r *http.Request) string {
+	if client, ok := r.Context().Value(clientContextKey{}).(*OAuthClient); ok && client.ClientName != "" {
+		return client.ClientName
+	}
+	return "An MCP client"
+}
+
+// writeLoginHeaders sets the headers of the login and consent pages
+func writeLoginHeaders(w http.ResponseWriter, status int) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.WriteHeader(status)
+}
+
+// renderForm writes the login form, carrying the authorization parameters along
+func (l *PasswordLogin) renderForm(w http.ResponseWriter, r *http.Request, message string, status int) {
+	token := l.csrfToken(w, r)
+	writeLoginHeaders(w, status)
+	loginTemplate.Execute(w, map[string]interface{}{
+		"ClientName": clientName(r),
+		"Error":      message,
+		"Params":     authorizationParams(r),
+		"CSRFToken":  token,
+	})
+}
+
+// renderConsent writes the page where the signed-in user approves or denies the client
+func (l *PasswordLogin) renderConsent(w http.ResponseWriter, r *http.Request, consent string, principal *Principal) {
+	scopes := r.Form.Get("scope")
+	if scopes == "" {
+		scopes = strings.Join(principal.Scopes, " ")
+	}
+	redirectHost := r.Form.Get("redirect_uri")
+	if u, err := url.Parse(redirectHost); err == nil && u.Host != "" {
+		redirectHost = u.Host
+	}
+
+	token := l.csrfToken(w, r)
+	writeLoginHeaders(w, http.StatusOK)
+	consentTemplate.Execute(w, map[string]interface{}{
+		"ClientName":   clientName(r),
+		"Subject":      principal.Subject,
+		"Scopes":       scopes,
+		"RedirectHost": redirectHost,
+		"Params":       authorizationParams(r),
+		"CSRFToken":    token,
+		"Consent":      consent,
+	})
+}
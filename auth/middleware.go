@@ -0,0 +1,130 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+// ErrInvalidCredentials is returned by an Authenticator that does not accept the token
+var ErrInvalidCredentials = errors.New("invalid credentials")
+
+// Authenticator resolves a bearer token or API key to a principal
+type Authenticator interface {
+	Authenticate(ctx context.Context, token string) (*Principal, error)
+}
+
+// Middleware rejects requests that don't carry valid credentials with the required scope
+type Middleware struct {
+	authenticators      []Authenticator
+	resourceMetadataURL string
+	logger              *slog.Logger
+	redactURL           func(string) string // Masks secrets in logged request URLs
+}
+
+// NewMiddleware creates a middleware trying each authenticator in order.
+// Without authenticators the middleware lets every request through.
+func NewMiddleware(authenticators ...Authenticator) *Middleware {
+	return &Middleware{
+		authenticators: authenticators,
+		logger:         slog.Default(),
+		redactURL:      func(string) string { return "[redacted]" },
+	}
+}
+
+// WithLogging sets the logger of rejected requests and the function masking
+// secrets in their URLs. Until it is called, request URLs are not logged.
+func (m *Middleware) WithLogging(logger *slog.Logger, redactURL func(string) string) *Middleware {
+	m.logger = logger
+	m.redactURL = redactURL
+	return m
+}
+
+// WithResourceMetadata advertises the protected resource metadata URL in the
+// WWW-Authenticate header of 401 responses, so MCP clients can discover the
+// authorization server.
+func (m *Middleware) WithResourceMetadata(url string) *Middleware {
+	m.resourceMetadataURL = url
+	return m
+}
+
+// Enabled reports whether requests are authenticated
+func (m *Middleware) Enabled() bool {
+	return len(m.authenticators) > 0
+}
+
+// Authenticate resolves the credentials of the request to a principal
+func (m *Middleware) Authenticate(r *http.Request) (*Principal, error) {
+	token := tokenFromRequest(r)
+	if token == "" {
+		return nil, errors.New("missing credentials")
+	}
+
+	err := ErrInvalidCredentials
+	for _, authenticator := range m.authenticators {
+		principal, authErr := authenticator.Authenticate(r.Context(), token)
+		if authErr == nil {
+			return principal, nil
+		}
+		if authErr != ErrInvalidCredentials {
+			// Keep the most specific reason for the log
+			err = authErr
+		}
+	}
+	return nil, err
+}
+
+// Require wraps next so that it is only reached by principals holding the scope.
+// The principal is stored in the request context, see PrincipalFromContext.
+func (m *Middleware) Require(scope string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Preflight requests carry no credentials
+		if !m.Enabled() || r.Method == http.MethodOptions {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		principal, err := m.Authenticate(r)
+		if err != nil {
+			m.logger.Warn("request rejected", "remote_addr", r.RemoteAddr, "url", m.redactURL(r.URL.String()), "error", err)
+			challenge := `Bearer realm="mcp-link"`
+			if m.resourceMetadataURL != "" {
+				challenge += fmt.Sprintf(`, resource_metadata="%s"`, m.resourceMetadataURL)
+			}
+			w.Header().Set("WWW-Authenticate", challenge)
+			writeError(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if !principal.HasScope(scope) {
+			m.logger.Warn("request lacks scope", "subject", principal.Subject, "scope", scope, "url", m.redactURL(r.URL.String()))
+			writeError(w, "Forbidden: missing scope "+scope, http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(WithPrincipal(r.Context(), principal)))
+	})
+}
+
+// tokenFromRequest extracts the bearer token or the X-API-Key header
+func tokenFromRequest(r *http.Request) string {
+	if authorization := r.Header.Get("Authorization"); authorization != "" {
+		if scheme, token, ok := strings.Cut(authorization, " "); ok && strings.EqualFold(scheme, "Bearer") {
+			return strings.TrimSpace(token)
+		}
+	}
+	return strings.TrimSpace(r.Header.Get("X-API-Key"))
+}
+
+// writeError writes an error in the format of the admin API responses
+func writeError(w http.ResponseWriter, message string, status int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error":  message,
+		"status": false,
+	})
+}
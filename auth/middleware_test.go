@@ -0,0 +1,99 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func newAPIKeyMiddleware(t *testing.T) *Middleware {
+	t.Helper()
+
+	sum := sha256.Sum256([]byte("connect-key"))
+	keys, err := NewAPIKeyAuthenticator([]APIKey{
+		{Name: "admin", Key: "admin-key", Scopes: []string{ScopeAdmin}},
+		{Name: "client", KeySHA256: hex.EncodeToString(sum[:]), Scopes: []string{ScopeConnect}, ConfigIDs: []string{"cfg-1"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewMiddleware(keys).WithResourceMetadata("https://mcp.example.com/.well-known/oauth-protected-resource")
+}
+
+// serveWith sends a request with the given headers through the middleware
+// requiring scope, and returns the response and the principal next received
+func serveWith(t *testing.T, m *Middleware, scope string, header http.Header) (*httptest.ResponseRecorder, *Principal) {
+	t.Helper()
+
+	var principal *Principal
+	handler := m.Require(scope, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal = PrincipalFromRequest(r)
+	}))
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/config", nil)
+	req.Header = header
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec, principal
+}
+
+func TestMiddlewareRejectsMissingOrInvalidKey(t *testing.T) {
+	m := newAPIKeyMiddleware(t)
+
+	for name, header := range map[string]http.Header{
+		"missing":       {},
+		"invalid":       {"X-Api-Key": {"wrong-key"}},
+		"invalid token": {"Authorization": {"Bearer wrong-key"}},
+		"other scheme":  {"Authorization": {"Basic YWRtaW4ta2V5"}},
+	} {
+		rec, principal := serveWith(t, m, ScopeConnect, header)
+		if rec.Code != http.StatusUnauthorized || principal != nil {
+			t.Errorf("%s key: got %d", name, rec.Code)
+		}
+		if challenge := rec.Header().Get("WWW-Authenticate"); !strings.Contains(challenge, `resource_metadata="https://mcp.example.com/`) {
+			t.Errorf("%s key: unexpected challenge %q", name, challenge)
+		}
+	}
+}
+
+func TestMiddlewareChecksScope(t *testing.T) {
+	m := newAPIKeyMiddleware(t)
+
+	rec, principal := serveWith(t, m, ScopeAdmin, http.Header{"X-Api-Key": {"connect-key"}})
+	if rec.Code != http.StatusForbidden || principal != nil {
+		t.Fatalf("connect key on an admin route got %d", rec.Code)
+	}
+
+	rec, principal = serveWith(t, m, ScopeConnect, http.Header{"Authorization": {"Bearer connect-key"}})
+	if rec.Code != http.StatusOK || principal == nil || principal.Subject != "apikey:client" || principal.CanUseConfig("cfg-2") {
+		t.Fatalf("connect key got %d, principal %+v", rec.Code, principal)
+	}
+
+	// The admin scope implies every other scope
+	rec, principal = serveWith(t, m, ScopeConnect, http.Header{"X-Api-Key": {"admin-key"}})
+	if rec.Code != http.StatusOK || principal == nil || !principal.AllConfigs() {
+		t.Fatalf("admin key got %d, principal %+v", rec.Code, principal)
+	}
+}
+
+func TestMiddlewareWithoutAuthenticatorsAllowsAll(t *testing.T) {
+	rec, principal := serveWith(t, NewMiddleware(), ScopeAdmin, http.Header{})
+	if rec.Code != http.StatusOK || principal != nil {
+		t.Fatalf("got %d, principal %+v", rec.Code, principal)
+	}
+}
+
+func TestAPIKeyAuthenticatorValidatesKeys(t *testing.T) {
+	for name, key := range map[string]APIKey{
+		"unnamed":     {Key: "k", Scopes: []string{ScopeConnect}},
+		"no scopes":   {Name: "a", Key: "k"},
+		"no key":      {Name: "a", Scopes: []string{ScopeConnect}},
+		"bad sha-256": {Name: "a", KeySHA256: "abc", Scopes: []string{ScopeConnect}},
+	} {
+		if _, err := NewAPIKeyAuthenticator([]APIKey{key}); err == nil {
+			t.Errorf("%s key accepted", name)
+		}
+	}
+}
@@ -0,0 +1,671 @@
+package auth
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// Endpoints served by OAuthServer
+const (
+	ProtectedResourceMetadataPath   = "/.well-known/oauth-protected-resource"
+	AuthorizationServerMetadataPath = "/.well-known/oauth-authorization-server"
+	RegistrationPath                = "/oauth/register"
+	AuthorizationPath               = "/oauth/authorize"
+	TokenPath                       = "/oauth/token"
+	JWKSPath                        = "/oauth/jwks"
+)
+
+const (
+	defaultAccessTokenTTL  = time.Hour
+	defaultRefreshTokenTTL = 30 * 24 * time.Hour
+	authorizationCodeTTL   = 10 * time.Minute
+
+	// Registration is anonymous, so the registered clients are bounded
+	maxOAuthClients = 1000
+	// unusedClientTTL is how long a client that never completed an authorization is kept
+	unusedClientTTL = time.Hour
+)
+
+// OAuthOptions configures the OAuth authorization server
+type OAuthOptions struct {
+	Issuer          string             // External base URL of mcp-link, used as issuer and resource identifier
+	Login           Login              // Authenticates the resource owner during authorization
+	SigningKey      ed25519.PrivateKey // Key signing access tokens; a generated key doesn't survive restarts
+	AccessTokenTTL  time.Duration
+	RefreshTokenTTL time.Duration
+}
+
+// OAuthClient is a client registered through dynamic client registration
+type OAuthClient struct {
+	ClientID                string   `json:"client_id"`
+	ClientIDIssuedAt        int64    `json:"client_id_issued_at"`
+	ClientName              string   `json:"client_name,omitempty"`
+	RedirectURIs            []string `json:"redirect_uris"`
+	GrantTypes              []string `json:"grant_types"`
+	ResponseTypes           []string `json:"response_types"`
+	TokenEndpointAuthMethod string   `json:"token_endpoint_auth_method"`
+	Scope                   string   `json:"scope,omitempty"`
+}
+
+// registeredClient is a registered client and when it was last used. Clients
+// that completed an authorization are kept for as long as a refresh token
+// lives without being used; others expire after unusedClientTTL.
+type registeredClient struct {
+	*OAuthClient
+	authorized bool
+	lastUsed   time.Time
+}
+
+// authorizationCode is an issued, not yet redeemed authorization code
+type authorizationCode struct {
+	clientID      string
+	redirectURI   string
+	codeChallenge string
+	scopes        []string
+	principal     *Principal
+	expiresAt     time.Time
+}
+
+// refreshGrant is the state behind an issued refresh token
+type refreshGrant struct {
+	clientID  string
+	scopes    []string
+	principal *Principal
+	expiresAt time.Time
+}
+
+type clientContextKey struct{}
+
+// OAuthServer implements the authorization server of the MCP authorization
+// specification: server metadata, dynamic client registration, and the
+// authorization code flow with PKCE. Clients, codes and refresh tokens are
+// kept in memory.
+type OAuthServer struct {
+	options  OAuthOptions
+	keyID    string
+	verifier *JWTAuthenticator
+
+	mu            sync.Mutex
+	clients       map[string]*registeredClient
+	codes         map[string]*authorizationCode
+	refreshGrants map[string]*refreshGrant
+}
+
+// NewOAuthServer creates an authorization server
+func NewOAuthServer(options OAuthOptions) (*OAuthServer, error) {
+	if options.Issuer == "" {
+		return nil, errors.New("OAuth issuer is required")
+	}
+	if options.Login == nil {
+		return nil, errors.New("OAuth login is required")
+	}
+	options.Issuer = strings.TrimSuffix(options.Issuer, "/")
+	if options.SigningKey == nil {
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate signing key: %w", err)
+		}
+		options.SigningKey = key
+	}
+	if options.AccessTokenTTL <= 0 {
+		options.AccessTokenTTL = defaultAccessTokenTTL
+	}
+	if options.RefreshTokenTTL <= 0 {
+		options.RefreshTokenTTL = defaultRefreshTokenTTL
+	}
+
+	s := &OAuthServer{
+		options:       options,
+		clients:       map[string]*registeredClient{},
+		codes:         map[string]*authorizationCode{},
+		refreshGrants: map[string]*refreshGrant{},
+	}
+
+	publicKey := options.SigningKey.Public().(ed25519.PublicKey)
+	sum := sha256.Sum256(publicKey)
+	s.keyID = base64.RawURLEncoding.EncodeToString(sum[:8])
+
+	verifier, err := NewJWTAuthenticator(s.jwks(), JWTOptions{
+		Issuer:   options.Issuer,
+		Audience: options.Issuer,
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.verifier = verifier
+
+	return s, nil
+}
+
+// LoadSigningKey reads an Ed25519 private key from a PKCS#8 PEM file
+func LoadSigningKey(path string) (ed25519.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read signing key: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("signing key is not PEM encoded")
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse signing key: %w", err)
+	}
+	edKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, errors.New("signing key is not an Ed25519 key")
+	}
+	return edKey, nil
+}
+
+// Authenticator returns an authenticator accepting the access tokens issued by the server
+func (s *OAuthServer) Authenticator() Authenticator {
+	return s.verifier
+}
+
+// ResourceMetadataURL returns the URL of the protected resource metadata
+func (s *OAuthServer) ResourceMetadataURL() string {
+	return s.options.Issuer + ProtectedResourceMetadataPath
+}
+
+// ServeHTTP serves the metadata and OAuth endpoints
+func (s *OAuthServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := r.URL.Path
+	switch {
+	case path == ProtectedResourceMetadataPath || strings.HasPrefix(path, ProtectedResourceMetadataPath+"/"):
+		s.handleProtectedResourceMetadata(w, r)
+	case path == AuthorizationServerMetadataPath || strings.HasPrefix(path, AuthorizationServerMetadataPath+"/"):
+		s.handleAuthorizationServerMetadata(w, r)
+	case path == RegistrationPath:
+		s.handleRegister(w, r)
+	case path == AuthorizationPath:
+		s.handleAuthorize(w, r)
+	case path == TokenPath:
+		s.handleToken(w, r)
+	case path == JWKSPath:
+		writeJSON(w, http.StatusOK, json.RawMessage(s.jwks()))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// handleProtectedResourceMetadata serves the RFC 9728 protected resource metadata
+func (s *OAuthServer) handleProtectedResourceMetadata(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"resource":                 s.options.Issuer,
+		"authorization_servers":    []string{s.options.Issuer},
+		"bearer_methods_supported": []string{"header"},
+		"scopes_supported":         []string{ScopeConnect, ScopeAdmin},
+	})
+}
+
+// handleAuthorizationServerMetadata serves the RFC 8414 authorization server metadata
+func (s *OAuthServer) handleAuthorizationServerMetadata(w http.ResponseWriter, r *http.Request) {
+	issuer := s.options.Issuer
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"issuer":                                issuer,
+		"authorization_endpoint":                issuer + AuthorizationPath,
+		"token_endpoint":                        issuer + TokenPath,
+		"registration_endpoint":                 issuer + RegistrationPath,
+		"jwks_uri":                              issuer + JWKSPath,
+		"response_types_supported":              []string{"code"},
+		"grant_types_supported":                 []string{"authorization_code", "refresh_token"},
+		"code_challenge_methods_supported":      []string{"S256"},
+		"token_endpoint_auth_methods_supported": []string{"none"},
+		"scopes_supported":                      []string{ScopeConnect, ScopeAdmin},
+	})
+}
+
+// handleRegister implements RFC 7591 dynamic client registration for public clients
+func (s *OAuthServer) handleRegister(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var client OAuthClient
+	if err := json.NewDecoder(r.Body).Decode(&client); err != nil {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_client_metadata", "Invalid JSON body")
+		return
+	}
+
+	if len(client.RedirectURIs) == 0 {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_redirect_uri", "At least one redirect_uri is required")
+		return
+	}
+	for _, redirectURI := range client.RedirectURIs {
+		if err := validateRedirectURI(redirectURI); err != nil {
+			writeOAuthError(w, http.StatusBadRequest, "invalid_redirect_uri", err.Error())
+			return
+		}
+	}
+	if client.TokenEndpointAuthMethod != "" && client.TokenEndpointAuthMethod != "none" {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_client_metadata", "Only public clients (token_endpoint_auth_method \"none\") are supported")
+		return
+	}
+
+	client.ClientID = uuid.New().String()
+	client.ClientIDIssuedAt = time.Now().Unix()
+	client.TokenEndpointAuthMethod = "none"
+	client.GrantTypes = []string{"authorization_code", "refresh_token"}
+	client.ResponseTypes = []string{"code"}
+
+	s.mu.Lock()
+	s.purgeExpiredLocked()
+	if len(s.clients) >= maxOAuthClients && !s.evictUnusedClientLocked() {
+		s.mu.Unlock()
+		writeOAuthError(w, http.StatusServiceUnavailable, "temporarily_unavailable", "Too many registered clients")
+		return
+	}
+	s.clients[client.ClientID] = &registeredClient{OAuthClient: &client, lastUsed: time.Now()}
+	s.mu.Unlock()
+
+	writeJSON(w, http.StatusCreated, client)
+}
+
+// evictUnusedClientLocked drops the least recently registered client that
+// never completed an authorization, to make room for a new registration. It
+// reports whether a client was dropped. The caller must hold mu.
+func (s *OAuthServer) evictUnusedClientLocked() bool {
+	var oldestID string
+	var oldest time.Time
+	for clientID, client := range s.clients {
+		if !client.authorized && (oldestID == "" || client.lastUsed.Before(oldest)) {
+			oldestID, oldest = clientID, client.lastUsed
+		}
+	}
+	if oldestID == "" {
+		return false
+	}
+	delete(s.clients, oldestID)
+	return true
+}
+
+// validateRedirectURI accepts https URLs, http URLs on loopback addresses and
+// private-use schemes of native apps, which must be reverse domain names such
+// as com.example.app (RFC 8252 section 7.1). Other schemes, e.g. javascript:
+// or data:, are rejected.
+func validateRedirectURI(redirectURI string) error {
+	u, err := url.Parse(redirectURI)
+	if err != nil || u.Scheme == "" {
+		return fmt.Errorf("invalid redirect_uri %q", redirectURI)
+	}
+	if u.Fragment != "" {
+		return fmt.Errorf("redirect_uri %q must not contain a fragment", redirectURI)
+	}
+	switch u.Scheme {
+	case "https":
+		return nil
+	case "http":
+		host := u.Hostname()
+		if host == "localhost" {
+			return nil
+		}
+		if ip := net.ParseIP(host); ip != nil && ip.IsLoopback() {
+			return nil
+		}
+		return fmt.Errorf("redirect_uri %q must use https unless it points to a loopback address", redirectURI)
+	default:
+		if !isReverseDomainScheme(u.Scheme) {
+			return fmt.Errorf("redirect_uri %q must use https, loopback http or a reverse domain name scheme such as com.example.app", redirectURI)
+		}
+		return nil
+	}
+}
+
+// isReverseDomainScheme reports whether a URI scheme is a reverse domain name
+// of at least two labels
+func isReverseDomainScheme(scheme string) bool {
+	labels := strings.Split(scheme, ".")
+	if len(labels) < 2 {
+		return false
+	}
+	for _, label := range labels {
+		if label == "" {
+			return false
+		}
+	}
+	return true
+}
+
+// handleAuthorize implements the authorization endpoint of the authorization code flow
+func (s *OAuthServer) handleAuthorize(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	// Errors about the client or redirect URI must not redirect
+	clientID := r.Form.Get("client_id")
+	s.mu.Lock()
+	registered := s.clients[clientID]
+	s.mu.Unlock()
+	if registered == nil {
+		http.Error(w, "Unknown client_id", http.StatusBadRequest)
+		return
+	}
+	client := registered.OAuthClient
+	redirectURI := r.Form.Get("redirect_uri")
+	if !contains(client.RedirectURIs, redirectURI) {
+		http.Error(w, "redirect_uri is not registered for the client", http.StatusBadRequest)
+		return
+	}
+
+	state := r.Form.Get("state")
+	if r.Form.Get("response_type") != "code" {
+		redirectError(w, r, redirectURI, state, "unsupported_response_type", "Only the code response type is supported")
+		return
+	}
+	codeChallenge := r.Form.Get("code_challenge")
+	if codeChallenge == "" || r.Form.Get("code_challenge_method") != "S256" {
+		redirectError(w, r, redirectURI, state, "invalid_request", "PKCE with code_challenge_method S256 is required")
+		return
+	}
+
+	principal := s.options.Login.Login(w, r.WithContext(context.WithValue(r.Context(), clientContextKey{}, client)))
+	if principal == nil {
+		// The login wrote its own response
+		return
+	}
+
+	scopes := grantScopes(principal, strings.Fields(r.Form.Get("scope")))
+	if len(scopes) == 0 {
+		redirectError(w, r, redirectURI, state, "invalid_scope", "None of the requested scopes are granted to the user")
+		return
+	}
+
+	code, err := randomToken()
+	if err != nil {
+		redirectError(w, r, redirectURI, state, "server_error", "Failed to issue authorization code")
+		return
+	}
+
+	s.mu.Lock()
+	s.purgeExpiredLocked()
+	registered.authorized = true
+	registered.lastUsed = time.Now()
+	s.codes[code] = &authorizationCode{
+		clientID:      clientID,
+		redirectURI:   redirectURI,
+		codeChallenge: codeChallenge,
+		scopes:        scopes,
+		principal:     principal,
+		expiresAt:     time.Now().Add(authorizationCodeTTL),
+	}
+	s.mu.Unlock()
+
+	target, _ := url.Parse(redirectURI)
+	q := target.Query()
+	q.Set("code", code)
+	if state != "" {
+		q.Set("state", state)
+	}
+	target.RawQuery = q.Encode()
+	http.Redirect(w, r, target.String(), http.StatusFound)
+}
+
+// grantScopes returns the requested scopes held by the principal, or all of
+// the principal's scopes when none were requested
+func grantScopes(principal *Principal, requested []string) []string {
+	if len(requested) == 0 {
+		return principal.Scopes
+	}
+	var granted []string
+	for _, scope := range requested {
+		if (scope == ScopeAdmin || scope == ScopeConnect) && principal.HasScope(scope) {
+			granted = append(granted, scope)
+		}
+	}
+	return granted
+}
+
+// handleToken implements the token endpoint for the authorization_code and refresh_token grants
+func (s *OAuthServer) handleToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_request", "Invalid form body")
+		return
+	}
+
+	switch r.PostForm.Get("grant_type") {
+	case "authorization_code":
+		s.exchangeCode(w, r)
+	case "refresh_token":
+		s.refresh(w, r)
+	default:
+		writeOAuthError(w, http.StatusBadRequest, "unsupported_grant_type", "Unsupported grant_type")
+	}
+}
+
+// exchangeCode redeems an authorization code after verifying the PKCE code verifier
+func (s *OAuthServer) exchangeCode(w http.ResponseWriter, r *http.Request) {
+	code := r.PostForm.Get("code")
+
+	// Codes are single use, whether or not the exchange succeeds
+	s.mu.Lock()
+	grant := s.codes[code]
+	delete(s.codes, code)
+	s.mu.Unlock()
+
+	if grant == nil || time.Now().After(grant.expiresAt) {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_grant", "Invalid or expired authorization code")
+		return
+	}
+	if grant.clientID != r.PostForm.Get("client_id") || grant.redirectURI != r.PostForm.Get("redirect_uri") {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_grant", "client_id or redirect_uri does not match the authorization request")
+		return
+	}
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if base64.RawURLEncoding.EncodeToString(sum[:]) != grant.codeChallenge {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_grant", "Invalid code_verifier")
+		return
+	}
+
+	s.issueTokens(w, grant.clientID, grant.principal, grant.scopes)
+}
+
+// refresh issues new tokens for a refresh token, rotating the refresh token
+func (s *OAuthServer) refresh(w http.ResponseWriter, r *http.Request) {
+	token := r.PostForm.Get("refresh_token")
+
+	s.mu.Lock()
+	grant := s.refreshGrants[token]
+	delete(s.refreshGrants, token)
+	s.mu.Unlock()
+
+	if grant == nil || time.Now().After(grant.expiresAt) {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_grant", "Invalid or expired refresh token")
+		return
+	}
+	if grant.clientID != r.PostForm.Get("client_id") {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_grant", "Refresh token was issued to another client")
+		return
+	}
+
+	scopes := grant.scopes
+	if requested := strings.Fields(r.PostForm.Get("scope")); len(requested) > 0 {
+		// A refresh may narrow the scopes but never widen them
+		scopes = nil
+		for _, scope := range requested {
+			if contains(grant.scopes, scope) {
+				scopes = append(scopes, scope)
+			}
+		}
+		if len(scopes) == 0 {
+			writeOAuthError(w, http.StatusBadRequest, "invalid_scope", "Requested scopes exceed the original grant")
+			return
+		}
+	}
+
+	s.issueTokens(w, grant.clientID, grant.principal, scopes)
+}
+
+// issueTokens writes a token response with a signed access token and a new refresh token
+func (s *OAuthServer) issueTokens(w http.ResponseWriter, clientID string, principal *Principal, scopes []string) {
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss":       s.options.Issuer,
+		"aud":       s.options.Issuer,
+		"sub":       principal.Subject,
+		"iat":       now.Unix(),
+		"exp":       now.Add(s.options.AccessTokenTTL).Unix(),
+		"jti":       uuid.New().String(),
+		"client_id": clientID,
+		"scope":     strings.Join(scopes, " "),
+	}
+	if len(principal.ConfigIDs) > 0 {
+		claims["config_ids"] = principal.ConfigIDs
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims)
+	token.Header["kid"] = s.keyID
+	accessToken, err := token.SignedString(s.options.SigningKey)
+	if err != nil {
+		writeOAuthError(w, http.StatusInternalServerError, "server_error", "Failed to sign access token")
+		return
+	}
+
+	refreshToken, err := randomToken()
+	if err != nil {
+		writeOAuthError(w, http.StatusInternalServerError, "server_error", "Failed to issue refresh token")
+		return
+	}
+
+	s.mu.Lock()
+	if client := s.clients[clientID]; client != nil {
+		client.lastUsed = now
+	}
+	s.purgeExpiredLocked()
+	s.refreshGrants[refreshToken] = &refreshGrant{
+		clientID:  clientID,
+		scopes:    scopes,
+		principal: principal,
+		expiresAt: now.Add(s.options.RefreshTokenTTL),
+	}
+	s.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token":  accessToken,
+		"token_type":    "Bearer",
+		"expires_in":    int(s.options.AccessTokenTTL.Seconds()),
+		"refresh_token": refreshToken,
+		"scope":         strings.Join(scopes, " "),
+	})
+}
+
+// purgeExpiredLocked drops expired codes, refresh tokens and clients. The
+// caller must hold mu.
+func (s *OAuthServer) purgeExpiredLocked() {
+	now := time.Now()
+	for clientID, client := range s.clients {
+		ttl := unusedClientTTL
+		if client.authorized {
+			ttl = s.options.RefreshTokenTTL
+		}
+		if now.Sub(client.lastUsed) > ttl {
+			delete(s.clients, clientID)
+		}
+	}
+	for code, grant := range s.codes {
+		if now.After(grant.expiresAt) {
+			delete(s.codes, code)
+		}
+	}
+	for token, grant := range s.refreshGrants {
+		if now.After(grant.expiresAt) {
+			delete(s.refreshGrants, token)
+		}
+	}
+}
+
+// jwks returns the JWKS document with the public signing key
+func (s *OAuthServer) jwks() []byte {
+	publicKey := s.options.SigningKey.Public().(ed25519.PublicKey)
+	data, _ := json.Marshal(map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "OKP",
+			"crv": "Ed25519",
+			"use": "sig",
+			"alg": "EdDSA",
+			"kid": s.keyID,
+			"x":   base64.RawURLEncoding.EncodeToString(publicKey),
+		}},
+	})
+	return data
+}
+
+// randomToken returns a random URL-safe token
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// redirectError sends an authorization error back to the client's redirect URI
+func redirectError(w http.ResponseWriter, r *http.Request, redirectURI, state, code, description string) {
+	target, err := url.Parse(redirectURI)
+	if err != nil {
+		http.Error(w, description, http.StatusBadRequest)
+		return
+	}
+	q := target.Query()
+	q.Set("error", code)
+	q.Set("error_description", description)
+	if state != "" {
+		q.Set("state", state)
+	}
+	target.RawQuery = q.Encode()
+	http.Redirect(w, r, target.String(), http.StatusFound)
+}
+
+// writeOAuthError writes an RFC 6749 error response
+func writeOAuthError(w http.ResponseWriter, status int, code, description string) {
+	writeJSON(w, status, map[string]string{
+		"error":             code,
+		"error_description": description,
+	})
+}
+
+// writeJSON writes a JSON response that must not be cached
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,494 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func newTestOAuthServer(t *testing.T) (*OAuthServer, *httptest.Server) {
+	t.Helper()
+
+	hash, err := bcrypt.GenerateFromPassword([]byte("s3cret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	users := NewStaticUserStore([]User{{
+		Username:     "alice",
+		PasswordHash: string(hash),
+		Scopes:       []string{ScopeConnect},
+		ConfigIDs:    []string{"cfg-1"},
+	}})
+
+	var oauth *OAuthServer
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		oauth.ServeHTTP(w, r)
+	}))
+	t.Cleanup(ts.Close)
+
+	oauth, err = NewOAuthServer(OAuthOptions{
+		Issuer: ts.URL,
+		Login:  &PasswordLogin{Users: users},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return oauth, ts
+}
+
+// noRedirect makes the client return redirects instead of following them
+var noRedirect = &http.Client{
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+// newBrowser returns a client keeping cookies and returning redirects, like a
+// browser going through the login form
+func newBrowser(t *testing.T) *http.Client {
+	t.Helper()
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &http.Client{Jar: jar, CheckRedirect: noRedirect.CheckRedirect}
+}
+
+var hiddenFieldPattern = regexp.MustCompile(`<input type="hidden" name="([^"]+)" value="([^"]*)">`)
+
+// readForm returns the hidden fields of the form in a login or consent page
+func readForm(t *testing.T, resp *http.Response) url.Values {
+	t.Helper()
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	form := url.Values{}
+	for _, match := range hiddenFieldPattern.FindAllStringSubmatch(string(body), -1) {
+		form.Add(match[1], html.UnescapeString(match[2]))
+	}
+	return form
+}
+
+// loginForm opens the login form of an authorization request
+func loginForm(t *testing.T, browser *http.Client, ts *httptest.Server, authorize url.Values) url.Values {
+	t.Helper()
+	resp, err := browser.Get(ts.URL + AuthorizationPath + "?" + authorize.Encode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("login form returned %d", resp.StatusCode)
+	}
+	form := readForm(t, resp)
+	if form.Get("csrf_token") == "" {
+		t.Fatal("login form has no CSRF token")
+	}
+	return form
+}
+
+// consentForm signs in as alice and returns the consent form
+func consentForm(t *testing.T, browser *http.Client, ts *httptest.Server, authorize url.Values) url.Values {
+	t.Helper()
+	form := loginForm(t, browser, ts, authorize)
+	form.Set("username", "alice")
+	form.Set("password", "s3cret")
+	resp, err := browser.PostForm(ts.URL+AuthorizationPath, form)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("login returned %d", resp.StatusCode)
+	}
+	consent := readForm(t, resp)
+	if consent.Get("consent") == "" {
+		t.Fatal("login did not ask for consent")
+	}
+	return consent
+}
+
+// authorizeCode signs in as alice, approves the client and returns the redirect
+func authorizeCode(t *testing.T, browser *http.Client, ts *httptest.Server, authorize url.Values) *url.URL {
+	t.Helper()
+	form := consentForm(t, browser, ts, authorize)
+	form.Set("decision", "approve")
+	resp, err := browser.PostForm(ts.URL+AuthorizationPath, form)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("authorization returned %d", resp.StatusCode)
+	}
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return location
+}
+
+func decodeJSON(t *testing.T, resp *http.Response, v interface{}) {
+	t.Helper()
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOAuthAuthorizationCodeFlow(t *testing.T) {
+	oauth, ts := newTestOAuthServer(t)
+
+	// Discover the authorization server
+	resp, err := http.Get(ts.URL + AuthorizationServerMetadataPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var metadata map[string]interface{}
+	decodeJSON(t, resp, &metadata)
+	if metadata["token_endpoint"] != ts.URL+TokenPath {
+		t.Fatalf("unexpected token endpoint %v", metadata["token_endpoint"])
+	}
+
+	// Register a public client
+	resp, err = http.Post(ts.URL+RegistrationPath, "application/json",
+		strings.NewReader(`{"client_name":"test","redirect_uris":["http://127.0.0.1:9999/callback"]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("registration returned %d", resp.StatusCode)
+	}
+	var client OAuthClient
+	decodeJSON(t, resp, &client)
+
+	verifier := "a-code-verifier-that-is-long-enough-for-pkce-0123456789"
+	sum := sha256.Sum256([]byte(verifier))
+	authorize := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {client.ClientID},
+		"redirect_uri":          {"http://127.0.0.1:9999/callback"},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(sum[:])},
+		"code_challenge_method": {"S256"},
+		"state":                 {"xyz"},
+		"scope":                 {"connect admin"},
+	}
+
+	browser := newBrowser(t)
+
+	// Wrong password shows the form again
+	form := loginForm(t, browser, ts, authorize)
+	form.Set("username", "alice")
+	form.Set("password", "wrong")
+	resp, err = browser.PostForm(ts.URL+AuthorizationPath, form)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("wrong password returned %d", resp.StatusCode)
+	}
+
+	// Correct password asks for consent, and approving redirects back with a code
+	location := authorizeCode(t, browser, ts, authorize)
+	if location.Query().Get("state") != "xyz" {
+		t.Fatalf("state not returned: %s", location)
+	}
+	code := location.Query().Get("code")
+
+	// A wrong verifier is rejected and burns the code
+	exchange := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"client_id":     {client.ClientID},
+		"redirect_uri":  {"http://127.0.0.1:9999/callback"},
+		"code_verifier": {"wrong"},
+	}
+	resp, err = http.PostForm(ts.URL+TokenPath, exchange)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("wrong verifier returned %d", resp.StatusCode)
+	}
+
+	// Run the flow again to get a fresh code
+	location = authorizeCode(t, browser, ts, authorize)
+	exchange.Set("code", location.Query().Get("code"))
+	exchange.Set("code_verifier", verifier)
+
+	resp, err = http.PostForm(ts.URL+TokenPath, exchange)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tokens struct {
+		AccessToken  string `json:"access_token"`
+		RefreshToken string `json:"refresh_token"`
+		Scope        string `json:"scope"`
+	}
+	decodeJSON(t, resp, &tokens)
+	if tokens.Scope != ScopeConnect {
+		t.Fatalf("expected only the connect scope to be granted, got %q", tokens.Scope)
+	}
+
+	// The access token is accepted by the server's authenticator
+	principal, err := oauth.Authenticator().Authenticate(context.Background(), tokens.AccessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if principal.Subject != "jwt:alice" || !principal.HasScope(ScopeConnect) || principal.HasScope(ScopeAdmin) {
+		t.Fatalf("unexpected principal %+v", principal)
+	}
+	if !principal.CanUseConfig("cfg-1") || principal.CanUseConfig("cfg-2") {
+		t.Fatalf("unexpected config restrictions %v", principal.ConfigIDs)
+	}
+
+	// Refresh tokens rotate
+	refresh := url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {tokens.RefreshToken},
+		"client_id":     {client.ClientID},
+	}
+	resp, err = http.PostForm(ts.URL+TokenPath, refresh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("refresh returned %d", resp.StatusCode)
+	}
+	resp, err = http.PostForm(ts.URL+TokenPath, refresh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("reused refresh token returned %d", resp.StatusCode)
+	}
+}
+
+func TestOAuthRejectsUnregisteredRedirect(t *testing.T) {
+	_, ts := newTestOAuthServer(t)
+
+	resp, err := http.Post(ts.URL+RegistrationPath, "application/json",
+		strings.NewReader(`{"redirect_uris":["http://evil.example.com/callback"]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("plain http redirect_uri was accepted with %d", resp.StatusCode)
+	}
+
+	resp, err = http.Post(ts.URL+RegistrationPath, "application/json",
+		strings.NewReader(`{"redirect_uris":["https://app.example.com/callback"]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var client OAuthClient
+	decodeJSON(t, resp, &client)
+
+	resp, err = noRedirect.Get(ts.URL + AuthorizationPath + "?" + url.Values{
+		"response_type": {"code"},
+		"client_id":     {client.ClientID},
+		"redirect_uri":  {"https://attacker.example.com/callback"},
+	}.Encode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("unregistered redirect_uri returned %d", resp.StatusCode)
+	}
+}
+
+func TestValidateRedirectURI(t *testing.T) {
+	valid := []string{
+		"https://app.example.com/callback",
+		"http://127.0.0.1:9999/callback",
+		"http://[::1]/callback",
+		"http://localhost:8080/callback",
+		"com.example.app:/oauth2redirect",
+	}
+	for _, uri := range valid {
+		if err := validateRedirectURI(uri); err != nil {
+			t.Errorf("%s rejected: %v", uri, err)
+		}
+	}
+
+	invalid := []string{
+		"http://evil.example.com/callback",
+		"https://app.example.com/callback#fragment",
+		"javascript:alert(document.cookie)",
+		"data:text/html,<script>alert(1)</script>",
+		"file:///etc/passwd",
+		"myapp://callback",
+		"com..example:/callback",
+		"/relative/callback",
+	}
+	for _, uri := range invalid {
+		if err := validateRedirectURI(uri); err == nil {
+			t.Errorf("%s accepted", uri)
+		}
+	}
+}
+
+func TestOAuthLoginRequiresCSRFTokenAndConsent(t *testing.T) {
+	_, ts := newTestOAuthServer(t)
+
+	resp, err := http.Post(ts.URL+RegistrationPath, "application/json",
+		strings.NewReader(`{"redirect_uris":["http://127.0.0.1:9999/callback"]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var client OAuthClient
+	decodeJSON(t, resp, &client)
+
+	sum := sha256.Sum256([]byte("a-code-verifier-that-is-long-enough-for-pkce-0123456789"))
+	authorize := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {client.ClientID},
+		"redirect_uri":          {"http://127.0.0.1:9999/callback"},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(sum[:])},
+		"code_challenge_method": {"S256"},
+		"state":                 {"xyz"},
+	}
+	browser := newBrowser(t)
+
+	// Credentials posted without the token of the form are rejected
+	form := url.Values{"username": {"alice"}, "password": {"s3cret"}}
+	for k, v := range authorize {
+		form[k] = v
+	}
+	resp, err = browser.PostForm(ts.URL+AuthorizationPath, form)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("login without CSRF token returned %d", resp.StatusCode)
+	}
+
+	// The token does not carry over to another browser or authorization request
+	form = loginForm(t, browser, ts, authorize)
+	form.Set("username", "alice")
+	form.Set("password", "s3cret")
+	for name, post := range map[string]func(url.Values) (*http.Response, error){
+		"another browser": func(form url.Values) (*http.Response, error) {
+			return newBrowser(t).PostForm(ts.URL+AuthorizationPath, form)
+		},
+		"another request": func(form url.Values) (*http.Response, error) {
+			changed := url.Values{}
+			for k, v := range form {
+				changed[k] = v
+			}
+			changed.Set("state", "other")
+			return browser.PostForm(ts.URL+AuthorizationPath, changed)
+		},
+	} {
+		resp, err = post(form)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusForbidden {
+			t.Fatalf("CSRF token from %s returned %d", name, resp.StatusCode)
+		}
+	}
+
+	// Signing in does not issue a code until the user approves
+	consent := consentForm(t, browser, ts, authorize)
+	consent.Set("decision", "deny")
+	resp, err = browser.PostForm(ts.URL+AuthorizationPath, consent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusFound || location.Query().Get("error") != "access_denied" || location.Query().Get("code") != "" {
+		t.Fatalf("denied consent returned %d to %s", resp.StatusCode, location)
+	}
+
+	// A consent is single use
+	consent.Set("decision", "approve")
+	resp, err = browser.PostForm(ts.URL+AuthorizationPath, consent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("reused consent returned %d", resp.StatusCode)
+	}
+}
+
+func TestOAuthRegistrationIsBounded(t *testing.T) {
+	oauth, ts := newTestOAuthServer(t)
+
+	register := func() *http.Response {
+		t.Helper()
+		resp, err := http.Post(ts.URL+RegistrationPath, "application/json",
+			strings.NewReader(`{"redirect_uris":["http://127.0.0.1:9999/callback"]}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+
+	// Unused clients expire
+	oauth.mu.Lock()
+	oauth.clients["stale"] = &registeredClient{OAuthClient: &OAuthClient{ClientID: "stale"}, lastUsed: time.Now().Add(-2 * unusedClientTTL)}
+	oauth.mu.Unlock()
+	if resp := register(); resp.StatusCode != http.StatusCreated {
+		t.Fatalf("registration returned %d", resp.StatusCode)
+	}
+	oauth.mu.Lock()
+	_, stale := oauth.clients["stale"]
+	oauth.mu.Unlock()
+	if stale {
+		t.Fatal("unused client did not expire")
+	}
+
+	// A full registry makes room by dropping unused clients, but never authorized ones
+	oauth.mu.Lock()
+	for i := len(oauth.clients); i < maxOAuthClients; i++ {
+		id := fmt.Sprintf("client-%d", i)
+		oauth.clients[id] = &registeredClient{OAuthClient: &OAuthClient{ClientID: id}, authorized: true, lastUsed: time.Now()}
+	}
+	oauth.mu.Unlock()
+	if resp := register(); resp.StatusCode != http.StatusCreated {
+		t.Fatalf("registration with unused clients returned %d", resp.StatusCode)
+	}
+	oauth.mu.Lock()
+	for _, client := range oauth.clients {
+		client.authorized = true
+	}
+	oauth.mu.Unlock()
+	if resp := register(); resp.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("registration beyond the limit returned %d", resp.StatusCode)
+	}
+	oauth.mu.Lock()
+	count := len(oauth.clients)
+	oauth.mu.Unlock()
+	if count != maxOAuthClients {
+		t.Fatalf("expected %d clients, got %d", maxOAuthClients, count)
+	}
+}
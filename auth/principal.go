@@ -0,0 +1,76 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+)
+
+const (
+	// ScopeAdmin allows managing configurations through the admin API. It implies ScopeConnect.
+	ScopeAdmin = "admin"
+	// ScopeConnect allows opening MCP sessions on /sse and posting to /message
+	ScopeConnect = "connect"
+)
+
+// Principal is the authenticated caller of a request
+type Principal struct {
+	Subject   string   `json:"subject"`
+	Scopes    []string `json:"scopes"`
+	ConfigIDs []string `json:"configIds,omitempty"` // Configurations the principal may connect to, empty means all
+	Method    string   `json:"method"`              // How the principal was authenticated, e.g. "api_key" or "jwt"
+}
+
+// HasScope reports whether the principal was granted the scope
+func (p *Principal) HasScope(scope string) bool {
+	for _, s := range p.Scopes {
+		if s == scope || s == ScopeAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+// CanUseConfig reports whether the principal may connect with the configuration
+func (p *Principal) CanUseConfig(configID string) bool {
+	if p.AllConfigs() {
+		return true
+	}
+	for _, id := range p.ConfigIDs {
+		if id == configID {
+			return true
+		}
+	}
+	return false
+}
+
+// AllConfigs reports whether the principal is not restricted to specific
+// configurations. Only such principals may open ad-hoc sessions from URL parameters.
+func (p *Principal) AllConfigs() bool {
+	if len(p.ConfigIDs) == 0 {
+		return true
+	}
+	for _, id := range p.ConfigIDs {
+		if id == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+type principalContextKey struct{}
+
+// WithPrincipal returns a copy of ctx carrying the principal
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalContextKey{}, p)
+}
+
+// PrincipalFromContext returns the principal of the request, or nil if the request is not authenticated
+func PrincipalFromContext(ctx context.Context) *Principal {
+	p, _ := ctx.Value(principalContextKey{}).(*Principal)
+	return p
+}
+
+// PrincipalFromRequest returns the principal of the request, or nil if the request is not authenticated
+func PrincipalFromRequest(r *http.Request) *Principal {
+	return PrincipalFromContext(r.Context())
+}
@@ -2,9 +2,12 @@ package controllers
 
 import (
 	"encoding/json"
+	"io"
 	"net/http"
+	"strconv"
 	"strings"
 
+	"github.com/anyisalin/mcp-openapi-to-mcp-adapter/models"
 	"github.com/anyisalin/mcp-openapi-to-mcp-adapter/services"
 )
 
@@ -28,6 +31,7 @@ type APIServerConfigResponse struct {
 	Description string `json:"description,omitempty"`
 	SchemaURL   string `json:"schemaUrl,omitempty"`
 	BaseURL     string `json:"baseUrl,omitempty"`
+	Version     int64  `json:"version,omitempty"`
 	Message     string `json:"message,omitempty"`
 	Error       string `json:"error,omitempty"`
 	Status      bool   `json:"status"`
@@ -63,7 +67,7 @@ func (c *APIServerConfigController) CreateAPIServerConfig(w http.ResponseWriter,
 	}
 
 	// 返回成功响应
-	c.writeSuccessResponse(w, "API server configuration created successfully", config.ID.Hex(), config.Name, config.Description, config.SchemaURL, config.BaseURL)
+	c.writeConfigResponse(w, "API server configuration created successfully", config)
 }
 
 // GetAPIServerConfig 获取 API 服务器配置
@@ -110,11 +114,13 @@ func (c *APIServerConfigController) GetAPIServerConfig(w http.ResponseWriter, r
 	}
 
 	// 返回配置
+	setETag(w, config.Version)
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(config)
 }
 
-// UpdateAPIServerConfig 处理更新现有的 API 服务器配置
+// UpdateAPIServerConfig 处理替换现有的 API 服务器配置。
+// 带 If-Match 请求头时，仅当配置仍为该版本时才更新
 func (c *APIServerConfigController) UpdateAPIServerConfig(w http.ResponseWriter, r *http.Request) {
 	// 只接受 PUT 请求
 	if r.Method != http.MethodPut {
@@ -130,6 +136,12 @@ func (c *APIServerConfigController) UpdateAPIServerConfig(w http.ResponseWriter,
 	}
 	id := pathParts[len(pathParts)-1]
 
+	version, err := parseIfMatch(r)
+	if err != nil {
+		c.writeErrorResponse(w, err.Error(), http.StatusPreconditionFailed)
+		return
+	}
+
 	// 解析请求体
 	var req CreateAPIServerConfigRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -138,14 +150,55 @@ func (c *APIServerConfigController) UpdateAPIServerConfig(w http.ResponseWriter,
 	}
 
 	// 更新数据库中的配置
-	config, err := c.service.UpdateAPIServerConfig(r.Context(), id, req.Name, req.Description, req.SchemaURL, req.BaseURL)
+	config, err := c.service.UpdateAPIServerConfig(r.Context(), id, version, req.Name, req.Description, req.SchemaURL, req.BaseURL)
 	if err != nil {
-		c.writeErrorResponse(w, "Failed to update API server configuration: "+err.Error(), http.StatusInternalServerError)
+		c.writeErrorResponse(w, "Failed to update API server configuration: "+err.Error(), updateErrorStatus(err))
 		return
 	}
 
 	// 返回成功响应
-	c.writeSuccessResponse(w, "API server configuration updated successfully", config.ID.Hex(), config.Name, config.Description, config.SchemaURL, config.BaseURL)
+	c.writeConfigResponse(w, "API server configuration updated successfully", config)
+}
+
+// PatchAPIServerConfig 处理以 JSON Merge Patch (RFC 7396) 更新 API 服务器配置。
+// 带 If-Match 请求头时，仅当配置仍为该版本时才更新
+func (c *APIServerConfigController) PatchAPIServerConfig(w http.ResponseWriter, r *http.Request) {
+	// 只接受 PATCH 请求
+	if r.Method != http.MethodPatch {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id := strings.TrimPrefix(r.URL.Path, apiServerConfigPathPrefix)
+	if id == "" || strings.Contains(id, "/") {
+		c.writeErrorResponse(w, "Invalid request path", http.StatusBadRequest)
+		return
+	}
+	if !isMergePatch(r) {
+		c.writeErrorResponse(w, "Content-Type must be "+mergePatchContentType, http.StatusUnsupportedMediaType)
+		return
+	}
+	version, err := parseIfMatch(r)
+	if err != nil {
+		c.writeErrorResponse(w, err.Error(), http.StatusPreconditionFailed)
+		return
+	}
+
+	// 读取补丁
+	patch, err := io.ReadAll(r.Body)
+	if err != nil {
+		c.writeErrorResponse(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	config, err := c.service.PatchAPIServerConfig(r.Context(), id, version, patch)
+	if err != nil {
+		c.writeErrorResponse(w, "Failed to update API server configuration: "+err.Error(), updateErrorStatus(err))
+		return
+	}
+
+	// 返回成功响应
+	c.writeConfigResponse(w, "API server configuration updated successfully", config)
 }
 
 // DeleteAPIServerConfig 处理删除 API 服务器配置
@@ -199,4 +252,96 @@ func (c *APIServerConfigController) writeSuccessResponse(w http.ResponseWriter,
 		Status:      true,
 	}
 	json.NewEncoder(w).Encode(response)
-} 
\ No newline at end of file
+}
+
+// writeConfigResponse 向客户端写入配置及其版本
+func (c *APIServerConfigController) writeConfigResponse(w http.ResponseWriter, message string, config *models.APIServerConfig) {
+	setETag(w, config.Version)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(APIServerConfigResponse{
+		ID:          config.ID.Hex(),
+		Name:        config.Name,
+		Description: config.Description,
+		SchemaURL:   config.SchemaURL,
+		BaseURL:     config.BaseURL,
+		Version:     config.Version,
+		Message:     message,
+		Status:      true,
+	})
+}
+
+// apiServerConfigPathPrefix 是 API 服务器配置路径的前缀
+const apiServerConfigPathPrefix = "/api/v1/api-server/config/"
+
+// ListAPIServerConfigRevisions 分页返回配置的修订历史，最新的在前
+func (c *APIServerConfigController) ListAPIServerConfigRevisions(w http.ResponseWriter, r *http.Request) {
+	// 只接受 GET 请求
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id, _, err := parseRevisionPath(r.URL.Path, apiServerConfigPathPrefix)
+	if err != nil {
+		writeRevisionError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	page, pageSize, err := parsePageParams(r)
+	if err != nil {
+		writeRevisionError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	revisions, total, err := c.service.GetAPIServerConfigRevisions(r.Context(), id, page, pageSize)
+	if err != nil {
+		writeRevisionError(w, "Failed to get API server configuration revisions: "+err.Error(), revisionErrorStatus(err))
+		return
+	}
+	writeRevisionList(w, revisions, total, page, pageSize)
+}
+
+// GetAPIServerConfigRevision 返回配置的指定修订
+func (c *APIServerConfigController) GetAPIServerConfigRevision(w http.ResponseWriter, r *http.Request) {
+	// 只接受 GET 请求
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id, number, err := parseRevisionPath(r.URL.Path, apiServerConfigPathPrefix)
+	if err != nil || number == 0 {
+		writeRevisionError(w, "Invalid request path", http.StatusBadRequest)
+		return
+	}
+
+	revision, err := c.service.GetAPIServerConfigRevision(r.Context(), id, number)
+	if err != nil {
+		writeRevisionError(w, "Failed to get API server configuration revision: "+err.Error(), revisionErrorStatus(err))
+		return
+	}
+	writeRevision(w, revision)
+}
+
+// RollbackAPIServerConfig 将配置回滚到指定修订
+func (c *APIServerConfigController) RollbackAPIServerConfig(w http.ResponseWriter, r *http.Request) {
+	// 只接受 POST 请求
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id, number, err := parseRevisionPath(r.URL.Path, apiServerConfigPathPrefix)
+	if err != nil || number == 0 {
+		c.writeErrorResponse(w, "Invalid request path", http.StatusBadRequest)
+		return
+	}
+
+	config, err := c.service.RollbackAPIServerConfig(r.Context(), id, number)
+	if err != nil {
+		c.writeErrorResponse(w, "Failed to roll back API server configuration: "+err.Error(), revisionErrorStatus(err))
+		return
+	}
+
+	// 返回成功响应
+	c.writeConfigResponse(w, "API server configuration rolled back to revision "+strconv.Itoa(number), config)
+}
@@ -0,0 +1,117 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/anyisalin/mcp-openapi-to-mcp-adapter/auth"
+	"github.com/anyisalin/mcp-openapi-to-mcp-adapter/utils"
+)
+
+// ApprovalController handles HTTP requests for approving held tool calls
+type ApprovalController struct {
+	sseServer *utils.SSEServer
+}
+
+// ApprovalListResponse represents the response structure for listing pending approvals
+type ApprovalListResponse struct {
+	Approvals []utils.PendingApproval `json:"approvals"`
+	Total     int                     `json:"total"`
+	Status    bool                    `json:"status"`
+}
+
+// ResolveApprovalRequest represents the request structure for approving or denying a call
+type ResolveApprovalRequest struct {
+	Approved bool   `json:"approved"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+// ApprovalResponse represents the response structure for approval operations
+type ApprovalResponse struct {
+	ID      string `json:"id,omitempty"`
+	Message string `json:"message,omitempty"`
+	Error   string `json:"error,omitempty"`
+	Status  bool   `json:"status"`
+}
+
+// NewApprovalController creates a new approval controller
+func NewApprovalController(sseServer *utils.SSEServer) *ApprovalController {
+	return &ApprovalController{
+		sseServer: sseServer,
+	}
+}
+
+// ListApprovals returns the tool calls waiting for approval
+func (c *ApprovalController) ListApprovals(w http.ResponseWriter, r *http.Request) {
+	// Only accept GET requests
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	approvals, err := c.sseServer.PendingApprovals(r.Context())
+	if err != nil {
+		c.writeResponse(w, http.StatusInternalServerError, ApprovalResponse{Error: "Failed to list approvals: " + err.Error()})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ApprovalListResponse{
+		Approvals: approvals,
+		Total:     len(approvals),
+		Status:    true,
+	})
+}
+
+// ResolveApproval approves or denies a held tool call
+func (c *ApprovalController) ResolveApproval(w http.ResponseWriter, r *http.Request) {
+	// Only accept POST requests
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Extract ID from URL path
+	id := strings.TrimPrefix(r.URL.Path, "/api/v1/approvals/")
+	if id == "" || strings.Contains(id, "/") {
+		c.writeResponse(w, http.StatusBadRequest, ApprovalResponse{Error: "Invalid request path"})
+		return
+	}
+
+	// Parse request body
+	var req ResolveApprovalRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		c.writeResponse(w, http.StatusBadRequest, ApprovalResponse{Error: "Invalid request body"})
+		return
+	}
+
+	// Record who decided; without authentication the decision is the admin API's
+	by := "admin"
+	if principal := auth.PrincipalFromRequest(r); principal != nil {
+		by = principal.Subject
+	}
+
+	if err := c.sseServer.ResolveApproval(r.Context(), id, req.Approved, by, req.Reason); err != nil {
+		if errors.Is(err, utils.ErrApprovalNotFound) {
+			c.writeResponse(w, http.StatusNotFound, ApprovalResponse{Error: "Approval not found or already resolved"})
+			return
+		}
+		c.writeResponse(w, http.StatusInternalServerError, ApprovalResponse{Error: "Failed to resolve approval: " + err.Error()})
+		return
+	}
+
+	message := "Call denied"
+	if req.Approved {
+		message = "Call approved"
+	}
+	c.writeResponse(w, http.StatusOK, ApprovalResponse{ID: id, Message: message, Status: true})
+}
+
+// writeResponse writes a JSON response to the client
+func (c *ApprovalController) writeResponse(w http.ResponseWriter, status int, response ApprovalResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,121 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/anyisalin/mcp-openapi-to-mcp-adapter/models"
+	"github.com/anyisalin/mcp-openapi-to-mcp-adapter/repositories"
+	"github.com/anyisalin/mcp-openapi-to-mcp-adapter/services"
+)
+
+const (
+	defaultAuditPageSize = 50
+	maxAuditPageSize     = 500
+)
+
+// AuditController handles HTTP requests for querying the audit log
+type AuditController struct {
+	service *services.AuditService
+}
+
+// AuditListResponse represents the response structure for querying the audit log
+type AuditListResponse struct {
+	Records  []*models.AuditRecord `json:"records"`
+	Total    int64                 `json:"total"`
+	Page     int                   `json:"page"`
+	PageSize int                   `json:"pageSize"`
+	Error    string                `json:"error,omitempty"`
+	Status   bool                  `json:"status"`
+}
+
+// NewAuditController creates a new audit controller
+func NewAuditController(service *services.AuditService) *AuditController {
+	return &AuditController{
+		service: service,
+	}
+}
+
+// ListAuditRecords returns audit records, newest first. Records can be
+// filtered by sessionId, configId, subject, tool, status and a from/to time
+// range (RFC 3339), and are paginated with page and pageSize.
+func (c *AuditController) ListAuditRecords(w http.ResponseWriter, r *http.Request) {
+	// Only accept GET requests
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	filter := repositories.AuditFilter{
+		SessionID: query.Get("sessionId"),
+		ConfigID:  query.Get("configId"),
+		Subject:   query.Get("subject"),
+		Tool:      query.Get("tool"),
+		Status:    query.Get("status"),
+	}
+
+	var err error
+	if filter.From, err = parseTimeParam(query.Get("from")); err != nil {
+		c.writeErrorResponse(w, "Invalid from parameter: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if filter.To, err = parseTimeParam(query.Get("to")); err != nil {
+		c.writeErrorResponse(w, "Invalid to parameter: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	page, err := parseIntParam(query.Get("page"), 1)
+	if err != nil || page < 1 {
+		c.writeErrorResponse(w, "Invalid page parameter", http.StatusBadRequest)
+		return
+	}
+	pageSize, err := parseIntParam(query.Get("pageSize"), defaultAuditPageSize)
+	if err != nil || pageSize < 1 || pageSize > maxAuditPageSize {
+		c.writeErrorResponse(w, "Invalid pageSize parameter: must be between 1 and "+strconv.Itoa(maxAuditPageSize), http.StatusBadRequest)
+		return
+	}
+
+	records, total, err := c.service.Query(r.Context(), filter, page, pageSize)
+	if err != nil {
+		c.writeErrorResponse(w, "Failed to query audit log: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(AuditListResponse{
+		Records:  records,
+		Total:    total,
+		Page:     page,
+		PageSize: pageSize,
+		Status:   true,
+	})
+}
+
+// writeErrorResponse writes an error response to the client
+func (c *AuditController) writeErrorResponse(w http.ResponseWriter, message string, status int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(AuditListResponse{
+		Error:  message,
+		Status: false,
+	})
+}
+
+// parseTimeParam parses an optional RFC 3339 query parameter
+func parseTimeParam(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// parseIntParam parses an optional integer query parameter
+func parseIntParam(value string, defaultValue int) (int, error) {
+	if value == "" {
+		return defaultValue, nil
+	}
+	return strconv.Atoi(value)
+}
@@ -0,0 +1,103 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/anyisalin/mcp-openapi-to-mcp-adapter/models"
+	"github.com/anyisalin/mcp-openapi-to-mcp-adapter/services"
+)
+
+const (
+	defaultRevisionPageSize = 20
+	maxRevisionPageSize     = 200
+)
+
+// RevisionListResponse represents the response structure for listing the revisions of a configuration
+type RevisionListResponse struct {
+	Revisions []*models.ConfigRevision `json:"revisions"`
+	Total     int64                    `json:"total"`
+	Page      int                      `json:"page"`
+	PageSize  int                      `json:"pageSize"`
+	Error     string                   `json:"error,omitempty"`
+	Status    bool                     `json:"status"`
+}
+
+// parseRevisionPath extracts the configuration ID and, if present, the
+// revision number from a path like {prefix}{id}/revisions[/{revision}[/rollback]]
+func parseRevisionPath(path, prefix string) (id string, revision int, err error) {
+	parts := strings.Split(strings.TrimPrefix(path, prefix), "/")
+	if len(parts) < 2 || parts[0] == "" || parts[1] != "revisions" {
+		return "", 0, errors.New("invalid request path")
+	}
+	if len(parts) > 2 {
+		if revision, err = strconv.Atoi(parts[2]); err != nil || revision < 1 {
+			return "", 0, errors.New("invalid revision number")
+		}
+	}
+	return parts[0], revision, nil
+}
+
+// parsePageParams parses the page and pageSize query parameters of a revision or spec listing
+func parsePageParams(r *http.Request) (page, pageSize int, err error) {
+	query := r.URL.Query()
+	page, err = parseIntParam(query.Get("page"), 1)
+	if err != nil || page < 1 {
+		return 0, 0, errors.New("invalid page parameter")
+	}
+	pageSize, err = parseIntParam(query.Get("pageSize"), defaultRevisionPageSize)
+	if err != nil || pageSize < 1 || pageSize > maxRevisionPageSize {
+		return 0, 0, errors.New("invalid pageSize parameter: must be between 1 and " + strconv.Itoa(maxRevisionPageSize))
+	}
+	return page, pageSize, nil
+}
+
+// revisionErrorStatus returns the HTTP status of an error reading or rolling back revisions
+func revisionErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrRevisionNotFound), errors.Is(err, services.ErrConfigNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrRevisionsDisabled):
+		return http.StatusNotImplemented
+	case errors.Is(err, services.ErrInvalidConfig):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrVersionConflict):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// writeRevisionList writes a page of revisions with their secrets masked
+func writeRevisionList(w http.ResponseWriter, revisions []*models.ConfigRevision, total int64, page, pageSize int) {
+	for i, revision := range revisions {
+		revisions[i] = revision.Redacted()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(RevisionListResponse{
+		Revisions: revisions,
+		Total:     total,
+		Page:      page,
+		PageSize:  pageSize,
+		Status:    true,
+	})
+}
+
+// writeRevisionError writes an error response to a revision request
+func writeRevisionError(w http.ResponseWriter, message string, status int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(RevisionListResponse{
+		Error:  message,
+		Status: false,
+	})
+}
+
+// writeRevision writes a revision with its secrets masked
+func writeRevision(w http.ResponseWriter, revision *models.ConfigRevision) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(revision.Redacted())
+}
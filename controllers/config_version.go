@@ -0,0 +1,62 @@
+package controllers
+
+import (
+	"errors"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/anyisalin/mcp-openapi-to-mcp-adapter/services"
+)
+
+// mergePatchContentType is the media type of JSON Merge Patch (RFC 7396) bodies
+const mergePatchContentType = "application/merge-patch+json"
+
+// errInvalidIfMatch is returned for an If-Match header that is not a configuration version
+var errInvalidIfMatch = errors.New("invalid If-Match header: expected a quoted configuration version")
+
+// parseIfMatch returns the configuration version an update requires, taken
+// from the If-Match header. Without the header, or with "*", any version
+// is accepted.
+func parseIfMatch(r *http.Request) (int64, error) {
+	value := strings.TrimSpace(r.Header.Get("If-Match"))
+	if value == "" || value == "*" {
+		return services.AnyVersion, nil
+	}
+
+	value = strings.TrimPrefix(value, "W/")
+	if len(value) < 2 || value[0] != '"' || value[len(value)-1] != '"' {
+		return 0, errInvalidIfMatch
+	}
+	version, err := strconv.ParseInt(value[1:len(value)-1], 10, 64)
+	if err != nil || version < 0 {
+		return 0, errInvalidIfMatch
+	}
+	return version, nil
+}
+
+// setETag sets the ETag header to the version of a configuration
+func setETag(w http.ResponseWriter, version int64) {
+	w.Header().Set("ETag", `"`+strconv.FormatInt(version, 10)+`"`)
+}
+
+// isMergePatch reports whether a PATCH request body is a JSON Merge Patch
+func isMergePatch(r *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return err == nil && (mediaType == mergePatchContentType || mediaType == "application/json")
+}
+
+// updateErrorStatus returns the HTTP status of an error creating or updating a configuration
+func updateErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrVersionConflict):
+		return http.StatusPreconditionFailed
+	case errors.Is(err, services.ErrConfigNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrInvalidPatch), errors.Is(err, services.ErrInvalidConfig):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
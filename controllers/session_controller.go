@@ -0,0 +1,45 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/anyisalin/mcp-openapi-to-mcp-adapter/utils"
+)
+
+// SessionController handles HTTP requests for inspecting active SSE sessions
+type SessionController struct {
+	sseServer *utils.SSEServer
+}
+
+// SessionListResponse represents the response structure for listing sessions
+type SessionListResponse struct {
+	Sessions []utils.SessionStats `json:"sessions"`
+	Total    int                  `json:"total"`
+	Status   bool                 `json:"status"`
+}
+
+// NewSessionController creates a new session controller
+func NewSessionController(sseServer *utils.SSEServer) *SessionController {
+	return &SessionController{
+		sseServer: sseServer,
+	}
+}
+
+// ListSessions returns the sessions held by this replica, including their event queue depth
+func (c *SessionController) ListSessions(w http.ResponseWriter, r *http.Request) {
+	// Only accept GET requests
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	sessions := c.sseServer.Sessions()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(SessionListResponse{
+		Sessions: sessions,
+		Total:    len(sessions),
+		Status:   true,
+	})
+}
@@ -0,0 +1,180 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/anyisalin/mcp-openapi-to-mcp-adapter/models"
+	"github.com/anyisalin/mcp-openapi-to-mcp-adapter/services"
+)
+
+// specPathPrefix is the path prefix of specific specs
+const specPathPrefix = "/api/v1/specs/"
+
+// SpecController handles HTTP requests for uploaded OpenAPI specifications
+type SpecController struct {
+	service *services.SpecService
+}
+
+// SpecResponse represents the response structure for spec operations
+type SpecResponse struct {
+	Spec    *models.Spec `json:"spec,omitempty"`
+	Message string       `json:"message,omitempty"`
+	Error   string       `json:"error,omitempty"`
+	Status  bool         `json:"status"`
+}
+
+// SpecListResponse represents the response structure for listing specs
+type SpecListResponse struct {
+	Specs    []*models.Spec `json:"specs"`
+	Total    int64          `json:"total"`
+	Page     int            `json:"page"`
+	PageSize int            `json:"pageSize"`
+	Error    string         `json:"error,omitempty"`
+	Status   bool           `json:"status"`
+}
+
+// NewSpecController creates a new spec controller
+func NewSpecController(service *services.SpecService) *SpecController {
+	return &SpecController{
+		service: service,
+	}
+}
+
+// UploadSpec stores the OpenAPI specification in the request body, in JSON
+// or YAML and optionally gzip-compressed, named by the name query parameter
+func (c *SpecController) UploadSpec(w http.ResponseWriter, r *http.Request) {
+	// Only accept POST requests
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, services.MaxSpecSize))
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			c.writeErrorResponse(w, "Spec is too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		c.writeErrorResponse(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	spec, err := c.service.Upload(r.Context(), r.URL.Query().Get("name"), data)
+	if errors.Is(err, services.ErrInvalidSpec) {
+		c.writeErrorResponse(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		c.writeErrorResponse(w, "Failed to store spec: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(SpecResponse{
+		Spec:    spec,
+		Message: "Spec stored successfully",
+		Status:  true,
+	})
+}
+
+// ListSpecs returns a page of the uploaded specs, newest first
+func (c *SpecController) ListSpecs(w http.ResponseWriter, r *http.Request) {
+	// Only accept GET requests
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	page, pageSize, err := parsePageParams(r)
+	if err != nil {
+		c.writeErrorResponse(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	specs, total, err := c.service.List(r.Context(), page, pageSize)
+	if err != nil {
+		c.writeErrorResponse(w, "Failed to list specs: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(SpecListResponse{
+		Specs:    specs,
+		Total:    total,
+		Page:     page,
+		PageSize: pageSize,
+		Status:   true,
+	})
+}
+
+// GetSpec returns the metadata of an uploaded spec
+func (c *SpecController) GetSpec(w http.ResponseWriter, r *http.Request) {
+	// Only accept GET requests
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id := strings.TrimPrefix(r.URL.Path, specPathPrefix)
+	spec, err := c.service.Get(r.Context(), id)
+	if err != nil {
+		c.writeErrorResponse(w, "Failed to get spec: "+err.Error(), specErrorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(spec)
+}
+
+// GetSpecContent returns the content of an uploaded spec, as uploaded
+func (c *SpecController) GetSpecContent(w http.ResponseWriter, r *http.Request) {
+	// Only accept GET requests
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, specPathPrefix), "/content")
+	spec, err := c.service.Get(r.Context(), id)
+	if err != nil {
+		c.writeErrorResponse(w, "Failed to get spec: "+err.Error(), specErrorStatus(err))
+		return
+	}
+	content, err := c.service.SpecContent(r.Context(), id)
+	if err != nil {
+		c.writeErrorResponse(w, "Failed to get spec content: "+err.Error(), specErrorStatus(err))
+		return
+	}
+
+	contentType := "application/yaml"
+	if spec.Format == "json" {
+		contentType = "application/json"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("ETag", `"`+spec.Hash+`"`)
+	w.Write(content)
+}
+
+// specErrorStatus returns the HTTP status of an error reading a spec
+func specErrorStatus(err error) int {
+	if errors.Is(err, services.ErrSpecNotFound) {
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
+
+// writeErrorResponse writes an error response to the client
+func (c *SpecController) writeErrorResponse(w http.ResponseWriter, message string, status int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(SpecResponse{
+		Error:  message,
+		Status: false,
+	})
+}
@@ -1,12 +1,16 @@
 package controllers
 
 import (
-	"context"
-	"encoding/base64"
 	"encoding/json"
+	"io"
+	"log/slog"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/anyisalin/mcp-openapi-to-mcp-adapter/models"
+	"github.com/anyisalin/mcp-openapi-to-mcp-adapter/repositories"
 	"github.com/anyisalin/mcp-openapi-to-mcp-adapter/services"
 	"github.com/anyisalin/mcp-openapi-to-mcp-adapter/utils"
 )
@@ -25,19 +29,38 @@ type CreateConfigRequest struct {
 	BaseURL     string            `json:"baseURL"`
 	Headers     map[string]string `json:"headers"`
 	Filters     []string          `json:"filters"`
+
+	UpstreamAuth   *models.UpstreamAuth           `json:"upstreamAuth,omitempty"`
+	ForwardHeaders []string                       `json:"forwardHeaders,omitempty"`
+	Approval       *models.ApprovalPolicy         `json:"approval,omitempty"`
+	ToolOverrides  map[string]models.ToolOverride `json:"toolOverrides,omitempty"`
 }
 
 // ConfigResponse represents the response structure for configuration operations
 type ConfigResponse struct {
-	ID      string `json:"id,omitempty"`
-	SSEUrl  string `json:"sseUrl,omitempty"`
-	Message string `json:"message,omitempty"`
-	Error   string `json:"error,omitempty"`
-	Status  bool   `json:"status"`
+	ID      string             `json:"id,omitempty"`
+	SSEUrl  string             `json:"sseUrl,omitempty"`
+	Version int64              `json:"version,omitempty"`
+	Preview *utils.ToolPreview `json:"preview,omitempty"` // Tools of a created or updated configuration
+	Message string             `json:"message,omitempty"`
+	Error   string             `json:"error,omitempty"`
+	Status  bool               `json:"status"`
 }
 
-// schemaBytesContextKey is used to store schema bytes in the request context
-type schemaBytesContextKey struct{}
+// ConfigListResponse represents the response structure for listing configurations
+type ConfigListResponse struct {
+	Configs  []*models.SSEConfig `json:"configs"`
+	Total    int64               `json:"total"`
+	Page     int                 `json:"page"`
+	PageSize int                 `json:"pageSize"`
+	Error    string              `json:"error,omitempty"`
+	Status   bool                `json:"status"`
+}
+
+const (
+	defaultConfigPageSize = 20
+	maxConfigPageSize     = 200
+)
 
 // NewSSEConfigController creates a new SSE configuration controller
 func NewSSEConfigController(service *services.SSEConfigService, sseServer *utils.SSEServer, baseURL string) *SSEConfigController {
@@ -48,7 +71,8 @@ func NewSSEConfigController(service *services.SSEConfigService, sseServer *utils
 	}
 }
 
-// CreateConfig handles the creation of a new SSE configuration
+// CreateConfig handles the creation of a new SSE configuration. The schema
+// is loaded and checked first, and the response previews the tools.
 func (c *SSEConfigController) CreateConfig(w http.ResponseWriter, r *http.Request) {
 	// Only accept POST requests
 	if r.Method != http.MethodPost {
@@ -64,17 +88,23 @@ func (c *SSEConfigController) CreateConfig(w http.ResponseWriter, r *http.Reques
 	}
 
 	// Create configuration in database
-	id, err := c.service.Create(r.Context(), req.ApiConfigId, req.SchemaURL, req.BaseURL, req.Headers, req.Filters)
+	id, preview, err := c.service.Create(r.Context(), req.ApiConfigId, req.SchemaURL, req.BaseURL, req.Headers, req.Filters, req.UpstreamAuth, req.ForwardHeaders, req.Approval, req.ToolOverrides)
 	if err != nil {
-		c.writeErrorResponse(w, "Failed to create configuration: "+err.Error(), http.StatusInternalServerError)
+		c.writeErrorResponse(w, "Failed to create configuration: "+err.Error(), updateErrorStatus(err))
 		return
 	}
 
-	// Build SSE URL with the configuration ID
-	sseURL := c.buildSSEURL(id)
-
-	// Return success response with the SSE URL
-	c.writeSuccessResponse(w, "Configuration created successfully", id, sseURL)
+	// Return success response with the SSE URL and the tools
+	setETag(w, 1)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ConfigResponse{
+		ID:      id,
+		SSEUrl:  c.buildSSEURL(id),
+		Version: 1,
+		Preview: preview,
+		Message: "Configuration created successfully",
+		Status:  true,
+	})
 }
 
 // GetConfig retrieves an SSE configuration
@@ -101,12 +131,91 @@ func (c *SSEConfigController) GetConfig(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	// Return the configuration
+	if config == nil {
+		c.writeErrorResponse(w, "Configuration not found", http.StatusNotFound)
+		return
+	}
+
+	// Return the configuration with its secrets masked
+	setETag(w, config.Version)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(config.Redacted())
+}
+
+// ListConfigs returns a page of configurations with their secrets masked.
+// Configurations can be filtered by apiServerConfigId, baseURLHost, a search
+// text q and createdFrom/createdTo/updatedFrom/updatedTo time ranges (RFC
+// 3339), sorted with sort (createdAt, updatedAt, baseURL or schemaURL, with
+// a - prefix for descending order; newest first by default), and paginated
+// with page and pageSize.
+func (c *SSEConfigController) ListConfigs(w http.ResponseWriter, r *http.Request) {
+	// Only accept GET requests
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	filter := repositories.SSEConfigFilter{
+		APIServerConfigID: query.Get("apiServerConfigId"),
+		BaseURLHost:       query.Get("baseURLHost"),
+		Search:            query.Get("q"),
+	}
+	for param, value := range map[string]*time.Time{
+		"createdFrom": &filter.CreatedFrom,
+		"createdTo":   &filter.CreatedTo,
+		"updatedFrom": &filter.UpdatedFrom,
+		"updatedTo":   &filter.UpdatedTo,
+	} {
+		var err error
+		if *value, err = parseTimeParam(query.Get(param)); err != nil {
+			c.writeListErrorResponse(w, "Invalid "+param+" parameter: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	sort := repositories.SSEConfigSort{Field: "createdAt", Descending: true}
+	if value := query.Get("sort"); value != "" {
+		sort.Field, sort.Descending = strings.TrimPrefix(value, "-"), strings.HasPrefix(value, "-")
+	}
+	if _, ok := repositories.SSEConfigSortFields[sort.Field]; !ok {
+		c.writeListErrorResponse(w, "Invalid sort parameter: must be createdAt, updatedAt, baseURL or schemaURL", http.StatusBadRequest)
+		return
+	}
+
+	page, err := parseIntParam(query.Get("page"), 1)
+	if err != nil || page < 1 {
+		c.writeListErrorResponse(w, "Invalid page parameter", http.StatusBadRequest)
+		return
+	}
+	pageSize, err := parseIntParam(query.Get("pageSize"), defaultConfigPageSize)
+	if err != nil || pageSize < 1 || pageSize > maxConfigPageSize {
+		c.writeListErrorResponse(w, "Invalid pageSize parameter: must be between 1 and "+strconv.Itoa(maxConfigPageSize), http.StatusBadRequest)
+		return
+	}
+
+	configs, total, err := c.service.List(r.Context(), filter, sort, page, pageSize)
+	if err != nil {
+		c.writeListErrorResponse(w, "Failed to list configurations: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	for i, config := range configs {
+		configs[i] = config.Redacted()
+	}
+
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(config)
+	json.NewEncoder(w).Encode(ConfigListResponse{
+		Configs:  configs,
+		Total:    total,
+		Page:     page,
+		PageSize: pageSize,
+		Status:   true,
+	})
 }
 
-// UpdateConfig handles updating an existing SSE configuration
+// UpdateConfig handles replacing an existing SSE configuration. With an
+// If-Match header the configuration is only updated if it still has the
+// given version.
 func (c *SSEConfigController) UpdateConfig(w http.ResponseWriter, r *http.Request) {
 	// Only accept PUT requests
 	if r.Method != http.MethodPut {
@@ -122,6 +231,12 @@ func (c *SSEConfigController) UpdateConfig(w http.ResponseWriter, r *http.Reques
 	}
 	id := pathParts[len(pathParts)-1]
 
+	version, err := parseIfMatch(r)
+	if err != nil {
+		c.writeErrorResponse(w, err.Error(), http.StatusPreconditionFailed)
+		return
+	}
+
 	// Parse request body
 	var req CreateConfigRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -130,116 +245,205 @@ func (c *SSEConfigController) UpdateConfig(w http.ResponseWriter, r *http.Reques
 	}
 
 	// Update configuration in database
-	err := c.service.Update(r.Context(), id, req.SchemaURL, req.BaseURL, req.Headers, req.Filters)
+	config, preview, err := c.service.Update(r.Context(), id, version, req.SchemaURL, req.BaseURL, req.Headers, req.Filters, req.UpstreamAuth, req.ForwardHeaders, req.Approval, req.ToolOverrides)
 	if err != nil {
-		c.writeErrorResponse(w, "Failed to update configuration: "+err.Error(), http.StatusInternalServerError)
+		c.writeErrorResponse(w, "Failed to update configuration: "+err.Error(), updateErrorStatus(err))
 		return
 	}
 
-	// Build SSE URL with the configuration ID
-	sseURL := c.buildSSEURL(id)
-
-	// Return success response
-	c.writeSuccessResponse(w, "Configuration updated successfully", id, sseURL)
+	c.writeUpdatedResponse(r, w, config, preview)
 }
 
-// DeleteConfig handles deleting an SSE configuration
-func (c *SSEConfigController) DeleteConfig(w http.ResponseWriter, r *http.Request) {
-	// Only accept DELETE requests
-	if r.Method != http.MethodDelete {
+// PatchConfig handles updating an existing SSE configuration with a JSON
+// Merge Patch (RFC 7396). With an If-Match header the configuration is only
+// updated if it still has the given version.
+func (c *SSEConfigController) PatchConfig(w http.ResponseWriter, r *http.Request) {
+	// Only accept PATCH requests
+	if r.Method != http.MethodPatch {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	// Extract ID from URL path
-	pathParts := strings.Split(r.URL.Path, "/")
-	if len(pathParts) < 3 {
+	id := strings.TrimPrefix(r.URL.Path, sseConfigPathPrefix)
+	if id == "" || strings.Contains(id, "/") {
 		c.writeErrorResponse(w, "Invalid request path", http.StatusBadRequest)
 		return
 	}
-	id := pathParts[len(pathParts)-1]
+	if !isMergePatch(r) {
+		c.writeErrorResponse(w, "Content-Type must be "+mergePatchContentType, http.StatusUnsupportedMediaType)
+		return
+	}
+	version, err := parseIfMatch(r)
+	if err != nil {
+		c.writeErrorResponse(w, err.Error(), http.StatusPreconditionFailed)
+		return
+	}
 
-	// Delete configuration from database
-	err := c.service.Delete(r.Context(), id)
+	patch, err := io.ReadAll(r.Body)
 	if err != nil {
-		c.writeErrorResponse(w, "Failed to delete configuration: "+err.Error(), http.StatusInternalServerError)
+		c.writeErrorResponse(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 
-	// Return success response
-	c.writeSuccessResponse(w, "Configuration deleted successfully", id, "")
+	config, preview, err := c.service.Patch(r.Context(), id, version, patch)
+	if err != nil {
+		c.writeErrorResponse(w, "Failed to update configuration: "+err.Error(), updateErrorStatus(err))
+		return
+	}
+
+	c.writeUpdatedResponse(r, w, config, preview)
 }
 
-// SSEHandler handles SSE connection requests with configuration ID
-func (c *SSEConfigController) SSEHandler(w http.ResponseWriter, r *http.Request) {
+// writeUpdatedResponse rebuilds the sessions following an updated
+// configuration and returns its new version and tools
+func (c *SSEConfigController) writeUpdatedResponse(r *http.Request, w http.ResponseWriter, config *models.SSEConfig, preview *utils.ToolPreview) {
+	id := config.ID.Hex()
+
+	// Rebuild the MCP servers of sessions connected with this configuration
+	if err := c.sseServer.ReloadConfig(r.Context(), id); err != nil {
+		slog.Error("failed to reload sessions", utils.LogKeyConfigID, id, "error", err)
+	}
+
+	setETag(w, config.Version)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ConfigResponse{
+		ID:      id,
+		SSEUrl:  c.buildSSEURL(id),
+		Version: config.Version,
+		Preview: preview,
+		Message: "Configuration updated successfully",
+		Status:  true,
+	})
+}
+
+// sseConfigPathPrefix is the path prefix of specific configurations
+const sseConfigPathPrefix = "/api/v1/config/"
+
+// ListConfigRevisions returns a page of the revisions of a configuration, newest first
+func (c *SSEConfigController) ListConfigRevisions(w http.ResponseWriter, r *http.Request) {
 	// Only accept GET requests
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	// Extract configID from query parameters
-	configID := r.URL.Query().Get("configId")
-	if configID == "" {
-		http.Error(w, "Missing configId parameter", http.StatusBadRequest)
+	id, _, err := parseRevisionPath(r.URL.Path, sseConfigPathPrefix)
+	if err != nil {
+		writeRevisionError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	page, pageSize, err := parsePageParams(r)
+	if err != nil {
+		writeRevisionError(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	// Get configuration from database
-	config, err := c.service.GetByID(r.Context(), configID)
+	revisions, total, err := c.service.Revisions(r.Context(), id, page, pageSize)
 	if err != nil {
-		http.Error(w, "Failed to get configuration: "+err.Error(), http.StatusInternalServerError)
+		writeRevisionError(w, "Failed to get configuration revisions: "+err.Error(), revisionErrorStatus(err))
+		return
+	}
+	writeRevisionList(w, revisions, total, page, pageSize)
+}
+
+// GetConfigRevision returns a revision of a configuration with its secrets masked
+func (c *SSEConfigController) GetConfigRevision(w http.ResponseWriter, r *http.Request) {
+	// Only accept GET requests
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id, number, err := parseRevisionPath(r.URL.Path, sseConfigPathPrefix)
+	if err != nil || number == 0 {
+		writeRevisionError(w, "Invalid request path", http.StatusBadRequest)
 		return
 	}
 
-	// Get schema content
-	schemaBytes, err := c.service.GetSchemaBytes(config.SchemaURL)
+	revision, err := c.service.Revision(r.Context(), id, number)
 	if err != nil {
-		http.Error(w, "Failed to get schema content: "+err.Error(), http.StatusInternalServerError)
+		writeRevisionError(w, "Failed to get configuration revision: "+err.Error(), revisionErrorStatus(err))
 		return
 	}
+	writeRevision(w, revision)
+}
 
-	// Create a new context with the schema bytes
-	ctx := context.WithValue(r.Context(), schemaBytesContextKey{}, schemaBytes)
-	r = r.WithContext(ctx)
+// RollbackConfig restores a revision of a configuration and rebuilds the
+// sessions following the configuration
+func (c *SSEConfigController) RollbackConfig(w http.ResponseWriter, r *http.Request) {
+	// Only accept POST requests
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
 
-	// Set parameters directly in the request's URL query instead of using 'code' parameter
-	q := r.URL.Query()
-	q.Set("u", config.BaseURL)
+	id, number, err := parseRevisionPath(r.URL.Path, sseConfigPathPrefix)
+	if err != nil || number == 0 {
+		c.writeErrorResponse(w, "Invalid request path", http.StatusBadRequest)
+		return
+	}
 
-	// Convert headers to JSON
-	headersJSON, err := json.Marshal(config.Headers)
-	if err == nil {
-		q.Set("h", string(headersJSON))
+	if err := c.service.Rollback(r.Context(), id, number); err != nil {
+		c.writeErrorResponse(w, "Failed to roll back configuration: "+err.Error(), revisionErrorStatus(err))
+		return
 	}
 
-	// Add filters if any
-	for _, filter := range config.Filters {
-		q.Add("f", filter)
+	// Rebuild the MCP servers of sessions connected with this configuration
+	if err := c.sseServer.ReloadConfig(r.Context(), id); err != nil {
+		slog.Error("failed to reload sessions", utils.LogKeyConfigID, id, "error", err)
 	}
 
-	// Create an encoded parameters object to match what the SSE server expects
-	paramsObj := map[string]interface{}{
-		"s": config.SchemaURL,
-		"u": config.BaseURL,
-		"h": config.Headers,
+	c.writeSuccessResponse(w, "Configuration rolled back to revision "+strconv.Itoa(number), id, c.buildSSEURL(id))
+}
+
+// DeleteConfig handles deleting an SSE configuration
+func (c *SSEConfigController) DeleteConfig(w http.ResponseWriter, r *http.Request) {
+	// Only accept DELETE requests
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
 	}
 
-	if len(config.Filters) > 0 {
-		paramsObj["f"] = strings.Join(config.Filters, ";")
+	// Extract ID from URL path
+	pathParts := strings.Split(r.URL.Path, "/")
+	if len(pathParts) < 3 {
+		c.writeErrorResponse(w, "Invalid request path", http.StatusBadRequest)
+		return
 	}
+	id := pathParts[len(pathParts)-1]
 
-	// Encode the params as JSON and then base64
-	paramsJSON, _ := json.Marshal(paramsObj)
-	encodedParams := base64.StdEncoding.EncodeToString(paramsJSON)
+	// Delete configuration from database
+	err := c.service.Delete(r.Context(), id)
+	if err != nil {
+		c.writeErrorResponse(w, "Failed to delete configuration: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
 
-	// Add the encoded params as 'code' param
-	q.Set("code", encodedParams)
+	// Close the sessions connected with the deleted configuration
+	c.sseServer.CloseConfig(id)
 
-	// Set the modified query
-	r.URL.RawQuery = q.Encode()
+	// Return success response
+	c.writeSuccessResponse(w, "Configuration deleted successfully", id, "")
+}
 
-	// Handle the SSE connection with the original SSE server handler
+// SSEHandler handles SSE connection requests with configuration ID
+func (c *SSEConfigController) SSEHandler(w http.ResponseWriter, r *http.Request) {
+	// Only accept GET requests
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Extract configID from query parameters
+	configID := r.URL.Query().Get("configId")
+	if configID == "" {
+		http.Error(w, "Missing configId parameter", http.StatusBadRequest)
+		return
+	}
+
+	// Handle the SSE connection with the original SSE server handler. It loads the
+	// configuration, including its headers, by ID: headers are never placed in the
+	// request URL, where they would end up in access logs.
 	c.sseServer.ServeHTTP(w, r)
 }
 
@@ -270,3 +474,13 @@ func (c *SSEConfigController) writeSuccessResponse(w http.ResponseWriter, messag
 	}
 	json.NewEncoder(w).Encode(response)
 }
+
+// writeListErrorResponse writes an error response to a listing request
+func (c *SSEConfigController) writeListErrorResponse(w http.ResponseWriter, message string, status int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(ConfigListResponse{
+		Error:  message,
+		Status: false,
+	})
+}
@@ -0,0 +1,167 @@
+package controllers
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/anyisalin/mcp-openapi-to-mcp-adapter/utils"
+)
+
+// ToolController handles HTTP requests for inspecting the tools of configurations
+type ToolController struct {
+	sseServer *utils.SSEServer
+}
+
+// ToolCatalogResponse represents the response structure for listing the tools of a configuration
+type ToolCatalogResponse struct {
+	ConfigID string              `json:"configId,omitempty"`
+	Revision int                 `json:"revision,omitempty"`
+	Tools    []utils.CatalogTool `json:"tools"`
+	Total    int                 `json:"total"`
+	Error    string              `json:"error,omitempty"`
+	Status   bool                `json:"status"`
+}
+
+// NewToolController creates a new tool controller
+func NewToolController(sseServer *utils.SSEServer) *ToolController {
+	return &ToolController{
+		sseServer: sseServer,
+	}
+}
+
+// ToolInvocationResponse represents the response structure for invoking a tool
+type ToolInvocationResponse struct {
+	*utils.ToolInvocation
+	Error  string `json:"error,omitempty"`
+	Status bool   `json:"status"`
+}
+
+// ListConfigTools returns the tools MCP clients see for a configuration, or
+// for the revision given by the revision query parameter
+func (c *ToolController) ListConfigTools(w http.ResponseWriter, r *http.Request) {
+	// Only accept GET requests
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, sseConfigPathPrefix), "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] != "tools" {
+		c.writeErrorResponse(w, "Invalid request path", http.StatusBadRequest)
+		return
+	}
+	revision := 0
+	if value := r.URL.Query().Get("revision"); value != "" {
+		var err error
+		if revision, err = strconv.Atoi(value); err != nil || revision < 1 {
+			c.writeErrorResponse(w, "Invalid revision parameter", http.StatusBadRequest)
+			return
+		}
+	}
+
+	c.writeCatalog(w, r, parts[0], revision)
+}
+
+// ListTools returns the tools MCP clients see for the ad-hoc s, u, h and f
+// (or code) query parameters of an SSE connection
+func (c *ToolController) ListTools(w http.ResponseWriter, r *http.Request) {
+	// Only accept GET requests
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	if query.Get("s") == "" && query.Get("code") == "" {
+		c.writeErrorResponse(w, "Missing schema: set the s or code parameter", http.StatusBadRequest)
+		return
+	}
+
+	c.writeCatalog(w, r, "", 0)
+}
+
+// InvokeTool calls a tool of a configuration with the tools/call arguments
+// in the request body, and returns the upstream request and response along
+// with the tool result. With the dryRun query parameter the upstream request
+// is only built.
+func (c *ToolController) InvokeTool(w http.ResponseWriter, r *http.Request) {
+	// Only accept POST requests
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, sseConfigPathPrefix), "/")
+	if len(parts) != 4 || parts[0] == "" || parts[1] != "tools" || parts[2] == "" || parts[3] != "invoke" {
+		c.writeInvocationError(w, "Invalid request path", http.StatusBadRequest)
+		return
+	}
+	dryRun := false
+	if value := r.URL.Query().Get("dryRun"); value != "" {
+		var err error
+		if dryRun, err = strconv.ParseBool(value); err != nil {
+			c.writeInvocationError(w, "Invalid dryRun parameter", http.StatusBadRequest)
+			return
+		}
+	}
+
+	// The body holds the arguments of tools/call; an empty body means no arguments
+	var arguments map[string]interface{}
+	if err := json.NewDecoder(r.Body).Decode(&arguments); err != nil && err != io.EOF {
+		c.writeInvocationError(w, "Invalid request body: expected a JSON object of tool arguments", http.StatusBadRequest)
+		return
+	}
+
+	invocation, status, err := c.sseServer.InvokeTool(r, parts[0], parts[2], arguments, dryRun)
+	if err != nil {
+		c.writeInvocationError(w, "Failed to invoke tool: "+err.Error(), status)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ToolInvocationResponse{
+		ToolInvocation: invocation,
+		Status:         true,
+	})
+}
+
+// writeCatalog writes the tool catalog of a configuration or of ad-hoc parameters
+func (c *ToolController) writeCatalog(w http.ResponseWriter, r *http.Request, configID string, revision int) {
+	tools, status, err := c.sseServer.ToolCatalog(r, configID, revision)
+	if err != nil {
+		c.writeErrorResponse(w, "Failed to list tools: "+err.Error(), status)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ToolCatalogResponse{
+		ConfigID: configID,
+		Revision: revision,
+		Tools:    tools,
+		Total:    len(tools),
+		Status:   true,
+	})
+}
+
+// writeErrorResponse writes an error response to the client
+func (c *ToolController) writeErrorResponse(w http.ResponseWriter, message string, status int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(ToolCatalogResponse{
+		Error:  message,
+		Status: false,
+	})
+}
+
+// writeInvocationError writes an error response for a tool invocation to the client
+func (c *ToolController) writeInvocationError(w http.ResponseWriter, message string, status int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(ToolInvocationResponse{
+		Error:  message,
+		Status: false,
+	})
+}
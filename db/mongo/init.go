@@ -9,6 +9,8 @@ import (
 	"sync"
 	"syscall"
 	"time"
+
+	"github.com/anyisalin/mcp-openapi-to-mcp-adapter/utils"
 )
 
 var initOnce sync.Once
@@ -47,7 +49,7 @@ func InitMongoDB() error {
 			return
 		}
 
-		log.Println("Successfully connected to MongoDB at", config.URI)
+		log.Println("Successfully connected to MongoDB at", utils.RedactURL(config.URI))
 
 		// 注册关闭钩子
 		if !shutdownHookRegistered {
@@ -83,7 +85,7 @@ func InitMongoDBWithConfig(config *Config) error {
 		return fmt.Errorf("failed to ping MongoDB: %w", err)
 	}
 
-	log.Println("Successfully connected to MongoDB at", config.URI)
+	log.Println("Successfully connected to MongoDB at", utils.RedactURL(config.URI))
 
 	// 注册关闭钩子
 	if !shutdownHookRegistered {
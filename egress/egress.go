@@ -0,0 +1,239 @@
+// Package egress restricts the hosts, addresses and local files mcp-link may
+// reach on behalf of its callers, so that schema URLs and upstream base URLs
+// cannot be used to probe internal services or read arbitrary files.
+package egress
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// ErrDenied is wrapped by the errors of requests and files denied by the policy
+var ErrDenied = errors.New("egress denied")
+
+// Policy decides which destinations may be reached
+type Policy struct {
+	AllowHosts   []string       // Host names that may be reached, "*.example.com" for subdomains; empty allows all hosts
+	DenyHosts    []string       // Host names that may never be reached
+	AllowCIDRs   []netip.Prefix // Addresses that may be reached even if private
+	DenyCIDRs    []netip.Prefix // Addresses that may never be reached, even by allowed hosts
+	AllowPrivate bool           // Allow loopback, private, link-local and other non-public addresses
+	SchemaDir    string         // Directory local schema files must be in; empty disables local schema files
+
+	transportOnce sync.Once
+	transport     *http.Transport
+}
+
+var (
+	defaultPolicy *Policy
+	policyMu      sync.RWMutex
+)
+
+// SetDefault sets the policy applied by Transport and ReadSchemaFile. A nil
+// policy allows every destination and file.
+func SetDefault(p *Policy) {
+	policyMu.Lock()
+	defer policyMu.Unlock()
+	defaultPolicy = p
+}
+
+// Default returns the default policy, or nil if egress is not restricted
+func Default() *Policy {
+	policyMu.RLock()
+	defer policyMu.RUnlock()
+	return defaultPolicy
+}
+
+// ParseCIDRs parses CIDRs and single addresses
+func ParseCIDRs(values []string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+		if !strings.Contains(value, "/") {
+			addr, err := netip.ParseAddr(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid address %q: %w", value, err)
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR %q: %w", value, err)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+// CheckHost checks the host name of a URL before it is resolved
+func (p *Policy) CheckHost(host string) error {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if matchHosts(p.DenyHosts, host) {
+		return fmt.Errorf("%w: host %s is denied", ErrDenied, host)
+	}
+	if len(p.AllowHosts) == 0 || matchHosts(p.AllowHosts, host) {
+		return nil
+	}
+	// IP literals may be allowed by address instead of name
+	if addr, err := netip.ParseAddr(host); err == nil && matchCIDRs(p.AllowCIDRs, addr.Unmap()) {
+		return nil
+	}
+	return fmt.Errorf("%w: host %s is not allowed", ErrDenied, host)
+}
+
+// CheckAddr checks an address a connection is about to be made to
+func (p *Policy) CheckAddr(addr netip.Addr) error {
+	addr = addr.Unmap()
+	if matchCIDRs(p.DenyCIDRs, addr) {
+		return fmt.Errorf("%w: address %s is denied", ErrDenied, addr)
+	}
+	if matchCIDRs(p.AllowCIDRs, addr) || p.AllowPrivate || isPublic(addr) {
+		return nil
+	}
+	return fmt.Errorf("%w: address %s is not public", ErrDenied, addr)
+}
+
+// CheckURL checks the scheme and host name of a URL before it is requested
+func (p *Policy) CheckURL(req *http.Request) error {
+	if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+		return fmt.Errorf("%w: scheme %s is not allowed", ErrDenied, req.URL.Scheme)
+	}
+	return p.CheckHost(req.URL.Hostname())
+}
+
+// RoundTrip checks the host of every request, including redirects, and
+// sends it through a transport checking the addresses it connects to
+func (p *Policy) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := p.CheckURL(req); err != nil {
+		return nil, err
+	}
+	return p.baseTransport().RoundTrip(req)
+}
+
+// baseTransport returns the transport of the policy. Its dialer checks the
+// resolved address of every connection, so a host name cannot be pointed at
+// a denied address after it was checked. Proxies are not used, since the
+// address of a proxy says nothing about the destination.
+func (p *Policy) baseTransport() *http.Transport {
+	p.transportOnce.Do(func() {
+		dialer := &net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+			Control: func(network, address string, _ syscall.RawConn) error {
+				addrPort, err := netip.ParseAddrPort(address)
+				if err != nil {
+					return fmt.Errorf("%w: cannot check address %s", ErrDenied, address)
+				}
+				return p.CheckAddr(addrPort.Addr())
+			},
+		}
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.Proxy = nil
+		transport.DialContext = dialer.DialContext
+		p.transport = transport
+	})
+	return p.transport
+}
+
+// Transport returns the transport for requests made on behalf of callers:
+// the default policy, or the default transport if egress is not restricted
+func Transport() http.RoundTripper {
+	if p := Default(); p != nil {
+		return p
+	}
+	return http.DefaultTransport
+}
+
+// ReadSchemaFile reads a local schema file. With a default policy, the file
+// must be inside its schema directory, after symbolic links are resolved.
+func ReadSchemaFile(path string) ([]byte, error) {
+	p := Default()
+	if p == nil {
+		return os.ReadFile(path)
+	}
+	if p.SchemaDir == "" {
+		return nil, fmt.Errorf("%w: local schema files are disabled", ErrDenied)
+	}
+
+	dir, err := filepath.EvalSymlinks(p.SchemaDir)
+	if err != nil {
+		return nil, fmt.Errorf("schema directory: %w", err)
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(dir, path)
+	}
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return nil, err
+	}
+	if rel, err := filepath.Rel(dir, resolved); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return nil, fmt.Errorf("%w: %s is outside the schema directory", ErrDenied, path)
+	}
+	return os.ReadFile(resolved)
+}
+
+// matchHosts reports whether the host matches one of the patterns
+func matchHosts(patterns []string, host string) bool {
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(pattern), "."))
+		if suffix, ok := strings.CutPrefix(pattern, "*."); ok {
+			if strings.HasSuffix(host, "."+suffix) {
+				return true
+			}
+			continue
+		}
+		if host == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+// matchCIDRs reports whether the address is in one of the prefixes
+func matchCIDRs(prefixes []netip.Prefix, addr netip.Addr) bool {
+	for _, prefix := range prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// isPublic reports whether the address is a global unicast address outside
+// the private, shared and documentation ranges
+func isPublic(addr netip.Addr) bool {
+	if !addr.IsGlobalUnicast() || addr.IsPrivate() {
+		return false
+	}
+	for _, prefix := range nonPublicPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// nonPublicPrefixes are global unicast ranges that are not reachable on the internet
+var nonPublicPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("100.64.0.0/10"),   // Carrier-grade NAT
+	netip.MustParsePrefix("192.0.0.0/24"),    // IETF protocol assignments
+	netip.MustParsePrefix("198.18.0.0/15"),   // Benchmarking
+	netip.MustParsePrefix("64:ff9b:1::/48"),  // Local-use NAT64
+	netip.MustParsePrefix("2001:db8::/32"),   // Documentation
+	netip.MustParsePrefix("192.0.2.0/24"),    // Documentation
+	netip.MustParsePrefix("198.51.100.0/24"), // Documentation
+	netip.MustParsePrefix("203.0.113.0/24"),  // Documentation
+}
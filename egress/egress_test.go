@@ -0,0 +1,114 @@
+package egress
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheckAddr(t *testing.T) {
+	policy := &Policy{
+		AllowCIDRs: []netip.Prefix{netip.MustParsePrefix("10.1.0.0/16")},
+		DenyCIDRs:  []netip.Prefix{netip.MustParsePrefix("10.1.2.0/24"), netip.MustParsePrefix("8.8.4.4/32")},
+	}
+	tests := map[string]bool{
+		"8.8.8.8":          true,
+		"8.8.4.4":          false,
+		"127.0.0.1":        false,
+		"169.254.169.254":  false,
+		"::ffff:127.0.0.1": false,
+		"fd00::1":          false,
+		"10.1.0.5":         true,
+		"10.1.2.5":         false,
+		"192.168.1.1":      false,
+		"0.0.0.0":          false,
+	}
+	for addr, allowed := range tests {
+		err := policy.CheckAddr(netip.MustParseAddr(addr))
+		if (err == nil) != allowed {
+			t.Errorf("CheckAddr(%s) = %v, want allowed %v", addr, err, allowed)
+		}
+	}
+}
+
+func TestCheckHost(t *testing.T) {
+	policy := &Policy{
+		AllowHosts: []string{"api.example.com", "*.petstore.io"},
+		DenyHosts:  []string{"admin.petstore.io"},
+		AllowCIDRs: []netip.Prefix{netip.MustParsePrefix("10.1.0.0/16")},
+	}
+	tests := map[string]bool{
+		"api.example.com":   true,
+		"API.example.com.":  true,
+		"v2.petstore.io":    true,
+		"petstore.io":       false,
+		"admin.petstore.io": false,
+		"evil.com":          false,
+		"10.1.0.5":          true,
+		"10.2.0.5":          false,
+	}
+	for host, allowed := range tests {
+		err := policy.CheckHost(host)
+		if (err == nil) != allowed {
+			t.Errorf("CheckHost(%s) = %v, want allowed %v", host, err, allowed)
+		}
+	}
+}
+
+func TestTransportChecksResolvedAddress(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+
+	// localhost passes the host check but resolves to a loopback address
+	url := strings.Replace(ts.URL, "127.0.0.1", "localhost", 1)
+	client := &http.Client{Transport: &Policy{}}
+	if _, err := client.Get(url); !errors.Is(err, ErrDenied) {
+		t.Fatalf("loopback request not denied: %v", err)
+	}
+
+	client = &http.Client{Transport: &Policy{AllowCIDRs: []netip.Prefix{netip.MustParsePrefix("127.0.0.0/8"), netip.MustParsePrefix("::1/128")}}}
+	resp, err := client.Get(url)
+	if err != nil {
+		t.Fatalf("allowed request failed: %v", err)
+	}
+	resp.Body.Close()
+}
+
+func TestReadSchemaFile(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "pets.json"), []byte("{}"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	outside := filepath.Join(t.TempDir(), "secret")
+	if err := os.WriteFile(outside, []byte("secret"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(outside, filepath.Join(dir, "link.json")); err != nil {
+		t.Fatal(err)
+	}
+
+	SetDefault(&Policy{SchemaDir: dir})
+	t.Cleanup(func() { SetDefault(nil) })
+
+	if _, err := ReadSchemaFile(filepath.Join(dir, "pets.json")); err != nil {
+		t.Fatalf("schema in the directory not read: %v", err)
+	}
+	if _, err := ReadSchemaFile("pets.json"); err != nil {
+		t.Fatalf("relative schema path not read: %v", err)
+	}
+	for _, path := range []string{outside, "../" + filepath.Base(filepath.Dir(outside)) + "/secret", filepath.Join(dir, "link.json")} {
+		if _, err := ReadSchemaFile(path); !errors.Is(err, ErrDenied) {
+			t.Errorf("ReadSchemaFile(%s) not denied: %v", path, err)
+		}
+	}
+
+	SetDefault(&Policy{})
+	if _, err := ReadSchemaFile(filepath.Join(dir, "pets.json")); !errors.Is(err, ErrDenied) {
+		t.Fatalf("local schema read without a schema directory: %v", err)
+	}
+}
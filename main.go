@@ -4,22 +4,42 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
 
+	"github.com/anyisalin/mcp-openapi-to-mcp-adapter/auth"
 	"github.com/anyisalin/mcp-openapi-to-mcp-adapter/controllers"
 	"github.com/anyisalin/mcp-openapi-to-mcp-adapter/db/mongo"
+	"github.com/anyisalin/mcp-openapi-to-mcp-adapter/egress"
+	"github.com/anyisalin/mcp-openapi-to-mcp-adapter/metrics"
 	"github.com/anyisalin/mcp-openapi-to-mcp-adapter/repositories"
 	"github.com/anyisalin/mcp-openapi-to-mcp-adapter/router"
+	"github.com/anyisalin/mcp-openapi-to-mcp-adapter/secrets"
 	"github.com/anyisalin/mcp-openapi-to-mcp-adapter/services"
+	"github.com/anyisalin/mcp-openapi-to-mcp-adapter/tracing"
 	"github.com/anyisalin/mcp-openapi-to-mcp-adapter/utils"
 	"github.com/urfave/cli/v2"
 )
 
 func main() {
+	// Keys encrypting stored header secrets, shared by serve and rotate-secrets
+	secretKeyFlags := []cli.Flag{
+		&cli.StringFlag{
+			Name:    "secret-keys-file",
+			Usage:   "YAML or JSON file with the keys encrypting stored header secrets (primary key plus older keys for rotation)",
+			EnvVars: []string{"SECRET_KEYS_FILE"},
+		},
+		&cli.StringFlag{
+			Name:    "secret-keys",
+			Usage:   "Keys encrypting stored header secrets as id:base64key[,id:base64key...], the first is the primary key",
+			EnvVars: []string{"SECRET_KEYS"},
+		},
+	}
+
 	app := &cli.App{
 		Name:  "mcp-link",
 		Usage: "Convert OpenAPI to MCP compatible endpoints",
@@ -27,7 +47,7 @@ func main() {
 			{
 				Name:  "serve",
 				Usage: "Start the MCP Link server",
-				Flags: []cli.Flag{
+				Flags: append([]cli.Flag{
 					&cli.IntFlag{
 						Name:    "port",
 						Aliases: []string{"p"},
@@ -52,8 +72,231 @@ func main() {
 						Usage:   "MongoDB database name",
 						EnvVars: []string{"MONGODB_DATABASE"},
 					},
-				},
+					&cli.DurationFlag{
+						Name:  "spec-poll-interval",
+						Value: 10 * time.Minute,
+						Usage: "Interval for re-checking remote OpenAPI schemas of active sessions (0 disables polling)",
+					},
+					&cli.DurationFlag{
+						Name:  "session-idle-timeout",
+						Value: 0,
+						Usage: "Close sessions that send no messages for this long (0 disables)",
+					},
+					&cli.IntFlag{
+						Name:  "max-sessions",
+						Value: 0,
+						Usage: "Maximum number of concurrent SSE sessions, further connections get 503 (0 is unlimited)",
+					},
+					&cli.DurationFlag{
+						Name:  "sse-keepalive-interval",
+						Value: 25 * time.Second,
+						Usage: "Interval between keepalive comments on SSE streams (0 disables)",
+					},
+					&cli.IntFlag{
+						Name:  "sse-replay-buffer",
+						Value: 100,
+						Usage: "Number of events kept per session for Last-Event-ID replay (0 disables resumption)",
+					},
+					&cli.DurationFlag{
+						Name:  "sse-resume-window",
+						Value: 2 * time.Minute,
+						Usage: "How long a disconnected session can be resumed with Last-Event-ID (0 disables resumption)",
+					},
+					&cli.IntFlag{
+						Name:  "event-queue-size",
+						Value: 100,
+						Usage: "Capacity of the per-session event queue",
+					},
+					&cli.StringFlag{
+						Name:  "backpressure-policy",
+						Value: "block",
+						Usage: "What to do when a session's event queue is full: block (wait up to --backpressure-timeout, then fail the message with 503), reject (fail with 503 immediately) or disconnect (close the session)",
+					},
+					&cli.DurationFlag{
+						Name:  "backpressure-timeout",
+						Value: 10 * time.Second,
+						Usage: "How long the block backpressure policy waits for room in a full event queue",
+					},
+					&cli.StringFlag{
+						Name:    "api-keys-file",
+						Usage:   "YAML or JSON file with static API keys and their scopes; enables authentication",
+						EnvVars: []string{"API_KEYS_FILE"},
+					},
+					&cli.StringFlag{
+						Name:    "jwks-file",
+						Usage:   "Local JWKS file used to validate JWT bearer tokens; enables authentication",
+						EnvVars: []string{"JWKS_FILE"},
+					},
+					&cli.StringFlag{
+						Name:  "jwt-issuer",
+						Usage: "Required issuer (iss) of JWT bearer tokens",
+					},
+					&cli.StringFlag{
+						Name:  "jwt-audience",
+						Usage: "Required audience (aud) of JWT bearer tokens",
+					},
+					&cli.StringFlag{
+						Name:    "oauth-users-file",
+						Usage:   "YAML or JSON file with local users; enables the built-in OAuth authorization server for MCP clients",
+						EnvVars: []string{"OAUTH_USERS_FILE"},
+					},
+					&cli.StringFlag{
+						Name:    "oauth-signing-key",
+						Usage:   "PKCS#8 PEM Ed25519 key signing OAuth access tokens (a generated key invalidates tokens on restart)",
+						EnvVars: []string{"OAUTH_SIGNING_KEY"},
+					},
+					&cli.StringFlag{
+						Name:  "oauth-issuer",
+						Usage: "External base URL of this server used as OAuth issuer (defaults to http://host:port)",
+					},
+					&cli.StringFlag{
+						Name:    "replica-id",
+						Value:   "",
+						Usage:   "Identifier of this replica in the session registry (defaults to hostname plus a random suffix)",
+						EnvVars: []string{"REPLICA_ID"},
+					},
+					&cli.StringFlag{
+						Name:  "session-registry",
+						Value: "none",
+						Usage: "Session registry for routing messages between replicas: none or mongo",
+					},
+					&cli.StringFlag{
+						Name:  "metrics-path",
+						Value: "/metrics",
+						Usage: "Path serving Prometheus metrics, requiring the admin scope when authentication is enabled (empty disables)",
+					},
+					&cli.BoolFlag{
+						Name:  "metrics-config-labels",
+						Usage: "Label tool call metrics with the configuration ID, adding series for every configuration",
+					},
+					&cli.StringFlag{
+						Name:    "log-format",
+						Value:   "text",
+						Usage:   "Log output format: text or json",
+						EnvVars: []string{"LOG_FORMAT"},
+					},
+					&cli.StringFlag{
+						Name:    "log-level",
+						Value:   "info",
+						Usage:   "Minimum log level: debug, info, warn or error",
+						EnvVars: []string{"LOG_LEVEL"},
+					},
+					&cli.StringSliceFlag{
+						Name:  "log-redact-keys",
+						Usage: "Additional patterns (case-insensitive regular expressions) of JSON keys and headers whose values are redacted from logs",
+					},
+					&cli.IntFlag{
+						Name:  "log-max-payload",
+						Value: utils.DefaultMaxLogPayload,
+						Usage: "Bytes of a logged payload kept before truncation (0 disables truncation)",
+					},
+					&cli.DurationFlag{
+						Name:  "approval-timeout",
+						Value: 5 * time.Minute,
+						Usage: "How long a tool call selected by an approval policy waits for approval, unless the policy sets a timeout",
+					},
+					&cli.BoolFlag{
+						Name:  "audit-log",
+						Value: true,
+						Usage: "Record every tool call in the audit log, queried at /api/v1/audit",
+					},
+					&cli.DurationFlag{
+						Name:  "audit-retention",
+						Value: 90 * 24 * time.Hour,
+						Usage: "How long audit records are kept (0 keeps them forever)",
+					},
+					&cli.StringFlag{
+						Name:    "tracing-exporter",
+						Value:   tracing.ExporterNone,
+						Usage:   "OpenTelemetry span exporter: none, stdout or otlphttp",
+						EnvVars: []string{"TRACING_EXPORTER"},
+					},
+					&cli.StringFlag{
+						Name:    "tracing-endpoint",
+						Usage:   "OTLP/HTTP endpoint as host:port (defaults to the OTEL_EXPORTER_OTLP_* variables)",
+						EnvVars: []string{"TRACING_ENDPOINT"},
+					},
+					&cli.BoolFlag{
+						Name:  "tracing-insecure",
+						Usage: "Send spans to the OTLP endpoint over plain HTTP",
+					},
+					&cli.Float64Flag{
+						Name:  "tracing-sample-ratio",
+						Value: 1,
+						Usage: "Fraction of new traces sampled; traces continued from a client follow its sampling decision",
+					},
+					&cli.StringSliceFlag{
+						Name:  "egress-allow-hosts",
+						Usage: "Hosts schemas and upstream APIs may be fetched from, *.example.com for subdomains (empty allows all hosts)",
+					},
+					&cli.StringSliceFlag{
+						Name:  "egress-deny-hosts",
+						Usage: "Hosts schemas and upstream APIs may never be fetched from",
+					},
+					&cli.StringSliceFlag{
+						Name:  "egress-allow-cidrs",
+						Usage: "Addresses or CIDRs that may be reached even though they are private, e.g. 10.1.0.0/16",
+					},
+					&cli.StringSliceFlag{
+						Name:  "egress-deny-cidrs",
+						Usage: "Addresses or CIDRs that may never be reached",
+					},
+					&cli.BoolFlag{
+						Name:  "egress-allow-private",
+						Usage: "Allow loopback, private and link-local addresses, including cloud metadata endpoints",
+					},
+					&cli.StringFlag{
+						Name:    "schema-dir",
+						Usage:   "Directory local schema files are read from (empty disables local schema files)",
+						EnvVars: []string{"SCHEMA_DIR"},
+					},
+					&cli.StringFlag{
+						Name:    "secret-env-prefix",
+						Usage:   "Prefix of the environment variables env: secret references may read (empty disables env: references)",
+						Value:   "MCP_LINK_SECRET_",
+						EnvVars: []string{"SECRET_ENV_PREFIX"},
+					},
+					&cli.StringFlag{
+						Name:    "secret-dir",
+						Usage:   "Directory file: secret references are read from (empty disables file: references)",
+						EnvVars: []string{"SECRET_DIR"},
+					},
+				}, secretKeyFlags...),
 				Action: func(c *cli.Context) error {
+					// Structured logging, also used by the standard log package
+					logger, err := utils.NewLogger(os.Stderr, c.String("log-format"), c.String("log-level"))
+					if err != nil {
+						return err
+					}
+					slog.SetDefault(logger)
+
+					if err := initSecretKeys(c); err != nil {
+						return err
+					}
+					if err := initSecretReferences(c); err != nil {
+						return err
+					}
+					if err := initEgress(c); err != nil {
+						return err
+					}
+
+					shutdownTracing, err := tracing.Setup(c.Context, tracing.Options{
+						Exporter:    c.String("tracing-exporter"),
+						Endpoint:    c.String("tracing-endpoint"),
+						Insecure:    c.Bool("tracing-insecure"),
+						SampleRatio: c.Float64("tracing-sample-ratio"),
+					})
+					if err != nil {
+						return err
+					}
+					defer func() {
+						ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+						defer cancel()
+						if err := shutdownTracing(ctx); err != nil {
+							slog.Error("failed to flush spans", "error", err)
+						}
+					}()
+
 					// Initialize MongoDB
 					mongoConfig := &mongo.Config{
 						URI:      c.String("mongodb-uri"),
@@ -65,9 +308,28 @@ func main() {
 					}
 
 					// 初始化API服务器配置
-					return runServer(c.String("host"), c.Int("port"))
+					return runServer(c)
 				},
 			},
+			{
+				Name:  "rotate-secrets",
+				Usage: "Re-encrypt stored header secrets with the primary key",
+				Flags: append([]cli.Flag{
+					&cli.StringFlag{
+						Name:    "mongodb-uri",
+						Value:   "mongodb://localhost:47017",
+						Usage:   "MongoDB connection URI",
+						EnvVars: []string{"MONGODB_URI"},
+					},
+					&cli.StringFlag{
+						Name:    "mongodb-database",
+						Value:   "omnimcp",
+						Usage:   "MongoDB database name",
+						EnvVars: []string{"MONGODB_DATABASE"},
+					},
+				}, secretKeyFlags...),
+				Action: rotateSecrets,
+			},
 		},
 	}
 
@@ -76,15 +338,230 @@ func main() {
 	}
 }
 
-func runServer(host string, port int) error {
+// initSecretKeys sets the keyring encrypting stored header secrets. Without
+// --secret-keys-file or --secret-keys secrets are stored in plaintext.
+func initSecretKeys(c *cli.Context) error {
+	var keyring *secrets.Keyring
+	var err error
+	switch {
+	case c.String("secret-keys-file") != "":
+		keyring, err = secrets.LoadKeyFile(c.String("secret-keys-file"))
+	case c.String("secret-keys") != "":
+		keyring, err = secrets.ParseKeys(c.String("secret-keys"))
+	default:
+		slog.Warn("no secret keys configured, header secrets are stored in plaintext")
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to load secret keys: %w", err)
+	}
+
+	secrets.SetDefault(keyring)
+	return nil
+}
+
+// initSecretReferences limits env: references to --secret-env-prefix and
+// file: references to --secret-dir
+func initSecretReferences(c *cli.Context) error {
+	secretDir := c.String("secret-dir")
+	if secretDir != "" {
+		if info, err := os.Stat(secretDir); err != nil || !info.IsDir() {
+			return fmt.Errorf("--secret-dir %s is not a directory", secretDir)
+		}
+	}
+	secrets.SetReferences(secrets.References{
+		EnvPrefix: c.String("secret-env-prefix"),
+		FileDir:   secretDir,
+	})
+	return nil
+}
+
+// initEgress restricts the destinations of schema fetches and upstream
+// calls. Unless allowed, only public addresses can be reached, and local
+// schema files only from --schema-dir.
+func initEgress(c *cli.Context) error {
+	allowCIDRs, err := egress.ParseCIDRs(c.StringSlice("egress-allow-cidrs"))
+	if err != nil {
+		return fmt.Errorf("invalid --egress-allow-cidrs: %w", err)
+	}
+	denyCIDRs, err := egress.ParseCIDRs(c.StringSlice("egress-deny-cidrs"))
+	if err != nil {
+		return fmt.Errorf("invalid --egress-deny-cidrs: %w", err)
+	}
+
+	schemaDir := c.String("schema-dir")
+	if schemaDir != "" {
+		if info, err := os.Stat(schemaDir); err != nil || !info.IsDir() {
+			return fmt.Errorf("--schema-dir %s is not a directory", schemaDir)
+		}
+	}
+
+	egress.SetDefault(&egress.Policy{
+		AllowHosts:   c.StringSlice("egress-allow-hosts"),
+		DenyHosts:    c.StringSlice("egress-deny-hosts"),
+		AllowCIDRs:   allowCIDRs,
+		DenyCIDRs:    denyCIDRs,
+		AllowPrivate: c.Bool("egress-allow-private"),
+		SchemaDir:    schemaDir,
+	})
+	return nil
+}
+
+// rotateSecrets re-encrypts the stored secrets of all configurations and their
+// revisions with the primary key, after which older keys can be removed
+func rotateSecrets(c *cli.Context) error {
+	if err := initSecretKeys(c); err != nil {
+		return err
+	}
+	if secrets.Default() == nil {
+		return fmt.Errorf("--secret-keys-file or --secret-keys is required")
+	}
+
+	mongoConfig := &mongo.Config{
+		URI:      c.String("mongodb-uri"),
+		Database: c.String("mongodb-database"),
+	}
+	if err := mongo.InitMongoDBWithConfig(mongoConfig); err != nil {
+		return fmt.Errorf("failed to initialize MongoDB: %w", err)
+	}
+	mongoClient, err := mongo.GetDefaultClient()
+	if err != nil {
+		return fmt.Errorf("failed to get MongoDB client: %w", err)
+	}
+
+	sseConfigRepo, err := repositories.NewSSEConfigRepository(mongoClient)
+	if err != nil {
+		return fmt.Errorf("failed to create SSE config repository: %w", err)
+	}
+
+	revisionRepo, err := repositories.NewConfigRevisionRepository(mongoClient)
+	if err != nil {
+		return fmt.Errorf("failed to create config revision repository: %w", err)
+	}
+	sseConfigService := services.NewSSEConfigServiceWithAPIRepo(sseConfigRepo, nil, services.NewConfigRevisionService(revisionRepo))
+
+	configs, revisions, err := sseConfigService.RotateSecrets(c.Context)
+	if err != nil {
+		return fmt.Errorf("failed to rotate secrets: %w", err)
+	}
+	fmt.Printf("Re-encrypted secrets of %d configurations and %d revisions\n", configs, revisions)
+	return nil
+}
+
+// newAuthMiddleware creates the authentication middleware from the API key,
+// JWKS and OAuth flags. Without any of them requests are not authenticated.
+// The OAuth authorization server is nil unless --oauth-users-file is set.
+func newAuthMiddleware(c *cli.Context, baseURL string) (*auth.Middleware, *auth.OAuthServer, error) {
+	var authenticators []auth.Authenticator
+
+	if path := c.String("api-keys-file"); path != "" {
+		apiKeys, err := auth.LoadAPIKeyFile(path)
+		if err != nil {
+			return nil, nil, err
+		}
+		authenticators = append(authenticators, apiKeys)
+	}
+
+	if path := c.String("jwks-file"); path != "" {
+		jwtAuth, err := auth.LoadJWKSFile(path, auth.JWTOptions{
+			Issuer:   c.String("jwt-issuer"),
+			Audience: c.String("jwt-audience"),
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+		authenticators = append(authenticators, jwtAuth)
+	}
+
+	var oauthServer *auth.OAuthServer
+	if path := c.String("oauth-users-file"); path != "" {
+		users, err := auth.LoadUserFile(path)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		options := auth.OAuthOptions{
+			Issuer: baseURL,
+			Login:  &auth.PasswordLogin{Users: users},
+		}
+		if issuer := c.String("oauth-issuer"); issuer != "" {
+			options.Issuer = issuer
+		}
+		if keyPath := c.String("oauth-signing-key"); keyPath != "" {
+			if options.SigningKey, err = auth.LoadSigningKey(keyPath); err != nil {
+				return nil, nil, err
+			}
+		}
+
+		if oauthServer, err = auth.NewOAuthServer(options); err != nil {
+			return nil, nil, err
+		}
+		authenticators = append(authenticators, oauthServer.Authenticator())
+	}
+
+	if len(authenticators) == 0 {
+		slog.Warn("authentication is disabled, anyone who can reach the server can use /sse, /message and /api/v1")
+	}
+
+	middleware := auth.NewMiddleware(authenticators...)
+	if oauthServer != nil {
+		middleware.WithResourceMetadata(oauthServer.ResourceMetadataURL())
+	}
+	return middleware, oauthServer, nil
+}
+
+// mongoSessionRegistry returns the SSE server options routing messages and
+// approval decisions between replicas through MongoDB
+func mongoSessionRegistry(ctx context.Context, mongoClient *mongo.Client) ([]utils.SSEOption, error) {
+	sessionRecordRepo, err := repositories.NewSessionRecordRepository(mongoClient)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create session record repository: %w", err)
+	}
+	if err := sessionRecordRepo.EnsureIndexes(ctx); err != nil {
+		return nil, err
+	}
+
+	relayMessageRepo, err := repositories.NewRelayMessageRepository(mongoClient)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create relay message repository: %w", err)
+	}
+	if err := relayMessageRepo.EnsureIndexes(ctx); err != nil {
+		return nil, err
+	}
+
+	approvalRepo, err := repositories.NewApprovalRepository(mongoClient)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create approval repository: %w", err)
+	}
+	if err := approvalRepo.EnsureIndexes(ctx); err != nil {
+		return nil, err
+	}
+
+	return []utils.SSEOption{
+		utils.WithSessionRegistry(services.NewSessionRegistryService(sessionRecordRepo)),
+		utils.WithMessageRelay(services.NewMessageRelayService(relayMessageRepo)),
+		utils.WithApprovalRegistry(services.NewApprovalRegistryService(approvalRepo)),
+	}, nil
+}
+
+// mongoAuditLog creates the audit service storing tool calls in MongoDB for retention
+func mongoAuditLog(ctx context.Context, mongoClient *mongo.Client, retention time.Duration) (*services.AuditService, error) {
+	auditRepo, err := repositories.NewAuditRepository(mongoClient)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create audit repository: %w", err)
+	}
+	if err := auditRepo.EnsureIndexes(ctx, retention); err != nil {
+		return nil, err
+	}
+	return services.NewAuditService(auditRepo), nil
+}
+
+func runServer(c *cli.Context) error {
 	// Create server address
-	addr := fmt.Sprintf("%s:%d", host, port)
+	addr := fmt.Sprintf("%s:%d", c.String("host"), c.Int("port"))
 
 	baseURL := fmt.Sprintf("http://%s", addr)
 
-	// Configure the SSE server
-	ss := utils.NewSSEServer()
-
 	// Get MongoDB client
 	mongoClient, err := mongo.GetDefaultClient()
 	if err != nil {
@@ -103,26 +580,135 @@ func runServer(host string, port int) error {
 		return fmt.Errorf("failed to create SSE config repository: %w", err)
 	}
 
+	// Initialize the revision history of configurations
+	revisionRepo, err := repositories.NewConfigRevisionRepository(mongoClient)
+	if err != nil {
+		return fmt.Errorf("failed to create config revision repository: %w", err)
+	}
+	if err := revisionRepo.EnsureIndexes(c.Context); err != nil {
+		return err
+	}
+	revisionService := services.NewConfigRevisionService(revisionRepo)
+
+	// Initialize the store of uploaded specs, referenced by spec: schema URLs
+	specRepo, err := repositories.NewSpecRepository(mongoClient)
+	if err != nil {
+		return fmt.Errorf("failed to create spec repository: %w", err)
+	}
+	if err := specRepo.EnsureIndexes(c.Context); err != nil {
+		return err
+	}
+	specService := services.NewSpecService(specRepo)
+	utils.SetSpecStore(specService)
+
 	// Initialize SSE config service with API server config repository
-	sseConfigService := services.NewSSEConfigServiceWithAPIRepo(sseConfigRepo, apiServerConfigRepo)
+	sseConfigService := services.NewSSEConfigServiceWithAPIRepo(sseConfigRepo, apiServerConfigRepo, revisionService)
+	utils.SetRefreshTokenStore(sseConfigService)
+
+	authMiddleware, oauthServer, err := newAuthMiddleware(c, baseURL)
+	if err != nil {
+		return err
+	}
+
+	backpressurePolicy, err := utils.ParseBackpressurePolicy(c.String("backpressure-policy"))
+	if err != nil {
+		return err
+	}
+
+	redactor, err := utils.NewRedactor(append(utils.DefaultSensitiveKeys, c.StringSlice("log-redact-keys")...), c.Int("log-max-payload"))
+	if err != nil {
+		return err
+	}
+	authMiddleware.WithLogging(slog.Default(), redactor.URL)
+
+	// Configure the SSE server, resolving configuration IDs through the SSE config service
+	sseOpts := []utils.SSEOption{
+		utils.WithConfigLoader(sseConfigService),
+		utils.WithSpecPollInterval(c.Duration("spec-poll-interval")),
+		utils.WithIdleTimeout(c.Duration("session-idle-timeout")),
+		utils.WithMaxSessions(c.Int("max-sessions")),
+		utils.WithConfigMetricLabels(c.Bool("metrics-config-labels")),
+		utils.WithKeepAliveInterval(c.Duration("sse-keepalive-interval")),
+		utils.WithResumption(c.Int("sse-replay-buffer"), c.Duration("sse-resume-window")),
+		utils.WithReplicaID(c.String("replica-id")),
+		utils.WithEventQueueSize(c.Int("event-queue-size")),
+		utils.WithBackpressure(backpressurePolicy, c.Duration("backpressure-timeout")),
+		utils.WithRedactor(redactor),
+		utils.WithLogger(slog.Default()),
+		utils.WithApprovalTimeout(c.Duration("approval-timeout")),
+	}
+
+	// Share session ownership between replicas so any replica can accept messages
+	switch c.String("session-registry") {
+	case "none", "":
+	case "mongo":
+		registryOpts, err := mongoSessionRegistry(c.Context, mongoClient)
+		if err != nil {
+			return err
+		}
+		sseOpts = append(sseOpts, registryOpts...)
+	default:
+		return fmt.Errorf("unknown session registry: %s", c.String("session-registry"))
+	}
+
+	// Audit log of tool calls
+	var auditService *services.AuditService
+	if c.Bool("audit-log") {
+		auditService, err = mongoAuditLog(c.Context, mongoClient, c.Duration("audit-retention"))
+		if err != nil {
+			return err
+		}
+		sseOpts = append(sseOpts, utils.WithAuditSink(auditService))
+	}
+
+	ss := utils.NewSSEServer(sseOpts...)
 
 	// Initialize SSE config controller
 	sseConfigController := controllers.NewSSEConfigController(sseConfigService, ss, baseURL)
 
 	// Initialize API server config service
-	apiServerConfigService := services.NewAPIServerConfigService(apiServerConfigRepo)
+	apiServerConfigService := services.NewAPIServerConfigService(apiServerConfigRepo, revisionService)
 
 	// Initialize API server config controller
 	apiServerConfigController := controllers.NewAPIServerConfigController(apiServerConfigService)
 
-	// Initialize router with both controllers
-	apiRouter := router.NewRouter(sseConfigController, apiServerConfigController)
+	// Initialize session controller
+	sessionController := controllers.NewSessionController(ss)
+
+	// Initialize approval controller
+	approvalController := controllers.NewApprovalController(ss)
+
+	// Initialize tool controller
+	toolController := controllers.NewToolController(ss)
+
+	// Initialize spec controller
+	specController := controllers.NewSpecController(specService)
+
+	// Initialize audit controller, only when auditing is enabled
+	var auditController *controllers.AuditController
+	if auditService != nil {
+		auditController = controllers.NewAuditController(auditService)
+	}
+
+	// Initialize router with all controllers
+	apiRouter := router.NewRouter(sseConfigController, apiServerConfigController, sessionController, auditController, approvalController, specController, toolController)
 
 	// Create HTTP server with CORS middleware and router
 	mux := http.NewServeMux()
-	mux.Handle("/api/v1/", corsMiddleware(apiRouter))
-	mux.Handle("/sse", corsMiddleware(ss))
-	mux.Handle("/message", corsMiddleware(ss))
+	mux.Handle("/api/v1/", corsMiddleware(authMiddleware.Require(auth.ScopeAdmin, apiRouter)))
+	mux.Handle("/sse", corsMiddleware(authMiddleware.Require(auth.ScopeConnect, ss)))
+	mux.Handle("/message", corsMiddleware(authMiddleware.Require(auth.ScopeConnect, ss)))
+
+	// Prometheus metrics
+	if path := c.String("metrics-path"); path != "" {
+		mux.Handle(path, authMiddleware.Require(auth.ScopeAdmin, metrics.Handler()))
+	}
+
+	// MCP authorization: server metadata, client registration and the OAuth endpoints
+	if oauthServer != nil {
+		mux.Handle("/.well-known/", corsMiddleware(oauthServer))
+		mux.Handle("/oauth/", corsMiddleware(oauthServer))
+	}
 
 	// 添加健康检查端点
 	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
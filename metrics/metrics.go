@@ -0,0 +1,150 @@
+// Package metrics defines the Prometheus metrics of mcp-link
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "mcp_link"
+
+var (
+	// SessionsActive is the number of SSE sessions held by this replica,
+	// including detached sessions waiting to be resumed
+	SessionsActive = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "sse_sessions_active",
+		Help:      "Number of SSE sessions held by this replica.",
+	})
+
+	// SessionsOpened counts SSE sessions created
+	SessionsOpened = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "sse_sessions_opened_total",
+		Help:      "Total number of SSE sessions opened.",
+	})
+
+	// SessionsClosed counts SSE sessions removed
+	SessionsClosed = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "sse_sessions_closed_total",
+		Help:      "Total number of SSE sessions closed.",
+	})
+
+	// JSONRPCRequests counts JSON-RPC messages by method
+	JSONRPCRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "jsonrpc_requests_total",
+		Help:      "Total number of JSON-RPC messages handled, by method.",
+	}, []string{"method"})
+
+	// ToolCalls counts tool calls by configuration, tool and status. The
+	// configuration is only set when enabled, see SSE option WithConfigMetricLabels.
+	ToolCalls = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "tool_calls_total",
+		Help:      "Total number of tool calls, by configuration, tool and status (ok, error or tool_error).",
+	}, []string{"config_id", "tool", "status"})
+
+	// UpstreamDuration observes the latency of upstream API calls by host.
+	// Only the hosts of stored configurations are labelled, others are "other".
+	UpstreamDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "upstream_request_duration_seconds",
+		Help:      "Latency of upstream API requests, by host of a stored configuration.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"host"})
+
+	// SchemaFetchDuration observes how long loading an OpenAPI schema takes
+	SchemaFetchDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "schema_fetch_duration_seconds",
+		Help:      "Time spent loading OpenAPI schemas, by source (url, file or stored).",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"source"})
+
+	// SchemaParseDuration observes how long parsing an OpenAPI schema takes
+	SchemaParseDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "schema_parse_duration_seconds",
+		Help:      "Time spent parsing OpenAPI schemas.",
+		Buckets:   prometheus.DefBuckets,
+	})
+
+	// CacheLookups counts cache lookups by cache
+	CacheLookups = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cache_lookups_total",
+		Help:      "Total number of cache lookups, by cache.",
+	}, []string{"cache"})
+
+	// CacheMisses counts cache lookups that had to fetch the value, by cache
+	CacheMisses = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cache_misses_total",
+		Help:      "Total number of cache lookups that missed, by cache.",
+	}, []string{"cache"})
+
+	// EventQueueDrops counts events that could not be queued on a full session event queue
+	EventQueueDrops = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "event_queue_dropped_total",
+		Help:      "Total number of events dropped because a session event queue was full, by backpressure policy.",
+	}, []string{"policy"})
+)
+
+func init() {
+	prometheus.MustRegister(
+		SessionsActive,
+		SessionsOpened,
+		SessionsClosed,
+		JSONRPCRequests,
+		ToolCalls,
+		UpstreamDuration,
+		SchemaFetchDuration,
+		SchemaParseDuration,
+		CacheLookups,
+		CacheMisses,
+		EventQueueDrops,
+	)
+}
+
+// Handler serves the metrics in the Prometheus exposition format
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// OtherLabel is the label value counting values clients could choose freely,
+// so that they cannot create arbitrary label values
+const OtherLabel = "other"
+
+// knownMethods are the JSON-RPC methods of the MCP protocol. Other methods are
+// counted as OtherLabel.
+var knownMethods = map[string]bool{
+	"initialize":                       true,
+	"ping":                             true,
+	"tools/list":                       true,
+	"tools/call":                       true,
+	"resources/list":                   true,
+	"resources/read":                   true,
+	"resources/templates/list":         true,
+	"resources/subscribe":              true,
+	"resources/unsubscribe":            true,
+	"prompts/list":                     true,
+	"prompts/get":                      true,
+	"logging/setLevel":                 true,
+	"completion/complete":              true,
+	"notifications/initialized":        true,
+	"notifications/cancelled":          true,
+	"notifications/roots/list_changed": true,
+}
+
+// MethodLabel returns the method label value of a JSON-RPC method
+func MethodLabel(method string) string {
+	if knownMethods[method] {
+		return method
+	}
+	return OtherLabel
+}
@@ -15,6 +15,7 @@ type APIServerConfig struct {
 	BaseURL     string             `bson:"base_url" json:"baseUrl"`
 	CreatedAt   time.Time          `bson:"created_at" json:"createdAt"`
 	UpdatedAt   time.Time          `bson:"updated_at" json:"updatedAt"`
+	Version     int64              `bson:"version" json:"version"` // 每次更新递增，用于乐观并发控制
 }
 
 // NewAPIServerConfig 创建一个新的 API 服务器配置
@@ -38,6 +39,7 @@ func (a *APIServerConfig) BeforeInsert() {
 	now := time.Now()
 	a.CreatedAt = now
 	a.UpdatedAt = now
+	a.Version = 1
 }
 
 // BeforeUpdate 在更新前执行
@@ -0,0 +1,25 @@
+package models
+
+import (
+	"github.com/anyisalin/mcp-openapi-to-mcp-adapter/db/mongo"
+)
+
+// AuditRecord records one tool call: who called which upstream operation,
+// with which arguments and with what result. CreatedAt is when the call
+// completed; the TTL index of the collection expires records from it.
+type AuditRecord struct {
+	mongo.BaseModel `bson:",inline"`
+	SessionID       string                 `json:"sessionId" bson:"session_id"`
+	ConfigID        string                 `json:"configId,omitempty" bson:"config_id,omitempty"`
+	Subject         string                 `json:"subject,omitempty" bson:"subject,omitempty"` // Authenticated caller
+	Tool            string                 `json:"tool" bson:"tool"`
+	Method          string                 `json:"method,omitempty" bson:"method,omitempty"` // HTTP method of the upstream request
+	URL             string                 `json:"url,omitempty" bson:"url,omitempty"`       // Upstream URL with secrets masked
+	Arguments       map[string]interface{} `json:"arguments,omitempty" bson:"arguments,omitempty"`
+	Status          string                 `json:"status" bson:"status"` // ok, error or tool_error
+	StatusCode      int                    `json:"statusCode,omitempty" bson:"status_code,omitempty"`
+	LatencyMS       float64                `json:"latencyMs" bson:"latency_ms"`
+	ResponseSize    int                    `json:"responseSize" bson:"response_size"`
+	Approval        string                 `json:"approval,omitempty" bson:"approval,omitempty"`      // approved, denied, timeout or cancelled for calls that needed approval
+	ApprovedBy      string                 `json:"approvedBy,omitempty" bson:"approved_by,omitempty"` // "client" or the administrator who decided
+}
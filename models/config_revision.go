@@ -0,0 +1,56 @@
+package models
+
+import (
+	"encoding/json"
+
+	"github.com/anyisalin/mcp-openapi-to-mcp-adapter/db/mongo"
+)
+
+// Kinds of configurations with a revision history
+const (
+	ConfigKindSSE       = "sse_config"
+	ConfigKindAPIServer = "api_server_config"
+)
+
+// Actions recorded by revisions
+const (
+	RevisionActionCreate   = "create"
+	RevisionActionUpdate   = "update"
+	RevisionActionRollback = "rollback"
+	RevisionActionBaseline = "baseline" // State of a configuration created before revisions were recorded
+)
+
+// ConfigRevision is an immutable snapshot of a configuration, recorded every
+// time the configuration is created, updated or rolled back. Revisions are
+// numbered from 1 per configuration. CreatedAt is when the change was made.
+type ConfigRevision struct {
+	mongo.BaseModel `bson:",inline"`
+	Kind            string           `json:"kind" bson:"kind"`
+	ConfigID        string           `json:"configId" bson:"config_id"`
+	Revision        int              `json:"revision" bson:"revision"`
+	Action          string           `json:"action" bson:"action"`
+	RollbackTo      int              `json:"rollbackTo,omitempty" bson:"rollback_to,omitempty"` // Revision restored by a rollback
+	Author          string           `json:"author,omitempty" bson:"author,omitempty"`          // Subject of the administrator who made the change
+	Diff            []FieldChange    `json:"diff" bson:"diff"`                                  // Changes from the previous revision, with secrets masked
+	SSEConfig       *SSEConfig       `json:"sseConfig,omitempty" bson:"sse_config,omitempty"`
+	APIServerConfig *APIServerConfig `json:"apiServerConfig,omitempty" bson:"api_server_config,omitempty"`
+}
+
+// FieldChange is the change of one field between two revisions. Nested
+// fields are named by their JSON path, e.g. "headers.Authorization", and
+// values are kept as JSON; a missing value means the field was unset.
+type FieldChange struct {
+	Field string          `json:"field" bson:"field"`
+	Old   json.RawMessage `json:"old,omitempty" bson:"old,omitempty"`
+	New   json.RawMessage `json:"new,omitempty" bson:"new,omitempty"`
+}
+
+// Redacted returns a copy of the revision with the secrets of its snapshot
+// masked, safe to return from the API
+func (r *ConfigRevision) Redacted() *ConfigRevision {
+	redacted := *r
+	if r.SSEConfig != nil {
+		redacted.SSEConfig = r.SSEConfig.Redacted()
+	}
+	return &redacted
+}
@@ -0,0 +1,54 @@
+package models
+
+import (
+	"time"
+
+	"github.com/anyisalin/mcp-openapi-to-mcp-adapter/db/mongo"
+)
+
+// SessionRecord records which replica holds the SSE stream of a session
+type SessionRecord struct {
+	mongo.BaseModel `bson:",inline"`
+	SessionID       string    `json:"sessionId" bson:"session_id"`
+	ReplicaID       string    `json:"replicaId" bson:"replica_id"`
+	ForwardHeaders  []string  `json:"forwardHeaders,omitempty" bson:"forward_headers,omitempty"` // Incoming headers the session forwards upstream
+	ExpiresAt       time.Time `json:"expiresAt" bson:"expires_at"`                               // Refreshed by the owning replica while the session is alive
+}
+
+// RelayMessage is a JSON-RPC message received by one replica and waiting to
+// be delivered to the replica that owns its session
+type RelayMessage struct {
+	mongo.BaseModel `bson:",inline"`
+	SessionID       string              `json:"sessionId" bson:"session_id"`
+	ReplicaID       string              `json:"replicaId" bson:"replica_id"` // Replica the message is addressed to
+	Body            []byte              `json:"body" bson:"body"`
+	Headers         map[string][]string `json:"headers" bson:"headers,omitempty"`
+	HeadersSealed   bool                `json:"headersSealed" bson:"headers_sealed,omitempty"` // Header values are encrypted with the keyring
+	RemoteAddr      string              `json:"remoteAddr" bson:"remote_addr,omitempty"`
+	Subject         string              `json:"subject" bson:"subject,omitempty"`             // Authenticated caller that posted the message
+	Approval        *RelayedApproval    `json:"approval,omitempty" bson:"approval,omitempty"` // Decision for a call held by the replica, instead of a message
+}
+
+// RelayedApproval is an administrator's decision on a held tool call
+type RelayedApproval struct {
+	ApprovalID string `json:"approvalId" bson:"approval_id"`
+	Approved   bool   `json:"approved" bson:"approved"`
+	By         string `json:"by" bson:"by"`
+	Reason     string `json:"reason,omitempty" bson:"reason,omitempty"`
+}
+
+// ApprovalRecord is a tool call held by a replica until an administrator
+// approves or denies it
+type ApprovalRecord struct {
+	mongo.BaseModel `bson:",inline"`
+	ApprovalID      string                 `json:"approvalId" bson:"approval_id"`
+	ReplicaID       string                 `json:"replicaId" bson:"replica_id"` // Replica holding the call
+	SessionID       string                 `json:"sessionId" bson:"session_id"`
+	ConfigID        string                 `json:"configId,omitempty" bson:"config_id,omitempty"`
+	Subject         string                 `json:"subject,omitempty" bson:"subject,omitempty"`
+	Tool            string                 `json:"tool" bson:"tool"`
+	Method          string                 `json:"method" bson:"method"`
+	URL             string                 `json:"url" bson:"url"`                                 // Upstream URL with secrets masked
+	Arguments       map[string]interface{} `json:"arguments,omitempty" bson:"arguments,omitempty"` // Tool arguments with secrets masked
+	ExpiresAt       time.Time              `json:"expiresAt" bson:"expires_at"`
+}
@@ -0,0 +1,25 @@
+package models
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/anyisalin/mcp-openapi-to-mcp-adapter/db/mongo"
+)
+
+// Spec is an OpenAPI specification uploaded to the server. Specs are
+// immutable and identified by the SHA-256 hash of their content, so uploading
+// the same content again returns the existing spec. Small specs are stored
+// in the document, larger ones in GridFS.
+type Spec struct {
+	mongo.BaseModel `bson:",inline"`
+	Name            string             `json:"name,omitempty" bson:"name,omitempty"`
+	Hash            string             `json:"hash" bson:"hash"`     // Hex SHA-256 of the content
+	Format          string             `json:"format" bson:"format"` // json or yaml
+	Size            int64              `json:"size" bson:"size"`
+	Title           string             `json:"title,omitempty" bson:"title,omitempty"`
+	APIVersion      string             `json:"apiVersion,omitempty" bson:"api_version,omitempty"` // info.version of the specification
+	Endpoints       int                `json:"endpoints" bson:"endpoints"`
+	SchemaURL       string             `json:"schemaURL" bson:"-"` // Reference to use as the schema URL of configurations
+	Content         []byte             `json:"-" bson:"content,omitempty"`
+	FileID          primitive.ObjectID `json:"-" bson:"file_id,omitempty"` // GridFS file holding the content of large specs
+}
@@ -4,19 +4,62 @@ import (
 	"time"
 
 	"github.com/anyisalin/mcp-openapi-to-mcp-adapter/db/mongo"
+	"github.com/anyisalin/mcp-openapi-to-mcp-adapter/secrets"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 // SSEConfig represents the SSE configuration stored in MongoDB
 type SSEConfig struct {
 	mongo.BaseModel   `bson:",inline"`
-	APIServerConfigId string            `json:"apiServerConfigId" bson:"api_server_config_id"`
-	SchemaURL         string            `json:"schemaURL" bson:"schema_url"`      // URL or path to the OpenAPI schema
-	BaseURL           string            `json:"baseURL" bson:"base_url"`          // Base URL for API requests
-	Headers           map[string]string `json:"headers" bson:"headers"`           // Headers to send with API requests
-	Filters           []string          `json:"filters" bson:"filters,omitempty"` // Filter expressions for API paths
-	CreatedAt         time.Time         `json:"createdAt" bson:"created_at"`
-	UpdatedAt         time.Time         `json:"updatedAt" bson:"updated_at,omitempty"`
+	APIServerConfigId string                  `json:"apiServerConfigId" bson:"api_server_config_id"`
+	SchemaURL         string                  `json:"schemaURL" bson:"schema_url"`                               // URL or path to the OpenAPI schema
+	BaseURL           string                  `json:"baseURL" bson:"base_url"`                                   // Base URL for API requests
+	Headers           map[string]string       `json:"headers" bson:"headers"`                                    // Headers to send with API requests
+	Filters           []string                `json:"filters" bson:"filters,omitempty"`                          // Filter expressions for API paths
+	UpstreamAuth      *UpstreamAuth           `json:"upstreamAuth,omitempty" bson:"upstream_auth,omitempty"`     // OAuth2 credentials for the upstream API
+	ForwardHeaders    []string                `json:"forwardHeaders,omitempty" bson:"forward_headers,omitempty"` // Incoming headers forwarded to the upstream API, as "Incoming:Upstream"
+	Approval          *ApprovalPolicy         `json:"approval,omitempty" bson:"approval,omitempty"`              // Operations whose calls must be approved by a human
+	ToolOverrides     map[string]ToolOverride `json:"toolOverrides,omitempty" bson:"tool_overrides,omitempty"`   // Tool customisations, keyed by operation ID or "METHOD /path"
+	Version           int64                   `json:"version" bson:"version"`                                    // Incremented by every update, for optimistic concurrency
+	CreatedAt         time.Time               `json:"createdAt" bson:"created_at"`
+	UpdatedAt         time.Time               `json:"updatedAt" bson:"updated_at,omitempty"`
+}
+
+// UpstreamAuth holds OAuth2 credentials used to obtain access tokens for the upstream API
+type UpstreamAuth struct {
+	Type           string            `json:"type" bson:"type"` // client_credentials or refresh_token
+	TokenURL       string            `json:"tokenURL" bson:"token_url"`
+	ClientID       string            `json:"clientId" bson:"client_id"`
+	ClientSecret   string            `json:"clientSecret,omitempty" bson:"client_secret,omitempty"`
+	RefreshToken   string            `json:"refreshToken,omitempty" bson:"refresh_token,omitempty"`
+	Scopes         []string          `json:"scopes,omitempty" bson:"scopes,omitempty"`
+	EndpointParams map[string]string `json:"endpointParams,omitempty" bson:"endpoint_params,omitempty"`
+	AuthStyle      string            `json:"authStyle,omitempty" bson:"auth_style,omitempty"`
+	HeaderName     string            `json:"headerName,omitempty" bson:"header_name,omitempty"`
+}
+
+// ApprovalPolicy selects the operations whose calls are held until a human approves them
+type ApprovalPolicy struct {
+	Rules          []ApprovalRule `json:"rules" bson:"rules"`
+	TimeoutSeconds int            `json:"timeoutSeconds,omitempty" bson:"timeout_seconds,omitempty"` // How long a call waits for approval
+}
+
+// ApprovalRule selects operations by method, path glob and tag; every criterion that is set must match
+type ApprovalRule struct {
+	Methods []string `json:"methods,omitempty" bson:"methods,omitempty"`
+	Path    string   `json:"path,omitempty" bson:"path,omitempty"` // Same glob syntax as filters
+	Tags    []string `json:"tags,omitempty" bson:"tags,omitempty"`
+}
+
+// ToolOverride customises the tool of an operation; parameters are named as in the schema
+type ToolOverride struct {
+	Name                  string                 `json:"name,omitempty" bson:"name,omitempty"`                                    // Replaces the generated tool name
+	Description           string                 `json:"description,omitempty" bson:"description,omitempty"`                      // Replaces the generated description
+	AppendDescription     string                 `json:"appendDescription,omitempty" bson:"append_description,omitempty"`         // Appended to the description
+	ParameterDescriptions map[string]string      `json:"parameterDescriptions,omitempty" bson:"parameter_descriptions,omitempty"` // Replace the descriptions of parameters
+	HiddenParameters      []string               `json:"hiddenParameters,omitempty" bson:"hidden_parameters,omitempty"`           // Not offered to clients
+	PinnedArguments       map[string]interface{} `json:"pinnedArguments,omitempty" bson:"pinned_arguments,omitempty"`             // Always sent with these values, not offered to clients
+	Defaults              map[string]interface{} `json:"defaults,omitempty" bson:"defaults,omitempty"`                            // Sent when clients omit the parameter
 }
 
 // GetID returns the ID of the model
@@ -40,20 +83,39 @@ func (c *SSEConfig) SetUpdatedAt(t time.Time) {
 }
 
 // NewSSEConfig creates a new SSE configuration
-func NewSSEConfig(apiServerConfigId string, schemaURL string, baseURL string, headers map[string]string, filters []string) *SSEConfig {
+func NewSSEConfig(apiServerConfigId string, schemaURL string, baseURL string, headers map[string]string, filters []string, upstreamAuth *UpstreamAuth, forwardHeaders []string, approval *ApprovalPolicy, toolOverrides map[string]ToolOverride) *SSEConfig {
 	return &SSEConfig{
 		APIServerConfigId: apiServerConfigId,
 		SchemaURL:         schemaURL,
 		BaseURL:           baseURL,
 		Headers:           headers,
 		Filters:           filters,
+		UpstreamAuth:      upstreamAuth,
+		ForwardHeaders:    forwardHeaders,
+		Approval:          approval,
+		ToolOverrides:     toolOverrides,
 		CreatedAt:         time.Now(),
 	}
 }
 
+// Redacted returns a copy of the configuration with header values and upstream
+// credentials masked, safe to return from the API
+func (c *SSEConfig) Redacted() *SSEConfig {
+	redacted := *c
+	redacted.Headers = secrets.MaskMap(c.Headers)
+	if c.UpstreamAuth != nil {
+		auth := *c.UpstreamAuth
+		auth.ClientSecret = secrets.Mask(auth.ClientSecret)
+		auth.RefreshToken = secrets.Mask(auth.RefreshToken)
+		redacted.UpstreamAuth = &auth
+	}
+	return &redacted
+}
+
 // BeforeInsert is called before inserting the document
 func (c *SSEConfig) BeforeInsert() {
 	c.CreatedAt = time.Now()
+	c.Version = 1
 }
 
 // BeforeUpdate is called before updating the document
@@ -25,7 +25,8 @@ type APIServerConfigRepository interface {
 
 // MongoAPIServerConfigRepository 是 APIServerConfigRepository 的MongoDB实现
 type MongoAPIServerConfigRepository struct {
-	repo *mongo.BaseRepository[*models.APIServerConfig]
+	client *mongo.Client
+	repo   *mongo.BaseRepository[*models.APIServerConfig]
 }
 
 // NewAPIServerConfigRepository 创建一个新的 API 服务器配置仓库
@@ -35,7 +36,8 @@ func NewAPIServerConfigRepository(client *mongo.Client) (APIServerConfigReposito
 	}
 	
 	repo := &MongoAPIServerConfigRepository{
-		repo: mongo.NewRepository[*models.APIServerConfig](client, APIServerConfigCollectionName),
+		client: client,
+		repo:   mongo.NewRepository[*models.APIServerConfig](client, APIServerConfigCollectionName),
 	}
 	return repo, nil
 }
@@ -87,12 +89,24 @@ func (r *MongoAPIServerConfigRepository) GetAll(ctx context.Context) ([]*models.
 	return configs, nil
 }
 
-// Update 更新现有的 API 服务器配置
+// Update 在配置版本未变时更新现有的 API 服务器配置，并递增版本；
+// 如果配置在读取后已被修改或删除，返回 ErrVersionConflict
 func (r *MongoAPIServerConfigRepository) Update(ctx context.Context, config *models.APIServerConfig) (*models.APIServerConfig, error) {
-	if err := r.repo.Update(ctx, config); err != nil {
+	collection, err := r.client.Collection(APIServerConfigCollectionName)
+	if err != nil {
+		return nil, err
+	}
+
+	expected := config.Version
+	config.Version++
+	if err := replaceVersion(ctx, collection, config.ID, expected, config); err != nil {
+		config.Version = expected
+		if errors.Is(err, ErrVersionConflict) {
+			return nil, err
+		}
 		return nil, errors.Wrap(err, "failed to update API server config")
 	}
-	
+
 	return config, nil
 }
 
@@ -0,0 +1,156 @@
+package repositories
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	mongodriver "go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/anyisalin/mcp-openapi-to-mcp-adapter/db/mongo"
+	"github.com/anyisalin/mcp-openapi-to-mcp-adapter/models"
+)
+
+const AuditRecordCollectionName = "audit_records"
+
+// auditTTLIndexName names the index expiring audit records after the retention period
+const auditTTLIndexName = "created_at_ttl"
+
+// AuditFilter selects audit records; zero fields match every record
+type AuditFilter struct {
+	SessionID string
+	ConfigID  string
+	Subject   string
+	Tool      string
+	Status    string
+	From      time.Time // Records created at or after From
+	To        time.Time // Records created before To
+}
+
+// AuditRepository handles database operations for the audit log
+type AuditRepository struct {
+	client *mongo.Client
+	repo   *mongo.BaseRepository[*models.AuditRecord]
+}
+
+// NewAuditRepository creates a new repository for audit records
+func NewAuditRepository(client *mongo.Client) (*AuditRepository, error) {
+	if client == nil {
+		return nil, errors.New("MongoDB client is nil")
+	}
+
+	return &AuditRepository{
+		client: client,
+		repo:   mongo.NewRepository[*models.AuditRecord](client, AuditRecordCollectionName),
+	}, nil
+}
+
+// EnsureIndexes creates the query indexes and the TTL index removing records
+// older than retention. Records are kept forever if retention is 0.
+func (r *AuditRepository) EnsureIndexes(ctx context.Context, retention time.Duration) error {
+	collection, err := r.client.Collection(AuditRecordCollectionName)
+	if err != nil {
+		return err
+	}
+
+	_, err = collection.Indexes().CreateMany(ctx, []mongodriver.IndexModel{
+		{Keys: bson.D{{Key: "config_id", Value: 1}, {Key: "created_at", Value: -1}}},
+		{Keys: bson.D{{Key: "session_id", Value: 1}, {Key: "created_at", Value: -1}}},
+		{Keys: bson.D{{Key: "subject", Value: 1}, {Key: "created_at", Value: -1}}},
+		{Keys: bson.D{{Key: "tool", Value: 1}, {Key: "created_at", Value: -1}}},
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to create audit record indexes")
+	}
+
+	return r.ensureRetention(ctx, collection, retention)
+}
+
+// ensureRetention creates, updates or drops the TTL index to match retention
+func (r *AuditRepository) ensureRetention(ctx context.Context, collection *mongodriver.Collection, retention time.Duration) error {
+	if retention <= 0 {
+		_, err := collection.Indexes().DropOne(ctx, auditTTLIndexName)
+		var cmdErr mongodriver.CommandError
+		if err != nil && !(errors.As(err, &cmdErr) && cmdErr.Name == "IndexNotFound") {
+			return errors.Wrap(err, "failed to drop audit retention index")
+		}
+		return nil
+	}
+
+	seconds := int32(retention.Seconds())
+	_, err := collection.Indexes().CreateOne(ctx, mongodriver.IndexModel{
+		Keys:    bson.D{{Key: "created_at", Value: 1}},
+		Options: options.Index().SetName(auditTTLIndexName).SetExpireAfterSeconds(seconds),
+	})
+	var cmdErr mongodriver.CommandError
+	if err != nil && errors.As(err, &cmdErr) && cmdErr.Name == "IndexOptionsConflict" {
+		// The retention changed since the index was created
+		db, dbErr := r.client.Database()
+		if dbErr != nil {
+			return dbErr
+		}
+		err = db.RunCommand(ctx, bson.D{
+			{Key: "collMod", Value: AuditRecordCollectionName},
+			{Key: "index", Value: bson.D{
+				{Key: "name", Value: auditTTLIndexName},
+				{Key: "expireAfterSeconds", Value: seconds},
+			}},
+		}).Err()
+	}
+	return errors.Wrap(err, "failed to create audit retention index")
+}
+
+// Create stores an audit record
+func (r *AuditRepository) Create(ctx context.Context, record *models.AuditRecord) error {
+	return errors.Wrap(r.repo.Create(ctx, record), "failed to create audit record")
+}
+
+// Find returns a page of the records matching the filter, newest first, and
+// the number of matching records
+func (r *AuditRepository) Find(ctx context.Context, filter AuditFilter, skip, limit int64) ([]*models.AuditRecord, int64, error) {
+	query := filter.query()
+
+	total, err := r.repo.Count(ctx, query)
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "failed to count audit records")
+	}
+
+	records, err := r.repo.Find(ctx, query, options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}).
+		SetSkip(skip).
+		SetLimit(limit))
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "failed to find audit records")
+	}
+	return records, total, nil
+}
+
+// query returns the MongoDB filter of the audit filter
+func (f AuditFilter) query() bson.M {
+	query := bson.M{}
+	for key, value := range map[string]string{
+		"session_id": f.SessionID,
+		"config_id":  f.ConfigID,
+		"subject":    f.Subject,
+		"tool":       f.Tool,
+		"status":     f.Status,
+	} {
+		if value != "" {
+			query[key] = value
+		}
+	}
+
+	createdAt := bson.M{}
+	if !f.From.IsZero() {
+		createdAt["$gte"] = f.From
+	}
+	if !f.To.IsZero() {
+		createdAt["$lt"] = f.To
+	}
+	if len(createdAt) > 0 {
+		query["created_at"] = createdAt
+	}
+	return query
+}
@@ -0,0 +1,115 @@
+package repositories
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	mongodriver "go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/anyisalin/mcp-openapi-to-mcp-adapter/db/mongo"
+	"github.com/anyisalin/mcp-openapi-to-mcp-adapter/models"
+)
+
+const ConfigRevisionCollectionName = "config_revisions"
+
+// ErrRevisionExists is returned when creating a revision whose number is already taken
+var ErrRevisionExists = errors.New("revision already exists")
+
+// ConfigRevisionRepository handles database operations for the revision
+// history of configurations. Revisions are only ever inserted, except that
+// secret rotation re-encrypts their snapshots.
+type ConfigRevisionRepository struct {
+	client *mongo.Client
+	repo   *mongo.BaseRepository[*models.ConfigRevision]
+}
+
+// NewConfigRevisionRepository creates a new repository for configuration revisions
+func NewConfigRevisionRepository(client *mongo.Client) (*ConfigRevisionRepository, error) {
+	if client == nil {
+		return nil, errors.New("MongoDB client is nil")
+	}
+
+	return &ConfigRevisionRepository{
+		client: client,
+		repo:   mongo.NewRepository[*models.ConfigRevision](client, ConfigRevisionCollectionName),
+	}, nil
+}
+
+// EnsureIndexes creates the unique index numbering the revisions of each configuration
+func (r *ConfigRevisionRepository) EnsureIndexes(ctx context.Context) error {
+	collection, err := r.client.Collection(ConfigRevisionCollectionName)
+	if err != nil {
+		return err
+	}
+
+	_, err = collection.Indexes().CreateOne(ctx, mongodriver.IndexModel{
+		Keys:    bson.D{{Key: "kind", Value: 1}, {Key: "config_id", Value: 1}, {Key: "revision", Value: -1}},
+		Options: options.Index().SetUnique(true),
+	})
+	return errors.Wrap(err, "failed to create config revision index")
+}
+
+// Create stores a revision. It returns ErrRevisionExists if the configuration
+// already has a revision with the same number.
+func (r *ConfigRevisionRepository) Create(ctx context.Context, revision *models.ConfigRevision) error {
+	err := r.repo.Create(ctx, revision)
+	if mongodriver.IsDuplicateKeyError(err) {
+		return ErrRevisionExists
+	}
+	return errors.Wrap(err, "failed to create config revision")
+}
+
+// Latest returns the latest revision of a configuration, or nil if it has none
+func (r *ConfigRevisionRepository) Latest(ctx context.Context, kind, configID string) (*models.ConfigRevision, error) {
+	revision, err := r.repo.FindOne(ctx, bson.M{"kind": kind, "config_id": configID},
+		options.FindOne().SetSort(bson.D{{Key: "revision", Value: -1}}))
+	return revision, errors.Wrap(err, "failed to find latest config revision")
+}
+
+// FindRevision returns a revision of a configuration by number, or nil if it does not exist
+func (r *ConfigRevisionRepository) FindRevision(ctx context.Context, kind, configID string, number int) (*models.ConfigRevision, error) {
+	revision, err := r.repo.FindOne(ctx, bson.M{"kind": kind, "config_id": configID, "revision": number})
+	return revision, errors.Wrap(err, "failed to find config revision")
+}
+
+// FindByKind returns every revision of the configurations of a kind
+func (r *ConfigRevisionRepository) FindByKind(ctx context.Context, kind string) ([]*models.ConfigRevision, error) {
+	revisions, err := r.repo.Find(ctx, bson.M{"kind": kind})
+	return revisions, errors.Wrap(err, "failed to find config revisions")
+}
+
+// ReplaceSSEConfig replaces the SSE configuration snapshot of a revision,
+// leaving the rest of the revision untouched
+func (r *ConfigRevisionRepository) ReplaceSSEConfig(ctx context.Context, revision *models.ConfigRevision) error {
+	collection, err := r.client.Collection(ConfigRevisionCollectionName)
+	if err != nil {
+		return err
+	}
+
+	_, err = collection.UpdateOne(ctx,
+		bson.M{"_id": revision.GetID()},
+		bson.M{"$set": bson.M{"sse_config": revision.SSEConfig}})
+	return errors.Wrap(err, "failed to update config revision")
+}
+
+// Find returns a page of the revisions of a configuration, newest first, and
+// the number of revisions
+func (r *ConfigRevisionRepository) Find(ctx context.Context, kind, configID string, skip, limit int64) ([]*models.ConfigRevision, int64, error) {
+	query := bson.M{"kind": kind, "config_id": configID}
+
+	total, err := r.repo.Count(ctx, query)
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "failed to count config revisions")
+	}
+
+	revisions, err := r.repo.Find(ctx, query, options.Find().
+		SetSort(bson.D{{Key: "revision", Value: -1}}).
+		SetSkip(skip).
+		SetLimit(limit))
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "failed to find config revisions")
+	}
+	return revisions, total, nil
+}
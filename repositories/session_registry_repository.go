@@ -0,0 +1,262 @@
+package repositories
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	mongodriver "go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/anyisalin/mcp-openapi-to-mcp-adapter/db/mongo"
+	"github.com/anyisalin/mcp-openapi-to-mcp-adapter/models"
+)
+
+const (
+	SessionRecordCollectionName = "sse_sessions"
+	RelayMessageCollectionName  = "sse_relay_messages"
+	ApprovalCollectionName      = "sse_approvals"
+)
+
+// relayMessageTTL is how long an undelivered relay message is kept
+const relayMessageTTL = 5 * time.Minute
+
+// SessionRecordRepository handles database operations for session ownership records
+type SessionRecordRepository struct {
+	client *mongo.Client
+	repo   *mongo.BaseRepository[*models.SessionRecord]
+}
+
+// NewSessionRecordRepository creates a new repository for session ownership records
+func NewSessionRecordRepository(client *mongo.Client) (*SessionRecordRepository, error) {
+	if client == nil {
+		return nil, errors.New("MongoDB client is nil")
+	}
+
+	return &SessionRecordRepository{
+		client: client,
+		repo:   mongo.NewRepository[*models.SessionRecord](client, SessionRecordCollectionName),
+	}, nil
+}
+
+// EnsureIndexes creates the unique session index and the TTL index expiring stale records
+func (r *SessionRecordRepository) EnsureIndexes(ctx context.Context) error {
+	collection, err := r.client.Collection(SessionRecordCollectionName)
+	if err != nil {
+		return err
+	}
+
+	_, err = collection.Indexes().CreateMany(ctx, []mongodriver.IndexModel{
+		{
+			Keys:    bson.D{{Key: "session_id", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys:    bson.D{{Key: "expires_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		},
+		{
+			Keys: bson.D{{Key: "replica_id", Value: 1}},
+		},
+	})
+	return errors.Wrap(err, "failed to create session record indexes")
+}
+
+// Upsert records that the session is owned by the replica until expiresAt
+func (r *SessionRecordRepository) Upsert(ctx context.Context, sessionID, replicaID string, forwardHeaders []string, expiresAt time.Time) error {
+	collection, err := r.client.Collection(SessionRecordCollectionName)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	_, err = collection.UpdateOne(ctx,
+		bson.M{"session_id": sessionID},
+		bson.M{
+			"$set": bson.M{
+				"replica_id":      replicaID,
+				"forward_headers": forwardHeaders,
+				"expires_at":      expiresAt,
+				"updated_at":      now,
+			},
+			"$setOnInsert": bson.M{
+				"_id":        primitive.NewObjectID(),
+				"created_at": now,
+			},
+		},
+		options.Update().SetUpsert(true),
+	)
+	return errors.Wrap(err, "failed to upsert session record")
+}
+
+// FindBySessionID returns the unexpired record of a session, or nil if there is none
+func (r *SessionRecordRepository) FindBySessionID(ctx context.Context, sessionID string) (*models.SessionRecord, error) {
+	record, err := r.repo.FindOne(ctx, bson.M{
+		"session_id": sessionID,
+		"expires_at": bson.M{"$gt": time.Now()},
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to find session record")
+	}
+	return record, nil
+}
+
+// DeleteBySessionID removes the record of a session
+func (r *SessionRecordRepository) DeleteBySessionID(ctx context.Context, sessionID string) error {
+	_, err := r.repo.DeleteMany(ctx, bson.M{"session_id": sessionID})
+	return errors.Wrap(err, "failed to delete session record")
+}
+
+// ExtendReplica moves the expiry of every session owned by the replica to expiresAt
+func (r *SessionRecordRepository) ExtendReplica(ctx context.Context, replicaID string, expiresAt time.Time) error {
+	collection, err := r.client.Collection(SessionRecordCollectionName)
+	if err != nil {
+		return err
+	}
+
+	_, err = collection.UpdateMany(ctx,
+		bson.M{"replica_id": replicaID},
+		bson.M{"$set": bson.M{"expires_at": expiresAt, "updated_at": time.Now()}},
+	)
+	return errors.Wrap(err, "failed to extend session records")
+}
+
+// RelayMessageRepository handles database operations for messages relayed between replicas
+type RelayMessageRepository struct {
+	client *mongo.Client
+	repo   *mongo.BaseRepository[*models.RelayMessage]
+}
+
+// NewRelayMessageRepository creates a new repository for relayed messages
+func NewRelayMessageRepository(client *mongo.Client) (*RelayMessageRepository, error) {
+	if client == nil {
+		return nil, errors.New("MongoDB client is nil")
+	}
+
+	return &RelayMessageRepository{
+		client: client,
+		repo:   mongo.NewRepository[*models.RelayMessage](client, RelayMessageCollectionName),
+	}, nil
+}
+
+// EnsureIndexes creates the delivery index and the TTL index dropping undelivered messages
+func (r *RelayMessageRepository) EnsureIndexes(ctx context.Context) error {
+	collection, err := r.client.Collection(RelayMessageCollectionName)
+	if err != nil {
+		return err
+	}
+
+	_, err = collection.Indexes().CreateMany(ctx, []mongodriver.IndexModel{
+		{
+			Keys: bson.D{{Key: "replica_id", Value: 1}, {Key: "created_at", Value: 1}},
+		},
+		{
+			Keys:    bson.D{{Key: "created_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(int32(relayMessageTTL.Seconds())),
+		},
+	})
+	return errors.Wrap(err, "failed to create relay message indexes")
+}
+
+// Create stores a message for delivery
+func (r *RelayMessageRepository) Create(ctx context.Context, message *models.RelayMessage) error {
+	return errors.Wrap(r.repo.Create(ctx, message), "failed to create relay message")
+}
+
+// ClaimNext atomically removes and returns the oldest message addressed to
+// the replica, or nil if there is none
+func (r *RelayMessageRepository) ClaimNext(ctx context.Context, replicaID string) (*models.RelayMessage, error) {
+	collection, err := r.client.Collection(RelayMessageCollectionName)
+	if err != nil {
+		return nil, err
+	}
+
+	var message models.RelayMessage
+	err = collection.FindOneAndDelete(ctx,
+		bson.M{"replica_id": replicaID},
+		options.FindOneAndDelete().SetSort(bson.D{{Key: "created_at", Value: 1}}),
+	).Decode(&message)
+	if err != nil {
+		if errors.Is(err, mongodriver.ErrNoDocuments) {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, "failed to claim relay message")
+	}
+	return &message, nil
+}
+
+// ApprovalRepository handles database operations for tool calls waiting for approval
+type ApprovalRepository struct {
+	client *mongo.Client
+	repo   *mongo.BaseRepository[*models.ApprovalRecord]
+}
+
+// NewApprovalRepository creates a new repository for pending approvals
+func NewApprovalRepository(client *mongo.Client) (*ApprovalRepository, error) {
+	if client == nil {
+		return nil, errors.New("MongoDB client is nil")
+	}
+
+	return &ApprovalRepository{
+		client: client,
+		repo:   mongo.NewRepository[*models.ApprovalRecord](client, ApprovalCollectionName),
+	}, nil
+}
+
+// EnsureIndexes creates the unique approval index and the TTL index expiring
+// approvals left behind by a crashed replica
+func (r *ApprovalRepository) EnsureIndexes(ctx context.Context) error {
+	collection, err := r.client.Collection(ApprovalCollectionName)
+	if err != nil {
+		return err
+	}
+
+	_, err = collection.Indexes().CreateMany(ctx, []mongodriver.IndexModel{
+		{
+			Keys:    bson.D{{Key: "approval_id", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys:    bson.D{{Key: "expires_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		},
+	})
+	return errors.Wrap(err, "failed to create approval indexes")
+}
+
+// Create stores a pending approval
+func (r *ApprovalRepository) Create(ctx context.Context, record *models.ApprovalRecord) error {
+	return errors.Wrap(r.repo.Create(ctx, record), "failed to create approval record")
+}
+
+// FindByApprovalID returns the unexpired pending approval, or nil if there is none
+func (r *ApprovalRepository) FindByApprovalID(ctx context.Context, approvalID string) (*models.ApprovalRecord, error) {
+	record, err := r.repo.FindOne(ctx, bson.M{
+		"approval_id": approvalID,
+		"expires_at":  bson.M{"$gt": time.Now()},
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to find approval record")
+	}
+	return record, nil
+}
+
+// FindPending returns every unexpired pending approval, oldest first
+func (r *ApprovalRepository) FindPending(ctx context.Context) ([]*models.ApprovalRecord, error) {
+	records, err := r.repo.Find(ctx,
+		bson.M{"expires_at": bson.M{"$gt": time.Now()}},
+		options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}),
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to find approval records")
+	}
+	return records, nil
+}
+
+// DeleteByApprovalID removes a pending approval
+func (r *ApprovalRepository) DeleteByApprovalID(ctx context.Context, approvalID string) error {
+	_, err := r.repo.DeleteMany(ctx, bson.M{"approval_id": approvalID})
+	return errors.Wrap(err, "failed to delete approval record")
+}
@@ -0,0 +1,172 @@
+package repositories
+
+import (
+	"bytes"
+	"context"
+
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	mongodriver "go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/anyisalin/mcp-openapi-to-mcp-adapter/db/mongo"
+	"github.com/anyisalin/mcp-openapi-to-mcp-adapter/models"
+)
+
+const (
+	SpecCollectionName = "specs"
+	// SpecBucketName is the GridFS bucket holding the content of large specs
+	SpecBucketName = "spec_files"
+)
+
+// InlineSpecLimit is the largest spec content stored in the spec document
+// itself; larger content goes to GridFS, away from the 16 MB document limit
+const InlineSpecLimit = 4 << 20
+
+// SpecRepository handles database operations for uploaded OpenAPI specifications
+type SpecRepository struct {
+	client *mongo.Client
+	repo   *mongo.BaseRepository[*models.Spec]
+}
+
+// NewSpecRepository creates a new repository for uploaded specifications
+func NewSpecRepository(client *mongo.Client) (*SpecRepository, error) {
+	if client == nil {
+		return nil, errors.New("MongoDB client is nil")
+	}
+
+	return &SpecRepository{
+		client: client,
+		repo:   mongo.NewRepository[*models.Spec](client, SpecCollectionName),
+	}, nil
+}
+
+// EnsureIndexes creates the unique index on the content hash of specs
+func (r *SpecRepository) EnsureIndexes(ctx context.Context) error {
+	collection, err := r.client.Collection(SpecCollectionName)
+	if err != nil {
+		return err
+	}
+
+	_, err = collection.Indexes().CreateOne(ctx, mongodriver.IndexModel{
+		Keys:    bson.D{{Key: "hash", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	return errors.Wrap(err, "failed to create spec index")
+}
+
+// Create stores a spec with its content, unless a spec with the same hash
+// already exists, and returns the stored spec
+func (r *SpecRepository) Create(ctx context.Context, spec *models.Spec, content []byte) (*models.Spec, error) {
+	if existing, err := r.FindByHash(ctx, spec.Hash); err != nil || existing != nil {
+		return existing, err
+	}
+
+	if len(content) > InlineSpecLimit {
+		bucket, err := r.bucket()
+		if err != nil {
+			return nil, err
+		}
+		spec.FileID, err = bucket.UploadFromStream(spec.Hash, bytes.NewReader(content))
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to upload spec content")
+		}
+	} else {
+		spec.Content = content
+	}
+
+	err := r.repo.Create(ctx, spec)
+	if mongodriver.IsDuplicateKeyError(err) {
+		// The same content was uploaded concurrently
+		r.deleteFile(spec.FileID)
+		return r.FindByHash(ctx, spec.Hash)
+	}
+	if err != nil {
+		r.deleteFile(spec.FileID)
+		return nil, errors.Wrap(err, "failed to create spec")
+	}
+	return spec, nil
+}
+
+// FindByID returns a spec without its content, or nil if it does not exist
+func (r *SpecRepository) FindByID(ctx context.Context, id string) (*models.Spec, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, nil
+	}
+	spec, err := r.repo.FindOne(ctx, bson.M{"_id": objectID}, options.FindOne().SetProjection(bson.M{"content": 0}))
+	return spec, errors.Wrap(err, "failed to find spec")
+}
+
+// FindByHash returns the spec with the given content hash, or nil if it does not exist
+func (r *SpecRepository) FindByHash(ctx context.Context, hash string) (*models.Spec, error) {
+	spec, err := r.repo.FindOne(ctx, bson.M{"hash": hash}, options.FindOne().SetProjection(bson.M{"content": 0}))
+	return spec, errors.Wrap(err, "failed to find spec")
+}
+
+// Find returns a page of specs without their content, newest first, and the number of specs
+func (r *SpecRepository) Find(ctx context.Context, skip, limit int64) ([]*models.Spec, int64, error) {
+	total, err := r.repo.Count(ctx, bson.M{})
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "failed to count specs")
+	}
+
+	specs, err := r.repo.Find(ctx, bson.M{}, options.Find().
+		SetProjection(bson.M{"content": 0}).
+		SetSort(bson.D{{Key: "created_at", Value: -1}}).
+		SetSkip(skip).
+		SetLimit(limit))
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "failed to find specs")
+	}
+	return specs, total, nil
+}
+
+// Content returns the content of a spec, or nil if the spec does not exist
+func (r *SpecRepository) Content(ctx context.Context, id string) ([]byte, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, nil
+	}
+	spec, err := r.repo.FindOne(ctx, bson.M{"_id": objectID})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to find spec")
+	}
+	if spec == nil {
+		return nil, nil
+	}
+	if spec.FileID.IsZero() {
+		return spec.Content, nil
+	}
+
+	bucket, err := r.bucket()
+	if err != nil {
+		return nil, err
+	}
+	var content bytes.Buffer
+	if _, err := bucket.DownloadToStream(spec.FileID, &content); err != nil {
+		return nil, errors.Wrap(err, "failed to download spec content")
+	}
+	return content.Bytes(), nil
+}
+
+// bucket returns the GridFS bucket of spec content
+func (r *SpecRepository) bucket() (*gridfs.Bucket, error) {
+	db, err := r.client.Database()
+	if err != nil {
+		return nil, err
+	}
+	return gridfs.NewBucket(db, options.GridFSBucket().SetName(SpecBucketName))
+}
+
+// deleteFile removes the GridFS file of a spec that could not be stored
+func (r *SpecRepository) deleteFile(id primitive.ObjectID) {
+	if id.IsZero() {
+		return
+	}
+	if bucket, err := r.bucket(); err == nil {
+		bucket.Delete(id)
+	}
+}
@@ -2,23 +2,55 @@ package repositories
 
 import (
 	"context"
+	"regexp"
+	"time"
 
 	"github.com/anyisalin/mcp-openapi-to-mcp-adapter/db/mongo"
 	"github.com/anyisalin/mcp-openapi-to-mcp-adapter/models"
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 const SSEConfigCollectionName = "sse_configs"
 
+// SSEConfigSortFields maps the sort keys of the listing API to document fields
+var SSEConfigSortFields = map[string]string{
+	"createdAt": "created_at",
+	"updatedAt": "updated_at",
+	"baseURL":   "base_url",
+	"schemaURL": "schema_url",
+}
+
+// SSEConfigFilter selects SSE configurations; zero fields match every configuration
+type SSEConfigFilter struct {
+	APIServerConfigID string
+	BaseURLHost       string // Host of the base URL, without port
+	Search            string // Case-insensitive text in the schema or base URL
+	CreatedFrom       time.Time
+	CreatedTo         time.Time
+	UpdatedFrom       time.Time
+	UpdatedTo         time.Time
+}
+
+// SSEConfigSort orders a listing by one of SSEConfigSortFields
+type SSEConfigSort struct {
+	Field      string
+	Descending bool
+}
+
 // SSEConfigRepository handles database operations for SSE configurations
 type SSEConfigRepository struct {
-	repo *mongo.BaseRepository[*models.SSEConfig]
+	client *mongo.Client
+	repo   *mongo.BaseRepository[*models.SSEConfig]
 }
 
 // NewSSEConfigRepository creates a new repository for SSE configurations
 func NewSSEConfigRepository(client *mongo.Client) (*SSEConfigRepository, error) {
 	repo := &SSEConfigRepository{
-		repo: mongo.NewRepository[*models.SSEConfig](client, SSEConfigCollectionName),
+		client: client,
+		repo:   mongo.NewRepository[*models.SSEConfig](client, SSEConfigCollectionName),
 	}
 	return repo, nil
 }
@@ -46,7 +78,14 @@ func (r *SSEConfigRepository) FindOne(ctx context.Context, filter interface{}) (
 	return r.repo.FindOne(ctx, filter)
 }
 
-// Update updates an existing SSE configuration
+// FindAll retrieves all SSE configurations
+func (r *SSEConfigRepository) FindAll(ctx context.Context) ([]*models.SSEConfig, error) {
+	return r.repo.Find(ctx, bson.M{})
+}
+
+// Update replaces an SSE configuration if it still has the version of config,
+// and increments the version of config. It returns ErrVersionConflict if the
+// configuration was changed or deleted since config was read.
 func (r *SSEConfigRepository) Update(ctx context.Context, id string, config *models.SSEConfig) error {
 	// Convert string ID to ObjectID
 	objID, err := primitive.ObjectIDFromHex(id)
@@ -59,12 +98,121 @@ func (r *SSEConfigRepository) Update(ctx context.Context, id string, config *mod
 	
 	// Call before update hook
 	config.BeforeUpdate()
-	
-	// Update the document
-	return r.repo.Update(ctx, config)
+
+	collection, err := r.client.Collection(SSEConfigCollectionName)
+	if err != nil {
+		return err
+	}
+
+	// Update the document, unless another update came first
+	expected := config.Version
+	config.Version++
+	if err := replaceVersion(ctx, collection, objID, expected, config); err != nil {
+		config.Version = expected
+		return err
+	}
+	return nil
+}
+
+// SetRefreshToken replaces the stored refresh token of the upstream auth of a
+// configuration, if it is still expected. The version is kept: the token was
+// rotated by the server, and must not make edits of administrators conflict.
+// It reports whether the token was replaced.
+func (r *SSEConfigRepository) SetRefreshToken(ctx context.Context, id, expected, refreshToken string) (bool, error) {
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return false, err
+	}
+
+	collection, err := r.client.Collection(SSEConfigCollectionName)
+	if err != nil {
+		return false, err
+	}
+
+	result, err := collection.UpdateOne(ctx,
+		bson.M{"_id": objID, "upstream_auth.refresh_token": expected},
+		bson.M{"$set": bson.M{"upstream_auth.refresh_token": refreshToken, "updated_at": time.Now()}},
+	)
+	if err != nil {
+		return false, errors.Wrap(err, "failed to update refresh token")
+	}
+	return result.MatchedCount > 0, nil
 }
 
 // Delete removes an SSE configuration from the database
 func (r *SSEConfigRepository) Delete(ctx context.Context, id string) error {
 	return r.repo.Delete(ctx, id)
-} 
\ No newline at end of file
+} 
+
+// List returns a page of the configurations matching the filter, in the
+// given order, and the number of matching configurations
+func (r *SSEConfigRepository) List(ctx context.Context, filter SSEConfigFilter, sort SSEConfigSort, skip, limit int64) ([]*models.SSEConfig, int64, error) {
+	field, ok := SSEConfigSortFields[sort.Field]
+	if !ok {
+		return nil, 0, errors.Errorf("unknown sort field %q", sort.Field)
+	}
+	direction := 1
+	if sort.Descending {
+		direction = -1
+	}
+
+	query := filter.query()
+	total, err := r.repo.Count(ctx, query)
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "failed to count SSE configurations")
+	}
+
+	configs, err := r.repo.Find(ctx, query, options.Find().
+		SetSort(bson.D{{Key: field, Value: direction}, {Key: "_id", Value: direction}}).
+		SetSkip(skip).
+		SetLimit(limit))
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "failed to find SSE configurations")
+	}
+	return configs, total, nil
+}
+
+// query returns the MongoDB filter of the configuration filter
+func (f SSEConfigFilter) query() bson.M {
+	query := bson.M{}
+	if f.APIServerConfigID != "" {
+		query["api_server_config_id"] = f.APIServerConfigID
+	}
+	if f.BaseURLHost != "" {
+		// Match the host exactly, with any scheme, port, path or credentials
+		query["base_url"] = primitive.Regex{
+			Pattern: `^[a-z][a-z0-9+.-]*://([^/?#]*@)?` + regexp.QuoteMeta(f.BaseURLHost) + `(:[0-9]*)?([/?#]|$)`,
+			Options: "i",
+		}
+	}
+	if f.Search != "" {
+		search := primitive.Regex{Pattern: regexp.QuoteMeta(f.Search), Options: "i"}
+		query["$or"] = bson.A{
+			bson.M{"schema_url": search},
+			bson.M{"base_url": search},
+		}
+	}
+	if createdAt := timeRange(f.CreatedFrom, f.CreatedTo); createdAt != nil {
+		query["created_at"] = createdAt
+	}
+	if updatedAt := timeRange(f.UpdatedFrom, f.UpdatedTo); updatedAt != nil {
+		query["updated_at"] = updatedAt
+	}
+	return query
+}
+
+// timeRange returns the filter of times at or after from and before to, or
+// nil if both are zero
+func timeRange(from, to time.Time) bson.M {
+	timeRange := bson.M{}
+	if !from.IsZero() {
+		timeRange["$gte"] = from
+	}
+	if !to.IsZero() {
+		timeRange["$lt"] = to
+	}
+	if len(timeRange) == 0 {
+		return nil
+	}
+	return timeRange
+}
@@ -0,0 +1,29 @@
+package repositories
+
+import (
+	"regexp"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestSSEConfigFilterMatchesBaseURLHost(t *testing.T) {
+	pattern := SSEConfigFilter{BaseURLHost: "api.example.com"}.query()["base_url"].(primitive.Regex)
+	re := regexp.MustCompile("(?" + pattern.Options + ")" + pattern.Pattern)
+
+	tests := map[string]bool{
+		"https://api.example.com":             true,
+		"https://API.example.com/v1":          true,
+		"http://api.example.com:8080/v1":      true,
+		"https://user:pw@api.example.com?x=1": true,
+		"https://api.example.com.evil.io":     false,
+		"https://apixexample.com":             false,
+		"https://evil.io/api.example.com":     false,
+		"https://other.api.example.com":       false,
+	}
+	for baseURL, match := range tests {
+		if re.MatchString(baseURL) != match {
+			t.Errorf("base URL %s: match %v, want %v", baseURL, !match, match)
+		}
+	}
+}
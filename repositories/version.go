@@ -0,0 +1,33 @@
+package repositories
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	mongodriver "go.mongodb.org/mongo-driver/mongo"
+)
+
+// ErrVersionConflict is returned when a document was changed or deleted
+// since the version being updated was read
+var ErrVersionConflict = errors.New("version conflict")
+
+// replaceVersion replaces the document with the given ID if it still has
+// the expected version. Documents stored before versions were introduced
+// have no version field and match version 0.
+func replaceVersion(ctx context.Context, collection *mongodriver.Collection, id primitive.ObjectID, expected int64, document interface{}) error {
+	filter := bson.M{"_id": id, "version": expected}
+	if expected == 0 {
+		filter["version"] = bson.M{"$in": bson.A{0, nil}}
+	}
+
+	result, err := collection.ReplaceOne(ctx, filter, document)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrVersionConflict
+	}
+	return nil
+}
@@ -11,13 +11,23 @@ import (
 type Router struct {
 	sseConfigController       *controllers.SSEConfigController
 	apiServerConfigController *controllers.APIServerConfigController
+	sessionController         *controllers.SessionController
+	auditController           *controllers.AuditController
+	approvalController        *controllers.ApprovalController
+	specController            *controllers.SpecController
+	toolController            *controllers.ToolController
 }
 
 // NewRouter creates a new router instance
-func NewRouter(sseConfigController *controllers.SSEConfigController, apiServerConfigController *controllers.APIServerConfigController) *Router {
+func NewRouter(sseConfigController *controllers.SSEConfigController, apiServerConfigController *controllers.APIServerConfigController, sessionController *controllers.SessionController, auditController *controllers.AuditController, approvalController *controllers.ApprovalController, specController *controllers.SpecController, toolController *controllers.ToolController) *Router {
 	return &Router{
 		sseConfigController:       sseConfigController,
 		apiServerConfigController: apiServerConfigController,
+		sessionController:         sessionController,
+		auditController:           auditController,
+		approvalController:        approvalController,
+		specController:            specController,
+		toolController:            toolController,
 	}
 }
 
@@ -27,8 +37,9 @@ func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 
 	// Set CORS headers for all responses
 	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, If-Match")
+	w.Header().Set("Access-Control-Expose-Headers", "ETag")
 
 	// Handle OPTIONS (preflight) requests
 	if req.Method == http.MethodOptions {
@@ -43,8 +54,7 @@ func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 			r.sseConfigController.CreateConfig(w, req)
 			return
 		case http.MethodGet:
-			// List configs - could be added later
-			http.Error(w, "Not implemented", http.StatusNotImplemented)
+			r.sseConfigController.ListConfigs(w, req)
 			return
 		default:
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -52,6 +62,37 @@ func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 		}
 	}
 
+	// Routes for the tools of a configuration
+	if strings.HasPrefix(path, "/api/v1/config/") && strings.HasSuffix(path, "/tools") {
+		r.toolController.ListConfigTools(w, req)
+		return
+	}
+	if strings.HasPrefix(path, "/api/v1/config/") && strings.Contains(path, "/tools/") && strings.HasSuffix(path, "/invoke") {
+		r.toolController.InvokeTool(w, req)
+		return
+	}
+
+	// Routes for the tools of ad-hoc SSE parameters
+	if path == "/api/v1/tools" {
+		r.toolController.ListTools(w, req)
+		return
+	}
+
+	// Routes for the revision history of a configuration
+	if strings.HasPrefix(path, "/api/v1/config/") && strings.Contains(path, "/revisions") {
+		switch {
+		case req.Method == http.MethodGet && strings.HasSuffix(path, "/revisions"):
+			r.sseConfigController.ListConfigRevisions(w, req)
+		case req.Method == http.MethodGet:
+			r.sseConfigController.GetConfigRevision(w, req)
+		case req.Method == http.MethodPost && strings.HasSuffix(path, "/rollback"):
+			r.sseConfigController.RollbackConfig(w, req)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+		return
+	}
+
 	// Routes for specific configuration
 	if strings.HasPrefix(path, "/api/v1/config/") && len(path) > 12 {
 		switch req.Method {
@@ -61,6 +102,9 @@ func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 		case http.MethodPut:
 			r.sseConfigController.UpdateConfig(w, req)
 			return
+		case http.MethodPatch:
+			r.sseConfigController.PatchConfig(w, req)
+			return
 		case http.MethodDelete:
 			r.sseConfigController.DeleteConfig(w, req)
 			return
@@ -91,6 +135,21 @@ func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 		}
 	}
 
+	// Routes for the revision history of an API server configuration
+	if strings.HasPrefix(path, "/api/v1/api-server/config/") && strings.Contains(path, "/revisions") {
+		switch {
+		case req.Method == http.MethodGet && strings.HasSuffix(path, "/revisions"):
+			r.apiServerConfigController.ListAPIServerConfigRevisions(w, req)
+		case req.Method == http.MethodGet:
+			r.apiServerConfigController.GetAPIServerConfigRevision(w, req)
+		case req.Method == http.MethodPost && strings.HasSuffix(path, "/rollback"):
+			r.apiServerConfigController.RollbackAPIServerConfig(w, req)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+		return
+	}
+
 	// Routes for specific API server configuration
 	if strings.HasPrefix(path, "/api/v1/api-server/config/") && len(path) > 19 {
 		switch req.Method {
@@ -100,6 +159,9 @@ func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 		case http.MethodPut:
 			r.apiServerConfigController.UpdateAPIServerConfig(w, req)
 			return
+		case http.MethodPatch:
+			r.apiServerConfigController.PatchAPIServerConfig(w, req)
+			return
 		case http.MethodDelete:
 			r.apiServerConfigController.DeleteAPIServerConfig(w, req)
 			return
@@ -109,6 +171,82 @@ func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 		}
 	}
 
+	// Routes for active SSE sessions
+	if path == "/api/v1/sessions" {
+		switch req.Method {
+		case http.MethodGet:
+			r.sessionController.ListSessions(w, req)
+			return
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+	}
+
+	// Routes for the audit log of tool calls, only when auditing is enabled
+	if path == "/api/v1/audit" && r.auditController != nil {
+		switch req.Method {
+		case http.MethodGet:
+			r.auditController.ListAuditRecords(w, req)
+			return
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+	}
+
+	// Routes for uploaded OpenAPI specifications
+	if path == "/api/v1/specs" {
+		switch req.Method {
+		case http.MethodPost:
+			r.specController.UploadSpec(w, req)
+			return
+		case http.MethodGet:
+			r.specController.ListSpecs(w, req)
+			return
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+	}
+
+	// Routes for a specific spec and its content
+	if strings.HasPrefix(path, "/api/v1/specs/") && len(path) > len("/api/v1/specs/") {
+		switch {
+		case req.Method == http.MethodGet && strings.HasSuffix(path, "/content"):
+			r.specController.GetSpecContent(w, req)
+		case req.Method == http.MethodGet:
+			r.specController.GetSpec(w, req)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+		return
+	}
+
+	// Routes for tool calls waiting for approval
+	if path == "/api/v1/approvals" {
+		switch req.Method {
+		case http.MethodGet:
+			r.approvalController.ListApprovals(w, req)
+			return
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+	}
+
+	// Routes for approving or denying a specific call
+	if strings.HasPrefix(path, "/api/v1/approvals/") && len(path) > len("/api/v1/approvals/") {
+		switch req.Method {
+		case http.MethodPost:
+			r.approvalController.ResolveApproval(w, req)
+			return
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+	}
+
 	// If no routes match, return 404
 	http.NotFound(w, req)
 }
@@ -0,0 +1,222 @@
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// encryptedPrefix marks a value encrypted by a Keyring
+const encryptedPrefix = "enc:v1:"
+
+// Keyring encrypts secret values with envelope encryption. Each value is
+// encrypted with its own random data key, and the data key is encrypted with
+// the primary key encryption key. Older keys are kept to decrypt values
+// written before a rotation.
+type Keyring struct {
+	primary string
+	keys    map[string][]byte // Key ID -> 256-bit key encryption key
+}
+
+// keyringFile is the format of the key file
+type keyringFile struct {
+	Primary string            `yaml:"primary"`
+	Keys    map[string]string `yaml:"keys"` // Key ID -> base64 encoded 32-byte key
+}
+
+// NewKeyring creates a keyring encrypting with the primary key
+func NewKeyring(primary string, keys map[string][]byte) (*Keyring, error) {
+	if _, ok := keys[primary]; !ok {
+		return nil, fmt.Errorf("primary key %q not found", primary)
+	}
+	for id, key := range keys {
+		if id == "" || strings.Contains(id, ":") {
+			return nil, fmt.Errorf("invalid key ID %q", id)
+		}
+		if len(key) != 32 {
+			return nil, fmt.Errorf("key %q must be 32 bytes, got %d", id, len(key))
+		}
+	}
+	return &Keyring{primary: primary, keys: keys}, nil
+}
+
+// LoadKeyFile reads a keyring from a YAML or JSON file:
+//
+//	primary: k2
+//	keys:
+//	  k1: <base64 32-byte key>
+//	  k2: <base64 32-byte key>
+func LoadKeyFile(path string) (*Keyring, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key file: %w", err)
+	}
+
+	var file keyringFile
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse key file: %w", err)
+	}
+
+	keys := map[string][]byte{}
+	for id, encoded := range file.Keys {
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("key %q is not valid base64: %w", id, err)
+		}
+		keys[id] = key
+	}
+	return NewKeyring(file.Primary, keys)
+}
+
+// ParseKeys parses a keyring from "id:base64key[,id:base64key...]", the
+// format of the key environment variable. The first key is the primary key.
+func ParseKeys(spec string) (*Keyring, error) {
+	keys := map[string][]byte{}
+	primary := ""
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		id, encoded, ok := strings.Cut(entry, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid key entry, expected id:base64key")
+		}
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("key %q is not valid base64: %w", id, err)
+		}
+		if primary == "" {
+			primary = id
+		}
+		keys[id] = key
+	}
+	if primary == "" {
+		return nil, errors.New("no keys given")
+	}
+	return NewKeyring(primary, keys)
+}
+
+// IsEncrypted reports whether the value was encrypted by a Keyring
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, encryptedPrefix)
+}
+
+// Encrypt encrypts the value under the primary key. The result has the form
+// "enc:v1:<key id>:<encrypted data key>:<encrypted value>".
+func (k *Keyring) Encrypt(plaintext string) (string, error) {
+	dataKey := make([]byte, 32)
+	if _, err := rand.Read(dataKey); err != nil {
+		return "", err
+	}
+
+	wrappedKey, err := seal(k.keys[k.primary], dataKey)
+	if err != nil {
+		return "", err
+	}
+	ciphertext, err := seal(dataKey, []byte(plaintext))
+	if err != nil {
+		return "", err
+	}
+
+	return encryptedPrefix + k.primary + ":" +
+		base64.RawStdEncoding.EncodeToString(wrappedKey) + ":" +
+		base64.RawStdEncoding.EncodeToString(ciphertext), nil
+}
+
+// Decrypt decrypts a value produced by Encrypt with any key of the keyring
+func (k *Keyring) Decrypt(value string) (string, error) {
+	keyID, wrappedKey, ciphertext, err := splitEncrypted(value)
+	if err != nil {
+		return "", err
+	}
+
+	kek, ok := k.keys[keyID]
+	if !ok {
+		return "", fmt.Errorf("unknown key %q", keyID)
+	}
+	dataKey, err := open(kek, wrappedKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt data key: %w", err)
+	}
+	plaintext, err := open(dataKey, ciphertext)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt value: %w", err)
+	}
+	return string(plaintext), nil
+}
+
+// NeedsRotation reports whether the encrypted value uses a key other than the primary key
+func (k *Keyring) NeedsRotation(value string) bool {
+	keyID, _, _, err := splitEncrypted(value)
+	return err == nil && keyID != k.primary
+}
+
+// Rotate re-encrypts the value under the primary key
+func (k *Keyring) Rotate(value string) (string, error) {
+	plaintext, err := k.Decrypt(value)
+	if err != nil {
+		return "", err
+	}
+	return k.Encrypt(plaintext)
+}
+
+// splitEncrypted splits an encrypted value into its parts
+func splitEncrypted(value string) (string, []byte, []byte, error) {
+	if !IsEncrypted(value) {
+		return "", nil, nil, errors.New("value is not encrypted")
+	}
+	parts := strings.Split(strings.TrimPrefix(value, encryptedPrefix), ":")
+	if len(parts) != 3 {
+		return "", nil, nil, errors.New("malformed encrypted value")
+	}
+	wrappedKey, err := base64.RawStdEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", nil, nil, errors.New("malformed encrypted value")
+	}
+	ciphertext, err := base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", nil, nil, errors.New("malformed encrypted value")
+	}
+	return parts[0], wrappedKey, ciphertext, nil
+}
+
+// seal encrypts with AES-256-GCM, prepending the nonce
+func seal(key, plaintext []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+// open decrypts data produced by seal
+func open(key, data []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < gcm.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	return gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,130 @@
+package secrets
+
+import (
+	"encoding/base64"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func testKey(b byte) string {
+	return base64.StdEncoding.EncodeToString([]byte(strings.Repeat(string(b), 32)))
+}
+
+func TestKeyringRotation(t *testing.T) {
+	old, err := ParseKeys("k1:" + testKey('a'))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed, err := old.Encrypt("Bearer secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsEncrypted(sealed) || strings.Contains(sealed, "secret") {
+		t.Fatalf("value not encrypted: %s", sealed)
+	}
+
+	// k2 becomes primary, k1 is kept to decrypt existing values
+	rotated, err := ParseKeys("k2:" + testKey('b') + ",k1:" + testKey('a'))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !rotated.NeedsRotation(sealed) {
+		t.Fatal("value under the old key should need rotation")
+	}
+	resealed, err := rotated.Rotate(sealed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rotated.NeedsRotation(resealed) {
+		t.Fatal("rotated value should use the primary key")
+	}
+
+	current, err := ParseKeys("k2:" + testKey('b'))
+	if err != nil {
+		t.Fatal(err)
+	}
+	plaintext, err := current.Decrypt(resealed)
+	if err != nil || plaintext != "Bearer secret" {
+		t.Fatalf("Decrypt = %q, %v", plaintext, err)
+	}
+	if _, err := current.Decrypt(sealed); err == nil {
+		t.Fatal("value under a removed key should not decrypt")
+	}
+}
+
+func TestSealAndResolve(t *testing.T) {
+	keyring, err := ParseKeys("k1:" + testKey('a'))
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetDefault(keyring)
+	defer SetDefault(nil)
+	SetReferences(References{EnvPrefix: "UPSTREAM_"})
+	defer SetReferences(References{})
+	t.Setenv("UPSTREAM_TOKEN", "from-env")
+
+	values, err := SealMap(map[string]string{
+		"Authorization": "Bearer secret",
+		"X-Api-Key":     "env:UPSTREAM_TOKEN",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsEncrypted(values["Authorization"]) || values["X-Api-Key"] != "env:UPSTREAM_TOKEN" {
+		t.Fatalf("unexpected sealed values: %v", values)
+	}
+
+	masked := MaskMap(values)
+	if masked["Authorization"] != MaskedValue || masked["X-Api-Key"] != "env:UPSTREAM_TOKEN" {
+		t.Fatalf("unexpected masked values: %v", masked)
+	}
+
+	resolved, err := ResolveMap(values)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resolved["Authorization"] != "Bearer secret" || resolved["X-Api-Key"] != "from-env" {
+		t.Fatalf("unexpected resolved values: %v", resolved)
+	}
+}
+
+func TestResolveLimitsReferences(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "token"), []byte("from-file\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	outside := filepath.Join(t.TempDir(), "secret")
+	if err := os.WriteFile(outside, []byte("secret"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(outside, filepath.Join(dir, "link")); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("MCP_LINK_SECRET_TOKEN", "from-env")
+	t.Setenv("MONGO_URI", "mongodb://user:pass@db")
+
+	// Both kinds of reference are disabled by default
+	for _, value := range []string{"env:MCP_LINK_SECRET_TOKEN", "file:" + filepath.Join(dir, "token")} {
+		if _, err := Resolve(value); !errors.Is(err, ErrReferenceDenied) {
+			t.Errorf("Resolve(%s) not denied: %v", value, err)
+		}
+	}
+
+	SetReferences(References{EnvPrefix: "MCP_LINK_SECRET_", FileDir: dir})
+	defer SetReferences(References{})
+
+	if value, err := Resolve("env:MCP_LINK_SECRET_TOKEN"); err != nil || value != "from-env" {
+		t.Fatalf("env reference not resolved: %q, %v", value, err)
+	}
+	if value, err := Resolve("file:token"); err != nil || value != "from-file" {
+		t.Fatalf("file reference not resolved: %q, %v", value, err)
+	}
+	for _, value := range []string{"env:MONGO_URI", "file:" + outside, "file:/proc/self/environ", "file:" + filepath.Join(dir, "link")} {
+		if _, err := Resolve(value); !errors.Is(err, ErrReferenceDenied) {
+			t.Errorf("Resolve(%s) not denied: %v", value, err)
+		}
+	}
+}
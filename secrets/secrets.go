@@ -0,0 +1,202 @@
+package secrets
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Prefixes of secret references, resolved when a session connects instead of being stored
+const (
+	envRefPrefix  = "env:"
+	fileRefPrefix = "file:"
+)
+
+// MaskedValue replaces secret values in API responses and logs
+const MaskedValue = "********"
+
+// ErrReferenceDenied is returned when a reference is outside what References allows
+var ErrReferenceDenied = errors.New("secret reference denied")
+
+// References limits what env: and file: references may read, since anyone
+// able to store a configuration chooses both the reference and the upstream
+// the resolved value is sent to
+type References struct {
+	EnvPrefix string // Environment variables must start with this prefix; empty disables env: references
+	FileDir   string // Files must be inside this directory; empty disables file: references
+}
+
+var (
+	defaultKeyring *Keyring
+	references     References
+	keyringMu      sync.RWMutex
+)
+
+// SetReferences sets what env: and file: references may read. Both are
+// disabled until it is called.
+func SetReferences(r References) {
+	keyringMu.Lock()
+	defer keyringMu.Unlock()
+	references = r
+}
+
+// currentReferences returns the reference limits
+func currentReferences() References {
+	keyringMu.RLock()
+	defer keyringMu.RUnlock()
+	return references
+}
+
+// SetDefault sets the keyring used by Seal and Resolve. A nil keyring stores
+// values in plaintext.
+func SetDefault(k *Keyring) {
+	keyringMu.Lock()
+	defer keyringMu.Unlock()
+	defaultKeyring = k
+}
+
+// Default returns the default keyring, or nil if encryption is not configured
+func Default() *Keyring {
+	keyringMu.RLock()
+	defer keyringMu.RUnlock()
+	return defaultKeyring
+}
+
+// IsReference reports whether the value refers to a secret held elsewhere
+func IsReference(value string) bool {
+	return strings.HasPrefix(value, envRefPrefix) || strings.HasPrefix(value, fileRefPrefix)
+}
+
+// Seal prepares a secret value for storage. References and already encrypted
+// values are kept; other values are encrypted with the default keyring, if any.
+func Seal(value string) (string, error) {
+	if value == "" || IsReference(value) || IsEncrypted(value) {
+		return value, nil
+	}
+	k := Default()
+	if k == nil {
+		return value, nil
+	}
+	return k.Encrypt(value)
+}
+
+// Resolve returns the plaintext of a stored secret value: encrypted values are
+// decrypted, env: references read from the environment and file: references
+// read from the file, within the limits set by SetReferences. Other values are
+// returned as is.
+func Resolve(value string) (string, error) {
+	switch {
+	case IsEncrypted(value):
+		k := Default()
+		if k == nil {
+			return "", errors.New("value is encrypted but no secret key is configured")
+		}
+		return k.Decrypt(value)
+	case strings.HasPrefix(value, envRefPrefix):
+		return resolveEnv(strings.TrimPrefix(value, envRefPrefix))
+	case strings.HasPrefix(value, fileRefPrefix):
+		return resolveFile(strings.TrimPrefix(value, fileRefPrefix))
+	default:
+		return value, nil
+	}
+}
+
+// resolveEnv reads an environment variable carrying the reference prefix
+func resolveEnv(name string) (string, error) {
+	prefix := currentReferences().EnvPrefix
+	if prefix == "" {
+		return "", fmt.Errorf("%w: env: references are disabled", ErrReferenceDenied)
+	}
+	if !strings.HasPrefix(name, prefix) {
+		return "", fmt.Errorf("%w: environment variable %s does not start with %s", ErrReferenceDenied, name, prefix)
+	}
+	resolved, ok := os.LookupEnv(name)
+	if !ok {
+		return "", fmt.Errorf("environment variable %s is not set", name)
+	}
+	return resolved, nil
+}
+
+// resolveFile reads a file inside the secrets directory, after symbolic links
+// are resolved
+func resolveFile(path string) (string, error) {
+	fileDir := currentReferences().FileDir
+	if fileDir == "" {
+		return "", fmt.Errorf("%w: file: references are disabled", ErrReferenceDenied)
+	}
+
+	dir, err := filepath.EvalSymlinks(fileDir)
+	if err != nil {
+		return "", fmt.Errorf("secrets directory: %w", err)
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(dir, path)
+	}
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read secret file: %w", err)
+	}
+	if rel, err := filepath.Rel(dir, resolved); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%w: %s is outside the secrets directory", ErrReferenceDenied, path)
+	}
+	data, err := os.ReadFile(resolved)
+	if err != nil {
+		return "", fmt.Errorf("failed to read secret file: %w", err)
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// Mask hides a secret value. References are shown since they hold no secret.
+func Mask(value string) string {
+	if value == "" || IsReference(value) {
+		return value
+	}
+	return MaskedValue
+}
+
+// MaskMap returns a copy of the map with every value masked
+func MaskMap(values map[string]string) map[string]string {
+	if values == nil {
+		return nil
+	}
+	masked := make(map[string]string, len(values))
+	for key, value := range values {
+		masked[key] = Mask(value)
+	}
+	return masked
+}
+
+// SealMap seals every value of the map, returning a new map
+func SealMap(values map[string]string) (map[string]string, error) {
+	if values == nil {
+		return nil, nil
+	}
+	sealed := make(map[string]string, len(values))
+	for key, value := range values {
+		s, err := Seal(value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encrypt %s: %w", key, err)
+		}
+		sealed[key] = s
+	}
+	return sealed, nil
+}
+
+// ResolveMap resolves every value of the map, returning a new map
+func ResolveMap(values map[string]string) (map[string]string, error) {
+	if values == nil {
+		return nil, nil
+	}
+	resolved := make(map[string]string, len(values))
+	for key, value := range values {
+		r, err := Resolve(value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve %s: %w", key, err)
+		}
+		resolved[key] = r
+	}
+	return resolved, nil
+}
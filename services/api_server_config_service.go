@@ -1,13 +1,17 @@
 package services
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"fmt"
 	"github.com/pkg/errors"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"net/url"
 
 	"github.com/anyisalin/mcp-openapi-to-mcp-adapter/models"
 	"github.com/anyisalin/mcp-openapi-to-mcp-adapter/repositories"
+	"github.com/anyisalin/mcp-openapi-to-mcp-adapter/utils"
 )
 
 // APIServerConfigService 是 API 服务器配置的服务接口
@@ -15,19 +19,25 @@ type APIServerConfigService interface {
 	CreateAPIServerConfig(ctx context.Context, name, description, schemaURL, baseURL string) (*models.APIServerConfig, error)
 	GetAPIServerConfigByID(ctx context.Context, id string) (*models.APIServerConfig, error)
 	GetAllAPIServerConfigs(ctx context.Context) ([]*models.APIServerConfig, error)
-	UpdateAPIServerConfig(ctx context.Context, id, name, description, schemaURL, baseURL string) (*models.APIServerConfig, error)
+	UpdateAPIServerConfig(ctx context.Context, id string, version int64, name, description, schemaURL, baseURL string) (*models.APIServerConfig, error)
+	PatchAPIServerConfig(ctx context.Context, id string, version int64, patch []byte) (*models.APIServerConfig, error)
 	DeleteAPIServerConfig(ctx context.Context, id string) error
+	GetAPIServerConfigRevisions(ctx context.Context, id string, page, pageSize int) ([]*models.ConfigRevision, int64, error)
+	GetAPIServerConfigRevision(ctx context.Context, id string, revision int) (*models.ConfigRevision, error)
+	RollbackAPIServerConfig(ctx context.Context, id string, revision int) (*models.APIServerConfig, error)
 }
 
 // DefaultAPIServerConfigService 是 API 服务器配置服务的默认实现
 type DefaultAPIServerConfigService struct {
-	repo repositories.APIServerConfigRepository
+	repo      repositories.APIServerConfigRepository
+	revisions *ConfigRevisionService // 记录修订历史，可为空
 }
 
-// NewAPIServerConfigService 创建一个新的 API 服务器配置服务
-func NewAPIServerConfigService(repo repositories.APIServerConfigRepository) APIServerConfigService {
+// NewAPIServerConfigService 创建一个新的 API 服务器配置服务，每次变更都会记录到修订历史
+func NewAPIServerConfigService(repo repositories.APIServerConfigRepository, revisions *ConfigRevisionService) APIServerConfigService {
 	return &DefaultAPIServerConfigService{
-		repo: repo,
+		repo:      repo,
+		revisions: revisions,
 	}
 }
 
@@ -72,7 +82,19 @@ func (s *DefaultAPIServerConfigService) CreateAPIServerConfig(ctx context.Contex
 	// 调用前置钩子
 	config.BeforeInsert()
 
-	return s.repo.Create(ctx, config)
+	created, err := s.repo.Create(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+
+	// 记录创建修订
+	err = s.revisions.record(ctx, revisionChange{
+		kind:     models.ConfigKindAPIServer,
+		configID: created.ID.Hex(),
+		action:   models.RevisionActionCreate,
+		after:    apiServerConfigSnapshot{created},
+	})
+	return created, errors.Wrap(err, "config created, but its revision was not recorded")
 }
 
 // GetAPIServerConfigByID 通过 ID 获取 API 服务器配置
@@ -89,32 +111,144 @@ func (s *DefaultAPIServerConfigService) GetAllAPIServerConfigs(ctx context.Conte
 	return s.repo.GetAll(ctx)
 }
 
-// UpdateAPIServerConfig 更新 API 服务器配置
-func (s *DefaultAPIServerConfigService) UpdateAPIServerConfig(ctx context.Context, id, name, description, schemaURL, baseURL string) (*models.APIServerConfig, error) {
+// UpdateAPIServerConfig 更新 API 服务器配置，要求配置仍为预期版本（AnyVersion 不检查版本）
+func (s *DefaultAPIServerConfigService) UpdateAPIServerConfig(ctx context.Context, id string, version int64, name, description, schemaURL, baseURL string) (*models.APIServerConfig, error) {
+	if err := validateURLs(schemaURL, baseURL); err != nil {
+		return nil, err
+	}
+
+	// 获取当前配置
+	config, err := s.findVersion(ctx, id, version)
+	if err != nil {
+		return nil, err
+	}
+
+	// 更新配置
+	before := *config
+	config.Update(name, description, schemaURL, baseURL)
+	// 调用前置钩子
+	config.BeforeUpdate()
+
+	updated, err := s.repo.Update(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+	return updated, s.recordRevision(ctx, id, models.RevisionActionUpdate, 0, &before, updated)
+}
+
+// PatchAPIServerConfig 以 JSON Merge Patch (RFC 7396) 更新 API 服务器配置，
+// 要求配置仍为预期版本（AnyVersion 不检查版本）。无效的补丁返回 ErrInvalidPatch
+func (s *DefaultAPIServerConfigService) PatchAPIServerConfig(ctx context.Context, id string, version int64, patch []byte) (*models.APIServerConfig, error) {
+	config, err := s.findVersion(ctx, id, version)
+	if err != nil {
+		return nil, err
+	}
+	before := *config
+
+	document, err := json.Marshal(config)
+	if err != nil {
+		return nil, err
+	}
+	merged, err := utils.MergePatch(document, patch)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPatch, err)
+	}
+	var patched models.APIServerConfig
+	decoder := json.NewDecoder(bytes.NewReader(merged))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&patched); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPatch, err)
+	}
+
+	// ID、时间和版本不可修改
+	patched.ID, patched.CreatedAt, patched.Version = config.ID, config.CreatedAt, config.Version
+	if patched.Name == "" || patched.SchemaURL == "" || patched.BaseURL == "" {
+		return nil, fmt.Errorf("%w: name, schemaUrl and baseUrl are required", ErrInvalidPatch)
+	}
+	if err := validateURLs(patched.SchemaURL, patched.BaseURL); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPatch, err)
+	}
+	patched.BeforeUpdate()
+
+	updated, err := s.repo.Update(ctx, &patched)
+	if err != nil {
+		return nil, err
+	}
+	return updated, s.recordRevision(ctx, id, models.RevisionActionUpdate, 0, &before, updated)
+}
+
+// findVersion 获取配置并检查其版本
+func (s *DefaultAPIServerConfigService) findVersion(ctx context.Context, id string, version int64) (*models.APIServerConfig, error) {
 	if id == "" {
 		return nil, errors.New("id is required")
 	}
 
-	if err := validateURLs(schemaURL, baseURL); err != nil {
+	config, err := s.repo.GetByID(ctx, id)
+	if err != nil {
 		return nil, err
 	}
+	if config == nil {
+		return nil, ErrConfigNotFound
+	}
+	if version != AnyVersion && config.Version != version {
+		return nil, ErrVersionConflict
+	}
+	return config, nil
+}
 
-	// 获取当前配置
-	config, err := s.repo.GetByID(ctx, id)
+// recordRevision 将配置变更记录到修订历史
+func (s *DefaultAPIServerConfigService) recordRevision(ctx context.Context, id, action string, rollbackTo int, before, after *models.APIServerConfig) error {
+	err := s.revisions.record(ctx, revisionChange{
+		kind:       models.ConfigKindAPIServer,
+		configID:   id,
+		action:     action,
+		rollbackTo: rollbackTo,
+		before:     apiServerConfigSnapshot{before},
+		after:      apiServerConfigSnapshot{after},
+	})
+	return errors.Wrap(err, "config updated, but its revision was not recorded")
+}
+
+// GetAPIServerConfigRevisions 分页获取配置的修订历史，最新的在前
+func (s *DefaultAPIServerConfigService) GetAPIServerConfigRevisions(ctx context.Context, id string, page, pageSize int) ([]*models.ConfigRevision, int64, error) {
+	if s.revisions == nil {
+		return nil, 0, ErrRevisionsDisabled
+	}
+	return s.revisions.List(ctx, models.ConfigKindAPIServer, id, page, pageSize)
+}
+
+// GetAPIServerConfigRevision 获取配置的指定修订，不存在时返回 ErrRevisionNotFound
+func (s *DefaultAPIServerConfigService) GetAPIServerConfigRevision(ctx context.Context, id string, revision int) (*models.ConfigRevision, error) {
+	if s.revisions == nil {
+		return nil, ErrRevisionsDisabled
+	}
+	return s.revisions.Get(ctx, models.ConfigKindAPIServer, id, revision)
+}
+
+// RollbackAPIServerConfig 将配置恢复到指定修订，回滚本身也会记录为新的修订
+func (s *DefaultAPIServerConfigService) RollbackAPIServerConfig(ctx context.Context, id string, revision int) (*models.APIServerConfig, error) {
+	target, err := s.GetAPIServerConfigRevision(ctx, id, revision)
 	if err != nil {
 		return nil, err
 	}
 
+	config, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
 	if config == nil {
-		return nil, errors.New("config not found")
+		return nil, ErrConfigNotFound
 	}
 
-	// 更新配置
-	config.Update(name, description, schemaURL, baseURL)
-	// 调用前置钩子
-	config.BeforeUpdate()
+	restored := *target.APIServerConfig
+	restored.CreatedAt, restored.Version = config.CreatedAt, config.Version
+	restored.BeforeUpdate()
 
-	return s.repo.Update(ctx, config)
+	updated, err := s.repo.Update(ctx, &restored)
+	if err != nil {
+		return nil, err
+	}
+	return updated, s.recordRevision(ctx, id, models.RevisionActionRollback, revision, config, updated)
 }
 
 // DeleteAPIServerConfig 删除 API 服务器配置
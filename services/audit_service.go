@@ -0,0 +1,55 @@
+package services
+
+import (
+	"context"
+
+	"github.com/anyisalin/mcp-openapi-to-mcp-adapter/models"
+	"github.com/anyisalin/mcp-openapi-to-mcp-adapter/repositories"
+	"github.com/anyisalin/mcp-openapi-to-mcp-adapter/utils"
+)
+
+// AuditService stores the audit log of tool calls in MongoDB
+type AuditService struct {
+	repo *repositories.AuditRepository
+}
+
+// NewAuditService creates a new audit service
+func NewAuditService(repo *repositories.AuditRepository) *AuditService {
+	return &AuditService{
+		repo: repo,
+	}
+}
+
+// Record stores the audit entry of a tool call
+func (s *AuditService) Record(ctx context.Context, entry utils.AuditEntry) error {
+	return s.repo.Create(ctx, &models.AuditRecord{
+		SessionID:    entry.SessionID,
+		ConfigID:     entry.ConfigID,
+		Subject:      entry.Subject,
+		Tool:         entry.Tool,
+		Method:       entry.Method,
+		URL:          entry.URL,
+		Arguments:    entry.Arguments,
+		Status:       entry.Status,
+		StatusCode:   entry.StatusCode,
+		LatencyMS:    float64(entry.Latency.Microseconds()) / 1000,
+		ResponseSize: entry.ResponseSize,
+		Approval:     entry.Approval,
+		ApprovedBy:   entry.ApprovedBy,
+	})
+}
+
+// Query returns a page of the audit records matching the filter, newest
+// first, and the number of matching records. Pages are numbered from 1.
+func (s *AuditService) Query(ctx context.Context, filter repositories.AuditFilter, page, pageSize int) ([]*models.AuditRecord, int64, error) {
+	records, total, err := s.repo.Find(ctx, filter, int64((page-1)*pageSize), int64(pageSize))
+	if err != nil {
+		return nil, 0, err
+	}
+	if records == nil {
+		records = []*models.AuditRecord{}
+	}
+	return records, total, nil
+}
+
+var _ utils.AuditSink = (*AuditService)(nil)
@@ -0,0 +1,273 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/anyisalin/mcp-openapi-to-mcp-adapter/auth"
+	"github.com/anyisalin/mcp-openapi-to-mcp-adapter/models"
+	"github.com/anyisalin/mcp-openapi-to-mcp-adapter/repositories"
+)
+
+var (
+	// ErrRevisionNotFound is returned for a revision a configuration does not have
+	ErrRevisionNotFound = errors.New("revision not found")
+	// ErrRevisionsDisabled is returned when reading revisions from a service that does not record them
+	ErrRevisionsDisabled = errors.New("revision history is not enabled")
+)
+
+// maxRevisionAttempts bounds the retries of concurrent changes racing for the same revision number
+const maxRevisionAttempts = 5
+
+// diffIgnoredFields are bookkeeping fields left out of revision diffs
+var diffIgnoredFields = map[string]bool{
+	"id": true, "createdAt": true, "updatedAt": true, "created_at": true, "updated_at": true, "version": true,
+}
+
+// ConfigRevisionService records and reads the revision history of configurations
+type ConfigRevisionService struct {
+	repo *repositories.ConfigRevisionRepository
+}
+
+// NewConfigRevisionService creates a new configuration revision service
+func NewConfigRevisionService(repo *repositories.ConfigRevisionRepository) *ConfigRevisionService {
+	return &ConfigRevisionService{
+		repo: repo,
+	}
+}
+
+// revisionChange describes a change of a configuration to record
+type revisionChange struct {
+	kind       string
+	configID   string
+	action     string
+	rollbackTo int
+	before     revisionSnapshot // nil for a created configuration
+	after      revisionSnapshot
+}
+
+// revisionSnapshot is the state of a configuration stored in a revision
+type revisionSnapshot interface {
+	apply(revision *models.ConfigRevision) // Stores a copy of the configuration in the revision
+	stored() interface{}
+	redacted() interface{}
+}
+
+type sseConfigSnapshot struct{ config *models.SSEConfig }
+
+func (s sseConfigSnapshot) apply(revision *models.ConfigRevision) {
+	config := *s.config
+	revision.SSEConfig = &config
+}
+
+func (s sseConfigSnapshot) stored() interface{}   { return s.config }
+func (s sseConfigSnapshot) redacted() interface{} { return s.config.Redacted() }
+
+type apiServerConfigSnapshot struct{ config *models.APIServerConfig }
+
+func (s apiServerConfigSnapshot) apply(revision *models.ConfigRevision) {
+	config := *s.config
+	revision.APIServerConfig = &config
+}
+
+func (s apiServerConfigSnapshot) stored() interface{}   { return s.config }
+func (s apiServerConfigSnapshot) redacted() interface{} { return s.config }
+
+// record stores a revision for the change. A configuration created before
+// revisions were recorded first gets a baseline revision of its previous
+// state, so that the change can be rolled back.
+func (s *ConfigRevisionService) record(ctx context.Context, change revisionChange) error {
+	if s == nil {
+		return nil
+	}
+
+	for attempt := 0; ; attempt++ {
+		latest, err := s.repo.Latest(ctx, change.kind, change.configID)
+		if err != nil {
+			return err
+		}
+
+		number := 1
+		if latest != nil {
+			number = latest.Revision + 1
+		} else if change.before != nil {
+			baseline := s.newRevision(change.kind, change.configID, 1, models.RevisionActionBaseline, "", nil, change.before)
+			if err = s.repo.Create(ctx, baseline); err == nil {
+				number = 2
+			}
+		}
+
+		if err == nil {
+			revision := s.newRevision(change.kind, change.configID, number, change.action, authorOf(ctx), change.before, change.after)
+			revision.RollbackTo = change.rollbackTo
+			err = s.repo.Create(ctx, revision)
+		}
+		if !errors.Is(err, repositories.ErrRevisionExists) || attempt+1 >= maxRevisionAttempts {
+			return err
+		}
+	}
+}
+
+// newRevision creates the revision of a configuration changed from before to after
+func (s *ConfigRevisionService) newRevision(kind, configID string, number int, action, author string, before, after revisionSnapshot) *models.ConfigRevision {
+	revision := &models.ConfigRevision{
+		Kind:     kind,
+		ConfigID: configID,
+		Revision: number,
+		Action:   action,
+		Author:   author,
+		Diff:     diffSnapshots(before, after),
+	}
+	after.apply(revision)
+	return revision
+}
+
+// List returns a page of the revisions of a configuration, newest first, and
+// the number of revisions. Pages are numbered from 1.
+func (s *ConfigRevisionService) List(ctx context.Context, kind, configID string, page, pageSize int) ([]*models.ConfigRevision, int64, error) {
+	revisions, total, err := s.repo.Find(ctx, kind, configID, int64((page-1)*pageSize), int64(pageSize))
+	if err != nil {
+		return nil, 0, err
+	}
+	if revisions == nil {
+		revisions = []*models.ConfigRevision{}
+	}
+	return revisions, total, nil
+}
+
+// Get returns a revision of a configuration, or ErrRevisionNotFound
+func (s *ConfigRevisionService) Get(ctx context.Context, kind, configID string, number int) (*models.ConfigRevision, error) {
+	revision, err := s.repo.FindRevision(ctx, kind, configID, number)
+	if err != nil {
+		return nil, err
+	}
+	if revision == nil {
+		return nil, ErrRevisionNotFound
+	}
+	return revision, nil
+}
+
+// rotateSSEConfigSecrets re-encrypts the secrets in the snapshots of SSE
+// configurations with rotate, which reports whether it changed a snapshot. It
+// returns the number of revisions updated.
+func (s *ConfigRevisionService) rotateSSEConfigSecrets(ctx context.Context, rotate func(config *models.SSEConfig) (bool, error)) (int, error) {
+	revisions, err := s.repo.FindByKind(ctx, models.ConfigKindSSE)
+	if err != nil {
+		return 0, err
+	}
+
+	updated := 0
+	for _, revision := range revisions {
+		if revision.SSEConfig == nil {
+			continue
+		}
+		changed, err := rotate(revision.SSEConfig)
+		if err != nil {
+			return updated, fmt.Errorf("revision %d of configuration %s: %w", revision.Revision, revision.ConfigID, err)
+		}
+		if !changed {
+			continue
+		}
+		if err := s.repo.ReplaceSSEConfig(ctx, revision); err != nil {
+			return updated, err
+		}
+		updated++
+	}
+	return updated, nil
+}
+
+// authorOf returns who is making a change; without authentication changes
+// are made through the admin API
+func authorOf(ctx context.Context) string {
+	if principal := auth.PrincipalFromContext(ctx); principal != nil {
+		return principal.Subject
+	}
+	return "admin"
+}
+
+// diffSnapshots lists the fields that differ between two snapshots. Fields
+// are compared as stored, so a replaced secret is reported, but their values
+// are taken from the redacted snapshots.
+func diffSnapshots(before, after revisionSnapshot) []models.FieldChange {
+	rawBefore, rawAfter := map[string]interface{}{}, flattenJSON(after.stored())
+	redactedBefore, redactedAfter := map[string]interface{}{}, flattenJSON(after.redacted())
+	if before != nil {
+		rawBefore = flattenJSON(before.stored())
+		redactedBefore = flattenJSON(before.redacted())
+	}
+
+	fields := map[string]bool{}
+	for field := range rawBefore {
+		fields[field] = true
+	}
+	for field := range rawAfter {
+		fields[field] = true
+	}
+
+	changes := []models.FieldChange{}
+	for field := range fields {
+		if diffIgnoredFields[field] || reflect.DeepEqual(rawBefore[field], rawAfter[field]) {
+			continue
+		}
+		changes = append(changes, models.FieldChange{
+			Field: field,
+			Old:   marshalField(redactedBefore, field),
+			New:   marshalField(redactedAfter, field),
+		})
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Field < changes[j].Field })
+	return changes
+}
+
+// marshalField returns the JSON of a field, or nil if the field is not set
+func marshalField(fields map[string]interface{}, field string) json.RawMessage {
+	value, ok := fields[field]
+	if !ok {
+		return nil
+	}
+	data, _ := json.Marshal(value)
+	return data
+}
+
+// flattenJSON returns the fields of the JSON representation of value, with
+// nested objects flattened into dotted paths. Empty values are left out.
+func flattenJSON(value interface{}) map[string]interface{} {
+	fields := map[string]interface{}{}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fields
+	}
+	var object map[string]interface{}
+	if err := json.Unmarshal(data, &object); err != nil {
+		return fields
+	}
+	flattenInto(fields, "", object)
+	return fields
+}
+
+func flattenInto(fields map[string]interface{}, prefix string, object map[string]interface{}) {
+	for key, value := range object {
+		if prefix != "" {
+			key = prefix + "." + key
+		}
+		switch v := value.(type) {
+		case map[string]interface{}:
+			flattenInto(fields, key, v)
+		case nil:
+		case string:
+			if v != "" {
+				fields[key] = v
+			}
+		case []interface{}:
+			if len(v) > 0 {
+				fields[key] = v
+			}
+		default:
+			fields[key] = v
+		}
+	}
+}
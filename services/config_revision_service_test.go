@@ -0,0 +1,44 @@
+package services
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/anyisalin/mcp-openapi-to-mcp-adapter/models"
+	"github.com/anyisalin/mcp-openapi-to-mcp-adapter/secrets"
+)
+
+func TestDiffSnapshotsMasksSecrets(t *testing.T) {
+	before := &models.SSEConfig{
+		BaseURL: "https://api.example.com",
+		Headers: map[string]string{"Authorization": "Bearer old-token"},
+		Filters: []string{"+/pets/**"},
+	}
+	after := &models.SSEConfig{
+		BaseURL: "https://api.example.com",
+		Headers: map[string]string{"Authorization": "Bearer new-token", "X-Team": "ops"},
+	}
+
+	changes := diffSnapshots(sseConfigSnapshot{before}, sseConfigSnapshot{after})
+
+	fields := map[string]models.FieldChange{}
+	for _, change := range changes {
+		fields[change.Field] = change
+	}
+	if len(fields) != 3 {
+		t.Fatalf("unexpected changes %+v", changes)
+	}
+	authorization, ok := fields["headers.Authorization"]
+	if !ok || strings.Contains(string(authorization.Old)+string(authorization.New), "token") {
+		t.Fatalf("replaced secret not reported masked: %s -> %s", authorization.Old, authorization.New)
+	}
+	if string(authorization.New) != `"`+secrets.MaskedValue+`"` {
+		t.Fatalf("unexpected masked value %s", authorization.New)
+	}
+	if filters := fields["filters"]; string(filters.Old) != `["+/pets/**"]` || filters.New != nil {
+		t.Fatalf("removed filters not reported: %+v", filters)
+	}
+	if _, ok := fields["headers.X-Team"]; !ok {
+		t.Fatal("added header not reported")
+	}
+}
@@ -0,0 +1,292 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/anyisalin/mcp-openapi-to-mcp-adapter/models"
+	"github.com/anyisalin/mcp-openapi-to-mcp-adapter/repositories"
+	"github.com/anyisalin/mcp-openapi-to-mcp-adapter/secrets"
+	"github.com/anyisalin/mcp-openapi-to-mcp-adapter/utils"
+)
+
+// relayPollInterval is how often an idle replica checks for relayed messages
+const relayPollInterval = 200 * time.Millisecond
+
+// SessionRegistryService is a MongoDB-backed session registry shared by all replicas
+type SessionRegistryService struct {
+	repo *repositories.SessionRecordRepository
+}
+
+// NewSessionRegistryService creates a new session registry service
+func NewSessionRegistryService(repo *repositories.SessionRecordRepository) *SessionRegistryService {
+	return &SessionRegistryService{
+		repo: repo,
+	}
+}
+
+// Register records that the session is owned by the replica for ttl
+func (s *SessionRegistryService) Register(ctx context.Context, sessionID string, owner utils.SessionOwner, ttl time.Duration) error {
+	return s.repo.Upsert(ctx, sessionID, owner.ReplicaID, owner.ForwardHeaders, time.Now().Add(ttl))
+}
+
+// Lookup returns the owner of the session
+func (s *SessionRegistryService) Lookup(ctx context.Context, sessionID string) (utils.SessionOwner, bool, error) {
+	record, err := s.repo.FindBySessionID(ctx, sessionID)
+	if err != nil {
+		return utils.SessionOwner{}, false, err
+	}
+	if record == nil {
+		return utils.SessionOwner{}, false, nil
+	}
+	return utils.SessionOwner{ReplicaID: record.ReplicaID, ForwardHeaders: record.ForwardHeaders}, true, nil
+}
+
+// Unregister removes the session from the registry
+func (s *SessionRegistryService) Unregister(ctx context.Context, sessionID string) error {
+	return s.repo.DeleteBySessionID(ctx, sessionID)
+}
+
+// Refresh extends every session owned by the replica by ttl
+func (s *SessionRegistryService) Refresh(ctx context.Context, replicaID string, ttl time.Duration) error {
+	return s.repo.ExtendReplica(ctx, replicaID, time.Now().Add(ttl))
+}
+
+var _ utils.SessionRegistry = (*SessionRegistryService)(nil)
+
+// MessageRelayService is a MongoDB-backed relay delivering messages to the
+// replica owning their session
+type MessageRelayService struct {
+	repo *repositories.RelayMessageRepository
+}
+
+// NewMessageRelayService creates a new message relay service
+func NewMessageRelayService(repo *repositories.RelayMessageRepository) *MessageRelayService {
+	return &MessageRelayService{
+		repo: repo,
+	}
+}
+
+// Publish stores the message for the replica it is addressed to
+func (s *MessageRelayService) Publish(ctx context.Context, msg utils.RelayedMessage) error {
+	message, err := toRelayMessage(msg)
+	if err != nil {
+		return err
+	}
+	return s.repo.Create(ctx, message)
+}
+
+// unsealedHeadersWarning logs once that relayed headers are stored in plaintext
+var unsealedHeadersWarning sync.Once
+
+// toRelayMessage converts a relayed message to the stored document. Forwarded
+// headers may carry per-user upstream credentials, so every header value is
+// encrypted with the default keyring, whatever it looks like. Values are never
+// passed through secrets.Seal, which keeps values that already look encrypted
+// and would let a client smuggle a stored config ciphertext to the owning
+// replica for decryption.
+func toRelayMessage(msg utils.RelayedMessage) (*models.RelayMessage, error) {
+	keyring := secrets.Default()
+	if keyring == nil && len(msg.Header) > 0 {
+		unsealedHeadersWarning.Do(func() {
+			slog.Warn("no secret key configured; headers of relayed messages, including forwarded headers, are stored unencrypted")
+		})
+	}
+
+	headers := make(map[string][]string, len(msg.Header))
+	for name, values := range msg.Header {
+		for _, value := range values {
+			if keyring != nil {
+				var err error
+				if value, err = keyring.Encrypt(value); err != nil {
+					return nil, fmt.Errorf("failed to encrypt header %s: %w", name, err)
+				}
+			}
+			headers[name] = append(headers[name], value)
+		}
+	}
+	message := &models.RelayMessage{
+		SessionID:     msg.SessionID,
+		ReplicaID:     msg.ReplicaID,
+		Body:          msg.Body,
+		Headers:       headers,
+		HeadersSealed: keyring != nil,
+		RemoteAddr:    msg.RemoteAddr,
+		Subject:       msg.Subject,
+	}
+	if msg.Approval != nil {
+		message.Approval = &models.RelayedApproval{
+			ApprovalID: msg.Approval.ID,
+			Approved:   msg.Approval.Approved,
+			By:         msg.Approval.By,
+			Reason:     msg.Approval.Reason,
+		}
+	}
+	return message, nil
+}
+
+// fromRelayMessage converts a stored document back to the relayed message
+func fromRelayMessage(message *models.RelayMessage) (utils.RelayedMessage, error) {
+	header, err := openHeaders(message)
+	if err != nil {
+		return utils.RelayedMessage{}, err
+	}
+	msg := utils.RelayedMessage{
+		SessionID:  message.SessionID,
+		ReplicaID:  message.ReplicaID,
+		Body:       message.Body,
+		Header:     header,
+		RemoteAddr: message.RemoteAddr,
+		Subject:    message.Subject,
+	}
+	if message.Approval != nil {
+		msg.Approval = &utils.ApprovalResolution{
+			ID:       message.Approval.ApprovalID,
+			Approved: message.Approval.Approved,
+			By:       message.Approval.By,
+			Reason:   message.Approval.Reason,
+		}
+	}
+	return msg, nil
+}
+
+// openHeaders returns the header values of a stored relay message, decrypting
+// every value if the message was sealed. Unlike secrets.Resolve it never
+// follows env: or file: references, which a client could otherwise send as
+// header values.
+func openHeaders(message *models.RelayMessage) (http.Header, error) {
+	if !message.HeadersSealed {
+		return message.Headers, nil
+	}
+	keyring := secrets.Default()
+	if keyring == nil {
+		return nil, errors.New("headers are encrypted but no secret key is configured")
+	}
+
+	opened := make(http.Header, len(message.Headers))
+	for name, values := range message.Headers {
+		for _, value := range values {
+			plaintext, err := keyring.Decrypt(value)
+			if err != nil {
+				return nil, fmt.Errorf("failed to decrypt header %s: %w", name, err)
+			}
+			opened[name] = append(opened[name], plaintext)
+		}
+	}
+	return opened, nil
+}
+
+// Subscribe claims messages addressed to the replica and passes them to handle
+// until ctx is done
+func (s *MessageRelayService) Subscribe(ctx context.Context, replicaID string, handle func(utils.RelayedMessage)) error {
+	for {
+		message, err := s.repo.ClaimNext(ctx, replicaID)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+
+		if message != nil {
+			msg, err := fromRelayMessage(message)
+			if err != nil {
+				// Drop the message rather than stopping delivery to the replica
+				slog.Error("dropping relayed message", utils.LogKeySessionID, message.SessionID, "error", err)
+				continue
+			}
+			handle(msg)
+			continue
+		}
+
+		select {
+		case <-time.After(relayPollInterval):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+var _ utils.MessageRelay = (*MessageRelayService)(nil)
+
+// approvalRecordTTL bounds how long an approval outlives a crashed replica;
+// the holding replica removes it as soon as the call is decided or expires
+const approvalRecordTTL = time.Minute
+
+// ApprovalRegistryService is a MongoDB-backed registry of the tool calls
+// waiting for approval on every replica
+type ApprovalRegistryService struct {
+	repo *repositories.ApprovalRepository
+}
+
+// NewApprovalRegistryService creates a new approval registry service
+func NewApprovalRegistryService(repo *repositories.ApprovalRepository) *ApprovalRegistryService {
+	return &ApprovalRegistryService{
+		repo: repo,
+	}
+}
+
+// RegisterApproval records that the call is held by the replica
+func (s *ApprovalRegistryService) RegisterApproval(ctx context.Context, approval utils.PendingApproval, replicaID string) error {
+	return s.repo.Create(ctx, &models.ApprovalRecord{
+		ApprovalID: approval.ID,
+		ReplicaID:  replicaID,
+		SessionID:  approval.SessionID,
+		ConfigID:   approval.ConfigID,
+		Subject:    approval.Subject,
+		Tool:       approval.Tool,
+		Method:     approval.Method,
+		URL:        approval.URL,
+		Arguments:  approval.Arguments,
+		ExpiresAt:  approval.ExpiresAt.Add(approvalRecordTTL),
+	})
+}
+
+// LookupApproval returns the replica holding the call
+func (s *ApprovalRegistryService) LookupApproval(ctx context.Context, id string) (string, bool, error) {
+	record, err := s.repo.FindByApprovalID(ctx, id)
+	if err != nil {
+		return "", false, err
+	}
+	if record == nil {
+		return "", false, nil
+	}
+	return record.ReplicaID, true, nil
+}
+
+// UnregisterApproval removes a decided or expired call from the registry
+func (s *ApprovalRegistryService) UnregisterApproval(ctx context.Context, id string) error {
+	return s.repo.DeleteByApprovalID(ctx, id)
+}
+
+// ListApprovals returns the calls waiting for approval on every replica
+func (s *ApprovalRegistryService) ListApprovals(ctx context.Context) ([]utils.PendingApproval, error) {
+	records, err := s.repo.FindPending(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	approvals := make([]utils.PendingApproval, 0, len(records))
+	for _, record := range records {
+		approvals = append(approvals, utils.PendingApproval{
+			ID:        record.ApprovalID,
+			SessionID: record.SessionID,
+			ConfigID:  record.ConfigID,
+			Subject:   record.Subject,
+			Tool:      record.Tool,
+			Method:    record.Method,
+			URL:       record.URL,
+			Arguments: record.Arguments,
+			CreatedAt: record.CreatedAt,
+			ExpiresAt: record.ExpiresAt.Add(-approvalRecordTTL),
+		})
+	}
+	return approvals, nil
+}
+
+var _ utils.ApprovalRegistry = (*ApprovalRegistryService)(nil)
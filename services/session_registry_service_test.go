@@ -0,0 +1,70 @@
+package services
+
+import (
+	"encoding/base64"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/anyisalin/mcp-openapi-to-mcp-adapter/secrets"
+	"github.com/anyisalin/mcp-openapi-to-mcp-adapter/utils"
+)
+
+func TestRelayedHeadersAreAlwaysSealed(t *testing.T) {
+	keyring, err := secrets.ParseKeys("k1:" + base64.StdEncoding.EncodeToString([]byte(strings.Repeat("a", 32))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	secrets.SetDefault(keyring)
+	defer secrets.SetDefault(nil)
+
+	// A client forwarding a stored config ciphertext must get it back verbatim
+	stored, err := keyring.Encrypt("config-secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := http.Header{}
+	header.Set("X-User-Token", "user-token")
+	header.Set("X-Smuggled", stored)
+
+	message, err := toRelayMessage(utils.RelayedMessage{SessionID: "s1", Header: header})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !message.HeadersSealed {
+		t.Fatal("headers not marked sealed")
+	}
+	if value := message.Headers["X-User-Token"][0]; !secrets.IsEncrypted(value) {
+		t.Fatalf("header stored in plaintext: %s", value)
+	}
+	if value := message.Headers["X-Smuggled"][0]; value == stored {
+		t.Fatal("encrypted-looking header stored without sealing")
+	}
+
+	opened, err := openHeaders(message)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opened.Get("X-User-Token") != "user-token" {
+		t.Fatalf("unexpected header %q", opened.Get("X-User-Token"))
+	}
+	if opened.Get("X-Smuggled") != stored {
+		t.Fatalf("ciphertext header was decrypted to %q", opened.Get("X-Smuggled"))
+	}
+}
+
+func TestRelayedApprovalRoundTrip(t *testing.T) {
+	resolution := &utils.ApprovalResolution{ID: "a1", Approved: true, By: "alice", Reason: "ok"}
+	message, err := toRelayMessage(utils.RelayedMessage{ReplicaID: "replica-a", Approval: resolution})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err := fromRelayMessage(message)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.ReplicaID != "replica-a" || msg.Approval == nil || *msg.Approval != *resolution {
+		t.Fatalf("approval not relayed: %+v", msg)
+	}
+}
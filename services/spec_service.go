@@ -0,0 +1,146 @@
+package services
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/anyisalin/mcp-openapi-to-mcp-adapter/models"
+	"github.com/anyisalin/mcp-openapi-to-mcp-adapter/repositories"
+	"github.com/anyisalin/mcp-openapi-to-mcp-adapter/utils"
+)
+
+// MaxSpecSize is the largest specification that can be uploaded, after decompression
+const MaxSpecSize = 32 << 20
+
+var (
+	// ErrSpecNotFound is returned for a spec that was not uploaded
+	ErrSpecNotFound = errors.New("spec not found")
+	// ErrInvalidSpec is returned when uploading content that is not a valid OpenAPI specification
+	ErrInvalidSpec = errors.New("invalid spec")
+)
+
+// SpecService stores uploaded OpenAPI specifications, which configurations
+// reference with a spec:<id> schema URL
+type SpecService struct {
+	repo *repositories.SpecRepository
+}
+
+// NewSpecService creates a new spec service
+func NewSpecService(repo *repositories.SpecRepository) *SpecService {
+	return &SpecService{
+		repo: repo,
+	}
+}
+
+// Upload validates and stores a specification in JSON or YAML, optionally
+// gzip-compressed. Content that was already uploaded returns the existing spec.
+func (s *SpecService) Upload(ctx context.Context, name string, data []byte) (*models.Spec, error) {
+	content, err := decompressSpec(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(content) == 0 {
+		return nil, fmt.Errorf("%w: empty content", ErrInvalidSpec)
+	}
+
+	parser, format, err := utils.ParseSpec(content)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSpec, err)
+	}
+
+	sum := sha256.Sum256(content)
+	info := parser.Info()
+	spec, err := s.repo.Create(ctx, &models.Spec{
+		Name:       name,
+		Hash:       hex.EncodeToString(sum[:]),
+		Format:     format,
+		Size:       int64(len(content)),
+		Title:      info.Title,
+		APIVersion: info.Version,
+		Endpoints:  len(parser.APIs()),
+	}, content)
+	if err != nil {
+		return nil, err
+	}
+	return withSchemaURL(spec), nil
+}
+
+// Get returns an uploaded spec without its content
+func (s *SpecService) Get(ctx context.Context, id string) (*models.Spec, error) {
+	spec, err := s.repo.FindByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if spec == nil {
+		return nil, ErrSpecNotFound
+	}
+	return withSchemaURL(spec), nil
+}
+
+// List returns a page of the uploaded specs, newest first, and the number of
+// specs. Pages are numbered from 1.
+func (s *SpecService) List(ctx context.Context, page, pageSize int) ([]*models.Spec, int64, error) {
+	specs, total, err := s.repo.Find(ctx, int64((page-1)*pageSize), int64(pageSize))
+	if err != nil {
+		return nil, 0, err
+	}
+	if specs == nil {
+		specs = []*models.Spec{}
+	}
+	for _, spec := range specs {
+		withSchemaURL(spec)
+	}
+	return specs, total, nil
+}
+
+// SpecContent returns the content of an uploaded spec
+func (s *SpecService) SpecContent(ctx context.Context, id string) ([]byte, error) {
+	content, err := s.repo.Content(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if content == nil {
+		return nil, ErrSpecNotFound
+	}
+	return content, nil
+}
+
+// withSchemaURL sets the schema URL configurations use to reference the spec
+func withSchemaURL(spec *models.Spec) *models.Spec {
+	spec.SchemaURL = utils.SpecReferencePrefix + spec.ID.Hex()
+	return spec
+}
+
+// decompressSpec returns the content of a possibly gzip-compressed upload,
+// rejecting content larger than MaxSpecSize
+func decompressSpec(data []byte) ([]byte, error) {
+	if len(data) < 2 || data[0] != 0x1f || data[1] != 0x8b {
+		if len(data) > MaxSpecSize {
+			return nil, fmt.Errorf("%w: larger than %d bytes", ErrInvalidSpec, MaxSpecSize)
+		}
+		return data, nil
+	}
+
+	reader, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSpec, err)
+	}
+	defer reader.Close()
+
+	content, err := io.ReadAll(io.LimitReader(reader, MaxSpecSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSpec, err)
+	}
+	if len(content) > MaxSpecSize {
+		return nil, fmt.Errorf("%w: larger than %d bytes", ErrInvalidSpec, MaxSpecSize)
+	}
+	return content, nil
+}
+
+var _ utils.SpecStore = (*SpecService)(nil)
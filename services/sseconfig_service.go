@@ -1,22 +1,43 @@
 package services
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"net/http"
-	"os"
 	"strings"
 	"time"
 
+	"github.com/anyisalin/mcp-openapi-to-mcp-adapter/egress"
 	"github.com/anyisalin/mcp-openapi-to-mcp-adapter/models"
 	"github.com/anyisalin/mcp-openapi-to-mcp-adapter/repositories"
+	"github.com/anyisalin/mcp-openapi-to-mcp-adapter/secrets"
+	"github.com/anyisalin/mcp-openapi-to-mcp-adapter/utils"
+)
+
+// AnyVersion makes updates skip the check of the configuration version
+const AnyVersion int64 = -1
+
+var (
+	// ErrConfigNotFound is returned when changing a configuration that does not exist
+	ErrConfigNotFound = errors.New("configuration not found")
+	// ErrVersionConflict is returned when a configuration does not have the expected version,
+	// because it was changed since the client read it
+	ErrVersionConflict = repositories.ErrVersionConflict
+	// ErrInvalidPatch is returned for merge patches that cannot be applied or yield an invalid configuration
+	ErrInvalidPatch = errors.New("invalid patch")
+	// ErrInvalidConfig is returned for configurations whose schema yields no usable tools
+	ErrInvalidConfig = errors.New("invalid configuration")
 )
 
 // SSEConfigService handles SSE configuration operations
 type SSEConfigService struct {
 	repo                *repositories.SSEConfigRepository
 	apiServerConfigRepo repositories.APIServerConfigRepository
+	revisions           *ConfigRevisionService // Records the revision history, if set
 }
 
 // NewSSEConfigService creates a new SSE configuration service
@@ -26,19 +47,23 @@ func NewSSEConfigService(repo *repositories.SSEConfigRepository) *SSEConfigServi
 	}
 }
 
-// NewSSEConfigServiceWithAPIRepo creates a new SSE configuration service with APIServerConfigRepository
-func NewSSEConfigServiceWithAPIRepo(repo *repositories.SSEConfigRepository, apiRepo repositories.APIServerConfigRepository) *SSEConfigService {
+// NewSSEConfigServiceWithAPIRepo creates a new SSE configuration service with
+// APIServerConfigRepository, recording every change in the revision history
+func NewSSEConfigServiceWithAPIRepo(repo *repositories.SSEConfigRepository, apiRepo repositories.APIServerConfigRepository, revisions *ConfigRevisionService) *SSEConfigService {
 	return &SSEConfigService{
 		repo:                repo,
 		apiServerConfigRepo: apiRepo,
+		revisions:           revisions,
 	}
 }
 
-// Create creates a new SSE configuration in the database
-func (s *SSEConfigService) Create(ctx context.Context, apiConfigId string, schemaURL, baseURL string, headers map[string]string, filters []string) (string, error) {
+// Create creates a new SSE configuration in the database and returns the
+// preview of its tools. Configurations whose schema yields no usable tools
+// are rejected with ErrInvalidConfig.
+func (s *SSEConfigService) Create(ctx context.Context, apiConfigId string, schemaURL, baseURL string, headers map[string]string, filters []string, upstreamAuth *models.UpstreamAuth, forwardHeaders []string, approval *models.ApprovalPolicy, toolOverrides map[string]models.ToolOverride) (string, *utils.ToolPreview, error) {
 	// Validate required fields
 	if apiConfigId == "" {
-		return "", errors.New("apiConfigId is required")
+		return "", nil, errors.New("apiConfigId is required")
 	}
 
 	// 检查是否设置了apiServerConfigRepo
@@ -59,23 +84,58 @@ func (s *SSEConfigService) Create(ctx context.Context, apiConfigId string, schem
 
 	// 验证必须的字段
 	if schemaURL == "" {
-		return "", errors.New("schemaURL is required")
+		return "", nil, errors.New("schemaURL is required")
 	}
 
 	if baseURL == "" {
-		return "", errors.New("base URL is required")
+		return "", nil, errors.New("base URL is required")
+	}
+
+	if upstreamAuth != nil {
+		if err := toUpstreamAuth(upstreamAuth).Validate(); err != nil {
+			return "", nil, err
+		}
+	}
+	if _, err := utils.ParseForwardHeaders(forwardHeaders); err != nil {
+		return "", nil, err
+	}
+	if approval != nil {
+		if err := toApprovalPolicy(approval).Validate(); err != nil {
+			return "", nil, err
+		}
+	}
+	if err := toToolOverrides(toolOverrides).Validate(); err != nil {
+		return "", nil, err
+	}
+
+	// Check that the schema yields usable tools before storing the configuration
+	preview, err := previewTools(ctx, schemaURL, filters, toolOverrides)
+	if err != nil {
+		return "", nil, err
 	}
 
 	// Create the configuration
-	config := models.NewSSEConfig(apiConfigId, schemaURL, baseURL, headers, filters)
+	config := models.NewSSEConfig(apiConfigId, schemaURL, baseURL, headers, filters, upstreamAuth, forwardHeaders, approval, toolOverrides)
+	if err := sealSecrets(config); err != nil {
+		return "", nil, err
+	}
 
 	// Save to database
 	id, err := s.repo.Create(ctx, config)
 	if err != nil {
-		return "", err
+		return "", nil, err
+	}
+
+	if err := s.revisions.record(ctx, revisionChange{
+		kind:     models.ConfigKindSSE,
+		configID: id,
+		action:   models.RevisionActionCreate,
+		after:    sseConfigSnapshot{config},
+	}); err != nil {
+		return id, preview, fmt.Errorf("configuration created, but its revision was not recorded: %w", err)
 	}
 
-	return id, nil
+	return id, preview, nil
 }
 
 // GetByID retrieves an SSE configuration by its ID
@@ -83,13 +143,217 @@ func (s *SSEConfigService) GetByID(ctx context.Context, id string) (*models.SSEC
 	return s.repo.FindByID(ctx, id)
 }
 
-// Update updates an existing SSE configuration
-func (s *SSEConfigService) Update(ctx context.Context, id string, schemaURL, baseURL string, headers map[string]string, filters []string) error {
-	// Retrieve the existing configuration
+// List returns a page of the configurations matching the filter and the
+// number of matching configurations. Pages are numbered from 1.
+func (s *SSEConfigService) List(ctx context.Context, filter repositories.SSEConfigFilter, sort repositories.SSEConfigSort, page, pageSize int) ([]*models.SSEConfig, int64, error) {
+	configs, total, err := s.repo.List(ctx, filter, sort, int64((page-1)*pageSize), int64(pageSize))
+	if err != nil {
+		return nil, 0, err
+	}
+	if configs == nil {
+		configs = []*models.SSEConfig{}
+	}
+	return configs, total, nil
+}
+
+// LoadConfig implements utils.ConfigLoader so the SSE server can resolve configuration IDs
+func (s *SSEConfigService) LoadConfig(ctx context.Context, id string) (*utils.Config, error) {
+	config, err := s.repo.FindByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if config == nil {
+		return nil, nil
+	}
+	return toConfig(id, config)
+}
+
+// toConfig converts a stored configuration into the configuration of the SSE server
+func toConfig(id string, config *models.SSEConfig) (*utils.Config, error) {
+	// Decrypt stored secrets and resolve env: and file: references at connection time
+	headers, err := secrets.ResolveMap(config.Headers)
+	if err != nil {
+		return nil, fmt.Errorf("configuration %s: %w", id, err)
+	}
+	upstreamAuth := toUpstreamAuth(config.UpstreamAuth)
+	if upstreamAuth != nil {
+		upstreamAuth.ConfigID = id
+		if upstreamAuth.ClientSecret, err = secrets.Resolve(upstreamAuth.ClientSecret); err != nil {
+			return nil, fmt.Errorf("configuration %s: client secret: %w", id, err)
+		}
+		if upstreamAuth.RefreshToken, err = secrets.Resolve(upstreamAuth.RefreshToken); err != nil {
+			return nil, fmt.Errorf("configuration %s: refresh token: %w", id, err)
+		}
+	}
+
+	return &utils.Config{
+		ID:        id,
+		SchemaURL: config.SchemaURL,
+		BaseURL:   config.BaseURL,
+		Headers:   headers,
+		Filters:   config.Filters,
+
+		UpstreamAuth:   upstreamAuth,
+		ForwardHeaders: config.ForwardHeaders,
+		Approval:       toApprovalPolicy(config.Approval),
+		ToolOverrides:  toToolOverrides(config.ToolOverrides),
+	}, nil
+}
+
+// SaveRefreshToken writes a refresh token rotated by the upstream token
+// endpoint back to the configuration, sealed with the default keyring. The
+// configuration is left alone if its refresh token is no longer previous,
+// e.g. because an administrator replaced it.
+func (s *SSEConfigService) SaveRefreshToken(ctx context.Context, id, previous, refreshToken string) error {
 	config, err := s.repo.FindByID(ctx, id)
 	if err != nil {
 		return err
 	}
+	if config == nil || config.UpstreamAuth == nil {
+		return nil
+	}
+
+	stored := config.UpstreamAuth.RefreshToken
+	sealed, ok, err := sealRotatedRefreshToken(stored, previous, refreshToken)
+	if err != nil || !ok {
+		return err
+	}
+	_, err = s.repo.SetRefreshToken(ctx, id, stored, sealed)
+	return err
+}
+
+// sealRotatedRefreshToken returns the value storing a rotated refresh token in
+// place of the stored one, and false if the stored token is no longer
+// previous. The token comes from the upstream, so it is always encrypted,
+// even if it looks like a reference or an encrypted value.
+func sealRotatedRefreshToken(stored, previous, refreshToken string) (string, bool, error) {
+	if secrets.IsReference(stored) {
+		return "", false, errors.New("the refresh token is a reference, update the secret it refers to")
+	}
+	current, err := secrets.Resolve(stored)
+	if err != nil {
+		return "", false, err
+	}
+	if current != previous {
+		return "", false, nil
+	}
+
+	keyring := secrets.Default()
+	if keyring == nil {
+		if secrets.IsReference(refreshToken) || secrets.IsEncrypted(refreshToken) {
+			return "", false, errors.New("the rotated refresh token cannot be stored without a secret key")
+		}
+		return refreshToken, true, nil
+	}
+	sealed, err := keyring.Encrypt(refreshToken)
+	if err != nil {
+		return "", false, err
+	}
+	return sealed, true, nil
+}
+
+// sealSecrets encrypts the header values and upstream credentials of the
+// configuration with the default keyring before it is stored
+func sealSecrets(config *models.SSEConfig) error {
+	headers, err := secrets.SealMap(config.Headers)
+	if err != nil {
+		return err
+	}
+	config.Headers = headers
+
+	if config.UpstreamAuth != nil {
+		auth := *config.UpstreamAuth
+		if auth.ClientSecret, err = secrets.Seal(auth.ClientSecret); err != nil {
+			return err
+		}
+		if auth.RefreshToken, err = secrets.Seal(auth.RefreshToken); err != nil {
+			return err
+		}
+		config.UpstreamAuth = &auth
+	}
+	return nil
+}
+
+// keepMaskedSecret returns the stored value when a client sends back the masked
+// value it received from the API, so a configuration can be round-tripped
+func keepMaskedSecret(value, stored string) string {
+	if value == secrets.MaskedValue {
+		return stored
+	}
+	return value
+}
+
+// toUpstreamAuth converts the stored upstream auth to the form used by the SSE server
+func toUpstreamAuth(auth *models.UpstreamAuth) *utils.UpstreamAuth {
+	if auth == nil {
+		return nil
+	}
+	return &utils.UpstreamAuth{
+		Type:           auth.Type,
+		TokenURL:       auth.TokenURL,
+		ClientID:       auth.ClientID,
+		ClientSecret:   auth.ClientSecret,
+		RefreshToken:   auth.RefreshToken,
+		Scopes:         auth.Scopes,
+		EndpointParams: auth.EndpointParams,
+		AuthStyle:      auth.AuthStyle,
+		HeaderName:     auth.HeaderName,
+	}
+}
+
+// toApprovalPolicy converts the stored approval policy to the form used by the SSE server
+func toApprovalPolicy(policy *models.ApprovalPolicy) *utils.ApprovalPolicy {
+	if policy == nil {
+		return nil
+	}
+	converted := &utils.ApprovalPolicy{
+		Timeout: time.Duration(policy.TimeoutSeconds) * time.Second,
+	}
+	for _, rule := range policy.Rules {
+		converted.Rules = append(converted.Rules, utils.ApprovalRule{
+			Methods: rule.Methods,
+			Path:    rule.Path,
+			Tags:    rule.Tags,
+		})
+	}
+	return converted
+}
+
+// toToolOverrides converts the stored tool overrides to the form used by the SSE server
+func toToolOverrides(overrides map[string]models.ToolOverride) utils.ToolOverrides {
+	if len(overrides) == 0 {
+		return nil
+	}
+	converted := make(utils.ToolOverrides, len(overrides))
+	for key, override := range overrides {
+		converted[key] = utils.ToolOverride{
+			Name:                  override.Name,
+			Description:           override.Description,
+			AppendDescription:     override.AppendDescription,
+			ParameterDescriptions: override.ParameterDescriptions,
+			HiddenParameters:      override.HiddenParameters,
+			PinnedArguments:       override.PinnedArguments,
+			Defaults:              override.Defaults,
+		}
+	}
+	return converted
+}
+
+// Ensure SSEConfigService implements the utils.ConfigLoader and utils.RevisionLoader interfaces
+var _ utils.ConfigLoader = (*SSEConfigService)(nil)
+var _ utils.RevisionLoader = (*SSEConfigService)(nil)
+var _ utils.RefreshTokenStore = (*SSEConfigService)(nil)
+
+// Update updates an existing SSE configuration, if it still has the expected
+// version (AnyVersion skips the check), and returns the preview of its tools.
+// Empty fields are left unchanged.
+func (s *SSEConfigService) Update(ctx context.Context, id string, version int64, schemaURL, baseURL string, headers map[string]string, filters []string, upstreamAuth *models.UpstreamAuth, forwardHeaders []string, approval *models.ApprovalPolicy, toolOverrides map[string]models.ToolOverride) (*models.SSEConfig, *utils.ToolPreview, error) {
+	// Retrieve the existing configuration
+	config, err := s.findVersion(ctx, id, version)
+	if err != nil {
+		return nil, nil, err
+	}
+	before := *config
 
 	// Update fields
 	if schemaURL != "" {
@@ -99,14 +363,317 @@ func (s *SSEConfigService) Update(ctx context.Context, id string, schemaURL, bas
 		config.BaseURL = baseURL
 	}
 	if headers != nil {
+		for key, value := range headers {
+			headers[key] = keepMaskedSecret(value, config.Headers[key])
+		}
 		config.Headers = headers
 	}
 	if filters != nil {
 		config.Filters = filters
 	}
+	if upstreamAuth != nil {
+		if config.UpstreamAuth != nil {
+			upstreamAuth.ClientSecret = keepMaskedSecret(upstreamAuth.ClientSecret, config.UpstreamAuth.ClientSecret)
+			upstreamAuth.RefreshToken = keepMaskedSecret(upstreamAuth.RefreshToken, config.UpstreamAuth.RefreshToken)
+		}
+		if err := toUpstreamAuth(upstreamAuth).Validate(); err != nil {
+			return nil, nil, err
+		}
+		config.UpstreamAuth = upstreamAuth
+	}
+	if forwardHeaders != nil {
+		if _, err := utils.ParseForwardHeaders(forwardHeaders); err != nil {
+			return nil, nil, err
+		}
+		config.ForwardHeaders = forwardHeaders
+	}
+	if approval != nil {
+		if err := toApprovalPolicy(approval).Validate(); err != nil {
+			return nil, nil, err
+		}
+		config.Approval = approval
+	}
+	if toolOverrides != nil {
+		if err := toToolOverrides(toolOverrides).Validate(); err != nil {
+			return nil, nil, err
+		}
+		config.ToolOverrides = toolOverrides
+	}
+
+	return s.save(ctx, id, models.RevisionActionUpdate, 0, &before, config)
+}
+
+// Patch applies a JSON Merge Patch (RFC 7396) to an existing SSE
+// configuration, if it still has the expected version (AnyVersion skips the
+// check). Unlike Update, the patch can clear fields with null and change
+// single headers. Masked secrets sent back by the client keep their stored
+// values. Invalid patches and configurations yield ErrInvalidPatch, schemas
+// yielding no usable tools ErrInvalidConfig.
+func (s *SSEConfigService) Patch(ctx context.Context, id string, version int64, patch []byte) (*models.SSEConfig, *utils.ToolPreview, error) {
+	config, err := s.findVersion(ctx, id, version)
+	if err != nil {
+		return nil, nil, err
+	}
+	before := *config
+
+	document, err := json.Marshal(config)
+	if err != nil {
+		return nil, nil, err
+	}
+	merged, err := utils.MergePatch(document, patch)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrInvalidPatch, err)
+	}
+	var patched models.SSEConfig
+	decoder := json.NewDecoder(bytes.NewReader(merged))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&patched); err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrInvalidPatch, err)
+	}
+
+	// Bookkeeping fields are not patched
+	patched.BaseModel = config.BaseModel
+	patched.CreatedAt, patched.UpdatedAt, patched.Version = config.CreatedAt, config.UpdatedAt, config.Version
+
+	for key, value := range patched.Headers {
+		patched.Headers[key] = keepMaskedSecret(value, config.Headers[key])
+	}
+	if patched.UpstreamAuth != nil && config.UpstreamAuth != nil {
+		patched.UpstreamAuth.ClientSecret = keepMaskedSecret(patched.UpstreamAuth.ClientSecret, config.UpstreamAuth.ClientSecret)
+		patched.UpstreamAuth.RefreshToken = keepMaskedSecret(patched.UpstreamAuth.RefreshToken, config.UpstreamAuth.RefreshToken)
+	}
+	if err := validateConfig(&patched); err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrInvalidPatch, err)
+	}
+
+	return s.save(ctx, id, models.RevisionActionUpdate, 0, &before, &patched)
+}
+
+// findVersion retrieves a configuration, checking that it has the expected version
+func (s *SSEConfigService) findVersion(ctx context.Context, id string, version int64) (*models.SSEConfig, error) {
+	config, err := s.repo.FindByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if config == nil {
+		return nil, ErrConfigNotFound
+	}
+	if version != AnyVersion && config.Version != version {
+		return nil, ErrVersionConflict
+	}
+	return config, nil
+}
+
+// save checks the tools of an updated configuration, seals its secrets,
+// stores it unless it was changed concurrently, and records the revision
+func (s *SSEConfigService) save(ctx context.Context, id, action string, rollbackTo int, before, config *models.SSEConfig) (*models.SSEConfig, *utils.ToolPreview, error) {
+	preview, err := previewTools(ctx, config.SchemaURL, config.Filters, config.ToolOverrides)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := sealSecrets(config); err != nil {
+		return nil, nil, err
+	}
 
 	// Save to database
-	return s.repo.Update(ctx, id, config)
+	if err := s.repo.Update(ctx, id, config); err != nil {
+		return nil, nil, err
+	}
+
+	return config, preview, s.recordRevision(ctx, id, action, rollbackTo, before, config)
+}
+
+// previewTools checks that a schema can be loaded and parsed, that the
+// filters leave usable tools and that the tool overrides do not make their
+// names collide or pin or hide parameters the tools cannot set, and returns
+// the preview of the tools
+func previewTools(ctx context.Context, schemaURL string, filters []string, toolOverrides map[string]models.ToolOverride) (*utils.ToolPreview, error) {
+	preview, err := utils.PreviewTools(ctx, schemaURL, filters, toToolOverrides(toolOverrides))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidConfig, err)
+	}
+	return preview, nil
+}
+
+// validateConfig checks the fields of a configuration that must be set or well-formed
+func validateConfig(config *models.SSEConfig) error {
+	if config.SchemaURL == "" {
+		return errors.New("schemaURL is required")
+	}
+	if config.BaseURL == "" {
+		return errors.New("base URL is required")
+	}
+	if config.UpstreamAuth != nil {
+		if err := toUpstreamAuth(config.UpstreamAuth).Validate(); err != nil {
+			return err
+		}
+	}
+	if _, err := utils.ParseForwardHeaders(config.ForwardHeaders); err != nil {
+		return err
+	}
+	if config.Approval != nil {
+		if err := toApprovalPolicy(config.Approval).Validate(); err != nil {
+			return err
+		}
+	}
+	return toToolOverrides(config.ToolOverrides).Validate()
+}
+
+// recordRevision records a change of the configuration in its revision history
+func (s *SSEConfigService) recordRevision(ctx context.Context, id, action string, rollbackTo int, before, after *models.SSEConfig) error {
+	err := s.revisions.record(ctx, revisionChange{
+		kind:       models.ConfigKindSSE,
+		configID:   id,
+		action:     action,
+		rollbackTo: rollbackTo,
+		before:     sseConfigSnapshot{before},
+		after:      sseConfigSnapshot{after},
+	})
+	if err != nil {
+		return fmt.Errorf("configuration updated, but its revision was not recorded: %w", err)
+	}
+	return nil
+}
+
+// Revisions returns a page of the revisions of a configuration, newest first,
+// and the number of revisions
+func (s *SSEConfigService) Revisions(ctx context.Context, id string, page, pageSize int) ([]*models.ConfigRevision, int64, error) {
+	if s.revisions == nil {
+		return nil, 0, ErrRevisionsDisabled
+	}
+	return s.revisions.List(ctx, models.ConfigKindSSE, id, page, pageSize)
+}
+
+// Revision returns a revision of a configuration, or ErrRevisionNotFound
+func (s *SSEConfigService) Revision(ctx context.Context, id string, number int) (*models.ConfigRevision, error) {
+	if s.revisions == nil {
+		return nil, ErrRevisionsDisabled
+	}
+	return s.revisions.Get(ctx, models.ConfigKindSSE, id, number)
+}
+
+// Rollback restores the configuration stored by one of its revisions. The
+// restored configuration is validated and saved like an update, so a revision
+// whose schema no longer yields usable tools is rejected with ErrInvalidConfig.
+// The rollback is recorded as a new revision, so it can be undone as well.
+func (s *SSEConfigService) Rollback(ctx context.Context, id string, number int) error {
+	revision, err := s.Revision(ctx, id, number)
+	if err != nil {
+		return err
+	}
+	config, err := s.repo.FindByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	if config == nil {
+		return ErrConfigNotFound
+	}
+
+	restored := *revision.SSEConfig
+	restored.CreatedAt, restored.Version = config.CreatedAt, config.Version
+	if err := validateConfig(&restored); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidConfig, err)
+	}
+	// The snapshot may be encrypted with a key that is being retired
+	if keyring := secrets.Default(); keyring != nil {
+		if _, err := rotateConfigSecrets(keyring, &restored); err != nil {
+			return err
+		}
+	}
+
+	_, _, err = s.save(ctx, id, models.RevisionActionRollback, number, config, &restored)
+	return err
+}
+
+// LoadConfigRevision implements utils.RevisionLoader so that sessions can be
+// pinned to a revision of a configuration
+func (s *SSEConfigService) LoadConfigRevision(ctx context.Context, id string, number int) (*utils.Config, error) {
+	revision, err := s.Revision(ctx, id, number)
+	if errors.Is(err, ErrRevisionNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return toConfig(id, revision.SSEConfig)
+}
+
+// RotateSecrets re-encrypts the stored secrets of every configuration, and of
+// the snapshots in its revision history, with the primary key of the default
+// keyring, so that older keys can be removed without breaking rollbacks or
+// pinned sessions. Plaintext values stored before encryption was enabled are
+// encrypted too. It returns the number of configurations and revisions updated.
+func (s *SSEConfigService) RotateSecrets(ctx context.Context) (int, int, error) {
+	keyring := secrets.Default()
+	if keyring == nil {
+		return 0, 0, errors.New("no secret key is configured")
+	}
+
+	configs, err := s.repo.FindAll(ctx)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	updated := 0
+	for _, config := range configs {
+		changed, err := rotateConfigSecrets(keyring, config)
+		if err != nil {
+			return updated, 0, fmt.Errorf("configuration %s: %w", config.GetID().Hex(), err)
+		}
+		if !changed {
+			continue
+		}
+		if err := s.repo.Update(ctx, config.GetID().Hex(), config); err != nil {
+			return updated, 0, err
+		}
+		updated++
+	}
+
+	if s.revisions == nil {
+		return updated, 0, nil
+	}
+	revisions, err := s.revisions.rotateSSEConfigSecrets(ctx, func(config *models.SSEConfig) (bool, error) {
+		return rotateConfigSecrets(keyring, config)
+	})
+	return updated, revisions, err
+}
+
+// rotateConfigSecrets re-encrypts the secrets of the configuration in place
+// with the primary key, reporting whether any of them changed
+func rotateConfigSecrets(keyring *secrets.Keyring, config *models.SSEConfig) (bool, error) {
+	rotate := func(value string) (string, bool, error) {
+		switch {
+		case keyring.NeedsRotation(value):
+			rotated, err := keyring.Rotate(value)
+			return rotated, true, err
+		case value != "" && !secrets.IsEncrypted(value) && !secrets.IsReference(value):
+			sealed, err := keyring.Encrypt(value)
+			return sealed, true, err
+		default:
+			return value, false, nil
+		}
+	}
+
+	changed := false
+	for key, value := range config.Headers {
+		rotated, ok, err := rotate(value)
+		if err != nil {
+			return false, fmt.Errorf("header %s: %w", key, err)
+		}
+		config.Headers[key] = rotated
+		changed = changed || ok
+	}
+	if auth := config.UpstreamAuth; auth != nil {
+		for _, field := range []*string{&auth.ClientSecret, &auth.RefreshToken} {
+			rotated, ok, err := rotate(*field)
+			if err != nil {
+				return false, fmt.Errorf("upstream auth: %w", err)
+			}
+			*field = rotated
+			changed = changed || ok
+		}
+	}
+	return changed, nil
 }
 
 // Delete removes an SSE configuration
@@ -120,7 +687,8 @@ func (s *SSEConfigService) GetSchemaBytes(schemaURL string) ([]byte, error) {
 	if strings.HasPrefix(schemaURL, "http://") || strings.HasPrefix(schemaURL, "https://") {
 		// Create a custom HTTP client with timeout
 		client := &http.Client{
-			Timeout: 30 * time.Second,
+			Transport: egress.Transport(),
+			Timeout:   30 * time.Second,
 		}
 
 		// Use the client to make the request
@@ -134,5 +702,5 @@ func (s *SSEConfigService) GetSchemaBytes(schemaURL string) ([]byte, error) {
 	}
 
 	// Local file
-	return os.ReadFile(schemaURL)
+	return egress.ReadSchemaFile(schemaURL)
 }
@@ -0,0 +1,49 @@
+package services
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/anyisalin/mcp-openapi-to-mcp-adapter/secrets"
+)
+
+func TestRotatedRefreshTokenIsSealed(t *testing.T) {
+	keyring, err := secrets.ParseKeys("k1:" + base64.StdEncoding.EncodeToString([]byte(strings.Repeat("a", 32))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	secrets.SetDefault(keyring)
+	defer secrets.SetDefault(nil)
+
+	stored, err := keyring.Encrypt("refresh-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sealed, ok, err := sealRotatedRefreshToken(stored, "refresh-1", "refresh-2")
+	if err != nil || !ok {
+		t.Fatalf("rotated token not stored: %v", err)
+	}
+	if !secrets.IsEncrypted(sealed) {
+		t.Fatalf("rotated token stored in plaintext: %s", sealed)
+	}
+	if opened, err := secrets.Resolve(sealed); err != nil || opened != "refresh-2" {
+		t.Fatalf("stored token opens to %q (%v)", opened, err)
+	}
+
+	// A token the upstream made look like a reference is still encrypted
+	if sealed, _, err := sealRotatedRefreshToken(stored, "refresh-1", "env:HOME"); err != nil || !secrets.IsEncrypted(sealed) {
+		t.Fatalf("reference-like token stored as %q (%v)", sealed, err)
+	}
+
+	// An administrator replaced the token meanwhile
+	if _, ok, err := sealRotatedRefreshToken(stored, "refresh-0", "refresh-2"); err != nil || ok {
+		t.Fatalf("replaced token overwritten: %v %v", ok, err)
+	}
+
+	// References are never overwritten
+	if _, _, err := sealRotatedRefreshToken("env:REFRESH_TOKEN", "refresh-1", "refresh-2"); err == nil {
+		t.Fatal("reference overwritten")
+	}
+}
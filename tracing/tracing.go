@@ -0,0 +1,122 @@
+// Package tracing sets up OpenTelemetry tracing for mcp-link
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Supported span exporters
+const (
+	ExporterNone     = "none"
+	ExporterStdout   = "stdout"
+	ExporterOTLPHTTP = "otlphttp"
+)
+
+// instrumentationName names the tracer of mcp-link
+const instrumentationName = "github.com/anyisalin/mcp-openapi-to-mcp-adapter"
+
+// Options configures tracing
+type Options struct {
+	Exporter    string    // none, stdout or otlphttp
+	Endpoint    string    // OTLP endpoint as host:port; the OTEL_EXPORTER_OTLP_* variables apply if empty
+	Insecure    bool      // Use HTTP instead of HTTPS for the OTLP endpoint
+	SampleRatio float64   // Fraction of new traces sampled; traces started by the client follow its decision
+	ServiceName string    // service.name resource attribute
+	Writer      io.Writer // Output of the stdout exporter, os.Stdout if nil
+}
+
+// Setup installs the tracer provider and the W3C trace context propagator.
+// Spans are only recorded when an exporter other than none is configured,
+// but trace context is propagated either way. The returned function flushes
+// and stops the exporter.
+func Setup(ctx context.Context, opts Options) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch opts.Exporter {
+	case ExporterNone, "":
+		return func(context.Context) error { return nil }, nil
+	case ExporterStdout:
+		writer := opts.Writer
+		if writer == nil {
+			writer = os.Stdout
+		}
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(writer))
+	case ExporterOTLPHTTP:
+		var otlpOpts []otlptracehttp.Option
+		if opts.Endpoint != "" {
+			otlpOpts = append(otlpOpts, otlptracehttp.WithEndpoint(opts.Endpoint))
+		}
+		if opts.Insecure {
+			otlpOpts = append(otlpOpts, otlptracehttp.WithInsecure())
+		}
+		exporter, err = otlptracehttp.New(ctx, otlpOpts...)
+	default:
+		return nil, fmt.Errorf("unknown tracing exporter: %s", opts.Exporter)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s span exporter: %w", opts.Exporter, err)
+	}
+
+	serviceName := opts.ServiceName
+	if serviceName == "" {
+		serviceName = "mcp-link"
+	}
+	sampleRatio := opts.SampleRatio
+	if sampleRatio <= 0 || sampleRatio > 1 {
+		sampleRatio = 1
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(sampleRatio))),
+		sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceName(serviceName))),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// Tracer returns the tracer of mcp-link
+func Tracer() trace.Tracer {
+	return otel.Tracer(instrumentationName)
+}
+
+// ExtractHTTP returns the context with the trace context of the request headers
+func ExtractHTTP(ctx context.Context, header http.Header) context.Context {
+	return otel.GetTextMapPropagator().Extract(ctx, propagation.HeaderCarrier(header))
+}
+
+// InjectHTTP adds the trace context of ctx to the request headers
+func InjectHTTP(ctx context.Context, header http.Header) {
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(header))
+}
+
+// ExtractMeta returns the context with the trace context sent by an MCP
+// client in the _meta object of the request params, as traceparent,
+// tracestate and baggage string fields. Without them ctx is returned as is.
+func ExtractMeta(ctx context.Context, meta map[string]interface{}) context.Context {
+	carrier := propagation.MapCarrier{}
+	for _, key := range otel.GetTextMapPropagator().Fields() {
+		if value, ok := meta[key].(string); ok && value != "" {
+			carrier[key] = value
+		}
+	}
+	if carrier["traceparent"] == "" {
+		return ctx
+	}
+	return otel.GetTextMapPropagator().Extract(ctx, carrier)
+}
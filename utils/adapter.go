@@ -9,9 +9,16 @@ import (
 	"net/http"
 	neturl "net/url"
 	"strings"
+	"time"
 
+	"github.com/anyisalin/mcp-openapi-to-mcp-adapter/egress"
+	"github.com/anyisalin/mcp-openapi-to-mcp-adapter/metrics"
+	"github.com/anyisalin/mcp-openapi-to-mcp-adapter/tracing"
 	"github.com/mark3labs/mcp-go/mcp"
 	"github.com/mark3labs/mcp-go/server"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
 func sanitizeToolName(name string) string {
@@ -50,7 +57,51 @@ func sanitizeToolName(name string) string {
 	return s
 }
 
-func NewToolHandler(method string, url string, extraHeaders map[string]string) func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+// toolHandlerOptions holds the optional behaviour of a tool handler
+type toolHandlerOptions struct {
+	upstreamAuth    *UpstreamAuth
+	forwardHeaders  []HeaderForward
+	approvalPolicy  *ApprovalPolicy // Selects the tools built by BuildServerTools that require approval
+	approval        bool            // Hold calls until they are approved
+	approvalTimeout time.Duration
+	toolOverrides   ToolOverrides // Customise the tools built by BuildServerTools
+	metricsHost     string        // Upstream host labelled in metrics, other hosts are counted as other
+}
+
+// withMetricsHost labels the upstream latencies of the tool handler with the
+// host, which must come from a stored configuration: hosts of ad-hoc sessions
+// are chosen by clients and would make the label unbounded
+func withMetricsHost(host string) ToolHandlerOption {
+	return func(o *toolHandlerOptions) {
+		o.metricsHost = host
+	}
+}
+
+// upstreamHostLabel returns the host label of an upstream request
+func (o *toolHandlerOptions) upstreamHostLabel(req *http.Request) string {
+	if o.metricsHost != "" && req.URL.Hostname() == o.metricsHost {
+		return o.metricsHost
+	}
+	return metrics.OtherLabel
+}
+
+// ToolHandlerOption configures a tool handler created by NewToolHandler
+type ToolHandlerOption func(*toolHandlerOptions)
+
+// WithUpstreamAuth makes the tool handler authenticate to the upstream API
+// with an OAuth2 access token obtained, cached and refreshed for the given auth
+func WithUpstreamAuth(auth *UpstreamAuth) ToolHandlerOption {
+	return func(o *toolHandlerOptions) {
+		o.upstreamAuth = auth
+	}
+}
+
+func NewToolHandler(method string, url string, extraHeaders map[string]string, opts ...ToolHandlerOption) func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	var options toolHandlerOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+
 	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 		// Extract parameters from the request
 		params := request.Params.Arguments
@@ -145,39 +196,129 @@ func NewToolHandler(method string, url string, extraHeaders map[string]string) f
 		}
 
 		// Convert body parameters to JSON for the HTTP request body
-		var reqBody io.Reader = nil
+		var jsonBody []byte
 		if len(bodyParams) > 0 {
 			jsonParams, err := json.Marshal(bodyParams)
 			if err != nil {
 				return mcp.NewToolResultText(fmt.Sprintf("Error marshaling body parameters: %v", err)), nil
 			}
-			reqBody = bytes.NewBuffer(jsonParams)
+			jsonBody = jsonParams
 		}
 
+		// Hold the call until a human approves it; a dry run sends nothing to approve
+		dryRun := isDryRun(ctx)
+		if options.approval && !dryRun {
+			decision := awaitApproval(ctx, approvalRequest{
+				tool:      request.Params.Name,
+				method:    method,
+				url:       finalURL,
+				arguments: request.Params.Arguments,
+				timeout:   options.approvalTimeout,
+			})
+			if decision.outcome != ApprovalApproved {
+				message := fmt.Sprintf("Call was not approved: %s", decision.outcome)
+				if decision.reason != "" {
+					message += " (" + decision.reason + ")"
+				}
+				result := mcp.NewToolResultText(message)
+				result.IsError = true
+				return result, nil
+			}
+		}
+
+		// Trace the upstream call; newRequest propagates the span to the upstream
+		ctx, span := tracing.Tracer().Start(ctx, "HTTP "+method,
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(attribute.String("http.request.method", method)))
+		defer span.End()
+
 		// Create HTTP request with the processed URL
-		req, err := http.NewRequestWithContext(ctx, method, finalURL, reqBody)
-		if err != nil {
-			return mcp.NewToolResultText(fmt.Sprintf("Error creating request: %v", err)), nil
+		newRequest := func() (*http.Request, error) {
+			var reqBody io.Reader = nil
+			if jsonBody != nil {
+				reqBody = bytes.NewReader(jsonBody)
+			}
+			req, err := http.NewRequestWithContext(ctx, method, finalURL, reqBody)
+			if err != nil {
+				return nil, fmt.Errorf("Error creating request: %v", err)
+			}
+
+			// Set headers
+			if reqBody != nil {
+				req.Header.Set("Content-Type", "application/json")
+			}
+			for key, value := range extraHeaders {
+				req.Header.Set(key, value)
+			}
+			applyForwardHeaders(ctx, req, options.forwardHeaders)
+			tracing.InjectHTTP(ctx, req.Header)
+			// A dry run sends nothing, so it must not fetch a token from the upstream either
+			if options.upstreamAuth != nil && dryRun {
+				setUpstreamTokenPlaceholder(req, options.upstreamAuth)
+			} else if options.upstreamAuth != nil {
+				if err := setUpstreamToken(req, options.upstreamAuth); err != nil {
+					return nil, fmt.Errorf("Error authenticating request: %v", err)
+				}
+			}
+			return req, nil
 		}
 
-		// Set headers
-		if reqBody != nil {
-			req.Header.Set("Content-Type", "application/json")
+		req, err := newRequest()
+		if err != nil {
+			spanError(span, err)
+			return mcp.NewToolResultText(err.Error()), nil
 		}
-		for key, value := range extraHeaders {
-			req.Header.Set(key, value)
+		reportInvocationRequest(ctx, req, jsonBody)
+		if dryRun {
+			return mcp.NewToolResultText(dryRunMessage), nil
 		}
+		span.SetAttributes(attribute.String("server.address", req.URL.Host))
 
 		// Execute the request
-		client := &http.Client{}
+		logger := upstreamLogger(ctx, req)
+		start := time.Now()
+		client := &http.Client{Transport: egress.Transport()}
 		resp, err := client.Do(req)
+		metrics.UpstreamDuration.WithLabelValues(options.upstreamHostLabel(req)).Observe(time.Since(start).Seconds())
 		if err != nil {
+			reportUpstreamCall(ctx, req, nil, 0)
+			logger.Warn("upstream request failed", latencyAttr(time.Since(start)), "error", err)
+			spanError(span, err)
 			return mcp.NewToolResultText(fmt.Sprintf("Error executing request: %v", err)), nil
 		}
+
+		// The upstream may revoke a token before it expires; retry once with a new token
+		if resp.StatusCode == http.StatusUnauthorized && options.upstreamAuth != nil {
+			resp.Body.Close()
+			invalidateUpstreamToken(options.upstreamAuth)
+
+			req, err = newRequest()
+			if err != nil {
+				spanError(span, err)
+				return mcp.NewToolResultText(err.Error()), nil
+			}
+			reportInvocationRequest(ctx, req, jsonBody)
+			retryStart := time.Now()
+			resp, err = client.Do(req)
+			metrics.UpstreamDuration.WithLabelValues(options.upstreamHostLabel(req)).Observe(time.Since(retryStart).Seconds())
+			if err != nil {
+				reportUpstreamCall(ctx, req, nil, 0)
+				logger.Warn("upstream request failed", latencyAttr(time.Since(start)), "error", err)
+				spanError(span, err)
+				return mcp.NewToolResultText(fmt.Sprintf("Error executing request: %v", err)), nil
+			}
+		}
 		defer resp.Body.Close()
+		logger.Info("upstream request", LogKeyStatus, resp.StatusCode, latencyAttr(time.Since(start)))
+		span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
+		if resp.StatusCode >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, resp.Status)
+		}
 
 		// Read response body
 		body, err := io.ReadAll(resp.Body)
+		reportUpstreamCall(ctx, req, resp, len(body))
+		reportInvocationResponse(ctx, resp, len(body), time.Since(start))
 		if err != nil {
 			return mcp.NewToolResultText(fmt.Sprintf("Error reading response: %v", err)), nil
 		}
@@ -192,26 +333,60 @@ func NewToolHandler(method string, url string, extraHeaders map[string]string) f
 }
 
 // NewMCPFromCustomParser creates an MCP server from our custom OpenAPIParser
-func NewMCPFromCustomParser(baseURL string, extraHeaders map[string]string, parser OpenAPIParser) (*server.MCPServer, error) {
-	// Create a new MCP server
-	apiInfo := parser.Info()
-	prefix := "omnimcp" + sanitizeToolName(apiInfo.Title)
+func NewMCPFromCustomParser(baseURL string, extraHeaders map[string]string, parser OpenAPIParser, opts ...ToolHandlerOption) (*server.MCPServer, error) {
+	return newMCPServer(parser.Info(), BuildServerTools(baseURL, extraHeaders, parser, opts...)), nil
+}
 
+// newMCPServer creates an MCP server for the given API and registers the tools on it
+func newMCPServer(apiInfo APIInfo, tools []server.ServerTool) *server.MCPServer {
 	s := server.NewMCPServer(
-		prefix,
+		toolPrefix(apiInfo),
 		apiInfo.Version,
 		server.WithResourceCapabilities(true, true),
+		server.WithToolCapabilities(true),
 		server.WithLogging(),
 	)
+	if len(tools) > 0 {
+		s.AddTools(tools...)
+	}
+	return s
+}
+
+// toolPrefix returns the prefix shared by the server name and all tool names of an API
+func toolPrefix(apiInfo APIInfo) string {
+	return "omnimcp" + sanitizeToolName(apiInfo.Title)
+}
+
+// toolName returns the name of the tool of an API endpoint, made from its path and method
+func toolName(prefix string, api APIEndpoint) string {
+	return sanitizeToolName(fmt.Sprintf("%s_%s_%s", prefix, strings.ToLower(api.Method), api.Path))
+}
+
+// BuildServerTools converts every API endpoint of the parser into an MCP tool and its handler
+// handlerOpts are applied to the handler of every tool.
+func BuildServerTools(baseURL string, extraHeaders map[string]string, parser OpenAPIParser, handlerOpts ...ToolHandlerOption) []server.ServerTool {
+	return buildTools(toolPrefix(parser.Info()), parser.APIs(), baseURL, extraHeaders, handlerOpts...)
+}
+
+// buildTools converts the API endpoints into MCP tools and their handlers, in the same order
+func buildTools(prefix string, apis []APIEndpoint, baseURL string, extraHeaders map[string]string, handlerOpts ...ToolHandlerOption) []server.ServerTool {
+	var tools []server.ServerTool
+
+	// Calls of the operations selected by the approval policy wait for approval,
+	// and the tools of overridden operations are customised
+	var shared toolHandlerOptions
+	for _, opt := range handlerOpts {
+		opt(&shared)
+	}
 
 	// Add all API endpoints as tools
-	for _, api := range parser.APIs() {
-		// Create tool name from API path and method
-		name := sanitizeToolName(fmt.Sprintf("%s_%s_%s", prefix, strings.ToLower(api.Method), api.Path))
+	for _, api := range apis {
+		name := shared.toolOverrides.toolName(prefix, api)
+		override, _, _ := shared.toolOverrides.find(api)
 
 		// Define tool options
 		opts := []mcp.ToolOption{
-			mcp.WithDescription(api.OperationID + " " + api.Summary + " " + api.Description),
+			mcp.WithDescription(override.description(api.OperationID + " " + api.Summary + " " + api.Description)),
 		}
 
 		// Add parameters
@@ -220,6 +395,14 @@ func NewMCPFromCustomParser(baseURL string, extraHeaders map[string]string, pars
 		path_props := map[string]interface{}{}
 
 		for _, param := range api.Parameters {
+			if param.Schema == nil {
+				param.Schema = &Schema{}
+			}
+			// Pinned and hidden parameters are not offered to the client
+			if override.removes(param.Name) {
+				continue
+			}
+			param = override.parameter(param)
 			if param.In == "query" {
 				query_props[param.Name] = param
 				query_props["type"] = param.Schema.Type
@@ -275,6 +458,10 @@ func NewMCPFromCustomParser(baseURL string, extraHeaders map[string]string, pars
 			for _, mediaType := range api.RequestBody.Content {
 				if mediaType.Schema != nil {
 					for propName, propSchema := range mediaType.Schema.Properties {
+						if override.removes(propName) {
+							continue
+						}
+						propSchema = override.property(propName, propSchema)
 						props[propName] = propSchema
 						props["type"] = propSchema.Type
 						if propSchema.Enum != nil {
@@ -303,11 +490,14 @@ func NewMCPFromCustomParser(baseURL string, extraHeaders map[string]string, pars
 
 		// Create the tool and handler
 		tool := mcp.NewTool(name, opts...)
-		handler := NewToolHandler(api.Method, baseURL+api.Path, extraHeaders)
+		toolOpts := handlerOpts
+		if shared.approvalPolicy.Matches(api) {
+			toolOpts = append(handlerOpts[:len(handlerOpts):len(handlerOpts)], WithApproval(shared.approvalPolicy.Timeout))
+		}
+		handler := override.wrap(NewToolHandler(api.Method, baseURL+api.Path, extraHeaders, toolOpts...), parameterGroups(api))
 
-		// Add the tool to the server
-		s.AddTool(tool, handler)
+		tools = append(tools, server.ServerTool{Tool: tool, Handler: handler})
 	}
 
-	return s, nil
+	return tools
 }
@@ -0,0 +1,470 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// defaultApprovalTimeout is how long a call waits for approval when neither
+// the policy nor the server sets a timeout
+const defaultApprovalTimeout = 5 * time.Minute
+
+// Outcomes of an approval request
+const (
+	ApprovalApproved  = "approved"
+	ApprovalDenied    = "denied"
+	ApprovalTimeout   = "timeout"
+	ApprovalCancelled = "cancelled" // The call was abandoned, e.g. the session closed
+)
+
+// ErrApprovalNotFound is returned when resolving an approval that is not pending
+var ErrApprovalNotFound = errors.New("approval not found")
+
+// ApprovalRegistry records the approvals pending on every replica, so that
+// any replica can list them and route a decision to the replica holding the call
+type ApprovalRegistry interface {
+	// RegisterApproval records that the approval is pending on the replica
+	RegisterApproval(ctx context.Context, approval PendingApproval, replicaID string) error
+	// LookupApproval returns the replica holding the approval, or false if it is not pending
+	LookupApproval(ctx context.Context, id string) (string, bool, error)
+	// UnregisterApproval removes the approval once it is resolved
+	UnregisterApproval(ctx context.Context, id string) error
+	// ListApprovals returns the approvals pending on all replicas
+	ListApprovals(ctx context.Context) ([]PendingApproval, error)
+}
+
+// ApprovalResolution is a decision on a pending approval, relayed to the
+// replica holding the call when it is made on another replica
+type ApprovalResolution struct {
+	ID       string
+	Approved bool
+	By       string // Subject of the administrator who decided
+	Reason   string
+}
+
+// ApprovalPolicy marks the operations of an API whose calls must be approved
+// by a human before they reach the upstream API
+type ApprovalPolicy struct {
+	Rules   []ApprovalRule
+	Timeout time.Duration // How long a call waits for approval, the server default if 0
+}
+
+// ApprovalRule selects operations by method, path and tag. Every criterion
+// that is set must match.
+type ApprovalRule struct {
+	Methods []string // HTTP methods; empty matches all methods
+	Path    string   // Path glob as in filters (* for a segment, ** for several); empty matches all paths
+	Tags    []string // OpenAPI tags, any of which matches; empty matches all operations
+}
+
+// Validate checks that every rule selects something
+func (p *ApprovalPolicy) Validate() error {
+	for i, rule := range p.Rules {
+		if len(rule.Methods) == 0 && rule.Path == "" && len(rule.Tags) == 0 {
+			return fmt.Errorf("approval rule %d must set methods, path or tags", i+1)
+		}
+	}
+	if p.Timeout < 0 {
+		return errors.New("approval timeout must not be negative")
+	}
+	return nil
+}
+
+// Matches reports whether calls of the operation require approval
+func (p *ApprovalPolicy) Matches(api APIEndpoint) bool {
+	if p == nil {
+		return false
+	}
+	for _, rule := range p.Rules {
+		if rule.matches(api) {
+			return true
+		}
+	}
+	return false
+}
+
+// matches reports whether the rule selects the operation
+func (r ApprovalRule) matches(api APIEndpoint) bool {
+	filter := PathFilter{Pattern: r.Path, Methods: r.Methods}
+	if !filter.MatchesMethod(api.Method) {
+		return false
+	}
+	if r.Path != "" && !filter.MatchesPath(api.Path) {
+		return false
+	}
+	if len(r.Tags) == 0 {
+		return true
+	}
+	for _, want := range r.Tags {
+		for _, tag := range api.Tags {
+			if strings.EqualFold(want, tag) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// WithApproval makes the tool handler hold every call until it is approved,
+// waiting at most timeout (the server default if 0)
+func WithApproval(timeout time.Duration) ToolHandlerOption {
+	return func(o *toolHandlerOptions) {
+		o.approval = true
+		o.approvalTimeout = timeout
+	}
+}
+
+// WithApprovalPolicy makes BuildServerTools hold the calls of the operations
+// selected by the policy until they are approved
+func WithApprovalPolicy(policy *ApprovalPolicy) ToolHandlerOption {
+	return func(o *toolHandlerOptions) {
+		o.approvalPolicy = policy
+	}
+}
+
+// WithApprovalRegistry shares pending approvals between replicas. Decisions
+// made on another replica reach the call through the message relay.
+func WithApprovalRegistry(registry ApprovalRegistry) SSEOption {
+	return func(s *SSEServer) {
+		s.approvalRegistry = registry
+	}
+}
+
+// WithApprovalTimeout sets how long calls wait for approval when their policy sets no timeout
+func WithApprovalTimeout(timeout time.Duration) SSEOption {
+	return func(s *SSEServer) {
+		if timeout > 0 {
+			s.approvalTimeout = timeout
+		}
+	}
+}
+
+// PendingApproval describes a tool call waiting for approval
+type PendingApproval struct {
+	ID        string                 `json:"id"`
+	SessionID string                 `json:"sessionId"`
+	ConfigID  string                 `json:"configId,omitempty"`
+	Subject   string                 `json:"subject,omitempty"`
+	Tool      string                 `json:"tool"`
+	Method    string                 `json:"method"`
+	URL       string                 `json:"url"`                 // Upstream URL with secrets masked
+	Arguments map[string]interface{} `json:"arguments,omitempty"` // Tool arguments with secrets masked
+	CreatedAt time.Time              `json:"createdAt"`
+	ExpiresAt time.Time              `json:"expiresAt"`
+}
+
+// approvalDecision is the resolution of an approval request
+type approvalDecision struct {
+	outcome string
+	by      string // Who decided: "client" for an elicitation, the admin subject, or empty
+	reason  string
+}
+
+// pendingApproval is an approval request waiting for a decision
+type pendingApproval struct {
+	PendingApproval
+	session     *sseSession
+	elicitation string // ID of the elicitation request sent to the client, if any
+	decision    chan approvalDecision
+}
+
+// resolve delivers the decision unless one was already made
+func (p *pendingApproval) resolve(decision approvalDecision) bool {
+	select {
+	case p.decision <- decision:
+		return true
+	default:
+		return false
+	}
+}
+
+// PendingApprovals returns the tool calls waiting for approval, oldest first.
+// With an approval registry they include the calls held by other replicas.
+func (s *SSEServer) PendingApprovals(ctx context.Context) ([]PendingApproval, error) {
+	pending := []PendingApproval{}
+	if s.approvalRegistry != nil {
+		registered, err := s.approvalRegistry.ListApprovals(ctx)
+		if err != nil {
+			return nil, err
+		}
+		pending = append(pending, registered...)
+	} else {
+		s.approvals.Range(func(key, value interface{}) bool {
+			pending = append(pending, value.(*pendingApproval).PendingApproval)
+			return true
+		})
+	}
+	sort.Slice(pending, func(i, j int) bool { return pending[i].CreatedAt.Before(pending[j].CreatedAt) })
+	return pending, nil
+}
+
+// ResolveApproval approves or denies a pending tool call on behalf of an
+// administrator. A call held by another replica gets the decision through
+// the message relay.
+func (s *SSEServer) ResolveApproval(ctx context.Context, id string, approved bool, by, reason string) error {
+	resolution := ApprovalResolution{ID: id, Approved: approved, By: by, Reason: reason}
+	if _, ok := s.approvals.Load(id); ok || s.approvalRegistry == nil || s.messageRelay == nil {
+		return s.resolveLocalApproval(resolution)
+	}
+
+	replicaID, ok, err := s.approvalRegistry.LookupApproval(ctx, id)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrApprovalNotFound
+	}
+	if replicaID == s.replicaID {
+		return s.resolveLocalApproval(resolution)
+	}
+	return s.messageRelay.Publish(ctx, RelayedMessage{ReplicaID: replicaID, Approval: &resolution})
+}
+
+// resolveLocalApproval delivers a decision to a call held by this replica
+func (s *SSEServer) resolveLocalApproval(resolution ApprovalResolution) error {
+	value, ok := s.approvals.Load(resolution.ID)
+	if !ok {
+		return ErrApprovalNotFound
+	}
+	decision := approvalDecision{outcome: ApprovalDenied, by: resolution.By, reason: resolution.Reason}
+	if resolution.Approved {
+		decision.outcome = ApprovalApproved
+	}
+	if !value.(*pendingApproval).resolve(decision) {
+		return ErrApprovalNotFound
+	}
+	return nil
+}
+
+// registerApproval records a pending approval in the approval registry
+func (s *SSEServer) registerApproval(pending *pendingApproval, logger *slog.Logger) {
+	if s.approvalRegistry == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), registryTimeout)
+	defer cancel()
+	if err := s.approvalRegistry.RegisterApproval(ctx, pending.PendingApproval, s.replicaID); err != nil {
+		logger.Error("failed to register approval, only this replica can resolve it", "error", err)
+	}
+}
+
+// unregisterApproval removes a resolved approval from the approval registry
+func (s *SSEServer) unregisterApproval(id string, logger *slog.Logger) {
+	if s.approvalRegistry == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), registryTimeout)
+	defer cancel()
+	if err := s.approvalRegistry.UnregisterApproval(ctx, id); err != nil {
+		logger.Error("failed to unregister approval", "error", err)
+	}
+}
+
+// approvalRequest describes the upstream request a tool handler wants to make
+type approvalRequest struct {
+	tool      string
+	method    string
+	url       string
+	arguments map[string]interface{}
+	timeout   time.Duration
+}
+
+// approver holds tool calls of a session until they are approved
+type approver struct {
+	server  *SSEServer
+	session *sseSession
+}
+
+type approverContextKey struct{}
+
+// withApprover lets tool handlers of the session request approval
+func (s *SSEServer) withApprover(ctx context.Context, session *sseSession) context.Context {
+	return context.WithValue(ctx, approverContextKey{}, &approver{server: s, session: session})
+}
+
+// awaitApproval blocks until the call is approved, denied, times out or ctx
+// is done. Without an approver in the context, nobody can approve the call
+// and it is denied.
+func awaitApproval(ctx context.Context, request approvalRequest) approvalDecision {
+	decision := approvalDecision{outcome: ApprovalDenied, reason: "no approval channel is available"}
+	if a, ok := ctx.Value(approverContextKey{}).(*approver); ok {
+		decision = a.await(ctx, request)
+	}
+	reportApproval(ctx, decision)
+	return decision
+}
+
+// await registers the approval request, asks the client to confirm it if it
+// supports elicitation, and waits for a decision
+func (a *approver) await(ctx context.Context, request approvalRequest) approvalDecision {
+	s := a.server
+	timeout := request.timeout
+	if timeout <= 0 {
+		timeout = s.approvalTimeout
+	}
+
+	now := time.Now()
+	pending := &pendingApproval{
+		PendingApproval: PendingApproval{
+			ID:        uuid.New().String(),
+			SessionID: a.session.sessionID,
+			ConfigID:  a.session.configID,
+			Subject:   subjectOf(a.session.principal),
+			Tool:      request.tool,
+			Method:    request.method,
+			URL:       s.redactor.URL(request.url),
+			CreatedAt: now,
+			ExpiresAt: now.Add(timeout),
+		},
+		session:  a.session,
+		decision: make(chan approvalDecision, 1),
+	}
+	if a.session.elicitation.Load() {
+		pending.elicitation = "approval-" + pending.ID
+	}
+	if arguments, ok := s.redactor.redact(request.arguments).(map[string]interface{}); ok {
+		pending.Arguments = arguments
+	}
+
+	logger := a.session.logger.With(LogKeyTool, request.tool, "approval_id", pending.ID)
+	s.approvals.Store(pending.ID, pending)
+	s.registerApproval(pending, logger)
+	defer func() {
+		s.approvals.Delete(pending.ID)
+		s.unregisterApproval(pending.ID, logger)
+	}()
+	logger.Info("tool call waiting for approval", "http_method", request.method, "url", pending.URL)
+
+	// The call may wait for minutes; answer the POST now and deliver the
+	// result on the SSE stream when the call completes
+	detachFromRequest(ctx)
+
+	if pending.elicitation != "" {
+		if err := s.sendApprovalElicitation(pending); err != nil {
+			logger.Warn("cannot ask the client for approval", "error", err)
+		}
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	var decision approvalDecision
+	select {
+	case decision = <-pending.decision:
+	case <-timer.C:
+		decision = approvalDecision{outcome: ApprovalTimeout}
+	case <-ctx.Done():
+		decision = approvalDecision{outcome: ApprovalCancelled}
+	case <-a.session.done:
+		decision = approvalDecision{outcome: ApprovalCancelled}
+	}
+
+	logger.Info("tool call approval resolved", "outcome", decision.outcome, "by", decision.by, "reason", decision.reason)
+	return decision
+}
+
+// sendApprovalElicitation asks the client of the session to confirm the call
+// with an elicitation/create request on the SSE stream
+func (s *SSEServer) sendApprovalElicitation(pending *pendingApproval) error {
+	request := map[string]interface{}{
+		"jsonrpc": mcp.JSONRPC_VERSION,
+		"id":      pending.elicitation,
+		"method":  "elicitation/create",
+		"params": map[string]interface{}{
+			"message": fmt.Sprintf("Allow tool %s to call %s %s?", pending.Tool, pending.Method, pending.URL),
+			"requestedSchema": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"approve": map[string]interface{}{
+						"type":        "boolean",
+						"title":       "Approve",
+						"description": "Allow this call to reach the upstream API",
+					},
+				},
+				"required": []string{"approve"},
+			},
+		},
+	}
+	data, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+	return s.enqueueEvent(pending.session, newMessageEvent(data))
+}
+
+// handleElicitationResponse resolves the approval answered by a JSON-RPC
+// response of the client. It reports false if the message does not answer an
+// approval elicitation of the session.
+func (s *SSEServer) handleElicitationResponse(session *sseSession, message map[string]interface{}) bool {
+	id, ok := message["id"].(string)
+	if !ok || !strings.HasPrefix(id, "approval-") {
+		return false
+	}
+	value, ok := s.approvals.Load(strings.TrimPrefix(id, "approval-"))
+	if !ok {
+		session.logger.Warn("response to an unknown approval elicitation", "id", id)
+		return true
+	}
+	pending := value.(*pendingApproval)
+	if pending.session != session || pending.elicitation != id {
+		session.logger.Warn("approval elicitation answered by another session", "id", id)
+		return true
+	}
+
+	var response struct {
+		Result struct {
+			Action  string `json:"action"`
+			Content struct {
+				Approve bool `json:"approve"`
+			} `json:"content"`
+		} `json:"result"`
+		Error *struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	data, _ := json.Marshal(message)
+	if err := json.Unmarshal(data, &response); err != nil || response.Error != nil {
+		// The client cannot decide; the call can still be approved by an administrator
+		session.logger.Warn("approval elicitation failed", "id", id)
+		return true
+	}
+
+	switch response.Result.Action {
+	case "accept":
+		decision := approvalDecision{outcome: ApprovalDenied, by: "client"}
+		if response.Result.Content.Approve {
+			decision.outcome = ApprovalApproved
+		}
+		pending.resolve(decision)
+	case "decline":
+		pending.resolve(approvalDecision{outcome: ApprovalDenied, by: "client", reason: "declined"})
+	default:
+		// Dismissed without a choice; keep waiting for an administrator
+		session.logger.Info("approval elicitation dismissed", "id", id)
+	}
+	return true
+}
+
+// clientSupportsElicitation reports whether the params of an initialize
+// request declare the elicitation capability
+func clientSupportsElicitation(params interface{}) bool {
+	paramsMap, ok := params.(map[string]interface{})
+	if !ok {
+		return false
+	}
+	capabilities, ok := paramsMap["capabilities"].(map[string]interface{})
+	if !ok {
+		return false
+	}
+	_, ok = capabilities["elicitation"]
+	return ok
+}
@@ -0,0 +1,194 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var petsApproval = &ApprovalPolicy{Rules: []ApprovalRule{{Tags: []string{"pets"}}}}
+
+// pendingApprovals returns the calls waiting for approval on the server
+func pendingApprovals(t *testing.T, ss *SSEServer) []PendingApproval {
+	t.Helper()
+	pending, err := ss.PendingApprovals(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pending
+}
+
+// awaitPendingApproval waits until a call is waiting for approval on the server
+func awaitPendingApproval(t *testing.T, ss *SSEServer) PendingApproval {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for len(pendingApprovals(t, ss)) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("tool call is not waiting for approval")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return pendingApprovals(t, ss)[0]
+}
+
+func TestToolCallApprovedByElicitation(t *testing.T) {
+	var calls atomic.Int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		fmt.Fprint(w, `{"name":"rex"}`)
+	}))
+	defer upstream.Close()
+
+	_, ts := newPetsServer(t, upstream.URL, petsApproval)
+	session := openSession(t, ts.URL+"/sse?configId=pets")
+	session.post(fmt.Sprintf(initializeMessage, `{"elicitation":{}}`))
+	session.next()
+
+	go session.post(`{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"` + petsTool + `","arguments":{}}}`)
+
+	var elicitation struct {
+		ID     string `json:"id"`
+		Method string `json:"method"`
+	}
+	if err := json.Unmarshal([]byte(session.next()), &elicitation); err != nil || elicitation.Method != "elicitation/create" {
+		t.Fatalf("expected an elicitation request, got %+v (%v)", elicitation, err)
+	}
+	if calls.Load() != 0 {
+		t.Fatal("upstream called before approval")
+	}
+
+	session.post(`{"jsonrpc":"2.0","id":"` + elicitation.ID + `","result":{"action":"accept","content":{"approve":true}}}`)
+	if result := session.next(); !strings.Contains(result, "rex") {
+		t.Fatalf("unexpected tool result %s", result)
+	}
+	if calls.Load() != 1 {
+		t.Fatalf("upstream called %d times", calls.Load())
+	}
+}
+
+func TestToolCallDeniedByAdministrator(t *testing.T) {
+	var calls atomic.Int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+	}))
+	defer upstream.Close()
+
+	sink := make(chanAuditSink, 1)
+	ss, ts := newPetsServer(t, upstream.URL, petsApproval, WithAuditSink(sink))
+	session := openSession(t, ts.URL+"/sse?configId=pets")
+	session.post(fmt.Sprintf(initializeMessage, `{}`))
+	session.next()
+
+	go session.post(`{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"` + petsTool + `","arguments":{}}}`)
+
+	pending := awaitPendingApproval(t, ss)
+	if pending.Tool != petsTool || pending.Method != http.MethodGet {
+		t.Fatalf("unexpected pending approval %+v", pending)
+	}
+
+	if err := ss.ResolveApproval(context.Background(), pending.ID, false, "alice", "not now"); err != nil {
+		t.Fatal(err)
+	}
+	if result := session.next(); !strings.Contains(result, `"isError":true`) || !strings.Contains(result, "denied") {
+		t.Fatalf("unexpected tool result %s", result)
+	}
+	if calls.Load() != 0 {
+		t.Fatal("denied call reached the upstream")
+	}
+
+	select {
+	case entry := <-sink:
+		if entry.Approval != ApprovalDenied || entry.ApprovedBy != "alice" || entry.StatusCode != 0 {
+			t.Fatalf("approval not audited: %+v", entry)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("tool call was not audited")
+	}
+	if err := ss.ResolveApproval(context.Background(), pending.ID, true, "alice", ""); err != ErrApprovalNotFound {
+		t.Fatalf("resolved approval can be resolved again: %v", err)
+	}
+}
+
+func TestToolCallWaitingForApprovalAnswersPost(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"name":"rex"}`)
+	}))
+	defer upstream.Close()
+
+	ss, ts := newPetsServer(t, upstream.URL, petsApproval)
+	session := openSession(t, ts.URL+"/sse?configId=pets")
+	session.post(fmt.Sprintf(initializeMessage, `{}`))
+	session.next()
+
+	// The POST is answered while the call waits, and a client timeout on it
+	// does not cancel the call
+	client := &http.Client{Timeout: 2 * time.Second}
+	resp, err := client.Post(session.messageURL, "application/json",
+		strings.NewReader(`{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"`+petsTool+`","arguments":{}}}`))
+	if err != nil {
+		t.Fatalf("POST blocked while the call waits for approval: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("POST returned %d", resp.StatusCode)
+	}
+
+	pending := awaitPendingApproval(t, ss)
+	if err := ss.ResolveApproval(context.Background(), pending.ID, true, "alice", ""); err != nil {
+		t.Fatal(err)
+	}
+	if result := session.next(); !strings.Contains(result, `"id":2`) || !strings.Contains(result, "rex") {
+		t.Fatalf("unexpected tool result %s", result)
+	}
+}
+
+func TestApprovalResolvedOnAnotherReplica(t *testing.T) {
+	var calls atomic.Int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		fmt.Fprint(w, `{"name":"rex"}`)
+	}))
+	defer upstream.Close()
+
+	registry, relay := newMemoryRegistry(), &memoryRelay{}
+	newApprovalReplica := func(replicaID string) (*SSEServer, *httptest.Server) {
+		ss, ts := newPetsServer(t, upstream.URL, petsApproval, WithReplicaID(replicaID),
+			WithSessionRegistry(registry), WithMessageRelay(relay), WithApprovalRegistry(registry))
+		t.Cleanup(func() { ss.Shutdown(context.Background()) })
+		return ss, ts
+	}
+	owner, ownerTS := newApprovalReplica("replica-a")
+	other, _ := newApprovalReplica("replica-b")
+
+	session := openSession(t, ownerTS.URL+"/sse?configId=pets")
+	session.post(fmt.Sprintf(initializeMessage, `{}`))
+	session.next()
+	session.post(`{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"` + petsTool + `","arguments":{}}}`)
+
+	// The other replica lists the call and routes the decision to its owner
+	pending := awaitPendingApproval(t, other)
+	if pending.SessionID == "" || pending.Tool != petsTool {
+		t.Fatalf("unexpected pending approval %+v", pending)
+	}
+	if err := other.ResolveApproval(context.Background(), pending.ID, true, "alice", ""); err != nil {
+		t.Fatal(err)
+	}
+	if result := session.next(); !strings.Contains(result, "rex") {
+		t.Fatalf("unexpected tool result %s", result)
+	}
+	if calls.Load() != 1 {
+		t.Fatalf("upstream called %d times", calls.Load())
+	}
+	if n := len(pendingApprovals(t, owner)); n != 0 {
+		t.Fatalf("%d approvals left in the registry", n)
+	}
+	if err := other.ResolveApproval(context.Background(), pending.ID, true, "alice", ""); err != ErrApprovalNotFound {
+		t.Fatalf("resolved approval can be resolved again: %v", err)
+	}
+}
@@ -0,0 +1,121 @@
+package utils
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// auditTimeout bounds how long writing an audit entry may take
+const auditTimeout = 5 * time.Second
+
+// AuditEntry records one tools/call and the upstream request it made
+type AuditEntry struct {
+	SessionID    string
+	ConfigID     string
+	Subject      string // Authenticated caller, empty without authentication
+	Tool         string
+	Method       string                 // HTTP method of the upstream request, empty if none was made
+	URL          string                 // Upstream URL with secrets masked
+	Arguments    map[string]interface{} // Tool arguments with secrets and personal data masked
+	Status       string                 // ok, error or tool_error
+	StatusCode   int                    // Upstream HTTP status, 0 without an upstream response
+	Latency      time.Duration
+	ResponseSize int    // Bytes of the upstream response body
+	Approval     string // Outcome of the approval of the call, empty if it needed none
+	ApprovedBy   string // Who approved or denied the call
+}
+
+// AuditSink stores audit entries
+type AuditSink interface {
+	Record(ctx context.Context, entry AuditEntry) error
+}
+
+// WithAuditSink records every tools/call in the audit sink
+func WithAuditSink(sink AuditSink) SSEOption {
+	return func(s *SSEServer) {
+		s.auditSink = sink
+	}
+}
+
+// upstreamCall collects the upstream request made by a tool handler, and
+// the approval it waited for
+type upstreamCall struct {
+	method       string
+	url          string
+	statusCode   int
+	responseSize int
+	approval     string
+	approvedBy   string
+}
+
+type upstreamCallContextKey struct{}
+
+// withUpstreamCall returns a context in which tool handlers report their upstream request
+func withUpstreamCall(ctx context.Context) (context.Context, *upstreamCall) {
+	call := &upstreamCall{}
+	return context.WithValue(ctx, upstreamCallContextKey{}, call), call
+}
+
+// reportUpstreamCall records the upstream request, and its response if
+// there is one, in the call of the context
+func reportUpstreamCall(ctx context.Context, req *http.Request, resp *http.Response, responseSize int) {
+	call, ok := ctx.Value(upstreamCallContextKey{}).(*upstreamCall)
+	if !ok {
+		return
+	}
+	call.method = req.Method
+	call.url = req.URL.String()
+	if resp != nil {
+		call.statusCode = resp.StatusCode
+		call.responseSize = responseSize
+	}
+}
+
+// reportApproval records the approval decision in the call of the context
+func reportApproval(ctx context.Context, decision approvalDecision) {
+	if call, ok := ctx.Value(upstreamCallContextKey{}).(*upstreamCall); ok {
+		call.approval = decision.outcome
+		call.approvedBy = decision.by
+	}
+}
+
+// audit writes the entry of a tools/call to the audit sink in the background
+func (s *SSEServer) audit(session *sseSession, toolName string, arguments interface{}, call *upstreamCall, status string, latency time.Duration) {
+	entry := AuditEntry{
+		SessionID:    session.sessionID,
+		ConfigID:     session.configID,
+		Subject:      subjectOf(session.principal),
+		Tool:         toolName,
+		Method:       call.method,
+		Status:       status,
+		StatusCode:   call.statusCode,
+		Latency:      latency,
+		ResponseSize: call.responseSize,
+		Approval:     call.approval,
+		ApprovedBy:   call.approvedBy,
+	}
+	if call.url != "" {
+		entry.URL = s.redactor.URL(call.url)
+	}
+	entry.Arguments = s.redactArguments(arguments)
+	s.recordAudit(entry, session.logger)
+}
+
+// redactArguments returns the tool arguments with secrets and personal data masked
+func (s *SSEServer) redactArguments(arguments interface{}) map[string]interface{} {
+	redacted, _ := s.redactor.redact(arguments).(map[string]interface{})
+	return redacted
+}
+
+// recordAudit writes the entry to the audit sink in the background
+func (s *SSEServer) recordAudit(entry AuditEntry, logger *slog.Logger) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), auditTimeout)
+		defer cancel()
+		if err := s.auditSink.Record(ctx, entry); err != nil {
+			logger.Error("failed to write audit entry", LogKeyTool, entry.Tool, "error", err)
+		}
+	}()
+}
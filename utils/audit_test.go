@@ -0,0 +1,47 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type chanAuditSink chan AuditEntry
+
+func (c chanAuditSink) Record(ctx context.Context, entry AuditEntry) error {
+	c <- entry
+	return nil
+}
+
+func TestToolCallIsAudited(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"name":"rex"}`)
+	}))
+	defer upstream.Close()
+
+	sink := make(chanAuditSink, 1)
+	_, ts := newPetsServer(t, upstream.URL, nil, WithAuditSink(sink))
+	session := openSession(t, ts.URL+"/sse?configId=pets")
+
+	session.post(`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2024-11-05","capabilities":{},"clientInfo":{"name":"test","version":"1"}}}`)
+	session.post(`{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"` + petsTool + `","arguments":{"searchParams":{"api_key":"secret","species":"dog"}}}}`)
+
+	select {
+	case entry := <-sink:
+		if entry.ConfigID != "pets" || entry.Tool != petsTool || entry.Status != "ok" {
+			t.Fatalf("unexpected entry %+v", entry)
+		}
+		if entry.Method != http.MethodGet || entry.StatusCode != http.StatusOK || entry.ResponseSize != len(`{"name":"rex"}`) {
+			t.Fatalf("upstream call not recorded: %+v", entry)
+		}
+		searchParams := entry.Arguments["searchParams"].(map[string]interface{})
+		if searchParams["api_key"] != redactedValue || searchParams["species"] != "dog" {
+			t.Fatalf("arguments not redacted: %v", entry.Arguments)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("tool call was not audited")
+	}
+}
@@ -0,0 +1,151 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/anyisalin/mcp-openapi-to-mcp-adapter/metrics"
+)
+
+// BackpressurePolicy decides what happens when the event queue of a session is full
+type BackpressurePolicy string
+
+const (
+	// BackpressureBlock waits for room in the queue up to the backpressure timeout
+	BackpressureBlock BackpressurePolicy = "block"
+	// BackpressureReject fails the message immediately
+	BackpressureReject BackpressurePolicy = "reject"
+	// BackpressureDisconnect closes the session of the slow consumer
+	BackpressureDisconnect BackpressurePolicy = "disconnect"
+)
+
+const (
+	defaultEventQueueSize      = 100
+	defaultBackpressureTimeout = 10 * time.Second
+)
+
+var (
+	errEventQueueFull     = errors.New("event queue full")
+	errSessionClosed      = errors.New("session closed")
+	errSessionOverwhelmed = errors.New("session closed: event queue full")
+)
+
+// ParseBackpressurePolicy parses a backpressure policy name
+func ParseBackpressurePolicy(name string) (BackpressurePolicy, error) {
+	switch policy := BackpressurePolicy(name); policy {
+	case BackpressureBlock, BackpressureReject, BackpressureDisconnect:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("unknown backpressure policy: %s", name)
+	}
+}
+
+// WithEventQueueSize sets the capacity of the per-session event queue
+func WithEventQueueSize(size int) SSEOption {
+	return func(s *SSEServer) {
+		if size > 0 {
+			s.eventQueueSize = size
+		}
+	}
+}
+
+// WithBackpressure sets what happens when a session's event queue is full.
+// timeout bounds how long BackpressureBlock waits for room in the queue.
+func WithBackpressure(policy BackpressurePolicy, timeout time.Duration) SSEOption {
+	return func(s *SSEServer) {
+		s.backpressurePolicy = policy
+		if timeout > 0 {
+			s.backpressureTimeout = timeout
+		}
+	}
+}
+
+// enqueueEvent queues an event on the session's SSE stream, applying the
+// backpressure policy when the queue is full
+func (s *SSEServer) enqueueEvent(session *sseSession, event sseEvent) error {
+	select {
+	case session.eventQueue <- event:
+		return nil
+	case <-session.done:
+		return errSessionClosed
+	default:
+	}
+
+	switch s.backpressurePolicy {
+	case BackpressureReject:
+		s.dropEvent(session)
+		return errEventQueueFull
+	case BackpressureDisconnect:
+		s.dropEvent(session)
+		session.logger.Warn("event queue full, disconnecting slow consumer")
+		s.removeSession(session.sessionID)
+		return errSessionOverwhelmed
+	default:
+		timer := time.NewTimer(s.backpressureTimeout)
+		defer timer.Stop()
+		select {
+		case session.eventQueue <- event:
+			return nil
+		case <-session.done:
+			return errSessionClosed
+		case <-timer.C:
+			s.dropEvent(session)
+			return errEventQueueFull
+		}
+	}
+}
+
+// dropEvent records an event that could not be queued on the session
+func (s *SSEServer) dropEvent(session *sseSession) {
+	session.dropped.Add(1)
+	metrics.EventQueueDrops.WithLabelValues(string(s.backpressurePolicy)).Inc()
+}
+
+// SessionStats describes the state of an active session
+type SessionStats struct {
+	SessionID     string    `json:"sessionId"`
+	ConfigID      string    `json:"configId,omitempty"`
+	Revision      int       `json:"revision,omitempty"` // Revision of the configuration the session is pinned to
+	Connected     bool      `json:"connected"`          // False while a resumable session waits for its client
+	Initialized   bool      `json:"initialized"`
+	QueueDepth    int       `json:"queueDepth"`
+	QueueCapacity int       `json:"queueCapacity"`
+	Dropped       uint64    `json:"dropped"` // Events that could not be queued
+	LastActive    time.Time `json:"lastActive"`
+}
+
+// Sessions returns the stats of all sessions held by this server, ordered by session ID
+func (s *SSEServer) Sessions() []SessionStats {
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+
+	stats := []SessionStats{}
+	s.sessions.Range(func(key, value interface{}) bool {
+		session := value.(*sseSession)
+
+		session.mu.Lock()
+		connected := session.writer != nil
+		session.mu.Unlock()
+
+		stat := SessionStats{
+			SessionID:     session.sessionID,
+			Connected:     connected,
+			Initialized:   session.Initialized(),
+			QueueDepth:    len(session.eventQueue),
+			QueueCapacity: cap(session.eventQueue),
+			Dropped:       session.dropped.Load(),
+			LastActive:    time.Unix(0, session.lastActive.Load()),
+		}
+		if session.source != nil {
+			stat.ConfigID = session.source.configID
+			stat.Revision = session.source.revision
+		}
+		stats = append(stats, stat)
+		return true
+	})
+
+	sort.Slice(stats, func(i, j int) bool { return stats[i].SessionID < stats[j].SessionID })
+	return stats
+}
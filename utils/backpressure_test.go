@@ -0,0 +1,127 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// stalledSession opens a resumable session with a single-event queue, drops
+// its stream so nothing drains the queue, and fills the queue
+func stalledSession(t *testing.T, policy BackpressurePolicy, timeout time.Duration) (*SSEServer, *httptest.Server, *testSession) {
+	t.Helper()
+
+	ss, ts := newPetsServer(t, "http://upstream.invalid", nil,
+		WithEventQueueSize(1), WithBackpressure(policy, timeout), WithResumption(10, time.Minute))
+	session := openSession(t, ts.URL+"/sse?configId=pets")
+	session.stream.Close()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for stats := ss.Sessions(); len(stats) != 1 || stats[0].Connected; stats = ss.Sessions() {
+		if time.Now().After(deadline) {
+			t.Fatal("stream not detached")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if status := session.postStatus(`{"jsonrpc":"2.0","id":1,"method":"ping"}`); status != http.StatusAccepted {
+		t.Fatalf("ping returned %d", status)
+	}
+	return ss, ts, session
+}
+
+// postPing posts a ping and returns the response status and body
+func postPing(t *testing.T, session *testSession, id int) (int, string) {
+	t.Helper()
+
+	resp, err := http.Post(session.messageURL, "application/json", strings.NewReader(fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"method":"ping"}`, id)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, string(body)
+}
+
+func TestBackpressureBlockTimesOut(t *testing.T) {
+	const timeout = 300 * time.Millisecond
+	ss, ts, session := stalledSession(t, BackpressureBlock, timeout)
+
+	start := time.Now()
+	status, body := postPing(t, session, 2)
+	if elapsed := time.Since(start); elapsed < timeout {
+		t.Fatalf("full queue did not block, returned after %v", elapsed)
+	}
+	if status != http.StatusServiceUnavailable || !strings.Contains(body, "event queue full") {
+		t.Fatalf("timed out message got %d %s", status, body)
+	}
+	stats := ss.Sessions()
+	if stats[0].Dropped != 1 {
+		t.Fatalf("%d events dropped", stats[0].Dropped)
+	}
+
+	// A blocked message is queued once the client reconnects and drains the queue
+	posted := make(chan int, 1)
+	go func() {
+		resp, err := http.Post(session.messageURL, "application/json", strings.NewReader(`{"jsonrpc":"2.0","id":3,"method":"ping"}`))
+		if err != nil {
+			posted <- 0
+			return
+		}
+		resp.Body.Close()
+		posted <- resp.StatusCode
+	}()
+	time.Sleep(50 * time.Millisecond)
+	resumed := resume(t, ts.URL+"/sse", formatEventID(stats[0].SessionID, 0))
+	resumed.next()
+	if status := <-posted; status != http.StatusAccepted {
+		t.Fatalf("blocked message got %d", status)
+	}
+}
+
+func TestBackpressureRejectReturnsError(t *testing.T) {
+	ss, _, session := stalledSession(t, BackpressureReject, 0)
+
+	start := time.Now()
+	status, body := postPing(t, session, 2)
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("rejected message waited %v", elapsed)
+	}
+	var response struct {
+		ID    int `json:"id"`
+		Error struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal([]byte(body), &response); err != nil || status != http.StatusServiceUnavailable ||
+		response.ID != 2 || !strings.Contains(response.Error.Message, "event queue full") {
+		t.Fatalf("rejected message got %d %s", status, body)
+	}
+
+	// The session stays open
+	if stats := ss.Sessions(); len(stats) != 1 || stats[0].Dropped != 1 {
+		t.Fatalf("unexpected sessions %+v", stats)
+	}
+}
+
+func TestBackpressureDisconnectClosesSession(t *testing.T) {
+	ss, _, session := stalledSession(t, BackpressureDisconnect, 0)
+
+	if status, body := postPing(t, session, 2); status != http.StatusServiceUnavailable {
+		t.Fatalf("message for the slow consumer got %d %s", status, body)
+	}
+	if stats := ss.Sessions(); len(stats) != 0 {
+		t.Fatalf("slow consumer not disconnected: %+v", stats)
+	}
+	if status := session.postStatus(pingMessage); status != http.StatusBadRequest {
+		t.Fatalf("message for the closed session returned %d", status)
+	}
+}
@@ -0,0 +1,90 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// HeaderForward copies a header of the incoming MCP request to the upstream request
+type HeaderForward struct {
+	Incoming string // Header on the /sse or /message request
+	Upstream string // Header set on the upstream API request
+}
+
+// reservedIncomingHeaders carry mcp-link's own credentials and must never be forwarded
+var reservedIncomingHeaders = map[string]bool{
+	"Authorization": true,
+	"X-Api-Key":     true,
+	"Cookie":        true,
+}
+
+// ParseForwardHeaders parses header forwarding rules of the form
+// "Incoming-Header:Upstream-Header", or "Header" to keep the same name
+func ParseForwardHeaders(specs []string) ([]HeaderForward, error) {
+	var rules []HeaderForward
+	for _, spec := range specs {
+		incoming, upstream, found := strings.Cut(spec, ":")
+		incoming = http.CanonicalHeaderKey(strings.TrimSpace(incoming))
+		upstream = http.CanonicalHeaderKey(strings.TrimSpace(upstream))
+		if !found {
+			upstream = incoming
+		}
+		if incoming == "" || upstream == "" {
+			return nil, fmt.Errorf("invalid forward header %q", spec)
+		}
+		if reservedIncomingHeaders[incoming] {
+			return nil, fmt.Errorf("header %s carries mcp-link credentials and cannot be forwarded", incoming)
+		}
+		rules = append(rules, HeaderForward{Incoming: incoming, Upstream: upstream})
+	}
+	return rules, nil
+}
+
+// WithForwardHeaders makes the tool handler copy the allowed headers of the
+// incoming MCP request, passed through the context, to the upstream request
+func WithForwardHeaders(rules []HeaderForward) ToolHandlerOption {
+	return func(o *toolHandlerOptions) {
+		o.forwardHeaders = rules
+	}
+}
+
+type incomingHeadersContextKey struct{}
+
+// withIncomingHeaders stores the headers of the incoming MCP request in the context
+func withIncomingHeaders(ctx context.Context, header http.Header) context.Context {
+	return context.WithValue(ctx, incomingHeadersContextKey{}, header)
+}
+
+// IncomingHeaders returns the headers of the MCP request being handled, or nil
+func IncomingHeaders(ctx context.Context) http.Header {
+	header, _ := ctx.Value(incomingHeadersContextKey{}).(http.Header)
+	return header
+}
+
+// applyForwardHeaders sets the allowed incoming headers on the upstream request
+func applyForwardHeaders(ctx context.Context, req *http.Request, rules []HeaderForward) {
+	incoming := IncomingHeaders(ctx)
+	if incoming == nil {
+		return
+	}
+	for _, rule := range rules {
+		if value := incoming.Get(rule.Incoming); value != "" {
+			req.Header.Set(rule.Upstream, value)
+		}
+	}
+}
+
+// requestHeaders returns the headers of a message request, falling back to
+// the headers of the /sse request that opened the session
+func (s *sseSession) requestHeaders(header http.Header) http.Header {
+	merged := s.connectHeader.Clone()
+	if merged == nil {
+		merged = http.Header{}
+	}
+	for key, values := range header {
+		merged[key] = values
+	}
+	return merged
+}
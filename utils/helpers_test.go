@@ -0,0 +1,143 @@
+package utils
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const initializeMessage = `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2024-11-05","capabilities":%s,"clientInfo":{"name":"test","version":"1"}}}`
+
+type staticConfigLoader struct {
+	config *Config
+}
+
+func (l *staticConfigLoader) LoadConfig(ctx context.Context, id string) (*Config, error) {
+	if id != l.config.ID {
+		return nil, fmt.Errorf("configuration %s not found", id)
+	}
+	return l.config, nil
+}
+
+// petsTool is the tool of the GET /pet operation of the "pets" configuration
+var petsTool = sanitizeToolName(toolPrefix(APIInfo{Title: "Pets"}) + "_get_/pet")
+
+// newPetsServer serves an SSE server with the "pets" configuration, an API
+// with a single GET /pet operation served by the upstream
+func newPetsServer(t *testing.T, upstreamURL string, approval *ApprovalPolicy, opts ...SSEOption) (*SSEServer, *httptest.Server) {
+	t.Helper()
+
+	schemaPath := filepath.Join(t.TempDir(), "pets.json")
+	schema := `{"openapi":"3.0.0","info":{"title":"Pets","version":"1"},"paths":{"/pet":{"get":{"operationId":"getPet","tags":["pets"]}}}}`
+	if err := os.WriteFile(schemaPath, []byte(schema), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	config := &Config{ID: "pets", SchemaURL: schemaPath, BaseURL: upstreamURL, Approval: approval}
+	ss := NewSSEServer(append([]SSEOption{WithConfigLoader(&staticConfigLoader{config: config})}, opts...)...)
+	ts := httptest.NewServer(ss)
+	t.Cleanup(ts.Close)
+	return ss, ts
+}
+
+// testSession is a client connected to the SSE endpoint
+type testSession struct {
+	t          *testing.T
+	messageURL string
+	events     *bufio.Reader
+	stream     io.Closer
+}
+
+// openSession connects to the SSE endpoint. The connection is closed when the test ends.
+func openSession(t *testing.T, sseURL string) *testSession {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodGet, sseURL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return openSessionRequest(t, req)
+}
+
+// openSessionRequest connects to the SSE endpoint with the request
+func openSessionRequest(t *testing.T, req *http.Request) *testSession {
+	t.Helper()
+
+	stream, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { stream.Body.Close() })
+	if stream.StatusCode != http.StatusOK {
+		t.Fatalf("SSE connection returned %d", stream.StatusCode)
+	}
+
+	session := &testSession{t: t, events: bufio.NewReader(stream.Body), stream: stream.Body}
+	session.messageURL = req.URL.Scheme + "://" + req.URL.Host + session.next()
+	return session
+}
+
+// post sends a message to the session; it may be called from any goroutine
+func (s *testSession) post(body string) {
+	resp, err := http.Post(s.messageURL, "application/json", strings.NewReader(body))
+	if err != nil {
+		s.t.Errorf("post message: %v", err)
+		return
+	}
+	resp.Body.Close()
+}
+
+// next returns the data of the next event on the SSE stream
+func (s *testSession) next() string {
+	s.t.Helper()
+
+	_, data := s.nextEvent()
+	return data
+}
+
+// nextEvent returns the ID and data of the next event on the SSE stream
+func (s *testSession) nextEvent() (string, string) {
+	s.t.Helper()
+
+	var id string
+	for {
+		line, err := s.events.ReadString('\n')
+		if err != nil {
+			s.t.Fatalf("no event: %v", err)
+		}
+		switch {
+		case strings.HasPrefix(line, "id: "):
+			id = strings.TrimSpace(strings.TrimPrefix(line, "id: "))
+		case strings.HasPrefix(line, "data: "):
+			return id, strings.TrimSpace(strings.TrimPrefix(line, "data: "))
+		}
+	}
+}
+
+// closed waits for the server to end the SSE stream, draining pending events
+func (s *testSession) closed() {
+	for {
+		if _, err := s.events.ReadString('\n'); err != nil {
+			return
+		}
+	}
+}
+
+// postStatus sends a message to the session and returns the response status
+func (s *testSession) postStatus(body string) int {
+	s.t.Helper()
+
+	resp, err := http.Post(s.messageURL, "application/json", strings.NewReader(body))
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
@@ -0,0 +1,94 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Attribute keys shared by the structured log records of the SSE server
+const (
+	LogKeySessionID    = "session_id"
+	LogKeyConfigID     = "config_id"
+	LogKeyUpstreamHost = "upstream_host"
+	LogKeyTool         = "tool"
+	LogKeyLatency      = "latency_ms"
+	LogKeyStatus       = "status"
+)
+
+// NewLogger creates a logger writing records in the given format, text or
+// json, at or above the given level: debug, info, warn or error
+func NewLogger(w io.Writer, format, level string) (*slog.Logger, error) {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("unknown log level: %s", level)
+	}
+	opts := &slog.HandlerOptions{Level: lvl}
+
+	switch strings.ToLower(format) {
+	case "text", "":
+		return slog.New(slog.NewTextHandler(w, opts)), nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(w, opts)), nil
+	default:
+		return nil, fmt.Errorf("unknown log format: %s", format)
+	}
+}
+
+// WithLogger sets the logger of the SSE server. Without it slog.Default() is used.
+func WithLogger(logger *slog.Logger) SSEOption {
+	return func(s *SSEServer) {
+		if logger != nil {
+			s.logger = logger
+		}
+	}
+}
+
+// loggerContextKey is the context key of the logger of the current session
+type loggerContextKey struct{}
+
+// withLogger returns a context carrying the logger
+func withLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerContextKey{}, logger)
+}
+
+// LoggerFromContext returns the logger of the session handling the request,
+// carrying its session and config IDs, or slog.Default() outside a session
+func LoggerFromContext(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(loggerContextKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
+
+// latencyAttr returns the latency attribute in milliseconds
+func latencyAttr(d time.Duration) slog.Attr {
+	return slog.Float64(LogKeyLatency, float64(d.Microseconds())/1000)
+}
+
+// upstreamLogger returns the logger for records of an upstream request. Session
+// loggers already carry the upstream host.
+func upstreamLogger(ctx context.Context, req *http.Request) *slog.Logger {
+	if logger, ok := ctx.Value(loggerContextKey{}).(*slog.Logger); ok {
+		return logger.With("http_method", req.Method)
+	}
+	return slog.Default().With(LogKeyUpstreamHost, req.URL.Hostname(), "http_method", req.Method)
+}
+
+// sessionLogger returns the logger for records of a session built from source
+func (s *SSEServer) sessionLogger(sessionID string, source *sessionSource) *slog.Logger {
+	attrs := []any{slog.String(LogKeySessionID, sessionID)}
+	if source != nil {
+		if source.configID != "" {
+			attrs = append(attrs, slog.String(LogKeyConfigID, source.configID))
+		}
+		if host, _ := getHostFromURL(source.params.BaseURL); host != "" {
+			attrs = append(attrs, slog.String(LogKeyUpstreamHost, host))
+		}
+	}
+	return s.logger.With(attrs...)
+}
@@ -0,0 +1,89 @@
+package utils
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/anyisalin/mcp-openapi-to-mcp-adapter/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestUpstreamHostLabel(t *testing.T) {
+	handlerOptions := func(params RequestParams) *toolHandlerOptions {
+		var options toolHandlerOptions
+		for _, opt := range params.toolHandlerOptions() {
+			opt(&options)
+		}
+		return &options
+	}
+	stored := handlerOptions(RequestParams{ConfigID: "pets", BaseURL: "https://api.example.com:8443/v1"})
+	adHoc := handlerOptions(RequestParams{BaseURL: "https://api.example.com:8443/v1"})
+
+	for _, test := range []struct {
+		options *toolHandlerOptions
+		url     string
+		label   string
+	}{
+		{stored, "https://api.example.com:8443/v1/pets", "api.example.com"},
+		{stored, "https://elsewhere.example.com/v1/pets", metrics.OtherLabel},
+		{adHoc, "https://api.example.com:8443/v1/pets", metrics.OtherLabel},
+	} {
+		req := httptest.NewRequest(http.MethodGet, test.url, nil)
+		if label := test.options.upstreamHostLabel(req); label != test.label {
+			t.Errorf("%s labelled %q, want %q", test.url, label, test.label)
+		}
+	}
+}
+
+// callPetsTool calls the tool of the "pets" configuration once
+func callPetsTool(t *testing.T, opts ...SSEOption) {
+	t.Helper()
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"name":"rex"}`)
+	}))
+	defer upstream.Close()
+
+	_, ts := newPetsServer(t, upstream.URL, nil, opts...)
+	session := openSession(t, ts.URL+"/sse?configId=pets")
+	session.post(fmt.Sprintf(initializeMessage, `{}`))
+	session.next()
+	session.post(`{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"` + petsTool + `","arguments":{}}}`)
+	if result := session.next(); !strings.Contains(result, "rex") {
+		t.Fatalf("unexpected tool result %s", result)
+	}
+}
+
+func TestToolCallMetricLabels(t *testing.T) {
+	unlabelled := metrics.ToolCalls.WithLabelValues("", petsTool, "ok")
+	labelled := metrics.ToolCalls.WithLabelValues("pets", petsTool, "ok")
+
+	before := testutil.ToFloat64(unlabelled)
+	callPetsTool(t)
+	if calls := testutil.ToFloat64(unlabelled) - before; calls != 1 {
+		t.Fatalf("%v calls counted without the configuration label", calls)
+	}
+
+	before = testutil.ToFloat64(labelled)
+	callPetsTool(t, WithConfigMetricLabels(true))
+	if calls := testutil.ToFloat64(labelled) - before; calls != 1 {
+		t.Fatalf("%v calls counted with the configuration label", calls)
+	}
+
+	// Tools of ad-hoc sessions and unknown tools are not named
+	ss := NewSSEServer(WithConfigMetricLabels(true))
+	for _, test := range []struct {
+		configID, status string
+	}{
+		{"", "ok"},
+		{"pets", "error"},
+	} {
+		labels := ss.toolCallLabels(&sseSession{configID: test.configID}, "client_chosen_tool", test.status)
+		if labels[1] != metrics.OtherLabel {
+			t.Errorf("tool of %+v labelled %q", test, labels[1])
+		}
+	}
+}
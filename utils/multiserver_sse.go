@@ -5,10 +5,10 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
 	"net/url"
-	"os"
+	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -16,23 +16,44 @@ import (
 
 	"encoding/base64"
 
-	"github.com/anyisalin/mcp-openapi-to-mcp-adapter/db/mongo"
-	"github.com/anyisalin/mcp-openapi-to-mcp-adapter/repositories"
-	"github.com/anyisalin/mcp-openapi-to-mcp-adapter/services"
+	"github.com/anyisalin/mcp-openapi-to-mcp-adapter/auth"
+	"github.com/anyisalin/mcp-openapi-to-mcp-adapter/egress"
+	"github.com/anyisalin/mcp-openapi-to-mcp-adapter/metrics"
+	"github.com/anyisalin/mcp-openapi-to-mcp-adapter/tracing"
 	"github.com/google/uuid"
 	"github.com/mark3labs/mcp-go/mcp"
 	"github.com/mark3labs/mcp-go/server"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // sseSession represents an active SSE connection.
 type sseSession struct {
-	writer              http.ResponseWriter
-	flusher             http.Flusher
 	done                chan struct{}
-	eventQueue          chan string // Channel for queuing events
+	eventQueue          chan sseEvent // Channel for queuing events
 	sessionID           string
 	notificationChannel chan mcp.JSONRPCNotification
 	initialized         atomic.Bool
+	source              *sessionSource // What the session's MCP server was built from, guarded by SSEServer.reloadMu
+	closeOnce           sync.Once
+	lastActive          atomic.Int64    // Unix nanoseconds of the last client activity
+	dropped             atomic.Uint64   // Events that could not be queued because the queue was full
+	principal           *auth.Principal // Caller that opened the session, nil without authentication
+	connectHeader       http.Header     // Headers of the /sse request, for header forwarding
+	logger              *slog.Logger    // Logger carrying the session ID, config ID and upstream host
+	configID            string          // Stored configuration the session was opened with, empty for ad-hoc sessions
+	elicitation         atomic.Bool     // The client declared the elicitation capability
+
+	// Stream state, guarded by mu. The session outlives a single connection
+	// when it can be resumed with Last-Event-ID.
+	mu          sync.Mutex
+	writer      http.ResponseWriter // Current stream, nil while detached
+	flusher     http.Flusher
+	takeover    chan struct{} // Closed when another connection attaches
+	expiry      *time.Timer   // Removes the session if it stays detached
+	nextEventID uint64
+	replay      []sseEvent // Most recently written events, for replay on resume
 }
 
 // SSEContextFunc is a function that takes an existing context and the current
@@ -56,6 +77,23 @@ func (s *sseSession) Initialized() bool {
 	return s.initialized.Load()
 }
 
+// close closes the done channel of the session exactly once
+func (s *sseSession) close() {
+	s.closeOnce.Do(func() {
+		close(s.done)
+	})
+}
+
+// touch records client activity on the session
+func (s *sseSession) touch() {
+	s.lastActive.Store(time.Now().UnixNano())
+}
+
+// idleFor returns how long the session has been without client activity
+func (s *sseSession) idleFor() time.Duration {
+	return time.Since(time.Unix(0, s.lastActive.Load()))
+}
+
 var _ server.ClientSession = (*sseSession)(nil)
 
 // SSEServer implements a Server-Sent Events (SSE) based MCP server.
@@ -71,9 +109,41 @@ type SSEServer struct {
 	sessions        sync.Map
 	srv             *http.Server
 	contextFunc     SSEContextFunc
-	debugMode       bool   // Flag to enable/disable debug logging
-	logPrefix       string // Prefix for log messages
+	logger          *slog.Logger // Structured logger, debug records are logged at slog.LevelDebug
+	logPrefix       string       // Logged as the server attribute of every record if set
 	configLoader    ConfigLoader
+
+	specPollInterval time.Duration // Interval for re-checking remote schemas, 0 disables polling
+	reloadMu         sync.Mutex    // Serializes rebuilds of session MCP servers
+	shutdownCh       chan struct{}
+	shutdownOnce     sync.Once
+
+	idleTimeout    time.Duration  // Sessions without client activity for this long are closed, 0 disables
+	maxSessions    int            // Maximum number of concurrent sessions, 0 means unlimited
+	activeSessions atomic.Int64   // Number of SSE connections currently being served
+	lifecycleMu    sync.Mutex     // Orders session admission against shutdown
+	handlers       sync.WaitGroup // Running SSE handlers, drained by Shutdown
+
+	keepAliveInterval time.Duration // Interval between keepalive comments, 0 disables
+	replayBufferSize  int           // Events kept per session for Last-Event-ID replay, 0 disables resumption
+	resumeWindow      time.Duration // How long a disconnected session can be resumed
+
+	replicaID       string          // Identifies this replica in the session registry
+	sessionRegistry SessionRegistry // Shared session ownership, nil for a single replica
+	messageRelay    MessageRelay    // Forwards messages to the replica owning the session
+
+	eventQueueSize      int                // Capacity of the per-session event queue
+	backpressurePolicy  BackpressurePolicy // What to do when a session's event queue is full
+	backpressureTimeout time.Duration      // How long BackpressureBlock waits for room in the queue
+
+	redactor  *Redactor // Removes secrets and personal data from logged payloads
+	auditSink AuditSink // Records tool calls, nil to disable auditing
+
+	approvals        sync.Map         // Pending approvals of this replica by ID, *pendingApproval
+	approvalTimeout  time.Duration    // How long calls wait for approval when their policy sets no timeout
+	approvalRegistry ApprovalRegistry // Pending approvals of all replicas, nil for a single replica
+
+	configMetricLabels bool // Label tool call metrics with the configuration ID
 }
 
 // SSEOption defines a function type for configuring SSEServer
@@ -143,13 +213,14 @@ func WithSSEContextFunc(fn SSEContextFunc) SSEOption {
 }
 
 // WithDebugMode sets the debug mode for logging
+//
+// Deprecated: debug records are logged at slog.LevelDebug, pass a logger
+// enabled for that level to WithLogger instead.
 func WithDebugMode(debug bool) SSEOption {
-	return func(s *SSEServer) {
-		s.debugMode = debug
-	}
+	return func(s *SSEServer) {}
 }
 
-// WithLogPrefix sets a custom prefix for log messages
+// WithLogPrefix sets a custom prefix for log messages, logged as the server attribute
 func WithLogPrefix(prefix string) SSEOption {
 	return func(s *SSEServer) {
 		s.logPrefix = prefix
@@ -163,12 +234,110 @@ func WithConfigLoader(loader ConfigLoader) SSEOption {
 	}
 }
 
+// WithSpecPollInterval sets how often remote schemas of active sessions are
+// re-fetched to detect changes. A zero interval disables polling.
+func WithSpecPollInterval(interval time.Duration) SSEOption {
+	return func(s *SSEServer) {
+		s.specPollInterval = interval
+	}
+}
+
+// WithIdleTimeout sets how long a session may go without client messages
+// before it is closed. A zero timeout disables idle expiry.
+func WithIdleTimeout(timeout time.Duration) SSEOption {
+	return func(s *SSEServer) {
+		s.idleTimeout = timeout
+	}
+}
+
+// WithMaxSessions sets the maximum number of concurrent SSE sessions.
+// Connections beyond the limit are rejected with 503. Zero means unlimited.
+func WithMaxSessions(max int) SSEOption {
+	return func(s *SSEServer) {
+		s.maxSessions = max
+	}
+}
+
+// WithConfigMetricLabels labels tool call metrics with the ID of the stored
+// configuration. Every configuration adds its own series, so it is off by default.
+func WithConfigMetricLabels(enabled bool) SSEOption {
+	return func(s *SSEServer) {
+		s.configMetricLabels = enabled
+	}
+}
+
+// toolCallLabels returns the config_id, tool and status labels of a tool
+// call. Tools of ad-hoc sessions come from schemas chosen by clients, and calls
+// of tools that don't exist fail with a JSON-RPC error, so neither names a tool.
+func (s *SSEServer) toolCallLabels(session *sseSession, toolName, status string) []string {
+	configID := ""
+	if s.configMetricLabels {
+		configID = session.configID
+	}
+	if session.configID == "" || status == "error" {
+		toolName = metrics.OtherLabel
+	}
+	return []string{configID, toolName, status}
+}
+
+// WithKeepAliveInterval sets how often a keepalive comment is sent on idle
+// SSE streams. A zero interval disables keepalives.
+func WithKeepAliveInterval(interval time.Duration) SSEOption {
+	return func(s *SSEServer) {
+		s.keepAliveInterval = interval
+	}
+}
+
+// WithResumption enables resumable streams. Every session keeps its last
+// bufferSize events, and a session whose client disconnected is kept for
+// window so a client reconnecting with Last-Event-ID gets the missed events.
+func WithResumption(bufferSize int, window time.Duration) SSEOption {
+	return func(s *SSEServer) {
+		s.replayBufferSize = bufferSize
+		s.resumeWindow = window
+	}
+}
+
+// WithReplicaID sets the identifier of this replica. Defaults to the hostname
+// followed by a random suffix.
+func WithReplicaID(replicaID string) SSEOption {
+	return func(s *SSEServer) {
+		s.replicaID = replicaID
+	}
+}
+
+// WithSessionRegistry sets the registry recording which replica owns each
+// session. Together with WithMessageRelay it lets any replica accept messages
+// for sessions whose SSE stream is held by another replica.
+func WithSessionRegistry(registry SessionRegistry) SSEOption {
+	return func(s *SSEServer) {
+		s.sessionRegistry = registry
+	}
+}
+
+// WithMessageRelay sets the relay used to forward messages between replicas
+func WithMessageRelay(relay MessageRelay) SSEOption {
+	return func(s *SSEServer) {
+		s.messageRelay = relay
+	}
+}
+
 // NewSSEServer creates a new SSE server instance with the given MCP server and options.
 func NewSSEServer(opts ...SSEOption) *SSEServer {
 	s := &SSEServer{
 		servers:         map[string]*server.MCPServer{},
 		sseEndpoint:     "/sse",
 		messageEndpoint: "/message",
+		shutdownCh:      make(chan struct{}),
+
+		eventQueueSize:      defaultEventQueueSize,
+		backpressurePolicy:  BackpressureBlock,
+		backpressureTimeout: defaultBackpressureTimeout,
+
+		redactor: defaultRedactor,
+		logger:   slog.Default(),
+
+		approvalTimeout: defaultApprovalTimeout,
 	}
 
 	// Apply all options
@@ -176,6 +345,24 @@ func NewSSEServer(opts ...SSEOption) *SSEServer {
 		opt(s)
 	}
 
+	if s.logPrefix != "" {
+		s.logger = s.logger.With("server", s.logPrefix)
+	}
+
+	if s.replicaID == "" {
+		s.replicaID = defaultReplicaID()
+	}
+
+	if s.specPollInterval > 0 {
+		go s.pollSpecs()
+	}
+	if s.sessionRegistry != nil {
+		go s.refreshSessions()
+	}
+	if s.messageRelay != nil {
+		go s.consumeRelayedMessages()
+	}
+
 	return s
 }
 
@@ -190,44 +377,110 @@ func (s *SSEServer) Start(addr string) error {
 	return s.srv.ListenAndServe()
 }
 
-// Shutdown gracefully stops the SSE server, closing all active sessions
-// and shutting down the HTTP server.
+// Shutdown gracefully stops the SSE server. It stops accepting new sessions,
+// closes all active sessions and waits for their handlers to finish, then
+// shuts down the HTTP server if the SSE server owns one (see Start). When the
+// SSE server is mounted on an external mux, call Shutdown before shutting
+// down the outer http.Server, which would otherwise wait on open streams.
 func (s *SSEServer) Shutdown(ctx context.Context) error {
+	s.lifecycleMu.Lock()
+	s.shutdownOnce.Do(func() {
+		close(s.shutdownCh)
+	})
+	s.lifecycleMu.Unlock()
+
+	// Close all sessions so their SSE handlers return, including detached ones
+	s.sessions.Range(func(key, value interface{}) bool {
+		s.removeSession(key.(string))
+		return true
+	})
+
+	drained := make(chan struct{})
+	go func() {
+		s.handlers.Wait()
+		close(drained)
+	}()
+
+	var err error
+	select {
+	case <-drained:
+		s.logger.Info("all sessions closed")
+	case <-ctx.Done():
+		err = fmt.Errorf("timed out waiting for sessions to close: %w", ctx.Err())
+	}
+
 	if s.srv != nil {
-		s.sessions.Range(func(key, value interface{}) bool {
-			if session, ok := value.(*sseSession); ok {
-				close(session.done)
-			}
-			s.sessions.Delete(key)
-			return true
-		})
+		if shutdownErr := s.srv.Shutdown(ctx); err == nil {
+			err = shutdownErr
+		}
+	}
+	return err
+}
+
+// acquireSession admits a new SSE connection, enforcing the session limit
+// unless the connection resumes an existing session. Every successful call
+// must be paired with releaseSession.
+func (s *SSEServer) acquireSession(resume bool) error {
+	s.lifecycleMu.Lock()
+	defer s.lifecycleMu.Unlock()
 
-		return s.srv.Shutdown(ctx)
+	select {
+	case <-s.shutdownCh:
+		return fmt.Errorf("server is shutting down")
+	default:
+	}
+
+	if n := s.activeSessions.Add(1); !resume && s.maxSessions > 0 && n > int64(s.maxSessions) {
+		s.activeSessions.Add(-1)
+		return fmt.Errorf("too many active sessions (limit %d)", s.maxSessions)
 	}
+	s.handlers.Add(1)
 	return nil
 }
 
-// logMessage logs a message with the server's prefix if set
-func (s *SSEServer) logMessage(format string, v ...interface{}) {
-	if s.logPrefix != "" {
-		format = fmt.Sprintf("[%s] %s", s.logPrefix, format)
+// releaseSession releases a slot acquired with acquireSession
+func (s *SSEServer) releaseSession() {
+	s.activeSessions.Add(-1)
+	s.handlers.Done()
+}
+
+// removeSession closes a session and drops every reference held for it
+func (s *SSEServer) removeSession(sessionID string) {
+	if value, ok := s.sessions.LoadAndDelete(sessionID); ok {
+		value.(*sseSession).close()
+		s.unregisterSession(sessionID)
+		metrics.SessionsClosed.Inc()
+		metrics.SessionsActive.Dec()
+	}
+
+	s.serversMutex.Lock()
+	mcpServer := s.servers[sessionID]
+	delete(s.servers, sessionID)
+	s.serversMutex.Unlock()
+
+	if mcpServer != nil {
+		mcpServer.UnregisterSession(sessionID)
+	}
+}
+
+// idleCheckInterval returns how often idle sessions are checked for the given timeout
+func idleCheckInterval(timeout time.Duration) time.Duration {
+	interval := timeout / 4
+	if interval < time.Second {
+		interval = time.Second
 	}
-	log.Printf(format, v...)
+	return interval
 }
 
 // handleSSE handles incoming SSE connection requests.
 // It sets up appropriate headers and creates a new session for the client.
-func (s *SSEServer) handleSSE(mcpServer *server.MCPServer, w http.ResponseWriter, r *http.Request) {
+// The source describes what mcpServer was built from so the session can be rebuilt on reload.
+func (s *SSEServer) handleSSE(mcpServer *server.MCPServer, source *sessionSource, w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	w.Header().Set("Content-Type", "text/event-stream")
-	w.Header().Set("Cache-Control", "no-cache")
-	w.Header().Set("Connection", "keep-alive")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-
 	flusher, ok := w.(http.Flusher)
 	if !ok {
 		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
@@ -235,15 +488,27 @@ func (s *SSEServer) handleSSE(mcpServer *server.MCPServer, w http.ResponseWriter
 	}
 
 	sessionID := uuid.New().String()
-	s.logMessage("[CONNECTION] New user connected. Session ID: %s, Remote Address: %s", sessionID, r.RemoteAddr)
 
 	session := &sseSession{
-		writer:              w,
-		flusher:             flusher,
 		done:                make(chan struct{}),
-		eventQueue:          make(chan string, 100), // Buffer for events
+		eventQueue:          make(chan sseEvent, s.eventQueueSize), // Buffer for events
 		sessionID:           sessionID,
 		notificationChannel: make(chan mcp.JSONRPCNotification, 100),
+		source:              source,
+		principal:           auth.PrincipalFromRequest(r),
+		connectHeader:       r.Header.Clone(),
+		logger:              s.sessionLogger(sessionID, source),
+	}
+	if source != nil {
+		session.configID = source.configID
+	}
+	session.touch()
+	session.logger.Info("session connected", "remote_addr", r.RemoteAddr)
+
+	if err := mcpServer.RegisterSession(session); err != nil {
+		session.logger.Error("session registration failed", "error", err)
+		http.Error(w, fmt.Sprintf("Session registration failed: %v", err), http.StatusInternalServerError)
+		return
 	}
 
 	// Protect map write with mutex
@@ -252,40 +517,21 @@ func (s *SSEServer) handleSSE(mcpServer *server.MCPServer, w http.ResponseWriter
 	s.serversMutex.Unlock()
 
 	s.sessions.Store(sessionID, session)
-	defer s.sessions.Delete(sessionID)
-
-	// Use read lock when accessing the map for reading
-	s.serversMutex.RLock()
-	mcpServer = s.servers[sessionID]
-	s.serversMutex.RUnlock()
-
-	if err := mcpServer.RegisterSession(session); err != nil {
-		s.logMessage("[ERROR] Session registration failed: %v, Session ID: %s", err, sessionID)
-		http.Error(w, fmt.Sprintf("Session registration failed: %v", err), http.StatusInternalServerError)
-		return
-	}
-	defer func() {
-		s.serversMutex.Lock()
-		defer s.serversMutex.Unlock()
-		mcpServer.UnregisterSession(sessionID)
-		s.sessions.Delete(sessionID)
-		s.logMessage("[DISCONNECTION] User disconnected. Session ID: %s", sessionID)
-	}()
+	s.registerSession(session)
+	metrics.SessionsOpened.Inc()
+	metrics.SessionsActive.Inc()
 
-	// Start notification handler for this session
+	// Start notification handler for this session. It outlives the connection
+	// so notifications are still queued while a resumable session is detached.
 	go func() {
 		for {
 			select {
 			case notification := <-session.notificationChannel:
 				eventData, err := json.Marshal(notification)
 				if err == nil {
-					if s.debugMode {
-						s.logMessage("[NOTIFICATION] Sending notification to session %s: %s", sessionID, string(eventData))
-					} else {
-						s.logMessage("[NOTIFICATION] Sending notification to session %s", sessionID)
-					}
+					session.logger.Debug("sending notification", "method", notification.Method)
 					select {
-					case session.eventQueue <- fmt.Sprintf("event: message\ndata: %s\n\n", eventData):
+					case session.eventQueue <- newMessageEvent(eventData):
 						// Event queued successfully
 					case <-session.done:
 						return
@@ -293,34 +539,134 @@ func (s *SSEServer) handleSSE(mcpServer *server.MCPServer, w http.ResponseWriter
 				}
 			case <-session.done:
 				return
-			case <-r.Context().Done():
-				return
 			}
 		}
 	}()
 
+	s.streamSession(session, w, flusher, r, 0, false)
+}
+
+// resumeSSE reattaches a client reconnecting with Last-Event-ID to its
+// existing session and replays the events it missed.
+func (s *SSEServer) resumeSSE(session *sseSession, lastSeq uint64, w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	session.logger.Info("session resumed", "last_event", lastSeq, "remote_addr", r.RemoteAddr)
+	session.touch()
+	s.streamSession(session, w, flusher, r, lastSeq, true)
+}
+
+// streamSession attaches w as the stream of the session and delivers queued
+// events until the client goes away, the session is closed or another
+// connection resumes the session.
+func (s *SSEServer) streamSession(session *sseSession, w http.ResponseWriter, flusher http.Flusher, r *http.Request, lastSeq uint64, resumed bool) {
+	sessionID := session.sessionID
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
 	messageEndpoint := fmt.Sprintf("%s?sessionId=%s", s.CompleteMessageEndpoint(), sessionID)
-	s.logMessage("[ENDPOINT] Session %s message endpoint: %s", sessionID, messageEndpoint)
+	session.logger.Debug("message endpoint sent", "endpoint", messageEndpoint)
+
+	// Send the endpoint event, followed by the missed events when resuming
+	takeover := session.attach(w, flusher, messageEndpoint, lastSeq, resumed)
+
+	// Periodically check whether the session went idle
+	var idleCheck <-chan time.Time
+	if s.idleTimeout > 0 {
+		ticker := time.NewTicker(idleCheckInterval(s.idleTimeout))
+		defer ticker.Stop()
+		idleCheck = ticker.C
+	}
 
-	// Send the initial endpoint event
-	fmt.Fprintf(w, "event: endpoint\ndata: %s\r\n\r\n", messageEndpoint)
-	flusher.Flush()
+	// Periodically send keepalive comments so idle connections aren't cut by proxies
+	var keepAlive <-chan time.Time
+	if s.keepAliveInterval > 0 {
+		ticker := time.NewTicker(s.keepAliveInterval)
+		defer ticker.Stop()
+		keepAlive = ticker.C
+	}
 
 	// Main event loop - this runs in the HTTP handler goroutine
 	for {
 		select {
 		case event := <-session.eventQueue:
 			// Write the event to the response
-			fmt.Fprint(w, event)
-			flusher.Flush()
+			session.writeEvent(event, s.replayBufferSize)
+		case <-keepAlive:
+			session.writePing(w)
+		case <-idleCheck:
+			if idle := session.idleFor(); idle >= s.idleTimeout {
+				session.logger.Info("session idle, closing", "idle", idle.Round(time.Second))
+				session.detach(w)
+				s.removeSession(sessionID)
+				return
+			}
+		case <-takeover:
+			session.logger.Info("session resumed on another connection")
+			return
+		case <-session.done:
+			session.logger.Info("session closed by server")
+			session.detach(w)
+			return
 		case <-r.Context().Done():
-			s.logMessage("[DISCONNECTION] Client connection terminated. Session ID: %s", sessionID)
-			close(session.done)
+			session.logger.Info("client connection terminated")
+			if !session.detach(w) {
+				// Another connection already took over the session
+				return
+			}
+			if s.resumable() {
+				session.logger.Info("session kept for resumption", "resume_window", s.resumeWindow)
+				session.expireAfter(s.resumeWindow, func() {
+					session.logger.Info("session expired without being resumed")
+					s.removeSession(sessionID)
+				})
+				return
+			}
+			s.removeSession(sessionID)
+			session.logger.Info("session disconnected")
 			return
 		}
 	}
 }
 
+// resumable reports whether disconnected sessions are kept for resumption
+func (s *SSEServer) resumable() bool {
+	return s.replayBufferSize > 0 && s.resumeWindow > 0
+}
+
+// findResumableSession returns the session and last seen event sequence
+// referenced by the Last-Event-ID of a reconnecting client, if any
+func (s *SSEServer) findResumableSession(r *http.Request) (*sseSession, uint64, bool) {
+	if !s.resumable() {
+		return nil, 0, false
+	}
+	eventID := lastEventID(r)
+	if eventID == "" {
+		return nil, 0, false
+	}
+	sessionID, seq, ok := parseEventID(eventID)
+	if !ok {
+		return nil, 0, false
+	}
+	value, ok := s.sessions.Load(sessionID)
+	if !ok {
+		return nil, 0, false
+	}
+	return value.(*sseSession), seq, true
+}
+
 // handleMessage processes incoming JSON-RPC messages from clients and sends responses
 // back through both the SSE connection and HTTP response.
 func (s *SSEServer) handleMessage(w http.ResponseWriter, r *http.Request) {
@@ -335,122 +681,232 @@ func (s *SSEServer) handleMessage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	s.logMessage("[MESSAGE] Received message for session ID: %s, Remote Address: %s", sessionID, r.RemoteAddr)
+	s.logger.Debug("message received", LogKeySessionID, sessionID, "remote_addr", r.RemoteAddr)
 
 	sessionI, ok := s.sessions.Load(sessionID)
 	if !ok {
-		s.logMessage("[ERROR] Invalid session ID: %s", sessionID)
+		// The SSE stream of the session may be held by another replica
+		if s.relayMessage(w, r, sessionID) {
+			return
+		}
+		s.logger.Warn("message for unknown session", LogKeySessionID, sessionID)
 		s.writeJSONRPCError(w, nil, mcp.INVALID_PARAMS, "Invalid session ID")
 		return
 	}
 	session := sessionI.(*sseSession)
+	if !session.ownedBy(auth.PrincipalFromRequest(r)) {
+		session.logger.Warn("message from a different principal rejected", "subject", subjectOf(auth.PrincipalFromRequest(r)))
+		s.writeJSONRPCErrorWithStatus(w, http.StatusForbidden, nil, mcp.INVALID_REQUEST, "Forbidden")
+		return
+	}
+	session.touch()
 
 	// Use read lock when accessing the map for reading
 	s.serversMutex.RLock()
 	server := s.servers[sessionID]
 	s.serversMutex.RUnlock()
 
-	// Use the retrieved server
-	ctx := server.WithContext(r.Context(), session)
+	// The session may have been removed since it was looked up
+	if server == nil {
+		session.logger.Error("session has no MCP server")
+		s.writeJSONRPCError(w, nil, mcp.INVALID_PARAMS, "Invalid session ID")
+		return
+	}
+
+	// Use the retrieved server. Processing may outlive the POST once it is
+	// detached from it, e.g. while a call waits for approval.
+	ctx := server.WithContext(tracing.ExtractHTTP(context.WithoutCancel(r.Context()), r.Header), session)
+	ctx = withIncomingHeaders(ctx, session.requestHeaders(r.Header))
 	if s.contextFunc != nil {
 		ctx = s.contextFunc(ctx, r)
 	}
 
+	session.logger.Debug("message request headers", "headers", s.redactor.Headers(r.Header))
+
 	// Parse message as raw JSON
 	var rawMessage json.RawMessage
-	s.logMessage("[MESSAGE] Sending message to client: %s", string(rawMessage))
 	if err := json.NewDecoder(r.Body).Decode(&rawMessage); err != nil {
-		s.logMessage("[ERROR] Parse error for session %s: %v", sessionID, err)
+		session.logger.Warn("message parse error", "error", err)
 		s.writeJSONRPCError(w, nil, mcp.PARSE_ERROR, "Parse error")
 		return
 	}
 
-	method := ""
-	// Enhanced logging for MCP tool calls
+	held := &heldMessage{detached: make(chan struct{})}
+	ctx, cancel := context.WithCancel(context.WithValue(ctx, heldMessageContextKey{}, held))
+	processed := make(chan processedMessage, 1)
+	go func() {
+		defer cancel()
+		response, ok, err := s.processMessage(ctx, session, server, rawMessage)
+		processed <- processedMessage{response: response, ok: ok, err: err}
+	}()
+
+	var result processedMessage
+	select {
+	case result = <-processed:
+	case <-held.detached:
+		// The response is delivered on the SSE stream once processing completes
+		w.WriteHeader(http.StatusAccepted)
+		return
+	case <-r.Context().Done():
+		cancel()
+		return
+	}
+	response, ok, err := result.response, result.ok, result.err
+	if !ok {
+		return
+	}
+
+	// The response could not be queued on the SSE stream
+	if err != nil {
+		var request struct {
+			ID interface{} `json:"id"`
+		}
+		json.Unmarshal(rawMessage, &request)
+		s.writeJSONRPCErrorWithStatus(w, http.StatusServiceUnavailable, request.ID, mcp.INTERNAL_ERROR, fmt.Sprintf("Cannot deliver response: %v", err))
+		return
+	}
+
+	if response != nil {
+		// Send HTTP response
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(response)
+	} else {
+		// For notifications, just send 202 Accepted with no body
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
+
+// processedMessage is the outcome of processMessage
+type processedMessage struct {
+	response mcp.JSONRPCMessage
+	ok       bool
+	err      error
+}
+
+// heldMessage lets the processing of a posted message answer the POST before
+// it completes, when it waits on something other than the client
+type heldMessage struct {
+	once     sync.Once
+	detached chan struct{}
+}
+
+type heldMessageContextKey struct{}
+
+// detachFromRequest makes the handler of the POST carrying the message answer
+// 202 right away; the response is still delivered on the SSE stream, and
+// processing is no longer cancelled when the client closes the POST
+func detachFromRequest(ctx context.Context) {
+	if held, ok := ctx.Value(heldMessageContextKey{}).(*heldMessage); ok {
+		held.once.Do(func() { close(held.detached) })
+	}
+}
+
+// processMessage handles a JSON-RPC message through the MCP server of the
+// session and queues the response on the session's SSE stream. It is shared by
+// messages posted to this replica and messages relayed from other replicas.
+// ok is false if the message is not a JSON object, and err is set if the
+// response could not be queued.
+func (s *SSEServer) processMessage(ctx context.Context, session *sseSession, mcpServer *server.MCPServer, rawMessage json.RawMessage) (response mcp.JSONRPCMessage, ok bool, err error) {
 	var request map[string]interface{}
-	if err := json.Unmarshal(rawMessage, &request); err == nil {
-		method, _ = request["method"].(string)
-		params, hasParams := request["params"]
-
-		// Log method and parameters, but skip detailed params for list methods
-		if method != "tools/list" {
-			if hasParams {
-				// For non-list methods, log detailed parameters
-				paramsJSON, err := json.Marshal(params)
-				s.logMessage("[MCP TOOL CALL NO List] Request params: %s", string(paramsJSON))
-				if err == nil {
-					s.logMessage("[MCP TOOL CALL] Session %s: Method: %s, Params: %s", sessionID, method, string(paramsJSON))
-				} else {
-					s.logMessage("[MCP TOOL CALL] Session %s: Method: %s, Params: [error marshaling params]", sessionID, method)
-				}
-			} else {
-				s.logMessage("[MCP TOOL CALL] Session %s: Method: %s, Params: none", sessionID, method)
-			}
-		} else {
-			// Fallback for old behavior if JSON parsing fails
-			if s.debugMode {
-				s.logMessage("[DEBUG][TOOL CALL] Session %s received tool call: %s", sessionID, string(rawMessage))
-			} else {
-				s.logMessage("[TOOL CALL] Session %s received tool call", sessionID)
-			}
+	if err := json.Unmarshal(rawMessage, &request); err != nil {
+		return nil, false, nil
+	}
+
+	// Responses of the client to requests of the server, e.g. approval confirmations
+	method, _ := request["method"].(string)
+	if method == "" && s.handleElicitationResponse(session, request) {
+		return nil, true, nil
+	}
+
+	// Records of the request carry the method, and the tool name for tool calls
+	logger := session.logger.With("method", method)
+	params, hasParams := request["params"]
+	toolName := ""
+	if paramsMap, ok := params.(map[string]interface{}); ok && method == "tools/call" {
+		toolName, _ = paramsMap["name"].(string)
+		logger = logger.With(LogKeyTool, toolName)
+	}
+	metrics.JSONRPCRequests.WithLabelValues(metrics.MethodLabel(method)).Inc()
+	if method == "initialize" {
+		session.elicitation.Store(clientSupportsElicitation(params))
+	}
+
+	// Continue the client's trace, from the _meta of the params if it sends one
+	if paramsMap, ok := params.(map[string]interface{}); ok {
+		if meta, ok := paramsMap["_meta"].(map[string]interface{}); ok {
+			ctx = tracing.ExtractMeta(ctx, meta)
 		}
+	}
+	ctx, span := tracing.Tracer().Start(ctx, "mcp.message "+metrics.MethodLabel(method),
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			attribute.String("rpc.system", "jsonrpc"),
+			attribute.String("rpc.method", method),
+			attribute.String(attrSessionID, session.sessionID),
+		))
+	defer span.End()
+	if session.configID != "" {
+		span.SetAttributes(attribute.String(attrConfigID, session.configID))
+	}
+	if toolName != "" {
+		span.SetAttributes(attribute.String(attrTool, toolName))
+	}
 
-		// Process message through MCPServer
-		response := server.HandleMessage(ctx, rawMessage)
+	// Log parameters with secrets and personal data redacted, skipping params for list methods
+	if hasParams && method != "tools/list" {
+		logger.Debug("MCP request", "params", s.redactor.Value(params))
+	}
 
-		// Log the tool response (only in debug mode if it contains raw data)
-		if response != nil {
-			respData, _ := json.Marshal(response)
+	// Process message through MCPServer
+	ctx, call := withUpstreamCall(s.withApprover(withLogger(ctx, logger), session))
+	start := time.Now()
+	response = mcpServer.HandleMessage(ctx, rawMessage)
+	latency := time.Since(start)
 
-			// Extract result if present
-			respMap := make(map[string]interface{})
-			if err := json.Unmarshal(respData, &respMap); err == nil {
-				if result, hasResult := respMap["result"]; hasResult && result != nil {
-					if method != "tools/list" {
-						s.logMessage("[MCP TOOL RESPONSE] Session %s: Method response", sessionID)
-					}
-				} else if errObj, hasError := respMap["error"]; hasError && errObj != nil {
-					s.logMessage("[MCP TOOL RESPONSE] Session %s: Method responded with error", sessionID)
-				} else {
-					s.logMessage("[MCP TOOL RESPONSE] Session %s: Method responded", sessionID)
-				}
-			} else {
-				// Fallback to old behavior if JSON parsing fails
-				if s.debugMode {
-					s.logMessage("[DEBUG][TOOL RESPONSE] Session %s tool response: %s", sessionID, string(respData))
-				} else {
-					s.logMessage("[TOOL RESPONSE] Session %s received response", sessionID)
-				}
+	// Only send response if there is one (not for notifications)
+	if response == nil {
+		logger.Debug("MCP notification handled", latencyAttr(latency))
+		return nil, true, nil
+	}
+	status := responseStatus(response)
+	if status != "ok" {
+		span.SetStatus(codes.Error, status)
+	}
+	logger.Info("MCP request handled", LogKeyStatus, status, latencyAttr(latency))
+	if method == "tools/call" {
+		if s.auditSink != nil {
+			var arguments interface{}
+			if paramsMap, ok := params.(map[string]interface{}); ok {
+				arguments = paramsMap["arguments"]
 			}
+			s.audit(session, toolName, arguments, call, status, latency)
 		}
 
-		// Only send response if there is one (not for notifications)
-		if response != nil {
-			eventData, _ := json.Marshal(response)
+		metrics.ToolCalls.WithLabelValues(s.toolCallLabels(session, toolName, status)...).Inc()
+	}
 
-			// Queue the event for sending via SSE
-			select {
-			case session.eventQueue <- fmt.Sprintf("event: message\ndata: %s\n\n", eventData):
-				// Event queued successfully
-				s.logMessage("[EVENT QUEUED] Response queued for session %s", sessionID)
-			case <-session.done:
-				// Session is closed, don't try to queue
-				s.logMessage("[EVENT FAILED] Cannot queue response - session %s is closed", sessionID)
-			default:
-				// Queue is full, could log this
-				s.logMessage("[EVENT FAILED] Cannot queue response - session %s queue is full", sessionID)
-			}
+	// Queue the event for sending via SSE
+	eventData, _ := json.Marshal(response)
+	if err = s.enqueueEvent(session, newMessageEvent(eventData)); err != nil {
+		logger.Warn("cannot queue response", "error", err)
+	}
 
-			// Send HTTP response
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusAccepted)
-			json.NewEncoder(w).Encode(response)
-		} else {
-			// For notifications, just send 202 Accepted with no body
-			s.logMessage("[NOTIFICATION] No response needed for session %s", sessionID)
-			w.WriteHeader(http.StatusAccepted)
+	return response, true, err
+}
+
+// responseStatus classifies a JSON-RPC response for logging: ok, error for
+// JSON-RPC errors, or tool_error for tool results flagged as errors
+func responseStatus(response mcp.JSONRPCMessage) string {
+	switch resp := response.(type) {
+	case mcp.JSONRPCError:
+		return "error"
+	case mcp.JSONRPCResponse:
+		if result, ok := resp.Result.(*mcp.CallToolResult); ok && result.IsError {
+			return "tool_error"
 		}
 	}
+	return "ok"
 }
 
 // writeJSONRPCError writes a JSON-RPC error response with the given error details.
@@ -459,10 +915,21 @@ func (s *SSEServer) writeJSONRPCError(
 	id interface{},
 	code int,
 	message string,
+) {
+	s.writeJSONRPCErrorWithStatus(w, http.StatusBadRequest, id, code, message)
+}
+
+// writeJSONRPCErrorWithStatus writes a JSON-RPC error response with the given HTTP status.
+func (s *SSEServer) writeJSONRPCErrorWithStatus(
+	w http.ResponseWriter,
+	status int,
+	id interface{},
+	code int,
+	message string,
 ) {
 	response := createErrorResponse(id, code, message)
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusBadRequest)
+	w.WriteHeader(status)
 	json.NewEncoder(w).Encode(response)
 }
 
@@ -484,14 +951,7 @@ func (s *SSEServer) SendEventToSession(
 	}
 
 	// Queue the event for sending via SSE
-	select {
-	case session.eventQueue <- fmt.Sprintf("event: message\ndata: %s\n\n", eventData):
-		return nil
-	case <-session.done:
-		return fmt.Errorf("session closed")
-	default:
-		return fmt.Errorf("event queue full")
-	}
+	return s.enqueueEvent(session, newMessageEvent(eventData))
 }
 
 func (s *SSEServer) GetUrlPath(input string) (string, error) {
@@ -532,6 +992,35 @@ type RequestParams struct {
 	RawBytes  []byte            `json:"b"`
 	Filters   []PathFilter      `json:"f"`
 	Error     error
+
+	ConfigID       string          `json:"-"` // Stored configuration the parameters come from, empty for ad-hoc sessions
+	UpstreamAuth   *UpstreamAuth   `json:"-"` // OAuth2 credentials for the upstream API, only set from stored configurations
+	ForwardHeaders []HeaderForward `json:"-"` // Incoming headers forwarded to the upstream API, only set from stored configurations
+	Approval       *ApprovalPolicy `json:"-"` // Operations whose calls must be approved, only set from stored configurations
+	ToolOverrides  ToolOverrides   `json:"-"` // Customisations of the tools of operations, only set from stored configurations
+}
+
+// toolHandlerOptions returns the tool handler options implied by the parameters
+func (p RequestParams) toolHandlerOptions() []ToolHandlerOption {
+	var opts []ToolHandlerOption
+	if p.ConfigID != "" {
+		if baseURL, err := url.Parse(p.BaseURL); err == nil && baseURL.Hostname() != "" {
+			opts = append(opts, withMetricsHost(baseURL.Hostname()))
+		}
+	}
+	if p.UpstreamAuth != nil {
+		opts = append(opts, WithUpstreamAuth(p.UpstreamAuth))
+	}
+	if len(p.ForwardHeaders) > 0 {
+		opts = append(opts, WithForwardHeaders(p.ForwardHeaders))
+	}
+	if p.Approval != nil && len(p.Approval.Rules) > 0 {
+		opts = append(opts, WithApprovalPolicy(p.Approval))
+	}
+	if len(p.ToolOverrides) > 0 {
+		opts = append(opts, WithToolOverrides(p.ToolOverrides))
+	}
+	return opts
 }
 
 // PathFilter defines a filter to include or exclude API paths
@@ -786,246 +1275,304 @@ func (s *SSEServer) parseRequestParams(r *http.Request) RequestParams {
 
 	// If schema bytes are not already set from context and we have a schema URL, load the schema
 	if len(params.RawBytes) == 0 && params.SchemaURL != "" {
-		var err error
-		// Check if schemaURL is a local file or a URL
-		if strings.HasPrefix(params.SchemaURL, "http://") || strings.HasPrefix(params.SchemaURL, "https://") {
-			// Fetch from URL
-			params.RawBytes, err = getSchemaURL(params.SchemaURL)
-			if err != nil {
-				params.Error = fmt.Errorf("failed to fetch schema from URL: %w", err)
-				return params
-			}
-		} else {
-			params.RawBytes, err = os.ReadFile(params.SchemaURL)
-			if err != nil {
-				params.Error = fmt.Errorf("failed to load schema: %w", err)
-				return params
-			}
-		}
+		params.RawBytes, params.Error = fetchSchema(r.Context(), params.SchemaURL)
 	}
 
 	return params
 }
 
-// Base64Decode decodes a base64 string to bytes
-func Base64Decode(encoded string) ([]byte, error) {
-	return base64.StdEncoding.DecodeString(encoded)
-}
+// loadSchemaBytes fetches the schema from a URL, reads it from a local file
+// or, for a spec: reference, loads it from the SpecStore
+func loadSchemaBytes(ctx context.Context, schemaURL string) ([]byte, error) {
+	start := time.Now()
 
-// ServeHTTP implements the http.Handler interface.
-func (s *SSEServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	path := r.URL.Path
-	// Use exact path matching rather than Contains
-	ssePath := s.CompleteSsePath()
-	if ssePath != "" && path == ssePath {
-		s.logMessage("[REQUEST] SSE connection request from %s", r.RemoteAddr)
-
-		// Check if a config ID is provided
-		configID := r.URL.Query().Get("configId")
-		if configID != "" {
-			s.logMessage("[CONFIG ID] Using config ID: %s", configID)
-
-			// Get MongoDB client
-			mongoClient, err := mongo.GetDefaultClient()
-			if err != nil {
-				s.logMessage("[ERROR] Failed to get MongoDB client: %v", err)
-				http.Error(w, fmt.Sprintf("Failed to get MongoDB client: %v", err), http.StatusInternalServerError)
-				return
-			}
+	if id, ok := SpecReference(schemaURL); ok {
+		data, err := loadStoredSpec(ctx, id)
+		metrics.SchemaFetchDuration.WithLabelValues("stored").Observe(time.Since(start).Seconds())
+		if err != nil {
+			return nil, fmt.Errorf("failed to load stored schema %s: %w", id, err)
+		}
+		return data, nil
+	}
 
-			// Create repository and service
-			sseConfigRepo, err := repositories.NewSSEConfigRepository(mongoClient)
-			if err != nil {
-				s.logMessage("[ERROR] Failed to create SSE config repository: %v", err)
-				http.Error(w, fmt.Sprintf("Failed to create SSE config repository: %v", err), http.StatusInternalServerError)
-				return
-			}
+	// Check if schemaURL is a local file or a URL
+	if strings.HasPrefix(schemaURL, "http://") || strings.HasPrefix(schemaURL, "https://") {
+		defer func() { metrics.SchemaFetchDuration.WithLabelValues("url").Observe(time.Since(start).Seconds()) }()
+		data, err := getSchemaURL(schemaURL)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch schema from URL: %w", err)
+		}
+		return data, nil
+	}
 
-			sseConfigService := services.NewSSEConfigService(sseConfigRepo)
+	data, err := egress.ReadSchemaFile(schemaURL)
+	metrics.SchemaFetchDuration.WithLabelValues("file").Observe(time.Since(start).Seconds())
+	if err != nil {
+		return nil, fmt.Errorf("failed to load schema: %w", err)
+	}
+	return data, nil
+}
 
-			// Get the configuration from database
-			config, err := sseConfigService.GetByID(r.Context(), configID)
-			if err != nil {
-				s.logMessage("[ERROR] Failed to get configuration: %v", err)
-				http.Error(w, fmt.Sprintf("Failed to get configuration: %v", err), http.StatusInternalServerError)
-				return
-			}
+// loadConfigParams loads a stored configuration through the ConfigLoader and
+// converts it into request parameters, fetching the schema it points to. A
+// revision other than 0 loads that revision of the configuration.
+// On failure it also returns the HTTP status that should be reported.
+func (s *SSEServer) loadConfigParams(ctx context.Context, configID string, revision int) (RequestParams, int, error) {
+	if s.configLoader == nil {
+		return RequestParams{}, http.StatusInternalServerError, fmt.Errorf("config loader is not configured")
+	}
 
-			// Check if config is nil
-			if config == nil {
-				s.logMessage("[ERROR] Configuration not found for ID: %s", configID)
-				http.Error(w, fmt.Sprintf("Configuration not found for ID: %s", configID), http.StatusNotFound)
-				return
-			}
+	loadCtx, loadSpan := tracing.Tracer().Start(ctx, "mcp.config.load")
+	var config *Config
+	var err error
+	if revision != 0 {
+		loadSpan.SetAttributes(attribute.Int(attrConfigRevision, revision))
+		revisionLoader, ok := s.configLoader.(RevisionLoader)
+		if !ok {
+			endSpan(loadSpan, nil)
+			return RequestParams{}, http.StatusBadRequest, fmt.Errorf("configuration revisions are not supported")
+		}
+		config, err = revisionLoader.LoadConfigRevision(loadCtx, configID, revision)
+	} else {
+		config, err = s.configLoader.LoadConfig(loadCtx, configID)
+	}
+	endSpan(loadSpan, err)
+	if err != nil {
+		return RequestParams{}, http.StatusInternalServerError, fmt.Errorf("failed to get configuration: %w", err)
+	}
+	if config == nil && revision != 0 {
+		return RequestParams{}, http.StatusNotFound, fmt.Errorf("revision %d not found for configuration ID: %s", revision, configID)
+	}
+	if config == nil {
+		return RequestParams{}, http.StatusNotFound, fmt.Errorf("configuration not found for ID: %s", configID)
+	}
+	if config.SchemaURL == "" {
+		return RequestParams{}, http.StatusInternalServerError, fmt.Errorf("invalid configuration: SchemaURL is empty")
+	}
+	if config.BaseURL == "" {
+		s.logger.Warn("configuration has an empty base URL", LogKeyConfigID, configID)
+	}
 
-			// Check if SchemaURL is empty
-			if config.SchemaURL == "" {
-				s.logMessage("[ERROR] SchemaURL is empty in configuration with ID: %s", configID)
-				http.Error(w, "Invalid configuration: SchemaURL is empty", http.StatusInternalServerError)
-				return
-			}
+	params := paramsFromConfig(config)
+	params.ConfigID = configID
+	if params.Error != nil {
+		return RequestParams{}, http.StatusInternalServerError, fmt.Errorf("invalid configuration: %w", params.Error)
+	}
 
-			// Get schema content
-			schemaBytes, err := sseConfigService.GetSchemaBytes(config.SchemaURL)
-			if err != nil {
-				s.logMessage("[ERROR] Failed to get schema content: %v", err)
-				http.Error(w, fmt.Sprintf("Failed to get schema content: %v", err), http.StatusInternalServerError)
-				return
-			}
+	params.RawBytes, err = fetchSchema(ctx, config.SchemaURL)
+	if err != nil {
+		return RequestParams{}, http.StatusInternalServerError, fmt.Errorf("failed to get schema content: %w", err)
+	}
+	if len(params.RawBytes) == 0 {
+		return RequestParams{}, http.StatusInternalServerError, fmt.Errorf("empty schema content")
+	}
 
-			// Check if schemaBytes is nil or empty
-			if schemaBytes == nil || len(schemaBytes) == 0 {
-				s.logMessage("[ERROR] Empty schema content for URL: %s", config.SchemaURL)
-				http.Error(w, "Empty schema content", http.StatusInternalServerError)
-				return
-			}
+	return params, http.StatusOK, nil
+}
 
-			// Create a new context with the schema bytes
-			ctx := context.WithValue(r.Context(), schemaBytesContextKey{}, schemaBytes)
-			r = r.WithContext(ctx)
+// paramsFromConfig converts a stored configuration into request parameters.
+// The schema itself is not loaded.
+func paramsFromConfig(config *Config) RequestParams {
+	params := RequestParams{
+		SchemaURL: config.SchemaURL,
+		BaseURL:   config.BaseURL,
+		Headers:   make(map[string]string, len(config.Headers)),
 
-			// Set parameters in the query
-			q := r.URL.Query()
-			q.Set("s", config.SchemaURL)
+		UpstreamAuth:  config.UpstreamAuth,
+		Approval:      config.Approval,
+		ToolOverrides: config.ToolOverrides,
+	}
+	for key, value := range config.Headers {
+		params.Headers[key] = value
+	}
+	for _, filterDSL := range config.Filters {
+		params.Filters = append(params.Filters, ParseFilterDSL(filterDSL).ToPathFilters()...)
+	}
+	params.ForwardHeaders, params.Error = ParseForwardHeaders(config.ForwardHeaders)
+	return params
+}
 
-			// Check if BaseURL is empty
-			if config.BaseURL == "" {
-				s.logMessage("[WARNING] BaseURL is empty in configuration with ID: %s, using default", configID)
-				// Set a reasonable default or use an empty string
-			} else {
-				q.Set("u", config.BaseURL)
-			}
+// parseOpenAPI parses the schema held in params and wraps the parser with
+// the filters of params, if any.
+func (s *SSEServer) parseOpenAPI(ctx context.Context, params RequestParams) (parser OpenAPIParser, err error) {
+	_, span := tracing.Tracer().Start(ctx, "mcp.schema.parse", trace.WithAttributes(attribute.Int("mcp.schema.size", len(params.RawBytes))))
+	defer func() { endSpan(span, err) }()
 
-			// Convert headers to JSON
-			if config.Headers != nil {
-				headersJSON, err := json.Marshal(config.Headers)
-				if err == nil {
-					q.Set("h", string(headersJSON))
-				} else {
-					s.logMessage("[WARNING] Failed to marshal headers: %v", err)
-				}
-			}
+	start := time.Now()
+	defer func() { metrics.SchemaParseDuration.Observe(time.Since(start).Seconds()) }()
 
-			// Add filters if any
-			if config.Filters != nil {
-				for _, filter := range config.Filters {
-					q.Add("f", filter)
-				}
-			}
+	// Check if it looks like YAML or JSON
+	if isYAML(params.RawBytes) {
+		s.logger.Debug("parsing OpenAPI schema", "format", "yaml", "size", len(params.RawBytes))
+		parser, err = ParseOpenAPIFromYAML(params.RawBytes)
+	} else {
+		s.logger.Debug("parsing OpenAPI schema", "format", "json", "size", len(params.RawBytes))
+		parser, err = ParseOpenAPIFromJSON(params.RawBytes)
+	}
+	if err != nil {
+		return nil, err
+	}
 
-			// Create an encoded parameters object
-			paramsObj := map[string]interface{}{
-				"s": config.SchemaURL,
-			}
+	// Apply filters if present
+	if len(params.Filters) > 0 {
+		s.logger.Debug("applying filters to API endpoints", "filters", len(params.Filters))
+		// Create a filtered parser that wraps the original parser
+		parser = &FilteredOpenAPIParser{
+			BaseParser: parser,
+			Filters:    params.Filters,
+		}
+	}
 
-			if config.BaseURL != "" {
-				paramsObj["u"] = config.BaseURL
-			}
+	return parser, nil
+}
 
-			if config.Headers != nil {
-				paramsObj["h"] = config.Headers
-			}
+// Base64Decode decodes a base64 string to bytes
+func Base64Decode(encoded string) ([]byte, error) {
+	return base64.StdEncoding.DecodeString(encoded)
+}
 
-			if config.Filters != nil && len(config.Filters) > 0 {
-				paramsObj["f"] = strings.Join(config.Filters, ";")
-			}
+// resolveParams returns the parameters of a stored configuration, or a
+// revision of it, or the ad-hoc parameters of the request if configID is
+// empty. On failure it also returns the HTTP status that should be reported.
+func (s *SSEServer) resolveParams(r *http.Request, configID string, revision int) (RequestParams, int, error) {
+	if configID != "" {
+		params, status, err := s.loadConfigParams(r.Context(), configID, revision)
+		if err != nil {
+			s.logger.Error("failed to load configuration", LogKeyConfigID, configID, "error", err)
+			return RequestParams{}, status, err
+		}
+		return params, http.StatusOK, nil
+	}
 
-			// Encode the params as JSON and then base64
-			paramsJSON, _ := json.Marshal(paramsObj)
-			encodedParams := base64.StdEncoding.EncodeToString(paramsJSON)
+	// Parse request parameters
+	params := s.parseRequestParams(r)
+	if params.Error != nil {
+		s.logger.Warn("failed to parse request parameters", "error", params.Error)
+		return RequestParams{}, http.StatusInternalServerError, fmt.Errorf("Failed to parse request parameters: %v", params.Error)
+	}
+	return params, http.StatusOK, nil
+}
 
-			// Add the encoded params as 'code' param
-			q.Set("code", encodedParams)
+// buildSession loads the configuration, or the request parameters of an
+// ad-hoc session, and builds the MCP server of a new SSE connection. On
+// failure it also returns the HTTP status that should be reported.
+func (s *SSEServer) buildSession(r *http.Request, configID string, revision int) (mcpServer *server.MCPServer, source *sessionSource, status int, err error) {
+	ctx, span := tracing.Tracer().Start(tracing.ExtractHTTP(r.Context(), r.Header), "mcp.sse.connect",
+		trace.WithSpanKind(trace.SpanKindServer))
+	defer func() { endSpan(span, err) }()
+	if configID != "" {
+		span.SetAttributes(attribute.String(attrConfigID, configID))
+	}
 
-			// Set the modified query
-			r.URL.RawQuery = q.Encode()
-		}
+	params, status, err := s.resolveParams(r.WithContext(ctx), configID, revision)
+	if err != nil {
+		return nil, nil, status, err
+	}
 
-		// Parse request parameters
-		params := s.parseRequestParams(r)
+	parser, err := s.parseOpenAPI(ctx, params)
+	if err != nil {
+		s.logger.Error("failed to parse OpenAPI schema", LogKeyConfigID, configID, "error", err)
+		return nil, nil, http.StatusInternalServerError, fmt.Errorf("Failed to parse OpenAPI schema: %v", err)
+	}
 
-		if params.Error != nil {
-			s.logMessage("[ERROR] Failed to parse request parameters: %v", params.Error)
-			http.Error(w, fmt.Sprintf("Failed to parse request parameters: %v", params.Error), http.StatusInternalServerError)
-			return
+	_, buildSpan := tracing.Tracer().Start(ctx, "mcp.server.build")
+	tools := BuildServerTools(params.BaseURL, params.Headers, parser, params.toolHandlerOptions()...)
+	mcpServer = newMCPServer(parser.Info(), tools)
+	buildSpan.SetAttributes(attribute.Int("mcp.tools", len(tools)))
+	buildSpan.End()
+
+	// Log the available API endpoints
+	apis := parser.APIs()
+	s.logger.Info("MCP server created", LogKeyConfigID, configID, "base_url", s.redactor.URL(params.BaseURL), "endpoints", len(apis))
+
+	// Only log detailed endpoints in debug mode
+	if s.logger.Enabled(ctx, slog.LevelDebug) {
+		for i, api := range apis {
+			if i < 10 { // Limit logging to first 10 endpoints to avoid flooding logs
+				s.logger.Debug("API endpoint", "http_method", api.Method, "path", api.Path)
+			} else if i == 10 {
+				s.logger.Debug("more API endpoints not logged", "count", len(apis)-10)
+				break
+			}
 		}
+	}
 
-		var mcpServer *server.MCPServer
+	return mcpServer, &sessionSource{
+		configID:    configID,
+		revision:    revision,
+		params:      params,
+		toolDigests: toolDigests(tools),
+	}, http.StatusOK, nil
+}
 
-		// First, try with our custom parser
-		var parser OpenAPIParser
-		var parseErr error
+// ServeHTTP implements the http.Handler interface.
+func (s *SSEServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := r.URL.Path
+	// Use exact path matching rather than Contains
+	ssePath := s.CompleteSsePath()
+	if ssePath != "" && path == ssePath {
+		s.logger.Debug("SSE connection request", "remote_addr", r.RemoteAddr)
 
-		// Update log prefix based on schema info if not already set
-		if s.logPrefix == "" && params.BaseURL != "" {
-			// Use the baseURL from the schema as the log prefix if not already set
-			baseURLHost, _ := getHostFromURL(params.BaseURL)
-			if baseURLHost != "" {
-				s.logPrefix = baseURLHost
+		// A client reconnecting with Last-Event-ID resumes its existing session
+		if session, lastSeq, ok := s.findResumableSession(r); ok {
+			if !session.ownedBy(auth.PrincipalFromRequest(r)) {
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+			if err := s.acquireSession(true); err != nil {
+				http.Error(w, err.Error(), http.StatusServiceUnavailable)
+				return
 			}
+			defer s.releaseSession()
+			s.resumeSSE(session, lastSeq, w, r)
+			return
 		}
 
-		// Check if it looks like YAML or JSON
-		if isYAML(params.RawBytes) {
-			s.logMessage("[PARSER] Parsing YAML OpenAPI schema, size: %d bytes", len(params.RawBytes))
-			parser, parseErr = ParseOpenAPIFromYAML(params.RawBytes)
-		} else {
-			s.logMessage("[PARSER] Parsing JSON OpenAPI schema, size: %d bytes", len(params.RawBytes))
-			parser, parseErr = ParseOpenAPIFromJSON(params.RawBytes)
+		// Reserve a session slot before doing any work for the connection
+		if err := s.acquireSession(false); err != nil {
+			s.logger.Warn("SSE connection rejected", "remote_addr", r.RemoteAddr, "error", err)
+			w.Header().Set("Retry-After", "5")
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
 		}
-		if parseErr != nil {
-			s.logMessage("[ERROR] Failed to parse OpenAPI schema: %v", parseErr)
-			http.Error(w, fmt.Sprintf("Failed to parse OpenAPI schema: %v", parseErr), http.StatusInternalServerError)
+		defer s.releaseSession()
+
+		// Check if a config ID is provided
+		configID := r.URL.Query().Get("configId")
+
+		// Reject callers not allowed to use the configuration before loading it or fetching any schema
+		if !authorizeConnect(r, configID) {
+			s.logger.Warn("connection with configuration forbidden", "subject", subjectOf(auth.PrincipalFromRequest(r)), LogKeyConfigID, configID)
+			http.Error(w, "Forbidden", http.StatusForbidden)
 			return
 		}
 
-		// Apply filters if present
-		if len(params.Filters) > 0 {
-			s.logMessage("[FILTERS] Applying %d filters to API endpoints", len(params.Filters))
-			// Create a filtered parser that wraps the original parser
-			parser = &FilteredOpenAPIParser{
-				BaseParser: parser,
-				Filters:    params.Filters,
+		// A revision pins the session to that revision of the configuration
+		revision := 0
+		if value := r.URL.Query().Get("revision"); value != "" {
+			var err error
+			if revision, err = strconv.Atoi(value); err != nil || revision < 1 || configID == "" {
+				http.Error(w, "Invalid revision: must be a revision number of the configuration", http.StatusBadRequest)
+				return
 			}
-			s.logMessage("[FILTERS] Applying filters to API endpoints: %v", parser)
 		}
 
-		var err error
-		s.logMessage("[SERVER] Creating MCP server with base URL: %s", params.BaseURL)
-		mcpServer, err = NewMCPFromCustomParser(params.BaseURL, params.Headers, parser)
+		mcpServer, source, status, err := s.buildSession(r, configID, revision)
 		if err != nil {
-			s.logMessage("[ERROR] Failed to create MCP server: %v", err)
-			http.Error(w, fmt.Sprintf("Failed to create MCP server: %v", err), http.StatusInternalServerError)
+			http.Error(w, err.Error(), status)
 			return
 		}
 
-		// Log the available API endpoints
-		apis := parser.APIs()
-		s.logMessage("[SERVER] MCP server created with %d API endpoints", len(apis))
-
-		// Only log detailed endpoints in debug mode
-		if s.debugMode {
-			for i, api := range apis {
-				if i < 10 { // Limit logging to first 10 endpoints to avoid flooding logs
-					s.logMessage("[DEBUG][ENDPOINT] %s %s", api.Method, api.Path)
-				} else if i == 10 {
-					s.logMessage("[DEBUG][ENDPOINT] ... and %d more endpoints", len(apis)-10)
-					break
-				}
-			}
-		}
-
-		s.handleSSE(mcpServer, w, r)
+		s.handleSSE(mcpServer, source, w, r)
 		return
 	}
 	messagePath := s.CompleteMessagePath()
 	if messagePath != "" && path == messagePath {
-		s.logMessage("[REQUEST] Message request from %s to %s", r.RemoteAddr, path)
 		s.handleMessage(w, r)
 		return
 	}
 
-	s.logMessage("[NOT FOUND] Path not found: %s", path)
+	s.logger.Debug("path not found", "path", path)
 	http.NotFound(w, r)
 }
 
@@ -1095,7 +1642,8 @@ func getSchemaURL(schemaURL string) ([]byte, error) {
 	if strings.HasPrefix(schemaURL, "http://") || strings.HasPrefix(schemaURL, "https://") {
 		// Create a custom HTTP client with timeout
 		client := &http.Client{
-			Timeout: 30 * time.Second, // 30 second timeout
+			Transport: egress.Transport(),
+			Timeout:   30 * time.Second, // 30 second timeout
 		}
 
 		// Use the client to make the request
@@ -1106,7 +1654,7 @@ func getSchemaURL(schemaURL string) ([]byte, error) {
 		defer resp.Body.Close()
 		return io.ReadAll(resp.Body)
 	}
-	return os.ReadFile(schemaURL)
+	return egress.ReadSchemaFile(schemaURL)
 }
 
 // ShouldIncludePath determines if a path and method should be included based on filters
@@ -1169,13 +1717,26 @@ type schemaBytesContextKey struct{}
 
 // Config represents a configuration for SSE
 type Config struct {
+	ID        string
 	SchemaURL string
 	BaseURL   string
 	Headers   map[string]string
 	Filters   []string
+
+	UpstreamAuth   *UpstreamAuth
+	ForwardHeaders []string // "Incoming:Upstream" header names allowed to be forwarded
+	Approval       *ApprovalPolicy
+	ToolOverrides  ToolOverrides
 }
 
 // ConfigLoader is an interface for loading configurations by ID
 type ConfigLoader interface {
 	LoadConfig(ctx context.Context, id string) (*Config, error)
 }
+
+// RevisionLoader is implemented by ConfigLoaders that keep the revision
+// history of configurations, so that sessions can be pinned to a revision
+type RevisionLoader interface {
+	// LoadConfigRevision returns a revision of a configuration, or nil if it does not exist
+	LoadConfigRevision(ctx context.Context, id string, revision int) (*Config, error)
+}
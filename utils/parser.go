@@ -38,6 +38,7 @@ type APIEndpoint struct {
 	Summary     string              `json:"summary,omitempty"`
 	Description string              `json:"description,omitempty"`
 	OperationID string              `json:"operationId,omitempty"`
+	Tags        []string            `json:"tags,omitempty"`
 	Parameters  []Parameter         `json:"parameters,omitempty"`
 	RequestBody *RequestBody        `json:"requestBody,omitempty"`
 	Responses   map[string]Response `json:"responses,omitempty"`
@@ -210,6 +211,14 @@ func (p *SimpleOpenAPIParser) APIs() []APIEndpoint {
 				endpoint.OperationID = operationId
 			}
 
+			if tags, ok := operationObj["tags"].([]interface{}); ok {
+				for _, tag := range tags {
+					if name, ok := tag.(string); ok {
+						endpoint.Tags = append(endpoint.Tags, name)
+					}
+				}
+			}
+
 			// Parse parameters
 			if parameters, ok := operationObj["parameters"].([]interface{}); ok {
 				for _, param := range parameters {
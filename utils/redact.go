@@ -0,0 +1,171 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// redactedValue replaces sensitive values in logs
+const redactedValue = "[REDACTED]"
+
+// DefaultSensitiveKeys are the patterns of keys whose values are never logged.
+// They are matched case-insensitively against JSON object keys and header names.
+var DefaultSensitiveKeys = []string{
+	`authori[sz]ation`, `^(x-)?auth([-_]|$)`, `token`, `secret`, `pass(word|wd)?`, `api[-_]?key`, `cookie`,
+	`credential`, `private[-_]?key`, `signature`,
+	`ssn`, `email`, `phone`, `card[-_]?(number|no)?`, `cvv`, `iban`,
+}
+
+// DefaultMaxLogPayload is the number of bytes of a payload kept in logs
+const DefaultMaxLogPayload = 512
+
+// Redactor removes secrets and personal data from values before they are logged
+type Redactor struct {
+	sensitiveKey *regexp.Regexp
+	maxPayload   int // Payloads are truncated to this many bytes, 0 disables truncation
+}
+
+// NewRedactor creates a redactor masking keys that match any of the patterns
+// and truncating payloads to maxPayload bytes
+func NewRedactor(patterns []string, maxPayload int) (*Redactor, error) {
+	if len(patterns) == 0 {
+		patterns = DefaultSensitiveKeys
+	}
+	sensitiveKey, err := regexp.Compile(`(?i)(` + strings.Join(patterns, `)|(`) + `)`)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sensitive key pattern: %w", err)
+	}
+	return &Redactor{sensitiveKey: sensitiveKey, maxPayload: maxPayload}, nil
+}
+
+// defaultRedactor is used by SSE servers without WithRedactor
+var defaultRedactor, _ = NewRedactor(nil, DefaultMaxLogPayload)
+
+// RedactURL masks the password and sensitive query parameters of a URL with
+// the default sensitive keys, for packages logging outside an SSE server
+func RedactURL(raw string) string {
+	return defaultRedactor.URL(raw)
+}
+
+// WithRedactor sets how secrets and personal data are removed from logs
+func WithRedactor(redactor *Redactor) SSEOption {
+	return func(s *SSEServer) {
+		if redactor != nil {
+			s.redactor = redactor
+		}
+	}
+}
+
+// IsSensitive reports whether values of the key must not be logged
+func (r *Redactor) IsSensitive(key string) bool {
+	return r.sensitiveKey.MatchString(key)
+}
+
+// JSON returns the JSON value with the values of sensitive keys masked,
+// truncated for logging. Invalid JSON is not logged at all.
+func (r *Redactor) JSON(data []byte) string {
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return fmt.Sprintf("[%d bytes of invalid JSON]", len(data))
+	}
+	return r.Value(value)
+}
+
+// Value returns a JSON representation of the value with the values of
+// sensitive keys masked, truncated for logging
+func (r *Redactor) Value(value interface{}) string {
+	data, err := json.Marshal(r.redact(value))
+	if err != nil {
+		return "[unloggable value]"
+	}
+	return r.Truncate(string(data))
+}
+
+// redactJSON returns the JSON value with the values of sensitive keys masked.
+// Unlike JSON it is not truncated, and invalid JSON is masked as a whole.
+func (r *Redactor) redactJSON(data []byte) json.RawMessage {
+	if len(data) == 0 {
+		return nil
+	}
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err == nil {
+		if redacted, err := json.Marshal(r.redact(value)); err == nil {
+			return redacted
+		}
+	}
+	masked, _ := json.Marshal(redactedValue)
+	return masked
+}
+
+// redact masks the values of sensitive keys in maps decoded from JSON
+func (r *Redactor) redact(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		redacted := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			if r.IsSensitive(key) && item != nil {
+				redacted[key] = redactedValue
+				continue
+			}
+			redacted[key] = r.redact(item)
+		}
+		return redacted
+	case []interface{}:
+		redacted := make([]interface{}, len(v))
+		for i, item := range v {
+			redacted[i] = r.redact(item)
+		}
+		return redacted
+	case map[string]string:
+		redacted := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			redacted[key] = item
+		}
+		return r.redact(redacted)
+	default:
+		return value
+	}
+}
+
+// Headers returns a copy of the headers with the values of sensitive headers masked
+func (r *Redactor) Headers(header http.Header) http.Header {
+	redacted := make(http.Header, len(header))
+	for name, values := range header {
+		if r.IsSensitive(name) {
+			redacted[name] = []string{redactedValue}
+			continue
+		}
+		redacted[name] = values
+	}
+	return redacted
+}
+
+// URL returns the URL with its password and the values of sensitive query parameters masked
+func (r *Redactor) URL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "[invalid URL]"
+	}
+	query := u.Query()
+	for key := range query {
+		if r.IsSensitive(key) {
+			query[key] = []string{redactedValue}
+		}
+	}
+	if len(query) > 0 {
+		u.RawQuery = query.Encode()
+	}
+	return u.Redacted()
+}
+
+// Truncate shortens the payload to the maximum logged size
+func (r *Redactor) Truncate(payload string) string {
+	if r.maxPayload <= 0 || len(payload) <= r.maxPayload {
+		return payload
+	}
+	return fmt.Sprintf("%s...(%d bytes truncated)", payload[:r.maxPayload], len(payload)-r.maxPayload)
+}
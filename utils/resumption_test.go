@@ -0,0 +1,121 @@
+package utils
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestKeepAliveComments(t *testing.T) {
+	_, ts := newPetsServer(t, "http://upstream.invalid", nil, WithKeepAliveInterval(20*time.Millisecond))
+	session := openSession(t, ts.URL+"/sse?configId=pets")
+
+	found := make(chan struct{})
+	go func() {
+		for {
+			line, err := session.events.ReadString('\n')
+			if err != nil {
+				return
+			}
+			if line == ": ping\n" {
+				close(found)
+				return
+			}
+		}
+	}()
+	select {
+	case <-found:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no keepalive comment on an idle stream")
+	}
+}
+
+// sendPings posts numbered pings to the session and returns the IDs of the
+// events carrying their responses
+func sendPings(session *testSession, from, to int) []string {
+	var ids []string
+	for i := from; i <= to; i++ {
+		session.post(fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"method":"ping"}`, i))
+		id, data := session.nextEvent()
+		if !strings.Contains(data, fmt.Sprintf(`"id":%d`, i)) {
+			session.t.Fatalf("unexpected response %s to ping %d", data, i)
+		}
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// resume reconnects to the session with the last event ID the client saw
+func resume(t *testing.T, sseURL, lastEventID string) *testSession {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodGet, sseURL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Last-Event-ID", lastEventID)
+	return openSessionRequest(t, req)
+}
+
+// replayed reads n events from the stream and returns their IDs
+func replayed(session *testSession, n int) []string {
+	var ids []string
+	for i := 0; i < n; i++ {
+		id, _ := session.nextEvent()
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+func TestResumeReplaysMissedEventsInOrder(t *testing.T) {
+	_, ts := newPetsServer(t, "http://upstream.invalid", nil, WithResumption(10, time.Minute))
+	session := openSession(t, ts.URL+"/sse?configId=pets")
+	ids := sendPings(session, 1, 4)
+
+	// The client lost the connection after the first response
+	session.stream.Close()
+	resumed := resume(t, ts.URL+"/sse", ids[0])
+	if resumed.messageURL != session.messageURL {
+		t.Fatalf("resumed a different session: %s", resumed.messageURL)
+	}
+	if got := replayed(resumed, 3); fmt.Sprint(got) != fmt.Sprint(ids[1:]) {
+		t.Fatalf("replayed %v, want %v", got, ids[1:])
+	}
+
+	// New events continue the sequence
+	next := sendPings(resumed, 5, 5)
+	if _, seq, _ := parseEventID(next[0]); seq != 5 {
+		t.Fatalf("event after resumption has ID %s", next[0])
+	}
+}
+
+func TestResumeAfterBufferOverflowReplaysRetainedEvents(t *testing.T) {
+	_, ts := newPetsServer(t, "http://upstream.invalid", nil, WithResumption(2, time.Minute))
+	session := openSession(t, ts.URL+"/sse?configId=pets")
+	ids := sendPings(session, 1, 4)
+
+	// Event 2 fell out of the buffer, so only the last two events are replayed
+	session.stream.Close()
+	resumed := resume(t, ts.URL+"/sse", ids[0])
+	if got := replayed(resumed, 2); fmt.Sprint(got) != fmt.Sprint(ids[2:]) {
+		t.Fatalf("replayed %v, want %v", got, ids[2:])
+	}
+
+	// The gap shows in the event IDs, and the next event follows the replay
+	next := sendPings(resumed, 5, 5)
+	if _, seq, _ := parseEventID(next[0]); seq != 5 {
+		t.Fatalf("event after resumption has ID %s", next[0])
+	}
+}
+
+func TestResumeWithUnknownEventIDStartsNewSession(t *testing.T) {
+	_, ts := newPetsServer(t, "http://upstream.invalid", nil, WithResumption(2, time.Minute))
+
+	session := resume(t, ts.URL+"/sse?configId=pets", "gone:7")
+	if strings.Contains(session.messageURL, "sessionId=gone") {
+		t.Fatalf("resumed an unknown session: %s", session.messageURL)
+	}
+	sendPings(session, 1, 1)
+}
@@ -0,0 +1,71 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// revisionConfigLoader serves the "pets" configuration and its revisions
+type revisionConfigLoader struct {
+	staticConfigLoader
+	revisions map[int]*Config
+}
+
+func (l *revisionConfigLoader) LoadConfigRevision(ctx context.Context, id string, revision int) (*Config, error) {
+	if id != l.config.ID {
+		return nil, fmt.Errorf("configuration %s not found", id)
+	}
+	return l.revisions[revision], nil
+}
+
+func TestSessionPinnedToRevision(t *testing.T) {
+	upstream := func(name string) *httptest.Server {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, `{"name":%q}`, name)
+		}))
+		t.Cleanup(ts.Close)
+		return ts
+	}
+	current, pinned := upstream("current"), upstream("pinned")
+
+	// Reuse the schema of the pets server for both versions of the configuration
+	ss, _ := newPetsServer(t, current.URL, nil)
+	config := ss.configLoader.(*staticConfigLoader).config
+	revision := *config
+	revision.BaseURL = pinned.URL
+	ss.configLoader = &revisionConfigLoader{
+		staticConfigLoader: staticConfigLoader{config: config},
+		revisions:          map[int]*Config{1: &revision},
+	}
+	ts := httptest.NewServer(ss)
+	t.Cleanup(ts.Close)
+
+	resp, err := http.Get(ts.URL + "/sse?configId=pets&revision=2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("unknown revision: status %d", resp.StatusCode)
+	}
+
+	session := openSession(t, ts.URL+"/sse?configId=pets&revision=1")
+	session.post(fmt.Sprintf(initializeMessage, `{}`))
+	session.next()
+
+	// Updates of the configuration do not reach pinned sessions
+	if err := ss.ReloadConfig(context.Background(), "pets"); err != nil {
+		t.Fatal(err)
+	}
+	session.post(`{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"` + petsTool + `","arguments":{}}}`)
+	if result := session.next(); !strings.Contains(result, "pinned") {
+		t.Fatalf("pinned session did not use its revision: %s", result)
+	}
+	if stats := ss.Sessions(); len(stats) != 1 || stats[0].Revision != 1 {
+		t.Fatalf("unexpected session stats %+v", stats)
+	}
+}
@@ -0,0 +1,38 @@
+package utils
+
+import (
+	"net/http"
+
+	"github.com/anyisalin/mcp-openapi-to-mcp-adapter/auth"
+)
+
+// authorizeConnect checks that the principal of the request, if any, may open
+// a session for the configuration. Ad-hoc sessions built from URL parameters
+// are only allowed for principals not restricted to specific configurations.
+func authorizeConnect(r *http.Request, configID string) bool {
+	principal := auth.PrincipalFromRequest(r)
+	if principal == nil {
+		return true
+	}
+	if configID == "" {
+		return principal.AllConfigs()
+	}
+	return principal.CanUseConfig(configID)
+}
+
+// ownedBy reports whether the principal may use the session. Sessions opened
+// without authentication can be used by anyone.
+func (s *sseSession) ownedBy(principal *auth.Principal) bool {
+	if s.principal == nil {
+		return true
+	}
+	return principal != nil && principal.Subject == s.principal.Subject
+}
+
+// subjectOf returns the subject of the principal, or an empty string
+func subjectOf(principal *auth.Principal) string {
+	if principal == nil {
+		return ""
+	}
+	return principal.Subject
+}
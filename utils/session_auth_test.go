@@ -0,0 +1,86 @@
+package utils
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/anyisalin/mcp-openapi-to-mcp-adapter/auth"
+)
+
+// newAuthenticatedPetsServer serves the "pets" configuration behind API key
+// authentication like main does: "pets-key" may only use the "pets"
+// configuration, "other-key" only the "other" configuration
+func newAuthenticatedPetsServer(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	keys, err := auth.NewAPIKeyAuthenticator([]auth.APIKey{
+		{Name: "pets", Key: "pets-key", Scopes: []string{auth.ScopeConnect}, ConfigIDs: []string{"pets"}},
+		{Name: "other", Key: "other-key", Scopes: []string{auth.ScopeConnect}, ConfigIDs: []string{"other"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ss, _ := newPetsServer(t, "http://upstream.invalid", nil)
+	ts := httptest.NewServer(auth.NewMiddleware(keys).Require(auth.ScopeConnect, ss))
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+// connectStatus opens an SSE connection with the API key and returns the status
+func connectStatus(t *testing.T, url, apiKey string) int {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if apiKey != "" {
+		req.Header.Set("X-API-Key", apiKey)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestConnectRestrictedToConfigIDs(t *testing.T) {
+	ts := newAuthenticatedPetsServer(t)
+
+	for name, test := range map[string]struct {
+		url    string
+		apiKey string
+		status int
+	}{
+		"without a key":           {"/sse?configId=pets", "", http.StatusUnauthorized},
+		"with an invalid key":     {"/sse?configId=pets", "wrong-key", http.StatusUnauthorized},
+		"another configuration":   {"/sse?configId=pets", "other-key", http.StatusForbidden},
+		"an ad-hoc session":       {"/sse?s=pets.json&u=http://upstream.invalid", "pets-key", http.StatusForbidden},
+		"no configuration at all": {"/sse", "pets-key", http.StatusForbidden},
+	} {
+		if status := connectStatus(t, ts.URL+test.url, test.apiKey); status != test.status {
+			t.Errorf("connecting %s: got %d, want %d", name, status, test.status)
+		}
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, ts.URL+"/sse?configId=pets", nil)
+	req.Header.Set("X-API-Key", "pets-key")
+	session := openSessionRequest(t, req)
+
+	// Only the principal that opened the session may post to it
+	for apiKey, want := range map[string]int{"other-key": http.StatusForbidden, "pets-key": http.StatusAccepted} {
+		req, _ := http.NewRequest(http.MethodPost, session.messageURL, strings.NewReader(pingMessage))
+		req.Header.Set("X-API-Key", apiKey)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != want {
+			t.Errorf("message posted with %s: got %d, want %d", apiKey, resp.StatusCode, want)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+const pingMessage = `{"jsonrpc":"2.0","id":1,"method":"ping"}`
+
+func TestMaxSessionsRejectsNewSessions(t *testing.T) {
+	_, ts := newPetsServer(t, "http://upstream.invalid", nil, WithMaxSessions(1))
+	first := openSession(t, ts.URL+"/sse?configId=pets")
+
+	resp, err := http.Get(ts.URL + "/sse?configId=pets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable || resp.Header.Get("Retry-After") == "" {
+		t.Fatalf("session over the limit got %d, Retry-After %q", resp.StatusCode, resp.Header.Get("Retry-After"))
+	}
+
+	// The rejected connection did not take the slot of the active session
+	if status := first.postStatus(pingMessage); status != http.StatusAccepted && status != http.StatusOK {
+		t.Fatalf("active session got %d", status)
+	}
+}
+
+func TestIdleSessionIsClosed(t *testing.T) {
+	_, ts := newPetsServer(t, "http://upstream.invalid", nil, WithIdleTimeout(100*time.Millisecond))
+	session := openSession(t, ts.URL+"/sse?configId=pets")
+
+	closed := make(chan struct{})
+	go func() {
+		session.closed()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("idle session not closed")
+	}
+	if status := session.postStatus(pingMessage); status != http.StatusBadRequest {
+		t.Fatalf("message for the idle session returned %d", status)
+	}
+}
+
+func TestShutdownDrainsSessions(t *testing.T) {
+	ss, ts := newPetsServer(t, "http://upstream.invalid", nil)
+	sessions := []*testSession{
+		openSession(t, ts.URL+"/sse?configId=pets"),
+		openSession(t, ts.URL+"/sse?configId=pets"),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := ss.Shutdown(ctx); err != nil {
+		t.Fatalf("shutdown did not drain: %v", err)
+	}
+	for _, session := range sessions {
+		session.closed()
+	}
+
+	resp, err := http.Get(ts.URL + "/sse?configId=pets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("session opened during shutdown got %d", resp.StatusCode)
+	}
+}
+
+func TestShutdownWithExpiredContextReturnsImmediately(t *testing.T) {
+	ss, ts := newPetsServer(t, "http://upstream.invalid", nil)
+	session := openSession(t, ts.URL+"/sse?configId=pets")
+
+	// A handler that does not finish keeps the server from draining
+	if err := ss.acquireSession(false); err != nil {
+		t.Fatal(err)
+	}
+	defer ss.releaseSession()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	start := time.Now()
+	err := ss.Shutdown(ctx)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected a timeout, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("shutdown waited %v", elapsed)
+	}
+	// Sessions are closed even though the server did not drain
+	session.closed()
+}
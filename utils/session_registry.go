@@ -0,0 +1,271 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/anyisalin/mcp-openapi-to-mcp-adapter/auth"
+	"github.com/anyisalin/mcp-openapi-to-mcp-adapter/tracing"
+	"github.com/google/uuid"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// SessionRegistry records which replica owns the SSE stream of each session,
+// so that a message for the session can be accepted by any replica.
+type SessionRegistry interface {
+	// Register records that the session is owned by the replica for ttl
+	Register(ctx context.Context, sessionID string, owner SessionOwner, ttl time.Duration) error
+	// Lookup returns the owner of the session, or false if it is unknown or expired
+	Lookup(ctx context.Context, sessionID string) (SessionOwner, bool, error)
+	// Unregister removes the session
+	Unregister(ctx context.Context, sessionID string) error
+	// Refresh extends every session owned by the replica by ttl
+	Refresh(ctx context.Context, replicaID string, ttl time.Duration) error
+}
+
+// SessionOwner is the replica holding the SSE stream of a session
+type SessionOwner struct {
+	ReplicaID      string
+	ForwardHeaders []string // Incoming headers the session forwards upstream, relayed along with its messages
+}
+
+// RelayedMessage is a JSON-RPC message accepted by one replica on behalf of
+// the replica owning the session
+type RelayedMessage struct {
+	SessionID  string
+	ReplicaID  string // Replica the message is addressed to
+	Body       []byte
+	Header     http.Header // Trace context, non-credential headers and the headers the session forwards
+	RemoteAddr string
+	Subject    string              // Authenticated caller, empty without authentication
+	Approval   *ApprovalResolution // Decision for an approval pending on the replica, instead of a JSON-RPC message
+}
+
+// MessageRelay forwards messages between replicas
+type MessageRelay interface {
+	// Publish delivers the message to the replica it is addressed to
+	Publish(ctx context.Context, msg RelayedMessage) error
+	// Subscribe calls handle for every message addressed to the replica until ctx is done
+	Subscribe(ctx context.Context, replicaID string, handle func(RelayedMessage)) error
+}
+
+// sessionRegistryTTL is how long a session registration lives without being refreshed
+const sessionRegistryTTL = time.Minute
+
+// registryTimeout bounds each call to the session registry
+const registryTimeout = 5 * time.Second
+
+// registerSession records this replica as the owner of the session, along
+// with the headers the session forwards
+func (s *SSEServer) registerSession(session *sseSession) {
+	if s.sessionRegistry == nil {
+		return
+	}
+	owner := SessionOwner{ReplicaID: s.replicaID}
+	if session.source != nil {
+		for _, rule := range session.source.params.ForwardHeaders {
+			owner.ForwardHeaders = append(owner.ForwardHeaders, rule.Incoming)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), registryTimeout)
+	defer cancel()
+	if err := s.sessionRegistry.Register(ctx, session.sessionID, owner, sessionRegistryTTL); err != nil {
+		s.logger.Error("failed to register session", LogKeySessionID, session.sessionID, "error", err)
+	}
+}
+
+// unregisterSession removes the session from the registry
+func (s *SSEServer) unregisterSession(sessionID string) {
+	if s.sessionRegistry == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), registryTimeout)
+	defer cancel()
+	if err := s.sessionRegistry.Unregister(ctx, sessionID); err != nil {
+		s.logger.Error("failed to unregister session", LogKeySessionID, sessionID, "error", err)
+	}
+}
+
+// refreshSessions keeps the registrations of this replica's sessions alive
+func (s *SSEServer) refreshSessions() {
+	ticker := time.NewTicker(sessionRegistryTTL / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), registryTimeout)
+			if err := s.sessionRegistry.Refresh(ctx, s.replicaID, sessionRegistryTTL); err != nil {
+				s.logger.Error("failed to refresh sessions of replica", "replica_id", s.replicaID, "error", err)
+			}
+			cancel()
+		case <-s.shutdownCh:
+			return
+		}
+	}
+}
+
+// relayMessage forwards a message for a session owned by another replica. It
+// reports whether the message was handled; false means the session is unknown.
+func (s *SSEServer) relayMessage(w http.ResponseWriter, r *http.Request, sessionID string) bool {
+	if s.sessionRegistry == nil || s.messageRelay == nil {
+		return false
+	}
+
+	owner, ok, err := s.sessionRegistry.Lookup(r.Context(), sessionID)
+	if err != nil {
+		s.logger.Error("failed to look up session", LogKeySessionID, sessionID, "error", err)
+		return false
+	}
+	replicaID := owner.ReplicaID
+	if !ok || replicaID == s.replicaID {
+		return false
+	}
+
+	var body json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		s.logger.Warn("message parse error", LogKeySessionID, sessionID, "error", err)
+		s.writeJSONRPCError(w, nil, mcp.PARSE_ERROR, "Parse error")
+		return true
+	}
+
+	err = s.messageRelay.Publish(r.Context(), RelayedMessage{
+		SessionID:  sessionID,
+		ReplicaID:  replicaID,
+		Body:       body,
+		Header:     relayedHeaders(r, owner.ForwardHeaders),
+		RemoteAddr: r.RemoteAddr,
+		Subject:    subjectOf(auth.PrincipalFromRequest(r)),
+	})
+	if err != nil {
+		s.logger.Error("failed to relay message", LogKeySessionID, sessionID, "replica_id", replicaID, "error", err)
+		s.writeJSONRPCError(w, nil, mcp.INTERNAL_ERROR, "Failed to relay message")
+		return true
+	}
+
+	// The response is delivered on the SSE stream held by the owning replica
+	s.logger.Debug("message relayed", LogKeySessionID, sessionID, "replica_id", replicaID)
+	w.WriteHeader(http.StatusAccepted)
+	return true
+}
+
+// relayedHeaderNames are the incoming headers relayed with a message
+var relayedHeaderNames = []string{"Content-Type", "User-Agent"}
+
+// relayedHeaders returns the headers of a message relayed to another replica:
+// the trace context, a few non-credential headers and the headers the session
+// forwards upstream.
+// Relayed messages are stored until the owning replica claims them, so
+// credentials such as Authorization, X-Api-Key and Cookie are never relayed.
+func relayedHeaders(r *http.Request, forwardHeaders []string) http.Header {
+	header := http.Header{}
+	tracing.InjectHTTP(tracing.ExtractHTTP(r.Context(), r.Header), header)
+	for _, name := range relayedHeaderNames {
+		if values := r.Header.Values(name); len(values) > 0 {
+			header[name] = append([]string(nil), values...)
+		}
+	}
+	for _, name := range forwardHeaders {
+		name = http.CanonicalHeaderKey(name)
+		if reservedIncomingHeaders[name] {
+			continue
+		}
+		if values := r.Header.Values(name); len(values) > 0 {
+			header[name] = append([]string(nil), values...)
+		}
+	}
+	return header
+}
+
+// consumeRelayedMessages processes messages relayed to this replica until shutdown
+func (s *SSEServer) consumeRelayedMessages() {
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-s.shutdownCh
+		cancel()
+	}()
+
+	for {
+		err := s.messageRelay.Subscribe(ctx, s.replicaID, func(msg RelayedMessage) {
+			go s.handleRelayedMessage(ctx, msg)
+		})
+		if ctx.Err() != nil {
+			return
+		}
+		s.logger.Error("relay subscription ended", "replica_id", s.replicaID, "error", err)
+		select {
+		case <-time.After(time.Second):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// handleRelayedMessage processes a message relayed from another replica as if
+// it had been posted to this replica
+func (s *SSEServer) handleRelayedMessage(ctx context.Context, msg RelayedMessage) {
+	if msg.Approval != nil {
+		if err := s.resolveLocalApproval(*msg.Approval); err != nil {
+			s.logger.Warn("relayed approval decision not applied", "approval_id", msg.Approval.ID, "error", err)
+		}
+		return
+	}
+
+	sessionI, ok := s.sessions.Load(msg.SessionID)
+	if !ok {
+		s.logger.Warn("relayed message for unknown session", LogKeySessionID, msg.SessionID)
+		return
+	}
+	session := sessionI.(*sseSession)
+	if session.principal != nil && session.principal.Subject != msg.Subject {
+		session.logger.Warn("relayed message from a different principal rejected", "subject", msg.Subject)
+		return
+	}
+	session.touch()
+
+	s.serversMutex.RLock()
+	mcpServer := s.servers[msg.SessionID]
+	s.serversMutex.RUnlock()
+	if mcpServer == nil {
+		session.logger.Error("session has no MCP server")
+		return
+	}
+
+	session.logger.Debug("relayed message received", "remote_addr", msg.RemoteAddr)
+
+	ctx = mcpServer.WithContext(tracing.ExtractHTTP(ctx, msg.Header), session)
+	ctx = withIncomingHeaders(ctx, session.requestHeaders(msg.Header))
+	if s.contextFunc != nil {
+		// Rebuild the original request so context functions see its headers
+		r, err := http.NewRequestWithContext(ctx, http.MethodPost, s.CompleteMessagePath()+"?sessionId="+url.QueryEscape(msg.SessionID), bytes.NewReader(msg.Body))
+		if err != nil {
+			session.logger.Error("failed to rebuild relayed request", "error", err)
+			return
+		}
+		if msg.Header != nil {
+			r.Header = msg.Header
+		}
+		r.RemoteAddr = msg.RemoteAddr
+		if session.principal != nil {
+			r = r.WithContext(auth.WithPrincipal(r.Context(), session.principal))
+		}
+		ctx = s.contextFunc(ctx, r)
+	}
+
+	s.processMessage(ctx, session, mcpServer, msg.Body)
+}
+
+// defaultReplicaID returns an identifier unique to this process
+func defaultReplicaID() string {
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "replica"
+	}
+	return hostname + "-" + uuid.New().String()[:8]
+}
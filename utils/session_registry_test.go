@@ -0,0 +1,266 @@
+package utils
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// memoryRegistry is a SessionRegistry shared by the replicas of a test
+type memoryRegistry struct {
+	mu        sync.Mutex
+	entries   map[string]memoryRegistration
+	approvals map[string]memoryApproval
+}
+
+type memoryRegistration struct {
+	owner     SessionOwner
+	expiresAt time.Time
+}
+
+func newMemoryRegistry() *memoryRegistry {
+	return &memoryRegistry{entries: map[string]memoryRegistration{}, approvals: map[string]memoryApproval{}}
+}
+
+// memoryApproval is an approval pending on a replica
+type memoryApproval struct {
+	approval  PendingApproval
+	replicaID string
+}
+
+func (r *memoryRegistry) RegisterApproval(ctx context.Context, approval PendingApproval, replicaID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.approvals[approval.ID] = memoryApproval{approval: approval, replicaID: replicaID}
+	return nil
+}
+
+func (r *memoryRegistry) LookupApproval(ctx context.Context, id string) (string, bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	entry, ok := r.approvals[id]
+	return entry.replicaID, ok, nil
+}
+
+func (r *memoryRegistry) UnregisterApproval(ctx context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.approvals, id)
+	return nil
+}
+
+func (r *memoryRegistry) ListApprovals(ctx context.Context) ([]PendingApproval, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	approvals := []PendingApproval{}
+	for _, entry := range r.approvals {
+		approvals = append(approvals, entry.approval)
+	}
+	return approvals, nil
+}
+
+func (r *memoryRegistry) Register(ctx context.Context, sessionID string, owner SessionOwner, ttl time.Duration) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.entries[sessionID] = memoryRegistration{owner: owner, expiresAt: time.Now().Add(ttl)}
+	return nil
+}
+
+func (r *memoryRegistry) Lookup(ctx context.Context, sessionID string) (SessionOwner, bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	entry, ok := r.entries[sessionID]
+	if !ok || time.Now().After(entry.expiresAt) {
+		return SessionOwner{}, false, nil
+	}
+	return entry.owner, true, nil
+}
+
+func (r *memoryRegistry) Unregister(ctx context.Context, sessionID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.entries, sessionID)
+	return nil
+}
+
+func (r *memoryRegistry) Refresh(ctx context.Context, replicaID string, ttl time.Duration) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for sessionID, entry := range r.entries {
+		if entry.owner.ReplicaID == replicaID {
+			entry.expiresAt = time.Now().Add(ttl)
+			r.entries[sessionID] = entry
+		}
+	}
+	return nil
+}
+
+// registered returns the sessions in the registry
+func (r *memoryRegistry) registered() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.entries)
+}
+
+// memoryRelay is a MessageRelay delivering messages between the replicas of a test
+type memoryRelay struct {
+	mu     sync.Mutex
+	queues map[string]chan RelayedMessage
+	sent   atomic.Int32
+}
+
+func (r *memoryRelay) queue(replicaID string) chan RelayedMessage {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.queues == nil {
+		r.queues = map[string]chan RelayedMessage{}
+	}
+	if r.queues[replicaID] == nil {
+		r.queues[replicaID] = make(chan RelayedMessage, 16)
+	}
+	return r.queues[replicaID]
+}
+
+func (r *memoryRelay) Publish(ctx context.Context, msg RelayedMessage) error {
+	r.sent.Add(1)
+	r.queue(msg.ReplicaID) <- msg
+	return nil
+}
+
+func (r *memoryRelay) Subscribe(ctx context.Context, replicaID string, handle func(RelayedMessage)) error {
+	queue := r.queue(replicaID)
+	for {
+		select {
+		case msg := <-queue:
+			handle(msg)
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// newReplica serves the "pets" configuration as one replica sharing the registry and relay
+func newReplica(t *testing.T, replicaID, upstreamURL string, registry *memoryRegistry, relay *memoryRelay) (*SSEServer, *httptest.Server) {
+	t.Helper()
+	ss, ts := newPetsServer(t, upstreamURL, nil,
+		WithReplicaID(replicaID), WithSessionRegistry(registry), WithMessageRelay(relay))
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		ss.Shutdown(ctx)
+	})
+	return ss, ts
+}
+
+// postTo posts a message to the message endpoint of another replica
+func postTo(t *testing.T, replicaURL, messageURL, body string) *http.Response {
+	t.Helper()
+	resp, err := http.Post(replicaURL+messageURL[strings.Index(messageURL, "/message"):], "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp
+}
+
+func TestMessageRelayedToOwningReplica(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"name":"rex"}`)
+	}))
+	defer upstream.Close()
+
+	registry, relay := newMemoryRegistry(), &memoryRelay{}
+	_, owner := newReplica(t, "replica-a", upstream.URL, registry, relay)
+	_, other := newReplica(t, "replica-b", upstream.URL, registry, relay)
+
+	session := openSession(t, owner.URL+"/sse?configId=pets")
+	if registry.registered() != 1 {
+		t.Fatalf("expected the session to be registered, got %d entries", registry.registered())
+	}
+
+	// Messages posted to the other replica are answered on the owner's stream
+	if resp := postTo(t, other.URL, session.messageURL, fmt.Sprintf(initializeMessage, `{}`)); resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("relayed message returned %d", resp.StatusCode)
+	}
+	if event := session.next(); !strings.Contains(event, `"id":1`) || !strings.Contains(event, "serverInfo") {
+		t.Fatalf("unexpected initialize response %s", event)
+	}
+
+	postTo(t, other.URL, session.messageURL, `{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"`+petsTool+`","arguments":{}}}`)
+	if event := session.next(); !strings.Contains(event, `"id":2`) || !strings.Contains(event, "rex") {
+		t.Fatalf("unexpected tool result %s", event)
+	}
+	if relay.sent.Load() != 2 {
+		t.Fatalf("expected 2 relayed messages, got %d", relay.sent.Load())
+	}
+
+	// Messages posted to the owner are not relayed
+	session.post(`{"jsonrpc":"2.0","id":3,"method":"tools/list"}`)
+	session.next()
+	if relay.sent.Load() != 2 {
+		t.Fatalf("message for a local session was relayed")
+	}
+}
+
+func TestSessionRegistryDropsStaleEntries(t *testing.T) {
+	registry, relay := newMemoryRegistry(), &memoryRelay{}
+	owner, ownerTS := newReplica(t, "replica-a", "http://upstream.invalid", registry, relay)
+	_, other := newReplica(t, "replica-b", "http://upstream.invalid", registry, relay)
+
+	// A disconnected session is removed from the registry
+	ctx, disconnect := context.WithCancel(context.Background())
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, ownerTS.URL+"/sse?configId=pets", nil)
+	stream, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	session := &testSession{t: t, events: bufio.NewReader(stream.Body)}
+	session.messageURL = ownerTS.URL + session.next()
+	disconnect()
+	stream.Body.Close()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for registry.registered() != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("disconnected session was not unregistered")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if resp := postTo(t, other.URL, session.messageURL, `{"jsonrpc":"2.0","id":1,"method":"ping"}`); resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("message for a closed session returned %d", resp.StatusCode)
+	}
+
+	// An entry whose owner stopped refreshing it is not relayed to
+	registry.Register(context.Background(), "crashed", SessionOwner{ReplicaID: "replica-gone"}, -time.Second)
+	resp, err := http.Post(other.URL+"/message?sessionId=crashed", "application/json", strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"ping"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest || relay.sent.Load() != 0 {
+		t.Fatalf("expired entry was relayed: %d, %d messages", resp.StatusCode, relay.sent.Load())
+	}
+	registry.Unregister(context.Background(), "crashed")
+
+	// Shutting a replica down unregisters the sessions it owns
+	openSession(t, ownerTS.URL+"/sse?configId=pets")
+	openSession(t, ownerTS.URL+"/sse?configId=pets")
+	if registry.registered() != 2 {
+		t.Fatalf("expected 2 registered sessions, got %d", registry.registered())
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := owner.Shutdown(shutdownCtx); err != nil {
+		t.Fatal(err)
+	}
+	if registry.registered() != 0 {
+		t.Fatalf("%d sessions left in the registry after shutdown", registry.registered())
+	}
+}
@@ -0,0 +1,327 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// sessionSource records what the MCP server of a session was built from,
+// so that the server can be rebuilt when the configuration or the remote
+// schema changes.
+type sessionSource struct {
+	configID    string            // ID of the stored configuration, empty for ad-hoc sessions
+	revision    int               // Revision the session is pinned to, 0 to follow the configuration
+	params      RequestParams     // Parameters including the schema bytes the server was built from
+	toolDigests map[string]string // Tool name -> digest of the tool definition
+}
+
+// ToolDiff describes how the tool set of a session changed after a rebuild
+type ToolDiff struct {
+	Added   []string
+	Removed []string
+	Changed []string
+}
+
+// Empty reports whether the tool set is unchanged
+func (d ToolDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// toolDigests returns a digest of every tool definition keyed by tool name
+func toolDigests(tools []server.ServerTool) map[string]string {
+	digests := make(map[string]string, len(tools))
+	for _, tool := range tools {
+		data, err := json.Marshal(tool.Tool)
+		if err != nil {
+			// Force the tool to be reported as changed
+			data = []byte(err.Error())
+		}
+		sum := sha256.Sum256(data)
+		digests[tool.Tool.Name] = hex.EncodeToString(sum[:])
+	}
+	return digests
+}
+
+// diffTools compares two tool digest sets
+func diffTools(oldDigests, newDigests map[string]string) ToolDiff {
+	var diff ToolDiff
+	for name, digest := range newDigests {
+		oldDigest, ok := oldDigests[name]
+		if !ok {
+			diff.Added = append(diff.Added, name)
+		} else if oldDigest != digest {
+			diff.Changed = append(diff.Changed, name)
+		}
+	}
+	for name := range oldDigests {
+		if _, ok := newDigests[name]; !ok {
+			diff.Removed = append(diff.Removed, name)
+		}
+	}
+	sort.Strings(diff.Added)
+	sort.Strings(diff.Removed)
+	sort.Strings(diff.Changed)
+	return diff
+}
+
+// ReloadConfig rebuilds the MCP servers of all sessions bound to the given
+// configuration ID and notifies those sessions if their tool set changed.
+// Sessions pinned to a revision are left alone.
+func (s *SSEServer) ReloadConfig(ctx context.Context, configID string) error {
+	following := func(source *sessionSource) bool { return source.configID == configID && source.revision == 0 }
+	if !s.hasSessions(following) {
+		return nil
+	}
+
+	params, _, err := s.loadConfigParams(ctx, configID, 0)
+	if err != nil {
+		return err
+	}
+
+	s.logger.Info("reloading sessions bound to configuration", LogKeyConfigID, configID)
+	return s.rebuildSessions(
+		following,
+		func(source *sessionSource) RequestParams { return params },
+	)
+}
+
+// CloseConfig closes every session bound to the given configuration ID,
+// including sessions pinned to a revision, so that none keeps running on the
+// handlers and credentials of a deleted configuration. It returns the number
+// of sessions closed.
+func (s *SSEServer) CloseConfig(configID string) int {
+	var sessionIDs []string
+	var auths []*UpstreamAuth
+	s.reloadMu.Lock()
+	s.sessions.Range(func(key, value interface{}) bool {
+		session := value.(*sseSession)
+		if session.source != nil && session.source.configID == configID {
+			sessionIDs = append(sessionIDs, session.sessionID)
+			auths = append(auths, session.source.params.UpstreamAuth)
+		}
+		return true
+	})
+	s.reloadMu.Unlock()
+
+	for _, sessionID := range sessionIDs {
+		s.removeSession(sessionID)
+	}
+	evictUpstreamTokens(auths...)
+
+	if len(sessionIDs) > 0 {
+		s.logger.Info("closed sessions bound to deleted configuration", LogKeyConfigID, configID, "sessions", len(sessionIDs))
+	}
+	return len(sessionIDs)
+}
+
+// hasSessions reports whether any active session matches the predicate
+func (s *SSEServer) hasSessions(match func(source *sessionSource) bool) bool {
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+
+	found := false
+	s.sessions.Range(func(key, value interface{}) bool {
+		session := value.(*sseSession)
+		if session.source != nil && match(session.source) {
+			found = true
+			return false
+		}
+		return true
+	})
+	return found
+}
+
+// rebuildSessions rebuilds the MCP server of every session matched by match
+// from the parameters returned by paramsFor. Sessions whose tool set changed
+// receive a notifications/tools/list_changed notification.
+func (s *SSEServer) rebuildSessions(match func(source *sessionSource) bool, paramsFor func(source *sessionSource) RequestParams) error {
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+
+	var errs []string
+	s.sessions.Range(func(key, value interface{}) bool {
+		session := value.(*sseSession)
+		if session.source == nil || !match(session.source) {
+			return true
+		}
+		if err := s.rebuildSession(session, paramsFor(session.source)); err != nil {
+			session.logger.Error("failed to rebuild session", "error", err)
+			errs = append(errs, fmt.Sprintf("session %s: %v", session.sessionID, err))
+		}
+		return true
+	})
+
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to rebuild sessions: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// rebuildSession rebuilds the MCP server of a single session. The caller must hold reloadMu.
+func (s *SSEServer) rebuildSession(session *sseSession, params RequestParams) error {
+	parser, err := s.parseOpenAPI(context.Background(), params)
+	if err != nil {
+		return fmt.Errorf("failed to parse OpenAPI schema: %w", err)
+	}
+
+	tools := BuildServerTools(params.BaseURL, params.Headers, parser, params.toolHandlerOptions()...)
+	digests := toolDigests(tools)
+	diff := diffTools(session.source.toolDigests, digests)
+
+	handlersChanged := handlerParamsChanged(session.source.params, params)
+
+	forwardHeadersChanged := !reflect.DeepEqual(session.source.params.ForwardHeaders, params.ForwardHeaders)
+	// Tokens of replaced upstream credentials are no longer needed
+	if oldAuth := session.source.params.UpstreamAuth; oldAuth != nil && !reflect.DeepEqual(oldAuth, params.UpstreamAuth) {
+		evictUpstreamTokens(oldAuth)
+	}
+	source := *session.source
+	source.params = params
+	source.toolDigests = digests
+	session.source = &source
+
+	// Other replicas relay only the headers the session forwards
+	if forwardHeadersChanged {
+		s.registerSession(session)
+	}
+
+	if diff.Empty() && !handlersChanged {
+		session.logger.Debug("tool set unchanged")
+		return nil
+	}
+
+	mcpServer := newMCPServer(parser.Info(), tools)
+	if err := mcpServer.RegisterSession(session); err != nil {
+		return fmt.Errorf("session registration failed: %w", err)
+	}
+
+	s.serversMutex.Lock()
+	// Don't resurrect a session that was removed while it was being rebuilt
+	if _, ok := s.sessions.Load(session.sessionID); !ok {
+		s.serversMutex.Unlock()
+		mcpServer.UnregisterSession(session.sessionID)
+		return nil
+	}
+	oldServer := s.servers[session.sessionID]
+	s.servers[session.sessionID] = mcpServer
+	s.serversMutex.Unlock()
+
+	if oldServer != nil {
+		oldServer.UnregisterSession(session.sessionID)
+	}
+
+	// Only the way tools call the upstream changed, the client has nothing to refetch
+	if diff.Empty() {
+		session.logger.Info("upstream settings changed")
+		return nil
+	}
+
+	session.logger.Info("tools changed", "added", len(diff.Added), "removed", len(diff.Removed), "changed", len(diff.Changed))
+
+	if !session.Initialized() {
+		return nil
+	}
+
+	notification := mcp.JSONRPCNotification{
+		JSONRPC: mcp.JSONRPC_VERSION,
+		Notification: mcp.Notification{
+			Method: "notifications/tools/list_changed",
+		},
+	}
+	select {
+	case session.notificationChannel <- notification:
+	case <-session.done:
+	default:
+		session.logger.Warn("notification channel full, dropping tools/list_changed")
+	}
+
+	return nil
+}
+
+// handlerParamsChanged reports whether the parameters used by tool handlers
+// to call the upstream API differ, which requires new handlers even when the
+// tool definitions are unchanged. Tool overrides count too: pinned and
+// hidden arguments are applied by the handlers and left out of the tools.
+func handlerParamsChanged(oldParams, newParams RequestParams) bool {
+	return oldParams.BaseURL != newParams.BaseURL ||
+		!reflect.DeepEqual(oldParams.Headers, newParams.Headers) ||
+		!reflect.DeepEqual(oldParams.UpstreamAuth, newParams.UpstreamAuth) ||
+		!reflect.DeepEqual(oldParams.ForwardHeaders, newParams.ForwardHeaders) ||
+		!reflect.DeepEqual(oldParams.Approval, newParams.Approval) ||
+		!reflect.DeepEqual(oldParams.ToolOverrides, newParams.ToolOverrides)
+}
+
+// pollSpecs periodically re-fetches the remote schemas used by active sessions
+// and rebuilds the sessions whose schema changed.
+func (s *SSEServer) pollSpecs() {
+	ticker := time.NewTicker(s.specPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.checkRemoteSpecs()
+		case <-s.shutdownCh:
+			return
+		}
+	}
+}
+
+// checkRemoteSpecs fetches every distinct remote schema once and rebuilds the
+// sessions built from a different version of it.
+func (s *SSEServer) checkRemoteSpecs() {
+	// Collect the distinct remote schema URLs in use
+	s.reloadMu.Lock()
+	schemaURLs := map[string]struct{}{}
+	s.sessions.Range(func(key, value interface{}) bool {
+		session := value.(*sseSession)
+		if session.source == nil {
+			return true
+		}
+		schemaURL := session.source.params.SchemaURL
+		if strings.HasPrefix(schemaURL, "http://") || strings.HasPrefix(schemaURL, "https://") {
+			schemaURLs[schemaURL] = struct{}{}
+		}
+		return true
+	})
+	s.reloadMu.Unlock()
+
+	for schemaURL := range schemaURLs {
+		rawBytes, err := loadSchemaBytes(context.Background(), schemaURL)
+		if err != nil {
+			s.logger.Error("failed to re-check schema", "schema_url", s.redactor.URL(schemaURL), "error", err)
+			continue
+		}
+		if len(rawBytes) == 0 {
+			continue
+		}
+
+		changed := func(source *sessionSource) bool {
+			return source.params.SchemaURL == schemaURL && !bytes.Equal(source.params.RawBytes, rawBytes)
+		}
+		if !s.hasSessions(changed) {
+			continue
+		}
+
+		s.logger.Info("remote schema changed", "schema_url", s.redactor.URL(schemaURL))
+		err = s.rebuildSessions(changed, func(source *sessionSource) RequestParams {
+			params := source.params
+			params.RawBytes = rawBytes
+			return params
+		})
+		if err != nil {
+			s.logger.Error("failed to reload sessions for schema", "schema_url", s.redactor.URL(schemaURL), "error", err)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReloadConfigNotifiesToolsListChanged(t *testing.T) {
+	ss, ts := newPetsServer(t, "http://upstream.invalid", nil)
+	config := ss.configLoader.(*staticConfigLoader).config
+
+	session := openSession(t, ts.URL+"/sse?configId=pets")
+	session.post(fmt.Sprintf(initializeMessage, `{}`))
+	session.next()
+	session.post(`{"jsonrpc":"2.0","method":"notifications/initialized"}`)
+
+	// An unchanged tool set is rebuilt silently
+	if err := ss.ReloadConfig(context.Background(), "pets"); err != nil {
+		t.Fatal(err)
+	}
+
+	// A new operation is announced and listed
+	schema := `{"openapi":"3.0.0","info":{"title":"Pets","version":"1"},"paths":{"/pet":{"get":{"operationId":"getPet"},"delete":{"operationId":"deletePet"}}}}`
+	if err := os.WriteFile(config.SchemaURL, []byte(schema), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ss.ReloadConfig(context.Background(), "pets"); err != nil {
+		t.Fatal(err)
+	}
+	if event := session.next(); !strings.Contains(event, `"notifications/tools/list_changed"`) {
+		t.Fatalf("expected tools/list_changed, got %s", event)
+	}
+
+	session.post(`{"jsonrpc":"2.0","id":2,"method":"tools/list"}`)
+	if event := session.next(); !strings.Contains(event, "_delete_") {
+		t.Fatalf("rebuilt session does not list the new tool: %s", event)
+	}
+
+	// Sessions of other configurations are left alone
+	if err := ss.ReloadConfig(context.Background(), "other"); err != nil {
+		t.Fatalf("reloading a configuration without sessions: %v", err)
+	}
+}
+
+func TestReloadPinnedArgument(t *testing.T) {
+	tenants := make(chan string, 2)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tenants <- r.URL.Query().Get("tenant")
+		w.Write([]byte(`{}`))
+	}))
+	defer upstream.Close()
+
+	ss, ts := newPetsServer(t, upstream.URL, nil)
+	schemaPath := filepath.Join(t.TempDir(), "tenants.json")
+	schema := `{"openapi":"3.0.0","info":{"title":"Pets","version":"1"},"paths":{"/pet":{"get":{"operationId":"getPet","parameters":[{"name":"tenant","in":"query","schema":{"type":"string"}}]}}}}`
+	if err := os.WriteFile(schemaPath, []byte(schema), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	config := ss.configLoader.(*staticConfigLoader).config
+	config.SchemaURL = schemaPath
+	config.ToolOverrides = ToolOverrides{"getPet": {PinnedArguments: map[string]interface{}{"tenant": "acme"}}}
+
+	session := openSession(t, ts.URL+"/sse?configId=pets")
+	session.post(fmt.Sprintf(initializeMessage, `{}`))
+	session.next()
+	call := `{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"` + petsTool + `","arguments":{}}}`
+	go session.post(call)
+	session.next()
+	if tenant := <-tenants; tenant != "acme" {
+		t.Fatalf("upstream got tenant %q", tenant)
+	}
+
+	// Only the pinned value changes: the tools are the same, the handlers are not
+	config.ToolOverrides = ToolOverrides{"getPet": {PinnedArguments: map[string]interface{}{"tenant": "globex"}}}
+	if err := ss.ReloadConfig(context.Background(), "pets"); err != nil {
+		t.Fatal(err)
+	}
+	go session.post(strings.Replace(call, `"id":2`, `"id":3`, 1))
+	if event := session.next(); !strings.Contains(event, `"id":3`) {
+		t.Fatalf("expected the call result, got %s", event)
+	}
+	if tenant := <-tenants; tenant != "globex" {
+		t.Errorf("session kept the old pinned value, upstream got tenant %q", tenant)
+	}
+}
+
+func TestCloseConfigEndsSessions(t *testing.T) {
+	ss, ts := newPetsServer(t, "http://upstream.invalid", nil)
+	sessions := []*testSession{
+		openSession(t, ts.URL+"/sse?configId=pets"),
+		openSession(t, ts.URL+"/sse?configId=pets"),
+	}
+
+	if n := ss.CloseConfig("other"); n != 0 {
+		t.Fatalf("closed %d sessions of another configuration", n)
+	}
+	if n := ss.CloseConfig("pets"); n != 2 {
+		t.Fatalf("expected 2 closed sessions, got %d", n)
+	}
+
+	for _, session := range sessions {
+		session.closed()
+		if status := session.postStatus(`{"jsonrpc":"2.0","id":1,"method":"ping"}`); status != http.StatusBadRequest {
+			t.Errorf("message for a closed session returned %d", status)
+		}
+	}
+}
+
+func TestDiffTools(t *testing.T) {
+	diff := diffTools(
+		map[string]string{"kept": "a", "changed": "b", "removed": "c"},
+		map[string]string{"kept": "a", "changed": "x", "added": "d"},
+	)
+	if fmt.Sprint(diff.Added, diff.Removed, diff.Changed) != "[added] [removed] [changed]" {
+		t.Fatalf("unexpected diff %+v", diff)
+	}
+	if !diffTools(map[string]string{"a": "1"}, map[string]string{"a": "1"}).Empty() {
+		t.Fatal("identical tool sets reported as changed")
+	}
+}
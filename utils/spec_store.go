@@ -0,0 +1,85 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// SpecReferencePrefix marks schema URLs pointing at a specification stored by
+// the server, e.g. "spec:6650c0ffee0123456789abcd"
+const SpecReferencePrefix = "spec:"
+
+// ErrSpecStoreUnavailable is returned when loading a stored specification
+// while no SpecStore is configured
+var ErrSpecStoreUnavailable = errors.New("stored specifications are not available")
+
+// SpecStore reads specifications uploaded to the server, so that configurations
+// do not depend on the host serving their schema
+type SpecStore interface {
+	// SpecContent returns the content of a stored specification
+	SpecContent(ctx context.Context, id string) ([]byte, error)
+}
+
+var (
+	specStoreMu sync.RWMutex
+	specStore   SpecStore
+)
+
+// SetSpecStore sets the store of the specifications referenced by spec: schema URLs
+func SetSpecStore(store SpecStore) {
+	specStoreMu.Lock()
+	defer specStoreMu.Unlock()
+	specStore = store
+}
+
+// SpecReference returns the ID of the stored specification a schema URL
+// points at, if it is a spec: reference
+func SpecReference(schemaURL string) (string, bool) {
+	if !strings.HasPrefix(schemaURL, SpecReferencePrefix) {
+		return "", false
+	}
+	return strings.TrimPrefix(schemaURL, SpecReferencePrefix), true
+}
+
+// loadStoredSpec reads a stored specification from the SpecStore
+func loadStoredSpec(ctx context.Context, id string) ([]byte, error) {
+	specStoreMu.RLock()
+	store := specStore
+	specStoreMu.RUnlock()
+
+	if store == nil {
+		return nil, ErrSpecStoreUnavailable
+	}
+	return store.SpecContent(ctx, id)
+}
+
+// ParseSpec parses an OpenAPI specification in JSON or YAML, as uploaded to
+// the server, and returns its parser and format ("json" or "yaml")
+func ParseSpec(data []byte) (OpenAPIParser, string, error) {
+	format := "yaml"
+	var parser OpenAPIParser
+	var err error
+	if json.Valid(data) {
+		format = "json"
+		parser, err = ParseOpenAPIFromJSON(data)
+	} else {
+		parser, err = ParseOpenAPIFromYAML(data)
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	if simple, ok := parser.(*SimpleOpenAPIParser); ok {
+		if simple.document["openapi"] == nil && simple.document["swagger"] == nil {
+			return nil, "", fmt.Errorf("not an OpenAPI specification: missing openapi or swagger version")
+		}
+		if _, ok := simple.document["paths"].(map[string]interface{}); !ok {
+			return nil, "", fmt.Errorf("invalid OpenAPI specification: missing paths")
+		}
+	}
+	return parser, format, nil
+}
@@ -0,0 +1,56 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// memorySpecStore serves specs from memory
+type memorySpecStore map[string][]byte
+
+func (s memorySpecStore) SpecContent(ctx context.Context, id string) ([]byte, error) {
+	content, ok := s[id]
+	if !ok {
+		return nil, errors.New("spec not found")
+	}
+	return content, nil
+}
+
+func TestParseSpec(t *testing.T) {
+	_, format, err := ParseSpec([]byte("openapi: 3.0.0\ninfo:\n  title: Pets\npaths:\n  /pets:\n    get: {}\n"))
+	if err != nil || format != "yaml" {
+		t.Fatalf("ParseSpec(yaml) = %q, %v", format, err)
+	}
+
+	parser, format, err := ParseSpec([]byte(`{"openapi":"3.0.0","info":{"title":"Pets"},"paths":{"/pets":{"get":{}}}}`))
+	if err != nil || format != "json" {
+		t.Fatalf("ParseSpec(json) = %q, %v", format, err)
+	}
+	if parser.Info().Title != "Pets" || len(parser.APIs()) != 1 {
+		t.Errorf("unexpected parse result: %+v, %d endpoints", parser.Info(), len(parser.APIs()))
+	}
+
+	for _, invalid := range []string{`{"name":"not a spec"}`, `{"openapi":"3.0.0"}`, "openapi: [3"} {
+		if _, _, err := ParseSpec([]byte(invalid)); err == nil {
+			t.Errorf("ParseSpec(%s) succeeded", invalid)
+		}
+	}
+}
+
+func TestLoadStoredSpec(t *testing.T) {
+	t.Cleanup(func() { SetSpecStore(nil) })
+
+	if _, err := loadSchemaBytes(context.Background(), "spec:abc"); !errors.Is(err, ErrSpecStoreUnavailable) {
+		t.Fatalf("expected ErrSpecStoreUnavailable, got %v", err)
+	}
+
+	SetSpecStore(memorySpecStore{"abc": []byte(`{"openapi":"3.0.0"}`)})
+	data, err := loadSchemaBytes(context.Background(), "spec:abc")
+	if err != nil || string(data) != `{"openapi":"3.0.0"}` {
+		t.Fatalf("loadSchemaBytes = %s, %v", data, err)
+	}
+	if _, err := loadSchemaBytes(context.Background(), "spec:missing"); err == nil {
+		t.Error("expected an error for a missing spec")
+	}
+}
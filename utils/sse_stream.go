@@ -0,0 +1,153 @@
+package utils
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// sseEvent is a single event queued for delivery on the SSE stream of a session
+type sseEvent struct {
+	id   uint64 // Sequence number within the session, assigned when the event is written
+	name string
+	data []byte
+}
+
+// newMessageEvent creates a "message" event carrying a JSON-RPC payload
+func newMessageEvent(data []byte) sseEvent {
+	return sseEvent{name: "message", data: data}
+}
+
+// formatEventID builds the SSE event ID of an event. The session ID is part of
+// the event ID so that a client reconnecting with Last-Event-ID can be routed
+// back to its session.
+func formatEventID(sessionID string, seq uint64) string {
+	return sessionID + ":" + strconv.FormatUint(seq, 10)
+}
+
+// parseEventID splits an event ID created by formatEventID
+func parseEventID(eventID string) (string, uint64, bool) {
+	idx := strings.LastIndex(eventID, ":")
+	if idx <= 0 {
+		return "", 0, false
+	}
+	seq, err := strconv.ParseUint(eventID[idx+1:], 10, 64)
+	if err != nil {
+		return "", 0, false
+	}
+	return eventID[:idx], seq, true
+}
+
+// lastEventID returns the Last-Event-ID sent by a reconnecting client, falling
+// back to the lastEventId query parameter for clients that cannot set headers.
+func lastEventID(r *http.Request) string {
+	if id := r.Header.Get("Last-Event-ID"); id != "" {
+		return id
+	}
+	return r.URL.Query().Get("lastEventId")
+}
+
+// attach makes w the stream of the session, replacing the previous stream if
+// any. It writes the endpoint event and replays every buffered event after
+// lastSeq. The returned channel is closed when another stream takes over.
+func (s *sseSession) attach(w http.ResponseWriter, flusher http.Flusher, endpoint string, lastSeq uint64, replay bool) <-chan struct{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.takeover != nil {
+		close(s.takeover)
+	}
+	if s.expiry != nil {
+		s.expiry.Stop()
+		s.expiry = nil
+	}
+
+	s.writer = w
+	s.flusher = flusher
+	s.takeover = make(chan struct{})
+
+	fmt.Fprintf(w, "event: endpoint\ndata: %s\r\n\r\n", endpoint)
+	if replay {
+		for _, event := range s.replay {
+			if event.id > lastSeq {
+				s.writeLocked(event)
+			}
+		}
+	}
+	flusher.Flush()
+
+	return s.takeover
+}
+
+// detach releases the stream w if it is still the stream of the session and
+// reports whether it was. Nothing is written to w after detach returns.
+func (s *sseSession) detach(w http.ResponseWriter) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.writer != w {
+		return false
+	}
+	s.writer = nil
+	s.flusher = nil
+	return true
+}
+
+// expireAfter removes the session through remove unless a stream attaches within d
+func (s *sseSession) expireAfter(d time.Duration, remove func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.writer != nil {
+		return
+	}
+	s.expiry = time.AfterFunc(d, func() {
+		s.mu.Lock()
+		detached := s.writer == nil
+		s.mu.Unlock()
+		if detached {
+			remove()
+		}
+	})
+}
+
+// writeEvent assigns the next event ID, records the event for replay and
+// writes it to the current stream, if one is attached.
+func (s *sseSession) writeEvent(event sseEvent, replaySize int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.nextEventID++
+	event.id = s.nextEventID
+
+	if replaySize > 0 {
+		s.replay = append(s.replay, event)
+		if len(s.replay) > replaySize {
+			s.replay = s.replay[len(s.replay)-replaySize:]
+		}
+	}
+
+	if s.writer != nil {
+		s.writeLocked(event)
+		s.flusher.Flush()
+	}
+}
+
+// writeLocked writes an event to the current stream. The caller must hold mu.
+func (s *sseSession) writeLocked(event sseEvent) {
+	fmt.Fprintf(s.writer, "id: %s\nevent: %s\ndata: %s\n\n", formatEventID(s.sessionID, event.id), event.name, event.data)
+}
+
+// writePing writes a keepalive comment to the stream w if it is still attached
+func (s *sseSession) writePing(w http.ResponseWriter) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.writer != w {
+		return
+	}
+	fmt.Fprint(w, ": ping\n\n")
+	s.flusher.Flush()
+}
@@ -0,0 +1,58 @@
+package utils
+
+import (
+	"net/http"
+	"sort"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// CatalogTool is a tool as MCP clients list it, with the operation it calls
+type CatalogTool struct {
+	Name        string              `json:"name"`
+	Description string              `json:"description,omitempty"`
+	InputSchema mcp.ToolInputSchema `json:"inputSchema"`
+	Method      string              `json:"method"`
+	Path        string              `json:"path"`
+	OperationID string              `json:"operationId,omitempty"`
+}
+
+// ToolCatalog lists the tools an MCP client would see for a stored
+// configuration, or a revision of it, or for the ad-hoc parameters of the
+// request (s, u, h, f or code) if configID is empty, without opening a
+// session. Tools are sorted by name like tools/list. On failure it also
+// returns the HTTP status that should be reported.
+func (s *SSEServer) ToolCatalog(r *http.Request, configID string, revision int) ([]CatalogTool, int, error) {
+	params, status, err := s.resolveParams(r, configID, revision)
+	if err != nil {
+		return nil, status, err
+	}
+
+	parser, err := s.parseOpenAPI(r.Context(), params)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+
+	// Build the tools as a session would; like the MCP server, the last
+	// operation registered under a name wins
+	apis := parser.APIs()
+	tools := buildTools(toolPrefix(parser.Info()), apis, params.BaseURL, params.Headers, params.toolHandlerOptions()...)
+	byName := make(map[string]CatalogTool, len(tools))
+	for i, tool := range tools {
+		byName[tool.Tool.Name] = CatalogTool{
+			Name:        tool.Tool.Name,
+			Description: tool.Tool.Description,
+			InputSchema: tool.Tool.InputSchema,
+			Method:      apis[i].Method,
+			Path:        apis[i].Path,
+			OperationID: apis[i].OperationID,
+		}
+	}
+
+	catalog := make([]CatalogTool, 0, len(byName))
+	for _, tool := range byName {
+		catalog = append(catalog, tool)
+	}
+	sort.Slice(catalog, func(i, j int) bool { return catalog[i].Name < catalog[j].Name })
+	return catalog, http.StatusOK, nil
+}
@@ -0,0 +1,52 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func TestToolCatalogMatchesToolsList(t *testing.T) {
+	ss, ts := newPetsServer(t, "http://upstream.invalid", nil)
+
+	catalog, status, err := ss.ToolCatalog(httptest.NewRequest("GET", "/api/v1/config/pets/tools", nil), "pets", 0)
+	if err != nil {
+		t.Fatalf("ToolCatalog: %d %v", status, err)
+	}
+	if len(catalog) != 1 || catalog[0].Method != "GET" || catalog[0].Path != "/pet" || catalog[0].OperationID != "getPet" {
+		t.Fatalf("unexpected catalog: %+v", catalog)
+	}
+
+	session := openSession(t, ts.URL+"/sse?configId=pets")
+	session.post(fmt.Sprintf(initializeMessage, `{}`))
+	session.next()
+	go session.post(`{"jsonrpc":"2.0","id":2,"method":"tools/list"}`)
+
+	var response struct {
+		Result mcp.ListToolsResult `json:"result"`
+	}
+	if err := json.Unmarshal([]byte(session.next()), &response); err != nil {
+		t.Fatal(err)
+	}
+	if len(response.Result.Tools) != len(catalog) {
+		t.Fatalf("tools/list returned %d tools, catalog %d", len(response.Result.Tools), len(catalog))
+	}
+	for i, tool := range response.Result.Tools {
+		listed, _ := json.Marshal(tool)
+		cataloged, _ := json.Marshal(mcp.Tool{Name: catalog[i].Name, Description: catalog[i].Description, InputSchema: catalog[i].InputSchema})
+		var a, b interface{}
+		json.Unmarshal(listed, &a)
+		json.Unmarshal(cataloged, &b)
+		if !reflect.DeepEqual(a, b) {
+			t.Errorf("catalog tool %s differs from tools/list: %s", cataloged, listed)
+		}
+	}
+
+	if _, status, err := ss.ToolCatalog(httptest.NewRequest("GET", "/", nil), "missing", 0); err == nil || status != 500 {
+		t.Errorf("expected an error for a missing configuration, got %d %v", status, err)
+	}
+}
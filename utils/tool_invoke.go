@@ -0,0 +1,182 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/anyisalin/mcp-openapi-to-mcp-adapter/auth"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// ErrToolNotFound is returned when invoking a tool a configuration does not have
+var ErrToolNotFound = errors.New("tool not found")
+
+// dryRunMessage is the result of a tool invoked without sending its request
+const dryRunMessage = "Dry run: the request was not sent"
+
+// ToolInvocation is the outcome of invoking a tool outside of an MCP session
+type ToolInvocation struct {
+	Tool      string              `json:"tool"`
+	DryRun    bool                `json:"dryRun,omitempty"`
+	Request   *InvocationRequest  `json:"request,omitempty"`  // Upstream request, nil if none was built
+	Response  *InvocationResponse `json:"response,omitempty"` // Upstream response, nil if none was received
+	LatencyMS float64             `json:"latencyMs"`
+	Result    *mcp.CallToolResult `json:"result"` // What tools/call would return to the client
+}
+
+// InvocationRequest is the upstream request of a tool, with secrets masked
+type InvocationRequest struct {
+	Method  string          `json:"method"`
+	URL     string          `json:"url"`
+	Headers http.Header     `json:"headers"`
+	Body    json.RawMessage `json:"body,omitempty"`
+}
+
+// InvocationResponse is the upstream response of a tool, with secrets masked
+type InvocationResponse struct {
+	StatusCode int         `json:"statusCode"`
+	Headers    http.Header `json:"headers"`
+	Size       int         `json:"size"`      // Bytes of the response body
+	LatencyMS  float64     `json:"latencyMs"` // Time until the response body was read
+}
+
+// invocation collects what a tool handler sent and received for InvokeTool
+type invocation struct {
+	dryRun   bool
+	request  *http.Request
+	body     []byte
+	response *http.Response
+	size     int
+	latency  time.Duration
+}
+
+type invocationContextKey struct{}
+
+// isDryRun reports whether tool handlers must build their upstream request without sending it
+func isDryRun(ctx context.Context) bool {
+	inv, ok := ctx.Value(invocationContextKey{}).(*invocation)
+	return ok && inv.dryRun
+}
+
+// reportInvocationRequest records the upstream request built by a tool handler
+func reportInvocationRequest(ctx context.Context, req *http.Request, body []byte) {
+	if inv, ok := ctx.Value(invocationContextKey{}).(*invocation); ok {
+		inv.request = req
+		inv.body = body
+	}
+}
+
+// reportInvocationResponse records the upstream response received by a tool handler
+func reportInvocationResponse(ctx context.Context, resp *http.Response, size int, latency time.Duration) {
+	if inv, ok := ctx.Value(invocationContextKey{}).(*invocation); ok {
+		inv.response = resp
+		inv.size = size
+		inv.latency = latency
+	}
+}
+
+// InvokeTool calls a tool of a stored configuration the way tools/call
+// would, and returns the upstream request and response along with the tool
+// result. With dryRun the upstream request is built but not sent. Calls of
+// tools that require approval are denied, since nobody can approve them
+// outside of a session. The headers of r belong to the administrator, not to
+// an MCP client, so they are never forwarded upstream. On failure it also
+// returns the HTTP status that should be reported.
+func (s *SSEServer) InvokeTool(r *http.Request, configID, toolName string, arguments map[string]interface{}, dryRun bool) (*ToolInvocation, int, error) {
+	params, status, err := s.resolveParams(r, configID, 0)
+	if err != nil {
+		return nil, status, err
+	}
+
+	parser, err := s.parseOpenAPI(r.Context(), params)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+
+	// Like the MCP server, the last operation registered under a name wins
+	var handler func(context.Context, mcp.CallToolRequest) (*mcp.CallToolResult, error)
+	for _, tool := range BuildServerTools(params.BaseURL, params.Headers, parser, params.toolHandlerOptions()...) {
+		if tool.Tool.Name == toolName {
+			handler = tool.Handler
+		}
+	}
+	if handler == nil {
+		return nil, http.StatusNotFound, fmt.Errorf("%w: %s", ErrToolNotFound, toolName)
+	}
+
+	var request mcp.CallToolRequest
+	request.Method = "tools/call"
+	request.Params.Name = toolName
+	request.Params.Arguments = arguments
+
+	logger := s.logger.With(LogKeyConfigID, configID, LogKeyTool, toolName)
+	inv := &invocation{dryRun: dryRun}
+	ctx := context.WithValue(withLogger(r.Context(), logger), invocationContextKey{}, inv)
+	ctx, call := withUpstreamCall(ctx)
+	start := time.Now()
+	result, err := handler(ctx, request)
+	latency := time.Since(start)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	logger.Info("tool invoked", "dry_run", dryRun, latencyAttr(latency))
+
+	invoked := &ToolInvocation{
+		Tool:      toolName,
+		DryRun:    dryRun,
+		LatencyMS: milliseconds(latency),
+		Result:    result,
+	}
+	if inv.request != nil {
+		invoked.Request = &InvocationRequest{
+			Method:  inv.request.Method,
+			URL:     s.redactor.URL(inv.request.URL.String()),
+			Headers: s.redactor.Headers(inv.request.Header),
+			Body:    s.redactor.redactJSON(inv.body),
+		}
+	}
+	if inv.response != nil {
+		invoked.Response = &InvocationResponse{
+			StatusCode: inv.response.StatusCode,
+			Headers:    s.redactor.Headers(inv.response.Header),
+			Size:       inv.size,
+			LatencyMS:  milliseconds(inv.latency),
+		}
+	}
+
+	// Invocations reach the upstream API like tools/call, so audit them too
+	if s.auditSink != nil && !dryRun {
+		status := "ok"
+		if result.IsError {
+			status = "tool_error"
+		}
+		entry := AuditEntry{
+			ConfigID:     configID,
+			Subject:      subjectOf(auth.PrincipalFromRequest(r)),
+			Tool:         toolName,
+			Method:       call.method,
+			Arguments:    s.redactArguments(arguments),
+			Status:       status,
+			StatusCode:   call.statusCode,
+			Latency:      latency,
+			ResponseSize: call.responseSize,
+			Approval:     call.approval,
+			ApprovedBy:   call.approvedBy,
+		}
+		if call.url != "" {
+			entry.URL = s.redactor.URL(call.url)
+		}
+		s.recordAudit(entry, logger)
+	}
+
+	return invoked, http.StatusOK, nil
+}
+
+// milliseconds returns the duration in milliseconds
+func milliseconds(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
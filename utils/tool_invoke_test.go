@@ -0,0 +1,105 @@
+package utils
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func TestInvokeTool(t *testing.T) {
+	calls := 0
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		// The headers of the administrator are not forwarded
+		if r.Header.Get("X-Tenant") != "" || r.URL.Query().Get("id") != "7" {
+			t.Errorf("unexpected upstream request: %s %v", r.URL, r.Header)
+		}
+		w.Header().Set("Set-Cookie", "session=secret")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"id":7}`))
+	}))
+	defer upstream.Close()
+
+	ss, _ := newPetsServer(t, upstream.URL, nil)
+	config := ss.configLoader.(*staticConfigLoader).config
+	config.Headers = map[string]string{"Authorization": "Bearer secret"}
+	config.ForwardHeaders = []string{"X-Tenant"}
+
+	invoke := func(dryRun bool) *ToolInvocation {
+		t.Helper()
+		r := httptest.NewRequest("POST", "/api/v1/config/pets/tools/"+petsTool+"/invoke", nil)
+		r.Header.Set("X-Tenant", "acme")
+		arguments := map[string]interface{}{"searchParams": map[string]interface{}{"id": 7}}
+		invocation, status, err := ss.InvokeTool(r, "pets", petsTool, arguments, dryRun)
+		if err != nil {
+			t.Fatalf("InvokeTool: %d %v", status, err)
+		}
+		return invocation
+	}
+
+	dry := invoke(true)
+	if calls != 0 || dry.Response != nil || dry.Request == nil {
+		t.Fatalf("dry run sent the request: %+v", dry)
+	}
+	if dry.Request.URL != upstream.URL+"/pet?id=7" || dry.Request.Headers.Get("Authorization") != redactedValue || dry.Request.Headers.Get("X-Tenant") != "" {
+		t.Errorf("unexpected dry run request: %+v", dry.Request)
+	}
+
+	invocation := invoke(false)
+	if calls != 1 || invocation.Response == nil || invocation.Response.StatusCode != http.StatusCreated {
+		t.Fatalf("unexpected invocation: %+v", invocation)
+	}
+	if invocation.Response.Headers.Get("Set-Cookie") != redactedValue || invocation.Response.Size != len(`{"id":7}`) {
+		t.Errorf("unexpected response: %+v", invocation.Response)
+	}
+	if text, ok := invocation.Result.Content[0].(mcp.TextContent); !ok || text.Text != `{"id":7}` {
+		t.Errorf("unexpected result: %+v", invocation.Result)
+	}
+
+	r := httptest.NewRequest("POST", "/", nil)
+	if _, status, err := ss.InvokeTool(r, "pets", "missing", nil, false); !errors.Is(err, ErrToolNotFound) || status != http.StatusNotFound {
+		t.Errorf("expected ErrToolNotFound, got %d %v", status, err)
+	}
+}
+
+func TestInvokeToolMasksRequestBody(t *testing.T) {
+	var received string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received = string(body)
+		w.Write([]byte(`{}`))
+	}))
+	defer upstream.Close()
+
+	ss, _ := newPetsServer(t, upstream.URL, nil)
+	config := ss.configLoader.(*staticConfigLoader).config
+	schemaPath := filepath.Join(t.TempDir(), "pets.json")
+	schema := `{"openapi":"3.0.0","info":{"title":"Pets","version":"1"},"paths":{"/pet":{"post":{"operationId":"addPet"}}}}`
+	if err := os.WriteFile(schemaPath, []byte(schema), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	config.SchemaURL = schemaPath
+	tool := sanitizeToolName(toolPrefix(APIInfo{Title: "Pets"}) + "_post_/pet")
+
+	arguments := map[string]interface{}{"requestBody": map[string]interface{}{"name": "rex", "password": "hunter2"}}
+	for _, dryRun := range []bool{true, false} {
+		invocation, status, err := ss.InvokeTool(httptest.NewRequest("POST", "/", nil), "pets", tool, arguments, dryRun)
+		if err != nil {
+			t.Fatalf("InvokeTool: %d %v", status, err)
+		}
+		body := string(invocation.Request.Body)
+		if strings.Contains(body, "hunter2") || !strings.Contains(body, "rex") {
+			t.Errorf("request body not masked (dry run %v): %s", dryRun, body)
+		}
+	}
+	if !strings.Contains(received, "hunter2") {
+		t.Errorf("upstream received a masked body: %s", received)
+	}
+}
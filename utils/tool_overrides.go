@@ -0,0 +1,308 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// Argument groups of the tool input schema
+const (
+	argumentsPath  = "pathNames"
+	argumentsQuery = "searchParams"
+	argumentsBody  = "requestBody"
+)
+
+// ToolOverrides customises the tools of a configuration, keyed by the
+// operation ID, or by "METHOD /path" for operations without one
+type ToolOverrides map[string]ToolOverride
+
+// ToolOverride customises the tool of an operation. Parameters are named as
+// in the schema, whether they are path, query or request body parameters.
+type ToolOverride struct {
+	Name                  string                 // Replaces the generated tool name
+	Description           string                 // Replaces the generated description
+	AppendDescription     string                 // Appended to the (replaced) description
+	ParameterDescriptions map[string]string      // Replace the descriptions of parameters
+	HiddenParameters      []string               // Removed from the schema; values sent by clients are dropped
+	PinnedArguments       map[string]interface{} // Always sent with these values, removed from the schema
+	Defaults              map[string]interface{} // Advertised in the schema and sent when clients omit the parameter
+}
+
+// WithToolOverrides makes BuildServerTools customise the tools of the
+// operations selected by the overrides
+func WithToolOverrides(overrides ToolOverrides) ToolHandlerOption {
+	return func(o *toolHandlerOptions) {
+		o.toolOverrides = overrides
+	}
+}
+
+// Validate checks that the overrides set valid tool names and do not both
+// pin and hide, or pin and default, the same parameter
+func (o ToolOverrides) Validate() error {
+	keys := make([]string, 0, len(o))
+	for key := range o {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	names := map[string]string{}
+	for _, key := range keys {
+		override := o[key]
+		if strings.TrimSpace(key) == "" {
+			return errors.New(`tool override must be keyed by an operation ID or "METHOD /path"`)
+		}
+		if override.Name != "" {
+			if sanitizeToolName(override.Name) != override.Name {
+				return fmt.Errorf("tool override %q: name %q may only contain lowercase letters, digits and single underscores", key, override.Name)
+			}
+			if other, ok := names[override.Name]; ok {
+				return fmt.Errorf("tool overrides %q and %q set the same name %q", other, key, override.Name)
+			}
+			names[override.Name] = key
+		}
+		for name := range override.PinnedArguments {
+			if _, ok := override.Defaults[name]; ok {
+				return fmt.Errorf("tool override %q: parameter %q cannot be both pinned and defaulted", key, name)
+			}
+		}
+		for _, name := range override.HiddenParameters {
+			if _, ok := override.PinnedArguments[name]; ok {
+				return fmt.Errorf("tool override %q: parameter %q cannot be both pinned and hidden", key, name)
+			}
+		}
+	}
+	return nil
+}
+
+// find returns the override of an operation and its key
+func (o ToolOverrides) find(api APIEndpoint) (ToolOverride, string, bool) {
+	if api.OperationID != "" {
+		if override, ok := o[api.OperationID]; ok {
+			return override, api.OperationID, true
+		}
+	}
+	key := strings.ToUpper(api.Method) + " " + api.Path
+	override, ok := o[key]
+	return override, key, ok
+}
+
+// toolName returns the name of the tool of an operation, the generated one unless it is overridden
+func (o ToolOverrides) toolName(prefix string, api APIEndpoint) string {
+	if override, _, ok := o.find(api); ok && override.Name != "" {
+		return override.Name
+	}
+	return toolName(prefix, api)
+}
+
+// description returns the description of the tool, given the generated one
+func (o ToolOverride) description(generated string) string {
+	if o.Description != "" {
+		generated = o.Description
+	}
+	if o.AppendDescription != "" {
+		generated = strings.TrimSpace(generated) + "\n\n" + o.AppendDescription
+	}
+	return generated
+}
+
+// removes reports whether the parameter is left out of the schema
+func (o ToolOverride) removes(name string) bool {
+	if _, ok := o.PinnedArguments[name]; ok {
+		return true
+	}
+	for _, hidden := range o.HiddenParameters {
+		if hidden == name {
+			return true
+		}
+	}
+	return false
+}
+
+// parameter returns the parameter with its description and default overridden
+func (o ToolOverride) parameter(param Parameter) Parameter {
+	if description, ok := o.ParameterDescriptions[param.Name]; ok {
+		param.Description = description
+	}
+	if value, ok := o.Defaults[param.Name]; ok {
+		schema := *param.Schema
+		schema.Default = value
+		param.Schema = &schema
+	}
+	return param
+}
+
+// property returns the request body property with its description and default overridden
+func (o ToolOverride) property(name string, schema Schema) Schema {
+	if description, ok := o.ParameterDescriptions[name]; ok {
+		schema.Description = description
+	}
+	if value, ok := o.Defaults[name]; ok {
+		schema.Default = value
+	}
+	return schema
+}
+
+// parameterGroups returns the argument groups of the parameters of an operation, by name
+func parameterGroups(api APIEndpoint) map[string][]string {
+	groups := map[string][]string{}
+	for _, param := range api.Parameters {
+		switch param.In {
+		case "query":
+			groups[param.Name] = append(groups[param.Name], argumentsQuery)
+		case "path":
+			groups[param.Name] = append(groups[param.Name], argumentsPath)
+		}
+	}
+	if api.RequestBody != nil {
+		for _, mediaType := range api.RequestBody.Content {
+			if mediaType.Schema == nil {
+				continue
+			}
+			for name := range mediaType.Schema.Properties {
+				groups[name] = append(groups[name], argumentsBody)
+			}
+		}
+	}
+	for name, list := range groups {
+		sort.Strings(list)
+		groups[name] = dedupe(list)
+	}
+	return groups
+}
+
+// dedupe removes adjacent duplicates from a sorted list
+func dedupe(list []string) []string {
+	unique := list[:0]
+	for i, item := range list {
+		if i == 0 || item != list[i-1] {
+			unique = append(unique, item)
+		}
+	}
+	return unique
+}
+
+// wrap returns a handler that pins, hides and defaults the arguments of a
+// call before passing it to the handler of the tool
+func (o ToolOverride) wrap(handler func(context.Context, mcp.CallToolRequest) (*mcp.CallToolResult, error), groups map[string][]string) func(context.Context, mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	if len(o.HiddenParameters) == 0 && len(o.PinnedArguments) == 0 && len(o.Defaults) == 0 {
+		return handler
+	}
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		request.Params.Arguments = o.arguments(request.Params.Arguments, groups)
+		return handler(ctx, request)
+	}
+}
+
+// arguments returns a copy of the arguments of a call with pinned values
+// set, hidden parameters dropped and defaults filled in
+func (o ToolOverride) arguments(arguments map[string]interface{}, groups map[string][]string) map[string]interface{} {
+	applied := make(map[string]interface{}, len(arguments))
+	for key, value := range arguments {
+		applied[key] = value
+	}
+
+	// Older clients send flat arguments rather than grouping them
+	flat := len(arguments) > 0
+	for _, group := range []string{argumentsPath, argumentsQuery, argumentsBody} {
+		if _, ok := arguments[group]; ok {
+			flat = false
+		}
+	}
+	values := func(group string) map[string]interface{} {
+		if flat {
+			return applied
+		}
+		existing, _ := applied[group].(map[string]interface{})
+		copied := make(map[string]interface{}, len(existing)+1)
+		for key, value := range existing {
+			copied[key] = value
+		}
+		applied[group] = copied
+		return copied
+	}
+
+	for _, name := range o.HiddenParameters {
+		for _, group := range groups[name] {
+			delete(values(group), name)
+		}
+	}
+	for name, value := range o.Defaults {
+		for _, group := range groups[name] {
+			if group := values(group); group[name] == nil {
+				group[name] = value
+			}
+		}
+	}
+	for name, value := range o.PinnedArguments {
+		for _, group := range groups[name] {
+			values(group)[name] = value
+		}
+	}
+	return applied
+}
+
+// unplacedOverrides lists the pinned and hidden parameters of overrides that
+// match no path, query or request body property of their operation. Their
+// values could not be set or dropped, so the tool would silently ignore them.
+func unplacedOverrides(overrides ToolOverrides, apis []APIEndpoint) []string {
+	var unplaced []string
+	for _, api := range apis {
+		override, _, ok := overrides.find(api)
+		if !ok {
+			continue
+		}
+		groups := parameterGroups(api)
+		for name := range override.PinnedArguments {
+			if len(groups[name]) == 0 {
+				unplaced = append(unplaced, fmt.Sprintf("%s %s: pinned parameter %q", api.Method, api.Path, name))
+			}
+		}
+		for _, name := range override.HiddenParameters {
+			if len(groups[name]) == 0 {
+				unplaced = append(unplaced, fmt.Sprintf("%s %s: hidden parameter %q", api.Method, api.Path, name))
+			}
+		}
+	}
+	sort.Strings(unplaced)
+	return unplaced
+}
+
+// overrideWarnings lists the overrides, and the described and defaulted
+// parameters of overrides, that match nothing in the operations of a
+// configuration
+func overrideWarnings(overrides ToolOverrides, apis []APIEndpoint) []string {
+	var warnings []string
+	matched := map[string]bool{}
+	for _, api := range apis {
+		override, key, ok := overrides.find(api)
+		if !ok {
+			continue
+		}
+		matched[key] = true
+
+		groups := parameterGroups(api)
+		names := map[string]bool{}
+		for name := range override.ParameterDescriptions {
+			names[name] = true
+		}
+		for name := range override.Defaults {
+			names[name] = true
+		}
+		for name := range names {
+			if len(groups[name]) == 0 {
+				warnings = append(warnings, fmt.Sprintf("%s %s: tool override of parameter %q matches no parameter", api.Method, api.Path, name))
+			}
+		}
+	}
+	for key := range overrides {
+		if !matched[key] {
+			warnings = append(warnings, fmt.Sprintf("tool override %q matches no operation", key))
+		}
+	}
+	return warnings
+}
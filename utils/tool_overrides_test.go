@@ -0,0 +1,101 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+const overridesSpec = `{
+  "openapi": "3.0.0",
+  "info": {"title": "Pets"},
+  "paths": {
+    "/pets": {
+      "post": {
+        "operationId": "addPet",
+        "summary": "Add a pet",
+        "parameters": [
+          {"name": "tenant", "in": "query", "schema": {"type": "string"}},
+          {"name": "debug", "in": "query", "schema": {"type": "boolean"}}
+        ],
+        "requestBody": {"content": {"application/json": {"schema": {"type": "object", "properties": {
+          "name": {"type": "string"},
+          "status": {"type": "string"}
+        }}}}}
+      }
+    }
+  }
+}`
+
+func TestToolOverrides(t *testing.T) {
+	var received *http.Request
+	var body string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		received, body = r, string(data)
+	}))
+	defer upstream.Close()
+
+	parser, err := ParseOpenAPIFromJSON([]byte(overridesSpec))
+	if err != nil {
+		t.Fatal(err)
+	}
+	overrides := ToolOverrides{"addPet": {
+		Name:                  "add_pet",
+		Description:           "Adds a pet to the store.",
+		AppendDescription:     "Only use for new pets.",
+		ParameterDescriptions: map[string]string{"name": "Name of the pet"},
+		HiddenParameters:      []string{"debug"},
+		PinnedArguments:       map[string]interface{}{"tenant": "acme"},
+		Defaults:              map[string]interface{}{"status": "available"},
+	}}
+	if err := overrides.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	tools := BuildServerTools(upstream.URL, nil, parser, WithToolOverrides(overrides))
+	if len(tools) != 1 || tools[0].Tool.Name != "add_pet" || tools[0].Tool.Description != "Adds a pet to the store.\n\nOnly use for new pets." {
+		t.Fatalf("unexpected tools: %+v", tools)
+	}
+	schema, _ := json.Marshal(tools[0].Tool.InputSchema)
+	for _, removed := range []string{`"tenant"`, `"debug"`} {
+		if strings.Contains(string(schema), removed) {
+			t.Errorf("schema offers %s: %s", removed, schema)
+		}
+	}
+	for _, kept := range []string{`"description":"Name of the pet"`, `"default":"available"`} {
+		if !strings.Contains(string(schema), kept) {
+			t.Errorf("schema lacks %s: %s", kept, schema)
+		}
+	}
+
+	var request mcp.CallToolRequest
+	request.Params.Arguments = map[string]interface{}{
+		"searchParams": map[string]interface{}{"tenant": "other", "debug": true},
+		"requestBody":  map[string]interface{}{"name": "Rex"},
+	}
+	if _, err := tools[0].Handler(context.Background(), request); err != nil {
+		t.Fatal(err)
+	}
+	if received == nil || received.URL.RawQuery != "tenant=acme" || body != `{"name":"Rex","status":"available"}` {
+		t.Errorf("unexpected upstream request: %v %s", received, body)
+	}
+
+	if warnings := overrideWarnings(ToolOverrides{"GET /pets": {}, "addPet": {Defaults: map[string]interface{}{"color": "black"}}}, parser.APIs()); len(warnings) != 2 {
+		t.Errorf("unexpected warnings: %q", warnings)
+	}
+	unplaced := unplacedOverrides(ToolOverrides{"addPet": {HiddenParameters: []string{"color", "debug"}, PinnedArguments: map[string]interface{}{"owner": "me", "tenant": "acme"}}}, parser.APIs())
+	if len(unplaced) != 2 || !strings.Contains(unplaced[0], `hidden parameter "color"`) || !strings.Contains(unplaced[1], `pinned parameter "owner"`) {
+		t.Errorf("unexpected unplaced overrides: %q", unplaced)
+	}
+
+	if err := (ToolOverrides{"addPet": {Name: "Add Pet"}}).Validate(); err == nil {
+		t.Error("expected an error for an invalid tool name")
+	}
+}
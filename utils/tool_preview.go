@@ -0,0 +1,146 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"mime"
+	"sort"
+	"strings"
+)
+
+var (
+	// ErrNoTools is returned for a configuration whose filters leave no operation of the schema
+	ErrNoTools = errors.New("no tools left after applying the filters")
+	// ErrToolNameCollision is returned when operations of a schema map to the same tool name
+	ErrToolNameCollision = errors.New("operations with the same tool name")
+	// ErrUnplacedOverride is returned for pinned or hidden parameters that match no parameter the tool can set
+	ErrUnplacedOverride = errors.New("tool overrides pin or hide parameters the tool cannot set")
+)
+
+// ToolPreview describes the tools an agent would see for a configuration
+type ToolPreview struct {
+	ToolCount int      `json:"toolCount"`
+	Tools     []string `json:"tools"`
+	Warnings  []string `json:"warnings,omitempty"` // Parts of the schema the tools cannot use
+}
+
+// PreviewTools loads and parses the schema of a configuration, applies its
+// filters and tool overrides and lists the tools it exposes, so that a broken
+// configuration is rejected when it is saved rather than when an agent
+// connects. Schemas that cannot be loaded or parsed, filters selecting no
+// operation, operations colliding on a tool name and pinned or hidden
+// parameters matching no path, query or request body property are errors;
+// constructs the tools do not support and other overrides matching nothing
+// are reported as warnings.
+func PreviewTools(ctx context.Context, schemaURL string, filters []string, overrides ToolOverrides) (*ToolPreview, error) {
+	data, err := fetchSchema(ctx, schemaURL)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, errors.New("empty schema content")
+	}
+
+	var parser OpenAPIParser
+	if isYAML(data) {
+		parser, err = ParseOpenAPIFromYAML(data)
+	} else {
+		parser, err = ParseOpenAPIFromJSON(data)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse schema: %w", err)
+	}
+
+	apis := parser.APIs()
+	total := len(apis)
+	var pathFilters []PathFilter
+	for _, filterDSL := range filters {
+		pathFilters = append(pathFilters, ParseFilterDSL(filterDSL).ToPathFilters()...)
+	}
+	if len(pathFilters) > 0 {
+		apis = ApplyFilters(apis, pathFilters)
+	}
+	if len(apis) == 0 {
+		return nil, fmt.Errorf("%w (%d operations in the schema)", ErrNoTools, total)
+	}
+
+	prefix := toolPrefix(parser.Info())
+	operations := map[string][]string{}
+	preview := &ToolPreview{}
+	for _, api := range apis {
+		name := overrides.toolName(prefix, api)
+		operations[name] = append(operations[name], api.Method+" "+api.Path)
+		preview.Warnings = append(preview.Warnings, unsupportedConstructs(api)...)
+	}
+
+	if unplaced := unplacedOverrides(overrides, apis); len(unplaced) > 0 {
+		return nil, fmt.Errorf("%w: %s", ErrUnplacedOverride, strings.Join(unplaced, "; "))
+	}
+	preview.Warnings = append(preview.Warnings, overrideWarnings(overrides, apis)...)
+
+	var collisions []string
+	for name, ops := range operations {
+		preview.Tools = append(preview.Tools, name)
+		if len(ops) > 1 {
+			sort.Strings(ops)
+			collisions = append(collisions, fmt.Sprintf("%s (%s)", name, strings.Join(ops, ", ")))
+		}
+	}
+	if len(collisions) > 0 {
+		sort.Strings(collisions)
+		return nil, fmt.Errorf("%w: %s; exclude all but one of them with filters or rename them with tool overrides", ErrToolNameCollision, strings.Join(collisions, "; "))
+	}
+
+	sort.Strings(preview.Tools)
+	sort.Strings(preview.Warnings)
+	preview.ToolCount = len(preview.Tools)
+	return preview, nil
+}
+
+// unsupportedConstructs lists the parts of an operation its tool cannot use
+func unsupportedConstructs(api APIEndpoint) []string {
+	operation := api.Method + " " + api.Path
+	var warnings []string
+	for _, param := range api.Parameters {
+		switch param.In {
+		case "query", "path":
+			if param.Schema == nil {
+				warnings = append(warnings, fmt.Sprintf("%s: %s parameter %q has no schema and is exposed without a type", operation, param.In, param.Name))
+			}
+		case "header", "cookie":
+			warnings = append(warnings, fmt.Sprintf("%s: %s parameter %q cannot be set by the tool", operation, param.In, param.Name))
+		default:
+			warnings = append(warnings, fmt.Sprintf("%s: parameter %q in %q is not supported", operation, param.Name, param.In))
+		}
+	}
+
+	if api.RequestBody != nil {
+		var others []string
+		hasJSON := false
+		for mediaType, content := range api.RequestBody.Content {
+			if isJSONMediaType(mediaType) {
+				hasJSON = true
+				if content.Schema != nil && content.Schema.Type != "" && content.Schema.Type != "object" {
+					warnings = append(warnings, fmt.Sprintf("%s: %s request body cannot be passed by the tool, only object bodies are supported", operation, content.Schema.Type))
+				}
+				continue
+			}
+			others = append(others, mediaType)
+		}
+		if !hasJSON && len(others) > 0 {
+			sort.Strings(others)
+			warnings = append(warnings, fmt.Sprintf("%s: request body is sent as JSON, %s is not supported", operation, strings.Join(others, ", ")))
+		}
+	}
+	return warnings
+}
+
+// isJSONMediaType reports whether a media type is JSON, e.g. application/json or application/problem+json
+func isJSONMediaType(mediaType string) bool {
+	base, _, err := mime.ParseMediaType(mediaType)
+	if err != nil {
+		base = mediaType
+	}
+	return base == "application/json" || strings.HasSuffix(base, "+json")
+}
@@ -0,0 +1,60 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+const previewSpec = `{
+  "openapi": "3.0.0",
+  "info": {"title": "Pets"},
+  "paths": {
+    "/pets": {
+      "get": {"parameters": [{"name": "X-Trace", "in": "header", "schema": {"type": "string"}}]},
+      "post": {"requestBody": {"content": {"multipart/form-data": {"schema": {"type": "object"}}}}}
+    },
+    "/pets/{id}": {"get": {"parameters": [{"name": "id", "in": "path", "schema": {"type": "string"}}]}},
+    "/pets/id": {"get": {}}
+  }
+}`
+
+func TestPreviewTools(t *testing.T) {
+	SetSpecStore(memorySpecStore{"pets": []byte(previewSpec)})
+	t.Cleanup(func() { SetSpecStore(nil) })
+	ctx := context.Background()
+
+	// /pets/{id} and /pets/id map to the same tool name
+	if _, err := PreviewTools(ctx, "spec:pets", nil, nil); !errors.Is(err, ErrToolNameCollision) || !strings.Contains(err.Error(), "GET /pets/id, GET /pets/{id}") {
+		t.Fatalf("expected a tool name collision, got %v", err)
+	}
+
+	if _, err := PreviewTools(ctx, "spec:pets", []string{"+/users/**"}, nil); !errors.Is(err, ErrNoTools) {
+		t.Fatalf("expected ErrNoTools, got %v", err)
+	}
+
+	preview, err := PreviewTools(ctx, "spec:pets", []string{"-/pets/id"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"omnimcppets_get_pets", "omnimcppets_get_pets_id", "omnimcppets_post_pets"}
+	if preview.ToolCount != 3 || strings.Join(preview.Tools, ",") != strings.Join(want, ",") {
+		t.Errorf("unexpected tools: %+v", preview)
+	}
+	if len(preview.Warnings) != 2 ||
+		!strings.Contains(preview.Warnings[0], `header parameter "X-Trace"`) ||
+		!strings.Contains(preview.Warnings[1], "multipart/form-data is not supported") {
+		t.Errorf("unexpected warnings: %q", preview.Warnings)
+	}
+
+	// Header parameters cannot be set by the tool, so pinning one would silently do nothing
+	overrides := ToolOverrides{"GET /pets": {PinnedArguments: map[string]interface{}{"X-Trace": "1"}}, "GET /pets/{id}": {HiddenParameters: []string{"id"}}}
+	if _, err := PreviewTools(ctx, "spec:pets", []string{"-/pets/id"}, overrides); !errors.Is(err, ErrUnplacedOverride) || !strings.Contains(err.Error(), `GET /pets: pinned parameter "X-Trace"`) || strings.Contains(err.Error(), `"id"`) {
+		t.Fatalf("expected ErrUnplacedOverride for the header parameter only, got %v", err)
+	}
+
+	if _, err := PreviewTools(ctx, "spec:missing", nil, nil); err == nil {
+		t.Error("expected an error for a schema that cannot be loaded")
+	}
+}
@@ -0,0 +1,41 @@
+package utils
+
+import (
+	"context"
+
+	"github.com/anyisalin/mcp-openapi-to-mcp-adapter/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Span attribute keys of the SSE server
+const (
+	attrSessionID      = "mcp.session_id"
+	attrConfigID       = "mcp.config_id"
+	attrConfigRevision = "mcp.config_revision"
+	attrTool           = "mcp.tool"
+)
+
+// spanError records err on the span and marks the span as failed
+func spanError(span trace.Span, err error) {
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
+
+// endSpan records the error, if any, on the span and ends it
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		spanError(span, err)
+	}
+	span.End()
+}
+
+// fetchSchema loads the schema at schemaURL within a span
+func fetchSchema(ctx context.Context, schemaURL string) ([]byte, error) {
+	_, span := tracing.Tracer().Start(ctx, "mcp.schema.fetch")
+	data, err := loadSchemaBytes(ctx, schemaURL)
+	span.SetAttributes(attribute.Int("mcp.schema.size", len(data)))
+	endSpan(span, err)
+	return data, err
+}
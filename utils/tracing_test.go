@@ -0,0 +1,57 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/anyisalin/mcp-openapi-to-mcp-adapter/tracing"
+)
+
+func TestToolCallContinuesClientTrace(t *testing.T) {
+	var spans bytes.Buffer
+	shutdown, err := tracing.Setup(context.Background(), tracing.Options{Exporter: tracing.ExporterStdout, Writer: &spans})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	traceparents := make(chan string, 1)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparents <- r.Header.Get("traceparent")
+		fmt.Fprint(w, `{"name":"rex"}`)
+	}))
+	defer upstream.Close()
+
+	_, ts := newPetsServer(t, upstream.URL, nil)
+	session := openSession(t, ts.URL+"/sse?configId=pets")
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	session.post(`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2024-11-05","capabilities":{},"clientInfo":{"name":"test","version":"1"}}}`)
+	session.post(`{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"` + petsTool + `","arguments":{},` +
+		`"_meta":{"traceparent":"00-` + traceID + `-00f067aa0ba902b7-01"}}}`)
+
+	select {
+	case traceparent := <-traceparents:
+		if !strings.HasPrefix(traceparent, "00-"+traceID+"-") {
+			t.Fatalf("upstream got traceparent %q", traceparent)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("upstream was not called")
+	}
+
+	// Wait for the message span to end before flushing the exporter
+	time.Sleep(100 * time.Millisecond)
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"mcp.sse.connect", "mcp.schema.parse", "mcp.message tools/call", "HTTP GET"} {
+		if !strings.Contains(spans.String(), `"Name":"`+name+`"`) {
+			t.Errorf("span %q not exported", name)
+		}
+	}
+}
@@ -0,0 +1,349 @@
+package utils
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/anyisalin/mcp-openapi-to-mcp-adapter/egress"
+	"github.com/anyisalin/mcp-openapi-to-mcp-adapter/metrics"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+)
+
+// Upstream auth types
+const (
+	UpstreamAuthClientCredentials = "client_credentials"
+	UpstreamAuthRefreshToken      = "refresh_token"
+)
+
+// UpstreamAuth describes how to obtain access tokens for the upstream API
+type UpstreamAuth struct {
+	Type           string            `json:"type"` // client_credentials or refresh_token
+	TokenURL       string            `json:"tokenURL"`
+	ClientID       string            `json:"clientId"`
+	ClientSecret   string            `json:"clientSecret,omitempty"`
+	RefreshToken   string            `json:"refreshToken,omitempty"` // Required for the refresh_token type
+	Scopes         []string          `json:"scopes,omitempty"`
+	EndpointParams map[string]string `json:"endpointParams,omitempty"` // Extra token request parameters, e.g. audience
+	AuthStyle      string            `json:"authStyle,omitempty"`      // header or params, auto-detected when empty
+	HeaderName     string            `json:"headerName,omitempty"`     // Header carrying the token, defaults to Authorization
+
+	// ConfigID is the stored configuration the credentials come from, which
+	// receives the refresh tokens rotated by the token endpoint
+	ConfigID string `json:"-"`
+}
+
+// RefreshTokenStore stores the refresh tokens rotated by upstream token
+// endpoints, so that they survive restarts
+type RefreshTokenStore interface {
+	// SaveRefreshToken replaces the refresh token of a configuration with
+	// refreshToken, unless it is no longer previous
+	SaveRefreshToken(ctx context.Context, configID, previous, refreshToken string) error
+}
+
+var (
+	refreshTokenStoreMu sync.RWMutex
+	refreshTokenStore   RefreshTokenStore
+)
+
+// SetRefreshTokenStore sets the store of rotated upstream refresh tokens
+func SetRefreshTokenStore(store RefreshTokenStore) {
+	refreshTokenStoreMu.Lock()
+	defer refreshTokenStoreMu.Unlock()
+	refreshTokenStore = store
+}
+
+// refreshTokenStoreTimeout bounds storing a rotated refresh token
+const refreshTokenStoreTimeout = 10 * time.Second
+
+// storeRefreshToken writes a rotated refresh token back to the configuration
+// of the upstream auth
+func (a *UpstreamAuth) storeRefreshToken(previous, refreshToken string) {
+	refreshTokenStoreMu.RLock()
+	store := refreshTokenStore
+	refreshTokenStoreMu.RUnlock()
+	if store == nil || a.ConfigID == "" {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), refreshTokenStoreTimeout)
+	defer cancel()
+	if err := store.SaveRefreshToken(ctx, a.ConfigID, previous, refreshToken); err != nil {
+		slog.Error("failed to store rotated upstream refresh token, it is lost on restart", LogKeyConfigID, a.ConfigID, "error", err)
+	}
+}
+
+// Validate checks that the upstream auth is complete
+func (a *UpstreamAuth) Validate() error {
+	switch a.Type {
+	case UpstreamAuthClientCredentials:
+	case UpstreamAuthRefreshToken:
+		if a.RefreshToken == "" {
+			return fmt.Errorf("upstream auth: refreshToken is required for the %s type", a.Type)
+		}
+	default:
+		return fmt.Errorf("upstream auth: unsupported type %q", a.Type)
+	}
+	if a.TokenURL == "" {
+		return fmt.Errorf("upstream auth: tokenURL is required")
+	}
+	if a.ClientID == "" {
+		return fmt.Errorf("upstream auth: clientId is required")
+	}
+	switch a.AuthStyle {
+	case "", "header", "params":
+	default:
+		return fmt.Errorf("upstream auth: unsupported authStyle %q", a.AuthStyle)
+	}
+	return nil
+}
+
+// cacheKey identifies the token source of the upstream auth. Sessions of the
+// same configuration share tokens; any change of credentials gets a new source.
+func (a *UpstreamAuth) cacheKey() string {
+	data, _ := json.Marshal(a)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func (a *UpstreamAuth) authStyle() oauth2.AuthStyle {
+	switch a.AuthStyle {
+	case "header":
+		return oauth2.AuthStyleInHeader
+	case "params":
+		return oauth2.AuthStyleInParams
+	default:
+		return oauth2.AuthStyleAutoDetect
+	}
+}
+
+// newTokenSource creates a token source that caches the token until it
+// expires. refreshToken is the current refresh token of the refresh_token type.
+func (a *UpstreamAuth) newTokenSource(refreshToken string) *upstreamTokenEntry {
+	// Token requests outlive the tool call that triggered them
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, &http.Client{Transport: egress.Transport(), Timeout: upstreamTokenTimeout})
+
+	if a.Type == UpstreamAuthRefreshToken {
+		config := &oauth2.Config{
+			ClientID:     a.ClientID,
+			ClientSecret: a.ClientSecret,
+			Scopes:       a.Scopes,
+			Endpoint: oauth2.Endpoint{
+				TokenURL:  a.TokenURL,
+				AuthStyle: a.authStyle(),
+			},
+		}
+		entry := countFetches(config.TokenSource(ctx, &oauth2.Token{RefreshToken: refreshToken}), refreshToken)
+		entry.fetches.store = a.storeRefreshToken
+		return entry
+	}
+
+	config := &clientcredentials.Config{
+		ClientID:       a.ClientID,
+		ClientSecret:   a.ClientSecret,
+		TokenURL:       a.TokenURL,
+		Scopes:         a.Scopes,
+		EndpointParams: map[string][]string{},
+		AuthStyle:      a.authStyle(),
+	}
+	for key, value := range a.EndpointParams {
+		config.EndpointParams.Set(key, value)
+	}
+	return countFetches(config.TokenSource(ctx), "")
+}
+
+// upstreamTokenCacheName is the cache label of the upstream token cache metrics
+const upstreamTokenCacheName = "upstream_token"
+
+// fetchCountingSource counts the tokens fetched from the token endpoint as
+// cache misses, and remembers and stores the refresh tokens the endpoint
+// rotates
+type fetchCountingSource struct {
+	source              oauth2.TokenSource
+	initialRefreshToken string                              // Refresh token the source started from, "" for client credentials
+	store               func(previous, refreshToken string) // Stores a rotated refresh token, if set
+
+	mu           sync.Mutex
+	refreshToken string
+}
+
+func (f *fetchCountingSource) Token() (*oauth2.Token, error) {
+	metrics.CacheMisses.WithLabelValues(upstreamTokenCacheName).Inc()
+	token, err := f.source.Token()
+	if err != nil || f.initialRefreshToken == "" || token.RefreshToken == "" {
+		return token, err
+	}
+
+	f.mu.Lock()
+	previous := f.refreshToken
+	if previous == "" {
+		previous = f.initialRefreshToken
+	}
+	rotated := token.RefreshToken != previous
+	if rotated {
+		f.refreshToken = token.RefreshToken
+	}
+	f.mu.Unlock()
+
+	// The token source serializes token requests, so rotations are stored in order
+	if rotated && f.store != nil {
+		f.store(previous, token.RefreshToken)
+	}
+	return token, nil
+}
+
+// latestRefreshToken returns the refresh token last rotated by the token
+// endpoint, or "" if none was
+func (f *fetchCountingSource) latestRefreshToken() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.refreshToken
+}
+
+// countFetches wraps the token source so that only tokens actually fetched,
+// not the cached ones, are counted as misses. refreshToken is the refresh
+// token the source starts from.
+func countFetches(source oauth2.TokenSource, refreshToken string) *upstreamTokenEntry {
+	fetches := &fetchCountingSource{source: source, initialRefreshToken: refreshToken}
+	return &upstreamTokenEntry{
+		source:  oauth2.ReuseTokenSource(nil, fetches),
+		fetches: fetches,
+	}
+}
+
+// upstreamTokenTimeout bounds a single token request
+const upstreamTokenTimeout = 30 * time.Second
+
+// upstreamTokenIdleTTL is how long a token source no tool call used is kept.
+// Every credential change gets a new source, so old ones must be dropped.
+const upstreamTokenIdleTTL = time.Hour
+
+// maxUpstreamTokenSources bounds the number of cached token sources
+const maxUpstreamTokenSources = 1024
+
+// upstreamTokenEntry is a cached token source. The source serializes its own
+// token requests, so the cache lock is never held while fetching a token.
+type upstreamTokenEntry struct {
+	source   oauth2.TokenSource
+	fetches  *fetchCountingSource
+	lastUsed time.Time
+}
+
+// upstreamTokenCache holds one token source per distinct upstream auth
+var upstreamTokenCache = struct {
+	sync.Mutex
+	sources map[string]*upstreamTokenEntry
+}{sources: map[string]*upstreamTokenEntry{}}
+
+// upstreamTokenSource returns the cached token source of the upstream auth
+func upstreamTokenSource(a *UpstreamAuth) oauth2.TokenSource {
+	key := a.cacheKey()
+	now := time.Now()
+
+	upstreamTokenCache.Lock()
+	defer upstreamTokenCache.Unlock()
+
+	entry, ok := upstreamTokenCache.sources[key]
+	if !ok {
+		evictUpstreamTokenSources(now)
+		entry = a.newTokenSource(a.RefreshToken)
+		upstreamTokenCache.sources[key] = entry
+	}
+	entry.lastUsed = now
+	return entry.source
+}
+
+// evictUpstreamTokenSources drops the token sources left idle for
+// upstreamTokenIdleTTL, and the least recently used one if the cache is still
+// full. Sources holding a rotated refresh token are kept: sessions still use
+// the credentials the token replaced, so a new source would start from a
+// refresh token the endpoint no longer accepts. The cache must be locked.
+func evictUpstreamTokenSources(now time.Time) {
+	var oldestKey string
+	var oldest time.Time
+	for key, entry := range upstreamTokenCache.sources {
+		if entry.fetches.latestRefreshToken() != "" {
+			continue
+		}
+		if now.Sub(entry.lastUsed) > upstreamTokenIdleTTL {
+			delete(upstreamTokenCache.sources, key)
+			continue
+		}
+		if oldestKey == "" || entry.lastUsed.Before(oldest) {
+			oldestKey, oldest = key, entry.lastUsed
+		}
+	}
+	if len(upstreamTokenCache.sources) >= maxUpstreamTokenSources && oldestKey != "" {
+		delete(upstreamTokenCache.sources, oldestKey)
+	}
+}
+
+// invalidateUpstreamToken drops the cached access token, e.g. after the
+// upstream rejected it, so the next call fetches a new one
+func invalidateUpstreamToken(a *UpstreamAuth) {
+	key := a.cacheKey()
+
+	upstreamTokenCache.Lock()
+	defer upstreamTokenCache.Unlock()
+
+	entry, ok := upstreamTokenCache.sources[key]
+	delete(upstreamTokenCache.sources, key)
+
+	// Keep a refresh token rotated by the token endpoint, the configured one may no longer be valid
+	if ok && a.Type == UpstreamAuthRefreshToken {
+		if refreshToken := entry.fetches.latestRefreshToken(); refreshToken != "" {
+			replacement := a.newTokenSource(refreshToken)
+			replacement.fetches.refreshToken = refreshToken
+			replacement.lastUsed = entry.lastUsed
+			upstreamTokenCache.sources[key] = replacement
+		}
+	}
+}
+
+// evictUpstreamTokens drops the token sources of upstream auths that are no
+// longer in use, e.g. because their configuration was changed or deleted
+func evictUpstreamTokens(auths ...*UpstreamAuth) {
+	upstreamTokenCache.Lock()
+	defer upstreamTokenCache.Unlock()
+
+	for _, a := range auths {
+		if a != nil {
+			delete(upstreamTokenCache.sources, a.cacheKey())
+		}
+	}
+}
+
+// setUpstreamToken sets the access token of the upstream auth on the request
+func setUpstreamToken(req *http.Request, a *UpstreamAuth) error {
+	metrics.CacheLookups.WithLabelValues(upstreamTokenCacheName).Inc()
+	token, err := upstreamTokenSource(a).Token()
+	if err != nil {
+		return fmt.Errorf("failed to obtain upstream access token: %w", err)
+	}
+
+	setUpstreamAuthHeader(req, a, token.Type(), token.AccessToken)
+	return nil
+}
+
+// setUpstreamTokenPlaceholder sets a masked access token on a request that
+// is not sent, such as a dry run, without obtaining a token from the upstream
+func setUpstreamTokenPlaceholder(req *http.Request, a *UpstreamAuth) {
+	setUpstreamAuthHeader(req, a, "Bearer", redactedValue)
+}
+
+// setUpstreamAuthHeader sets an access token in the header of the upstream auth
+func setUpstreamAuthHeader(req *http.Request, a *UpstreamAuth, tokenType, accessToken string) {
+	headerName := a.HeaderName
+	if headerName == "" || http.CanonicalHeaderKey(headerName) == "Authorization" {
+		req.Header.Set("Authorization", tokenType+" "+accessToken)
+	} else {
+		req.Header.Set(headerName, accessToken)
+	}
+}
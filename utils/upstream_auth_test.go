@@ -0,0 +1,269 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// newTokenServer stubs an OAuth2 token endpoint issuing numbered access tokens
+func newTokenServer(t *testing.T, expiresIn int) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+
+	var issued atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("invalid token request: %v", err)
+		}
+		n := issued.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"access_token":"token-%d","token_type":"Bearer","expires_in":%d,"refresh_token":"refresh-%d"}`, n, expiresIn, n)
+	}))
+	t.Cleanup(ts.Close)
+	return ts, &issued
+}
+
+func callTool(t *testing.T, handler func(context.Context, mcp.CallToolRequest) (*mcp.CallToolResult, error)) string {
+	t.Helper()
+
+	result, err := handler(context.Background(), mcp.CallToolRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return result.Content[0].(mcp.TextContent).Text
+}
+
+func TestUpstreamClientCredentialsTokenIsCached(t *testing.T) {
+	tokenServer, issued := newTokenServer(t, 3600)
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, r.Header.Get("Authorization"))
+	}))
+	defer upstream.Close()
+
+	auth := &UpstreamAuth{
+		Type:         UpstreamAuthClientCredentials,
+		TokenURL:     tokenServer.URL,
+		ClientID:     "client",
+		ClientSecret: "cached",
+	}
+	handler := NewToolHandler(http.MethodGet, upstream.URL+"/pets", nil, WithUpstreamAuth(auth))
+
+	for i := 0; i < 3; i++ {
+		if got := callTool(t, handler); got != "Bearer token-1" {
+			t.Fatalf("call %d sent %q", i, got)
+		}
+	}
+	if n := issued.Load(); n != 1 {
+		t.Fatalf("expected 1 token request, got %d", n)
+	}
+}
+
+func TestUpstreamExpiredTokenIsRefreshed(t *testing.T) {
+	// Tokens expiring within the oauth2 expiry margin are refetched on every call
+	tokenServer, issued := newTokenServer(t, 1)
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, r.Header.Get("Authorization"))
+	}))
+	defer upstream.Close()
+
+	auth := &UpstreamAuth{
+		Type:         UpstreamAuthRefreshToken,
+		TokenURL:     tokenServer.URL,
+		ClientID:     "client",
+		RefreshToken: "initial",
+	}
+	handler := NewToolHandler(http.MethodGet, upstream.URL+"/pets", nil, WithUpstreamAuth(auth))
+
+	if got := callTool(t, handler); got != "Bearer token-1" {
+		t.Fatalf("first call sent %q", got)
+	}
+	if got := callTool(t, handler); got != "Bearer token-2" {
+		t.Fatalf("second call sent %q", got)
+	}
+	if n := issued.Load(); n != 2 {
+		t.Fatalf("expected 2 token requests, got %d", n)
+	}
+}
+
+func TestUpstreamRejectedTokenIsReplaced(t *testing.T) {
+	tokenServer, issued := newTokenServer(t, 3600)
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The first token was revoked before it expired
+		if r.Header.Get("Authorization") == "Bearer token-1" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprint(w, r.Header.Get("Authorization"))
+	}))
+	defer upstream.Close()
+
+	auth := &UpstreamAuth{
+		Type:         UpstreamAuthClientCredentials,
+		TokenURL:     tokenServer.URL,
+		ClientID:     "client",
+		ClientSecret: "revoked",
+		HeaderName:   "Authorization",
+	}
+	handler := NewToolHandler(http.MethodGet, upstream.URL+"/pets", nil, WithUpstreamAuth(auth))
+
+	if got := callTool(t, handler); got != "Bearer token-2" {
+		t.Fatalf("call sent %q", got)
+	}
+	if n := issued.Load(); n != 2 {
+		t.Fatalf("expected 2 token requests, got %d", n)
+	}
+}
+
+func TestUpstreamTokenIsNotFetchedForDryRun(t *testing.T) {
+	tokenServer, issued := newTokenServer(t, 3600)
+
+	for _, headerName := range []string{"", "X-Api-Token"} {
+		auth := &UpstreamAuth{
+			Type:         UpstreamAuthClientCredentials,
+			TokenURL:     tokenServer.URL,
+			ClientID:     "client",
+			ClientSecret: "dry-run-" + headerName,
+			HeaderName:   headerName,
+		}
+		handler := NewToolHandler(http.MethodGet, "http://upstream.invalid/pets", nil, WithUpstreamAuth(auth))
+
+		inv := &invocation{dryRun: true}
+		ctx := context.WithValue(context.Background(), invocationContextKey{}, inv)
+		if _, err := handler(ctx, mcp.CallToolRequest{}); err != nil {
+			t.Fatal(err)
+		}
+		if inv.request == nil {
+			t.Fatal("dry run did not build the request")
+		}
+
+		want, header := "Bearer "+redactedValue, "Authorization"
+		if headerName != "" {
+			want, header = redactedValue, headerName
+		}
+		if got := inv.request.Header.Get(header); got != want {
+			t.Errorf("dry run set %s to %q", header, got)
+		}
+	}
+	if n := issued.Load(); n != 0 {
+		t.Fatalf("dry run requested %d upstream tokens", n)
+	}
+}
+
+func TestUpstreamTokenCacheEvictsSources(t *testing.T) {
+	now := time.Now()
+	upstreamTokenCache.Lock()
+	saved := upstreamTokenCache.sources
+	upstreamTokenCache.sources = map[string]*upstreamTokenEntry{}
+	upstreamTokenCache.Unlock()
+	t.Cleanup(func() {
+		upstreamTokenCache.Lock()
+		upstreamTokenCache.sources = saved
+		upstreamTokenCache.Unlock()
+	})
+
+	idle := countFetches(nil, "")
+	idle.lastUsed = now.Add(-2 * upstreamTokenIdleTTL)
+	rotated := countFetches(nil, "refresh-1")
+	rotated.lastUsed = idle.lastUsed
+	rotated.fetches.refreshToken = "refresh-2"
+	upstreamTokenCache.sources["idle"] = idle
+	upstreamTokenCache.sources["rotated"] = rotated
+	for i := 0; i < maxUpstreamTokenSources-1; i++ {
+		entry := countFetches(nil, "")
+		entry.lastUsed = now.Add(time.Duration(i) * time.Second)
+		upstreamTokenCache.sources[fmt.Sprint(i)] = entry
+	}
+
+	upstreamTokenCache.Lock()
+	evictUpstreamTokenSources(now)
+	_, idleKept := upstreamTokenCache.sources["idle"]
+	_, rotatedKept := upstreamTokenCache.sources["rotated"]
+	_, oldestKept := upstreamTokenCache.sources["0"]
+	size := len(upstreamTokenCache.sources)
+	upstreamTokenCache.Unlock()
+
+	if idleKept {
+		t.Fatal("idle token source not evicted")
+	}
+	// A rotated refresh token cannot be recovered once dropped
+	if !rotatedKept {
+		t.Fatal("source holding a rotated refresh token evicted")
+	}
+	// The cache was still full, so the least recently used other source made room
+	if oldestKept || size != maxUpstreamTokenSources-1 {
+		t.Fatalf("least recently used source not evicted: kept %v, %d sources", oldestKept, size)
+	}
+}
+
+// recordingTokenStore records the refresh tokens stored for configurations
+type recordingTokenStore struct {
+	mu     sync.Mutex
+	stored []string
+}
+
+func (s *recordingTokenStore) SaveRefreshToken(ctx context.Context, configID, previous, refreshToken string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stored = append(s.stored, configID+":"+previous+"->"+refreshToken)
+	return nil
+}
+
+func TestUpstreamRotatedRefreshTokenIsStored(t *testing.T) {
+	store := &recordingTokenStore{}
+	SetRefreshTokenStore(store)
+	t.Cleanup(func() { SetRefreshTokenStore(nil) })
+
+	// Tokens expiring within the oauth2 expiry margin are refetched on every call
+	tokenServer, _ := newTokenServer(t, 1)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, r.Header.Get("Authorization"))
+	}))
+	defer upstream.Close()
+
+	auth := &UpstreamAuth{
+		Type:         UpstreamAuthRefreshToken,
+		TokenURL:     tokenServer.URL,
+		ClientID:     "client",
+		RefreshToken: "stored",
+		ConfigID:     "pets",
+	}
+	handler := NewToolHandler(http.MethodGet, upstream.URL+"/pets", nil, WithUpstreamAuth(auth))
+	callTool(t, handler)
+	callTool(t, handler)
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	want := []string{"pets:stored->refresh-1", "pets:refresh-1->refresh-2"}
+	if fmt.Sprint(store.stored) != fmt.Sprint(want) {
+		t.Fatalf("stored %v, want %v", store.stored, want)
+	}
+}
+
+func TestUpstreamAuthValidate(t *testing.T) {
+	valid := UpstreamAuth{Type: UpstreamAuthClientCredentials, TokenURL: "https://auth.example.com/token", ClientID: "client"}
+	if err := valid.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	missingRefresh := valid
+	missingRefresh.Type = UpstreamAuthRefreshToken
+	if err := missingRefresh.Validate(); err == nil {
+		t.Fatal("refresh_token type without refreshToken was accepted")
+	}
+
+	unknown := valid
+	unknown.Type = "password"
+	if err := unknown.Validate(); err == nil {
+		t.Fatal("unsupported type was accepted")
+	}
+}